@@ -3,6 +3,8 @@ package main
 import (
 	"b46/b46/_sys_init"
 	"b46/b46/logging"
+	"b46/b46/models"
+	"b46/b46/risk"
 	"b46/b46/strategies"
 	"github.com/coder/websocket"
 	"log"
@@ -13,6 +15,11 @@ import (
 
 func main() {
 
+	// Offline tools, e.g. "b46 backtest", run without connecting to the chain.
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	_ = _sys_init.NewEnviroSetup()
 	//log.Println(_sys_init.Env)
 
@@ -21,20 +28,63 @@ func main() {
 		logging.PrintErrorToLog("Error creating logging session:		", errLogSession.Error())
 	}
 
-	kamikaze := strategies.Kamikaze{}
-	kamikaze.InitializeKamikaze()
+	// STRATEGY lists the strategies to run with their allocation, e.g. "kamikaze:0.02:3,other:0.01:1",
+	// or named instances of one strategy, e.g. "fast=kamikaze:0.02:3:EntryMarketCap=6000,slow=kamikaze:0.01:1".
+	strategySpec := _sys_init.Env.STRATEGY
+	if strategySpec == "" {
+		strategySpec = models.DefaultStrategy
+	}
+	allocations, errAllocations := risk.ParseAllocations(strategySpec)
+	if errAllocations != nil {
+		logging.PrintErrorToLog("Error parsing strategies:		", errAllocations.Error())
+		log.Fatalln(errAllocations)
+	}
+	running, errStrategy := strategies.NewStrategies(allocations)
+	if errStrategy != nil {
+		logging.PrintErrorToLog("Error creating strategy:		", errStrategy.Error())
+		log.Fatalln(errStrategy)
+	}
+
+	engine := strategies.NewEngine(running, allocations)
+	engine.InitializeEngine()
+	engine.StartSession()
 
-	go kamikaze.Start()
+	go engine.Start()
 
-	defer kamikaze.Websocket.Close(websocket.StatusInternalError, "Connection closed")
-	defer kamikaze.WssClient.Close()
+	// SIGUSR1 stops new buys, SIGUSR2 halts trading and flattens every open position.
+	killSignals := make(chan os.Signal, 1)
+	signal.Notify(killSignals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range killSignals {
+			var err error
+			switch sig {
+			case syscall.SIGUSR1:
+				err = engine.KillSwitch.Engage(strategies.ModeExitsOnly, false, "signal "+sig.String())
+			case syscall.SIGUSR2:
+				err = engine.KillSwitch.Engage(strategies.ModeHalted, true, "signal "+sig.String())
+			}
+			if err != nil {
+				logging.PrintErrorToLog("Kill switch error:		", err.Error())
+			}
+		}
+	}()
+
+	defer engine.Websocket.Close(websocket.StatusInternalError, "Connection closed")
+	defer engine.WssClient.Close()
 
 	// Listen for interrupt signals to gracefully shut down.
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGTRAP)
 	<-quit
 	log.Println("Shutting down B46...")
+	engine.CloseSession()
 	logging.CloseAllLoggers()
 	log.Println("Closed All Loggers...")
+	if engine.Store != nil {
+		models.FlushStore()
+		if err := engine.Store.Close(); err != nil {
+			logging.PrintErrorToLog("Error closing state store:		", err.Error())
+		}
+	}
 
 }
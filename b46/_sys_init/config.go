@@ -11,6 +11,8 @@ type Enviro struct {
 	WSS         string
 	PK          string
 	DEVELOPMENT string
+	STRATEGY    string
+	LIVE        string // "TRUE" sends orders on chain, anything else paper trades
 }
 
 var Env *Enviro
@@ -35,6 +37,8 @@ func NewEnviroSetup() *Enviro {
 		WSS:         os.Getenv("WSS"),
 		PK:          os.Getenv("PK"),
 		DEVELOPMENT: os.Getenv("DEVELOPMENT"),
+		STRATEGY:    os.Getenv("STRATEGY"),
+		LIVE:        os.Getenv("LIVE"),
 	}
 	return Env
 }
@@ -0,0 +1,257 @@
+package backtest
+
+import (
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/risk"
+	"b46/b46/sol"
+	"b46/b46/strategies"
+	"log"
+	"sort"
+	"time"
+)
+
+// Options configures a backtest run.
+type Options struct {
+	Limits risk.Limits // risk limits enforced on every buy, the zero value disables them
+}
+
+// DefaultOptions returns the options the live bot trades with.
+func DefaultOptions() Options {
+	return Options{Limits: risk.DefaultLimits()}
+}
+
+// event is a point of a session's simulated clock: snapshot index of token taken at time.
+// The first snapshot of a token is its creation.
+type event struct {
+	token int
+	index int
+	at    time.Time
+}
+
+// backtester replays one session against one strategy.
+type backtester struct {
+	session   Session
+	strategy  strategies.Strategy
+	timeline  []event
+	risk      *risk.Manager
+	portfolio *portfolio.Portfolio
+	tokens    map[string]*models.MemeToken
+	clock     *models.SimulatedClock
+
+	entryReasons map[string]string
+	exitReasons  map[string]string
+	report       Report
+	exposureAt   time.Time
+	exposureSum  float64 // SOL x seconds of exposure, for the time weighted average
+	peakEquity   float64
+}
+
+// Run drives strategy through the session on its own simulated clock, which the risk manager
+// rolls its days on and the tokens' transitions are dated with, so sweeps can run sessions
+// side by side. Every snapshot is handed to the strategy like the live engine would, and its
+// orders are filled at once against the snapshot's bonding curve with sol.CurveFill.
+func Run(session Session, strategy strategies.Strategy, options Options) Report {
+	return newBacktester(session, strategy, options).run()
+}
+
+func newBacktester(session Session, strategy strategies.Strategy, options Options) *backtester {
+	var timeline []event
+	for i, token := range session.Tokens {
+		for index, info := range token.Info {
+			timeline = append(timeline, event{token: i, index: index, at: info.Snapshot})
+		}
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].at.Before(timeline[j].at)
+	})
+
+	start := session.Start
+	if len(timeline) > 0 && timeline[0].at.Before(start) {
+		start = timeline[0].at
+	}
+	clock := models.NewSimulatedClock(start)
+	return &backtester{
+		session:      session,
+		strategy:     strategy,
+		timeline:     timeline,
+		clock:        clock,
+		risk:         risk.NewManagerWithClock(options.Limits, clock),
+		portfolio:    portfolio.New(),
+		tokens:       make(map[string]*models.MemeToken),
+		entryReasons: make(map[string]string),
+		exitReasons:  make(map[string]string),
+		report: Report{
+			Session:  session.Name,
+			Strategy: strategy.Name(),
+			Start:    session.Start,
+			End:      session.End,
+			Tokens:   len(session.Tokens),
+		},
+	}
+}
+
+// run replays the timeline and reports the outcome.
+func (b *backtester) run() Report {
+	for _, e := range b.timeline {
+		b.advance(e.at)
+		b.replay(e)
+		b.measure()
+	}
+	b.advance(b.session.End)
+	return b.finish()
+}
+
+// advance moves the simulated clock forward, accruing the exposure held since the last move.
+func (b *backtester) advance(to time.Time) {
+	if !b.exposureAt.IsZero() && to.After(b.exposureAt) {
+		b.exposureSum += b.portfolio.Totals().Exposure * to.Sub(b.exposureAt).Seconds()
+	}
+	if now := b.clock.Now(); to.After(now) {
+		b.clock.Advance(to.Sub(now))
+	}
+	b.exposureAt = b.clock.Now()
+}
+
+func (b *backtester) replay(e event) {
+	source := b.session.Tokens[e.token]
+	key := source.Mint.String()
+
+	if e.index == 0 {
+		token := source
+		token.Info = append([]models.MemeInfo(nil), source.Info[0])
+		token.State = models.StateDiscovered
+		b.tokens[key] = &token
+		b.apply(&token, b.strategy.OnTokenCreated(token))
+		return
+	}
+
+	token, exists := b.tokens[key]
+	if !exists || token.State.Terminal() {
+		return
+	}
+	token.Info = append(token.Info, source.Info[e.index])
+	b.portfolio.Mark(*token)
+
+	if token.State == models.StateDiscovered {
+		b.transition(token, models.StateWatching, "first snapshot")
+	}
+	if info := token.Info[len(token.Info)-1]; info.BondingState != nil && info.BondingState.Complete {
+		held := token.State == models.StateHeld
+		b.transition(token, models.StateMigrated, "bonding curve complete")
+		if position, written := b.portfolio.WriteOff(key, b.clock.Now()); held && written {
+			b.risk.ConfirmSell(key, position.RealizedPnL)
+			b.exitReasons[key] = "migrated while held"
+		}
+		return
+	}
+	b.apply(token, b.strategy.OnSnapshot(*token))
+}
+
+// apply carries out a decision with strategies.ApplyDecision, the way the live engine does,
+// except that orders fill at once.
+func (b *backtester) apply(token *models.MemeToken, decision strategies.Decision) {
+	strategies.ApplyDecision(b, *token, b.strategy.Name(), decision)
+}
+
+func (b *backtester) Reject(token models.MemeToken, reason string) {
+	b.transition(b.tokens[token.Mint.String()], models.StateRejected, reason)
+}
+
+func (b *backtester) Promote(token models.MemeToken, strategy string, reason string) models.MemeToken {
+	promoted := b.tokens[token.Mint.String()]
+	b.transition(promoted, models.StateCandidate, reason)
+	return *promoted
+}
+
+func (b *backtester) Buy(token models.MemeToken, strategy string, amount float64, reason string) {
+	key := token.Mint.String()
+	held := b.tokens[key]
+	approved, err := b.risk.ApproveBuy(key, held.User, amount)
+	if err != nil {
+		b.report.RejectedOrders++
+		return
+	}
+	fill := sol.CurveFill(*held, models.FillSideBuy, approved, 0, b.clock.Now())
+	fill.Strategy = strategy
+	if fill.TokenAmount == 0 {
+		b.risk.CancelBuy(key)
+		b.report.RejectedOrders++
+		return
+	}
+	b.transition(held, models.StateEntering, reason)
+	b.transition(held, models.StateHeld, "BUY filled")
+	b.portfolio.ApplyFill(*held, fill)
+	b.risk.ConfirmBuy(key, fill.Price)
+	b.entryReasons[key] = reason
+	b.apply(held, b.strategy.OnFill(*held, fill))
+}
+
+func (b *backtester) Sell(token models.MemeToken, strategy string, reason string) {
+	key := token.Mint.String()
+	position, exists := b.portfolio.Position(key)
+	if !exists || !position.Open() {
+		return
+	}
+	held := b.tokens[key]
+	fill := sol.CurveFill(*held, models.FillSideSell, 0, position.Tokens, b.clock.Now())
+	fill.Strategy = strategy
+	b.transition(held, models.StateExiting, reason)
+	b.transition(held, models.StateClosed, "SELL filled")
+	position = b.portfolio.ApplyFill(*held, fill)
+	b.risk.ConfirmSell(key, position.RealizedPnL)
+	b.exitReasons[key] = reason
+	b.apply(held, b.strategy.OnFill(*held, fill))
+}
+
+func (b *backtester) transition(token *models.MemeToken, next models.TokenState, reason string) {
+	if _, err := token.TransitionAt(next, reason, b.clock.Now()); err != nil {
+		log.Printf("Backtest %s: %v", b.session.Name, err)
+	}
+}
+
+// measure samples the equity curve and the exposure after every event.
+func (b *backtester) measure() {
+	totals := b.portfolio.Totals()
+	equity := totals.PnL()
+	if equity > b.peakEquity {
+		b.peakEquity = equity
+	}
+	if drawdown := b.peakEquity - equity; drawdown > b.report.MaxDrawdown {
+		b.report.MaxDrawdown = drawdown
+	}
+	if totals.Exposure > b.report.MaxExposure {
+		b.report.MaxExposure = totals.Exposure
+	}
+}
+
+func (b *backtester) finish() Report {
+	report := b.report
+	report.Totals = b.portfolio.Totals()
+	if duration := report.End.Sub(report.Start).Seconds(); duration > 0 {
+		report.AvgExposure = b.exposureSum / duration
+	}
+
+	for _, position := range b.portfolio.Positions() {
+		trade := Trade{
+			Mint:        position.Mint,
+			Name:        position.Name,
+			Symbol:      position.Symbol,
+			OpenedAt:    position.OpenedAt,
+			ClosedAt:    position.ClosedAt,
+			Invested:    position.Invested,
+			Proceeds:    position.Proceeds,
+			PnL:         position.RealizedPnL + position.UnrealizedPnL(),
+			EntryReason: b.entryReasons[position.Mint],
+			ExitReason:  b.exitReasons[position.Mint],
+			Open:        position.Open(),
+		}
+		if trade.PnL > 0 {
+			report.Wins++
+		} else {
+			report.Losses++
+		}
+		report.Trades = append(report.Trades, trade)
+	}
+	return report
+}
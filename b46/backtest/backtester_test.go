@@ -0,0 +1,182 @@
+package backtest
+
+import (
+	"b46/b46/models"
+	"b46/b46/risk"
+	"b46/b46/strategies"
+	"github.com/gagliardetto/solana-go"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// doubler buys every token except REJ ones and sells once the price doubled.
+type doubler struct{}
+
+func (doubler) Name() string { return "doubler" }
+func (doubler) OnTokenCreated(token models.MemeToken) strategies.Decision {
+	return strategies.Decision{}
+}
+func (doubler) OnTrade(models.MemeToken, models.PumpTrade) strategies.Decision {
+	return strategies.Decision{}
+}
+func (doubler) OnFill(models.MemeToken, models.Fill) strategies.Decision {
+	return strategies.Decision{}
+}
+
+func (doubler) OnSnapshot(token models.MemeToken) strategies.Decision {
+	price := token.Info[len(token.Info)-1].TokenPrice
+	switch {
+	case token.State == models.StateWatching && token.Symbol == "REJ":
+		return strategies.Decision{Action: strategies.ActionReject, Reason: "rejected"}
+	case token.State == models.StateWatching, token.State == models.StateCandidate:
+		return strategies.Decision{Action: strategies.ActionBuy, Reason: "entry", Amount: 0.1}
+	case token.State == models.StateHeld && price >= 2*token.Info[0].TokenPrice:
+		return strategies.Decision{Action: strategies.ActionSell, Reason: "doubled"}
+	}
+	return strategies.Decision{}
+}
+
+var start = time.Unix(1700000000, 0)
+
+// snapshot returns a snapshot taken seconds after start of a curve holding solReserves
+// virtual lamports, at the price the constant product of a fresh curve gives.
+func snapshot(seconds float64, solReserves uint64, complete bool) models.MemeInfo {
+	const product = 30_000_000_000 * 1_073_000_000_000_000.0
+	curve := &models.BondingCurveState{
+		VirtualSolReserves:   solReserves,
+		VirtualTokenReserves: uint64(product / float64(solReserves)),
+		RealTokenReserves:    793_100_000_000_000,
+		RealSolReserves:      solReserves - 30_000_000_000 + 1_000_000_000,
+		Complete:             complete,
+	}
+	price := (float64(curve.VirtualSolReserves) / models.LamportsPerSOL) / (float64(curve.VirtualTokenReserves) / math.Pow10(models.TOKEN_DECIMALS))
+	return models.MemeInfo{
+		BondingState: curve,
+		TokenPrice:   price,
+		Snapshot:     start.Add(time.Duration(seconds * float64(time.Second))),
+	}
+}
+
+func TestRun(t *testing.T) {
+	migrating := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "MIG", Info: []models.MemeInfo{
+		snapshot(0, 30_000_000_000, false),
+		snapshot(1, 30_000_000_000, false),
+		snapshot(2, 85_000_000_000, true),
+		snapshot(2.5, 85_000_000_000, true),
+	}}
+	winning := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "WIN", Info: []models.MemeInfo{
+		snapshot(0.5, 30_000_000_000, false),
+		snapshot(1.5, 30_000_000_000, false), // rejected, MIG holds the only position
+		snapshot(3, 30_000_000_000, false),
+		snapshot(4, 60_000_000_000, false),
+	}}
+	rejected := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "REJ", Info: []models.MemeInfo{
+		snapshot(0.2, 30_000_000_000, false),
+		snapshot(0.3, 30_000_000_000, false),
+	}}
+	session := Session{
+		Name:   "session-test",
+		Tokens: []models.MemeToken{migrating, winning, rejected},
+		Start:  start,
+		End:    start.Add(10 * time.Second),
+	}
+
+	report := Run(session, doubler{}, Options{Limits: risk.Limits{MaxPositions: 1, MinOrderSOL: 0.001}})
+
+	if report.Tokens != 3 || report.RejectedOrders != 1 || len(report.Trades) != 2 {
+		t.Fatalf("%d tokens, %d rejected orders, trades %v", report.Tokens, report.RejectedOrders, report.Trades)
+	}
+	if report.Wins != 1 || report.Losses != 1 {
+		t.Errorf("%d wins %d losses, want 1 and 1", report.Wins, report.Losses)
+	}
+	trades := make(map[string]Trade)
+	for _, trade := range report.Trades {
+		trades[trade.Symbol] = trade
+		if trade.Open || trade.EntryReason != "entry" {
+			t.Errorf("trade %s", trade)
+		}
+	}
+
+	mig := trades["MIG"]
+	if mig.ExitReason != "migrated while held" || mig.Proceeds != 0 || math.Abs(mig.PnL+mig.Invested) > 1e-12 {
+		t.Errorf("migrated trade %s, want its investment written off", mig)
+	}
+	if !mig.ClosedAt.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("migrated trade closed at %s", mig.ClosedAt)
+	}
+
+	win := trades["WIN"]
+	if win.ExitReason != "doubled" || win.PnL <= 0 || !win.OpenedAt.Equal(start.Add(3*time.Second)) || !win.ClosedAt.Equal(start.Add(4*time.Second)) {
+		t.Errorf("winning trade %s", win)
+	}
+
+	totals := report.Totals
+	if totals.OpenPositions != 0 || totals.Exposure != 0 || totals.UnrealizedPnL != 0 {
+		t.Errorf("totals %s, want every position closed", totals)
+	}
+	if math.Abs(totals.RealizedPnL-(mig.PnL+win.PnL)) > 1e-12 {
+		t.Errorf("realized %.6f, want the sum of the trades %.6f", totals.RealizedPnL, mig.PnL+win.PnL)
+	}
+	if math.Abs(report.MaxExposure-mig.Invested) > 1e-12 {
+		t.Errorf("max exposure %.6f, want %.6f", report.MaxExposure, mig.Invested)
+	}
+	// Each position was held 1 second out of 10.
+	if want := (mig.Invested + win.Invested) / 10; math.Abs(report.AvgExposure-want) > 1e-9 {
+		t.Errorf("average exposure %.6f, want %.6f", report.AvgExposure, want)
+	}
+	if report.MaxDrawdown < mig.Invested-1e-12 {
+		t.Errorf("max drawdown %.6f, want at least the written off %.6f", report.MaxDrawdown, mig.Invested)
+	}
+}
+
+func TestRunDatesTransitionsOnItsClock(t *testing.T) {
+	// Sessions replayed side by side, as a sweep does, each on its own clock.
+	offsets := []time.Duration{0, time.Hour, 24 * time.Hour}
+	runs := make([]*backtester, len(offsets))
+	var wg sync.WaitGroup
+	for i, offset := range offsets {
+		token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "WIN", Info: []models.MemeInfo{
+			snapshot(0, 30_000_000_000, false),
+			snapshot(1, 30_000_000_000, false),
+			snapshot(2, 60_000_000_000, false),
+		}}
+		for j := range token.Info {
+			token.Info[j].Snapshot = token.Info[j].Snapshot.Add(offset)
+		}
+		session := Session{Name: "session-test", Tokens: []models.MemeToken{token}, Start: start.Add(offset), End: start.Add(offset + 10*time.Second)}
+		runs[i] = newBacktester(session, doubler{}, Options{Limits: risk.Limits{MaxPositions: 1, MinOrderSOL: 0.001}})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runs[i].run()
+		}()
+	}
+	wg.Wait()
+
+	want := []struct {
+		to      models.TokenState
+		seconds float64
+	}{
+		{models.StateWatching, 1},
+		{models.StateCandidate, 1},
+		{models.StateEntering, 1},
+		{models.StateHeld, 1},
+		{models.StateExiting, 2},
+		{models.StateClosed, 2},
+	}
+	for i, run := range runs {
+		for _, token := range run.tokens {
+			if len(token.Transitions) != len(want) {
+				t.Fatalf("run %d: transitions %v", i, token.Transitions)
+			}
+			for j, transition := range token.Transitions {
+				at := start.Add(offsets[i] + time.Duration(want[j].seconds*float64(time.Second)))
+				if transition.To != want[j].to || !transition.Time.Equal(at) {
+					t.Errorf("run %d: %s, want %s at %s", i, transition, want[j].to, at)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package backtest
+
+import (
+	"b46/b46/portfolio"
+	"fmt"
+	"time"
+)
+
+// Trade is one position opened during a backtest. Amounts are in SOL.
+type Trade struct {
+	Mint        string
+	Name        string
+	Symbol      string
+	OpenedAt    time.Time
+	ClosedAt    time.Time
+	Invested    float64
+	Proceeds    float64
+	PnL         float64 // realized, plus unrealized at the last price for open trades
+	EntryReason string
+	ExitReason  string
+	Open        bool // still held when the session ended
+}
+
+// HoldTime is how long the trade was held, up to end for open trades.
+func (t Trade) HoldTime(end time.Time) time.Duration {
+	if t.Open {
+		return end.Sub(t.OpenedAt)
+	}
+	return t.ClosedAt.Sub(t.OpenedAt)
+}
+
+func (t Trade) String() string {
+	state := "closed"
+	if t.Open {
+		state = "open"
+	}
+	return fmt.Sprintf("Trade{Mint: %s, Symbol: %s, %s, Invested: %.6f, Proceeds: %.6f, PnL: %.6f, Entry: %s, Exit: %s}",
+		t.Mint, t.Symbol, state, t.Invested, t.Proceeds, t.PnL, t.EntryReason, t.ExitReason)
+}
+
+// Report is the outcome of a strategy over one session.
+type Report struct {
+	Session  string
+	Strategy string
+	Start    time.Time
+	End      time.Time
+	Tokens   int // tokens recorded in the session
+
+	Trades         []Trade
+	Totals         portfolio.Totals
+	Wins           int
+	Losses         int
+	RejectedOrders int // buys rejected by the risk limits or left unfilled
+
+	MaxDrawdown float64 // largest fall of the PnL from its running peak, SOL
+	MaxExposure float64 // largest cost basis held at once, SOL
+	AvgExposure float64 // time weighted cost basis held over the session, SOL
+}
+
+// WinRate is the share of trades that made money.
+func (r Report) WinRate() float64 {
+	if len(r.Trades) == 0 {
+		return 0
+	}
+	return float64(r.Wins) / float64(len(r.Trades))
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"Backtest{Session: %s, Strategy: %s, Duration: %s, Tokens: %d, Trades: %d, Wins: %d, Losses: %d, WinRate: %.1f%%, Rejected: %d, PnL: %.6f, Realized: %.6f, Unrealized: %.6f, Fees: %.6f, Rent: %.6f, MaxDrawdown: %.6f, MaxExposure: %.6f, AvgExposure: %.6f}",
+		r.Session, r.Strategy, r.End.Sub(r.Start).Round(time.Second), r.Tokens, len(r.Trades), r.Wins, r.Losses, r.WinRate()*100, r.RejectedOrders,
+		r.Totals.PnL(), r.Totals.RealizedPnL, r.Totals.UnrealizedPnL, r.Totals.Fees, r.Totals.Rent, r.MaxDrawdown, r.MaxExposure, r.AvgExposure,
+	)
+}
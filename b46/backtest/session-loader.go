@@ -0,0 +1,51 @@
+package backtest
+
+import (
+	"b46/b46/logging/reader"
+	"b46/b46/models"
+	"time"
+)
+
+// Session is a recorded trading session rebuilt from its log files.
+type Session struct {
+	Name   string
+	Dir    string
+	Tokens []models.MemeToken // one timeline per mint, snapshots in time order
+	Start  time.Time
+	End    time.Time
+}
+
+// LoadSessions loads every session-N directory under root, in session order.
+func LoadSessions(root string) ([]Session, error) {
+	dirs, err := reader.SessionDirs(root)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, 0, len(dirs))
+	for _, dir := range dirs {
+		session, err := LoadSession(dir)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// LoadSession rebuilds the token timelines of one session from its logs.
+func LoadSession(dir string) (Session, error) {
+	logs, err := reader.ReadSession(dir)
+	if err != nil {
+		return Session{}, err
+	}
+	session := Session{Name: logs.Name, Dir: dir, Tokens: logs.Timelines()}
+	for _, token := range session.Tokens {
+		if session.Start.IsZero() || token.AddedTime.Before(session.Start) {
+			session.Start = token.AddedTime
+		}
+		if last := token.Info[len(token.Info)-1].Snapshot; last.After(session.End) {
+			session.End = last
+		}
+	}
+	return session, nil
+}
@@ -0,0 +1,357 @@
+package backtest
+
+import (
+	"b46/b46/strategies"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Parameter is a Kamikaze parameter swept from Min to Max in steps of Step.
+type Parameter struct {
+	Name string
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// ParseParameters parses "name=min:max:step" entries separated by commas, e.g.
+// "EntryMarketCap=30:50:5,MinEntryHistory=1:4:1". A single value fixes the parameter.
+func ParseParameters(spec string) ([]Parameter, error) {
+	var parameters []Parameter
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, bounds, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid parameter %q, expected name=min:max:step", entry)
+		}
+		fields := strings.Split(bounds, ":")
+		values := make([]float64, 0, 3)
+		for _, field := range fields {
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bound %q of %s: %w", field, name, err)
+			}
+			values = append(values, value)
+		}
+		parameter := Parameter{Name: strings.TrimSpace(name)}
+		switch len(values) {
+		case 1:
+			parameter.Min, parameter.Max = values[0], values[0]
+		case 3:
+			parameter.Min, parameter.Max, parameter.Step = values[0], values[1], values[2]
+		default:
+			return nil, fmt.Errorf("invalid parameter %q, expected name=min:max:step", entry)
+		}
+		if parameter.Max < parameter.Min || (parameter.Max > parameter.Min && parameter.Step <= 0) {
+			return nil, fmt.Errorf("invalid range of %s: %s", parameter.Name, bounds)
+		}
+		if err := (&strategies.KamikazeParams{}).Set(parameter.Name, parameter.Min); err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, parameter)
+	}
+	if len(parameters) == 0 {
+		return nil, fmt.Errorf("no parameters to sweep")
+	}
+	return parameters, nil
+}
+
+// Values lists the values the parameter takes, Min and every step up to Max.
+func (p Parameter) Values() []float64 {
+	if p.Step <= 0 {
+		return []float64{p.Min}
+	}
+	var values []float64
+	steps := int(math.Floor((p.Max-p.Min)/p.Step + 1e-9))
+	for i := 0; i <= steps; i++ {
+		values = append(values, p.Min+float64(i)*p.Step)
+	}
+	return values
+}
+
+// Grid returns base with every combination of the parameter values.
+func Grid(base strategies.KamikazeParams, parameters []Parameter) []strategies.KamikazeParams {
+	configs := []strategies.KamikazeParams{base}
+	for _, parameter := range parameters {
+		var next []strategies.KamikazeParams
+		for _, config := range configs {
+			for _, value := range parameter.Values() {
+				_ = config.Set(parameter.Name, value)
+				next = append(next, config)
+			}
+		}
+		configs = next
+	}
+	return configs
+}
+
+// Random returns count configurations drawn from the parameter values, each value of a
+// parameter being equally likely.
+func Random(base strategies.KamikazeParams, parameters []Parameter, count int, rng *rand.Rand) []strategies.KamikazeParams {
+	configs := make([]strategies.KamikazeParams, 0, count)
+	for i := 0; i < count; i++ {
+		config := base
+		for _, parameter := range parameters {
+			values := parameter.Values()
+			_ = config.Set(parameter.Name, values[rng.Intn(len(values))])
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// Objective scores the reports of one configuration, higher is better.
+type Objective func(reports []Report) float64
+
+// Objectives are the objectives a sweep can rank by.
+var Objectives = map[string]Objective{
+	// pnl is the total PnL.
+	"pnl": func(reports []Report) float64 {
+		return sumPnL(reports)
+	},
+	// expectancy is the average PnL per trade.
+	"expectancy": func(reports []Report) float64 {
+		if trades := countTrades(reports); trades > 0 {
+			return sumPnL(reports) / float64(trades)
+		}
+		return 0
+	},
+	// winrate is the share of trades that made money.
+	"winrate": func(reports []Report) float64 {
+		wins := 0
+		for _, report := range reports {
+			wins += report.Wins
+		}
+		if trades := countTrades(reports); trades > 0 {
+			return float64(wins) / float64(trades)
+		}
+		return 0
+	},
+	// pnl-drawdown is the total PnL less the worst drawdown of any session.
+	"pnl-drawdown": func(reports []Report) float64 {
+		drawdown := 0.0
+		for _, report := range reports {
+			drawdown = max(drawdown, report.MaxDrawdown)
+		}
+		return sumPnL(reports) - drawdown
+	},
+}
+
+// ObjectiveNames lists the objectives in name order.
+func ObjectiveNames() []string {
+	names := make([]string, 0, len(Objectives))
+	for name := range Objectives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SweepOptions configures a sweep.
+type SweepOptions struct {
+	Options
+	Objective string
+	Folds     int // walk-forward folds, 0 only ranks over every session
+	Workers   int // backtests run at once, runtime.NumCPU() when 0
+}
+
+// Candidate is a configuration with its score over a set of sessions.
+type Candidate struct {
+	Params  strategies.KamikazeParams
+	Score   float64
+	Trades  int
+	Wins    int
+	PnL     float64
+	Reports []Report
+
+	config int // index of Params in the swept configurations
+}
+
+func (c Candidate) String() string {
+	winRate := 0.0
+	if c.Trades > 0 {
+		winRate = float64(c.Wins) / float64(c.Trades) * 100
+	}
+	p := c.Params
+	return fmt.Sprintf(
+		"Candidate{Score: %.6f, Trades: %d, WinRate: %.1f%%, PnL: %.6f, EntryMarketCap: %g, MinEntryHistory: %d, MaxEntryHistory: %d, ExitMarketCap: %g, TokenStability: %g, PositionAmount: %g}",
+		c.Score, c.Trades, winRate, c.PnL, p.EntryMarketCap, p.MinEntryHistory, p.MaxEntryHistory, p.ExitMarketCap, p.TokenStability, p.PositionAmount,
+	)
+}
+
+// Fold is one walk-forward step: the best configuration over the training sessions and
+// how it did on the test sessions that follow them.
+type Fold struct {
+	Train      []string
+	Test       []string
+	Best       Candidate // scored on the training sessions
+	TestResult Candidate // the same configuration scored on the test sessions
+}
+
+// SweepResult ranks the configurations of a sweep.
+type SweepResult struct {
+	Objective   string
+	Ranking     []Candidate // every configuration over every session, best first
+	Folds       []Fold
+	OutOfSample Candidate // the test results of every fold together, Params is unset
+}
+
+// Sweep backtests every configuration against every session in parallel and ranks the
+// configurations by the objective. With folds, the sessions are split in time order into
+// folds+1 blocks: fold i picks the best configuration on blocks 0 to i and tests it on
+// block i+1, so the out of sample result shows how much of the ranking is overfitting.
+func Sweep(sessions []Session, configs []strategies.KamikazeParams, options SweepOptions) (SweepResult, error) {
+	objective, exists := Objectives[options.Objective]
+	if !exists {
+		return SweepResult{}, fmt.Errorf("unknown objective %q, available: %s", options.Objective, strings.Join(ObjectiveNames(), ", "))
+	}
+	if options.Folds > 0 && len(sessions) < options.Folds+1 {
+		return SweepResult{}, fmt.Errorf("%d walk-forward folds need at least %d sessions, got %d", options.Folds, options.Folds+1, len(sessions))
+	}
+
+	reports := runAll(sessions, configs, options)
+	result := SweepResult{Objective: options.Objective}
+
+	all := make([]int, len(sessions))
+	for i := range all {
+		all[i] = i
+	}
+	result.Ranking = rank(configs, reports, all, objective)
+
+	if options.Folds == 0 {
+		return result, nil
+	}
+	blocks := split(len(sessions), options.Folds+1)
+	var outOfSample []Report
+	for fold := 1; fold < len(blocks); fold++ {
+		var train []int
+		for _, block := range blocks[:fold] {
+			train = append(train, block...)
+		}
+		test := blocks[fold]
+
+		best := rank(configs, reports, train, objective)[0]
+		tested := score(best.Params, best.config, pick(reports[best.config], test), objective)
+		result.Folds = append(result.Folds, Fold{
+			Train:      names(sessions, train),
+			Test:       names(sessions, test),
+			Best:       best,
+			TestResult: tested,
+		})
+		outOfSample = append(outOfSample, tested.Reports...)
+	}
+	result.OutOfSample = score(strategies.KamikazeParams{}, -1, outOfSample, objective)
+	return result, nil
+}
+
+// runAll runs every configuration against every session, reports[config][session].
+func runAll(sessions []Session, configs []strategies.KamikazeParams, options SweepOptions) [][]Report {
+	reports := make([][]Report, len(configs))
+	for i := range reports {
+		reports[i] = make([]Report, len(sessions))
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct{ config, session int }
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				strategy := strategies.NewKamikaze(configs[j.config])
+				reports[j.config][j.session] = Run(sessions[j.session], strategy, options.Options)
+			}
+		}()
+	}
+	for config := range configs {
+		for session := range sessions {
+			jobs <- job{config: config, session: session}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return reports
+}
+
+// rank scores every configuration over the given sessions, best first. Ties keep the
+// order of configs.
+func rank(configs []strategies.KamikazeParams, reports [][]Report, sessions []int, objective Objective) []Candidate {
+	candidates := make([]Candidate, 0, len(configs))
+	for i, config := range configs {
+		candidates = append(candidates, score(config, i, pick(reports[i], sessions), objective))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+func score(params strategies.KamikazeParams, config int, reports []Report, objective Objective) Candidate {
+	candidate := Candidate{Params: params, Score: objective(reports), Reports: reports, PnL: sumPnL(reports), Trades: countTrades(reports), config: config}
+	for _, report := range reports {
+		candidate.Wins += report.Wins
+	}
+	return candidate
+}
+
+// split cuts count sessions into blocks consecutive blocks of nearly equal size.
+func split(count, blocks int) [][]int {
+	var result [][]int
+	start := 0
+	for block := 0; block < blocks; block++ {
+		end := start + (count-start)/(blocks-block)
+		var indexes []int
+		for i := start; i < end; i++ {
+			indexes = append(indexes, i)
+		}
+		result = append(result, indexes)
+		start = end
+	}
+	return result
+}
+
+func pick(reports []Report, indexes []int) []Report {
+	picked := make([]Report, 0, len(indexes))
+	for _, i := range indexes {
+		picked = append(picked, reports[i])
+	}
+	return picked
+}
+
+func names(sessions []Session, indexes []int) []string {
+	var result []string
+	for _, i := range indexes {
+		result = append(result, sessions[i].Name)
+	}
+	return result
+}
+
+func sumPnL(reports []Report) float64 {
+	pnl := 0.0
+	for _, report := range reports {
+		pnl += report.Totals.PnL()
+	}
+	return pnl
+}
+
+func countTrades(reports []Report) int {
+	trades := 0
+	for _, report := range reports {
+		trades += len(report.Trades)
+	}
+	return trades
+}
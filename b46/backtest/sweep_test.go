@@ -0,0 +1,146 @@
+package backtest
+
+import (
+	"b46/b46/portfolio"
+	"b46/b46/strategies"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		count, blocks int
+		want          [][]int
+	}{
+		{4, 2, [][]int{{0, 1}, {2, 3}}},
+		{5, 2, [][]int{{0, 1}, {2, 3, 4}}},
+		{7, 3, [][]int{{0, 1}, {2, 3}, {4, 5, 6}}},
+		{3, 3, [][]int{{0}, {1}, {2}}},
+		{3, 1, [][]int{{0, 1, 2}}},
+	}
+	for _, test := range tests {
+		if got := split(test.count, test.blocks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("split(%d, %d) = %v, want %v", test.count, test.blocks, got, test.want)
+		}
+	}
+}
+
+func TestParseParameters(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []Parameter
+		wantErr string
+	}{
+		{spec: "EntryMarketCap=30:50:5", want: []Parameter{{"EntryMarketCap", 30, 50, 5}}},
+		{spec: " TokenStability=0.00001 , MinEntryHistory=1:4:1,", want: []Parameter{{"TokenStability", 0.00001, 0.00001, 0}, {"MinEntryHistory", 1, 4, 1}}},
+		{spec: "", wantErr: "no parameters"},
+		{spec: "EntryMarketCap", wantErr: "expected name=min:max:step"},
+		{spec: "EntryMarketCap=30:50", wantErr: "expected name=min:max:step"},
+		{spec: "EntryMarketCap=30:x:5", wantErr: "invalid bound"},
+		{spec: "EntryMarketCap=50:30:5", wantErr: "invalid range"},
+		{spec: "EntryMarketCap=30:50:0", wantErr: "invalid range"},
+		{spec: "Unknown=1", wantErr: "unknown kamikaze parameter"},
+	}
+	for _, test := range tests {
+		got, err := ParseParameters(test.spec)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("ParseParameters(%q) error = %v, want %q", test.spec, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseParameters(%q) = %v, %v, want %v", test.spec, got, err, test.want)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	parameters := []Parameter{{"EntryMarketCap", 30, 40, 5}, {"TokenStability", 0, 0.00001, 0.00001}}
+	configs := Grid(strategies.DefaultKamikazeParams(), parameters)
+	if len(configs) != 6 {
+		t.Fatalf("Grid() returned %d configurations, want 6", len(configs))
+	}
+	seen := make(map[[2]float64]bool)
+	for _, config := range configs {
+		seen[[2]float64{config.EntryMarketCap, config.TokenStability}] = true
+	}
+	for _, entry := range []float64{30, 35, 40} {
+		for _, stability := range []float64{0, 0.00001} {
+			if !seen[[2]float64{entry, stability}] {
+				t.Errorf("Grid() misses EntryMarketCap %g, TokenStability %g", entry, stability)
+			}
+		}
+	}
+}
+
+// pnlReports returns reports[config][session] with the given PnL per session.
+func pnlReports(pnls ...[]float64) [][]Report {
+	reports := make([][]Report, len(pnls))
+	for config, sessions := range pnls {
+		for _, pnl := range sessions {
+			reports[config] = append(reports[config], Report{Totals: portfolio.Totals{RealizedPnL: pnl}})
+		}
+	}
+	return reports
+}
+
+func TestRankTrainsOnTheGivenSessions(t *testing.T) {
+	configs := make([]strategies.KamikazeParams, 3)
+	for i := range configs {
+		configs[i].EntryMarketCap = float64(i)
+	}
+	// Config 0 wins the first sessions and loses the last, config 2 the opposite.
+	reports := pnlReports(
+		[]float64{3, 3, -5, -5},
+		[]float64{1, 1, 1, 1},
+		[]float64{-1, -1, 4, 4},
+	)
+	objective := Objectives["pnl"]
+	blocks := split(4, 2)
+
+	train := rank(configs, reports, blocks[0], objective)
+	if best := train[0]; best.config != 0 || best.Score != 6 {
+		t.Fatalf("best on training = config %d scoring %g, want config 0 scoring 6", best.config, best.Score)
+	}
+	tested := score(train[0].Params, train[0].config, pick(reports[train[0].config], blocks[1]), objective)
+	if tested.Score != -10 {
+		t.Errorf("out of sample score = %g, want -10", tested.Score)
+	}
+	all := rank(configs, reports, []int{0, 1, 2, 3}, objective)
+	if order := []int{all[0].config, all[1].config, all[2].config}; !reflect.DeepEqual(order, []int{2, 1, 0}) {
+		t.Errorf("ranking over every session = %v, want [2 1 0]", order)
+	}
+}
+
+func TestSweepFolds(t *testing.T) {
+	sessions := []Session{{Name: "session-1"}, {Name: "session-2"}, {Name: "session-3"}, {Name: "session-4"}, {Name: "session-5"}}
+	configs := []strategies.KamikazeParams{strategies.DefaultKamikazeParams()}
+	result, err := Sweep(sessions, configs, SweepOptions{Objective: "pnl", Folds: 2, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Fold{
+		{Train: []string{"session-1"}, Test: []string{"session-2", "session-3"}},
+		{Train: []string{"session-1", "session-2", "session-3"}, Test: []string{"session-4", "session-5"}},
+	}
+	if len(result.Folds) != len(want) {
+		t.Fatalf("Sweep() returned %d folds, want %d", len(result.Folds), len(want))
+	}
+	for i, fold := range result.Folds {
+		if !reflect.DeepEqual(fold.Train, want[i].Train) || !reflect.DeepEqual(fold.Test, want[i].Test) {
+			t.Errorf("fold %d trains on %v and tests on %v, want %v and %v", i, fold.Train, fold.Test, want[i].Train, want[i].Test)
+		}
+	}
+	if len(result.OutOfSample.Reports) != 4 {
+		t.Errorf("out of sample covers %d sessions, want 4", len(result.OutOfSample.Reports))
+	}
+
+	if _, err := Sweep(sessions[:2], configs, SweepOptions{Objective: "pnl", Folds: 2}); err == nil {
+		t.Error("Sweep() with more folds than sessions succeeded")
+	}
+	if _, err := Sweep(sessions, configs, SweepOptions{Objective: "sharpe"}); err == nil {
+		t.Error("Sweep() with an unknown objective succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"b46/b46/models"
+	"math"
+)
+
+// ---------------------
+// Streaming Indicators on []models.MemeInfo
+// ---------------------
+
+// UpdateIndicators folds the snapshots of infos that previous has not seen yet into it
+// and returns the result. Pass the indicators of the token's last analysis, or the zero
+// value to start over. Indicators that folded nothing, like those read back from a log,
+// or that folded more than infos holds, are started over.
+func UpdateIndicators(previous models.Indicators, infos []models.MemeInfo) models.Indicators {
+	ind := previous
+	if ind.Folded == 0 || ind.Folded > len(infos) {
+		ind = models.Indicators{}
+	}
+	for _, info := range infos[ind.Folded:] {
+		if info.BondingState == nil || info.TokenPrice <= 0 {
+			continue
+		}
+		addSample(&ind, info.TokenPrice)
+	}
+	ind.Folded = len(infos)
+	if ind.Samples == 0 {
+		return ind
+	}
+
+	// The windowed indicators only look at the last samples.
+	prices := recentPrices(infos, max(models.BollingerPeriod, models.RateOfChangePeriod+1))
+	window := prices[max(0, len(prices)-models.BollingerPeriod):]
+	ind.BollingerMiddle = CalculateMovingAverage(window)
+	width := models.BollingerWidth * CalculateStandardDeviation(window)
+	ind.BollingerUpper = ind.BollingerMiddle + width
+	ind.BollingerLower = ind.BollingerMiddle - width
+
+	ind.RateOfChange = 0
+	if len(prices) > models.RateOfChangePeriod {
+		first := prices[len(prices)-1-models.RateOfChangePeriod]
+		ind.RateOfChange = (prices[len(prices)-1] - first) / first * 100.0
+	}
+	return ind
+}
+
+// addSample folds one price into the running indicators.
+func addSample(ind *models.Indicators, price float64) {
+	ind.Samples++
+	if ind.Samples == 1 {
+		ind.EMAFast, ind.EMASlow = price, price
+		ind.Peak, ind.LastPrice = price, price
+		return
+	}
+
+	ind.EMAFast = CalculateEMAStep(ind.EMAFast, price, models.EMAFastPeriod)
+	ind.EMASlow = CalculateEMAStep(ind.EMASlow, price, models.EMASlowPeriod)
+	ind.MACD = ind.EMAFast - ind.EMASlow
+	// MACD is first defined on the second sample, which seeds its signal line.
+	if ind.Samples == 2 {
+		ind.MACDSignal = ind.MACD
+	} else {
+		ind.MACDSignal = CalculateEMAStep(ind.MACDSignal, ind.MACD, models.MACDSignalPeriod)
+	}
+	ind.MACDHistogram = ind.MACD - ind.MACDSignal
+
+	// Wilder's smoothing, seeded with the plain average of the first RSIPeriod changes.
+	gain := math.Max(price-ind.LastPrice, 0)
+	loss := math.Max(ind.LastPrice-price, 0)
+	changes := float64(min(ind.Samples-1, models.RSIPeriod))
+	ind.AvgGain += (gain - ind.AvgGain) / changes
+	ind.AvgLoss += (loss - ind.AvgLoss) / changes
+	if ind.Warm(models.RSIPeriod) {
+		ind.RSI = CalculateRSI(ind.AvgGain, ind.AvgLoss)
+	}
+
+	ind.Peak = math.Max(ind.Peak, price)
+	ind.Drawdown = (ind.Peak - price) / ind.Peak * 100.0
+	ind.LastPrice = price
+}
+
+// CalculateEMAStep moves an exponential moving average over period one value forward.
+func CalculateEMAStep(ema, value float64, period int) float64 {
+	alpha := 2.0 / float64(period+1)
+	return ema + alpha*(value-ema)
+}
+
+// CalculateRSI returns the relative strength index for the given average gain and loss.
+// Returns 50 when the price did not move at all.
+func CalculateRSI(avgGain, avgLoss float64) float64 {
+	if avgLoss == 0 {
+		if avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100.0 - 100.0/(1.0+avgGain/avgLoss)
+}
+
+// recentPrices returns up to count of the last priced snapshots of infos, oldest first.
+func recentPrices(infos []models.MemeInfo, count int) []float64 {
+	prices := make([]float64, count)
+	next := count
+	for i := len(infos) - 1; i >= 0 && next > 0; i-- {
+		if infos[i].BondingState == nil || infos[i].TokenPrice <= 0 {
+			continue
+		}
+		next--
+		prices[next] = infos[i].TokenPrice
+	}
+	return prices[next:]
+}
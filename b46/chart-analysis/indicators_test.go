@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"b46/b46/models"
+	"math"
+	"testing"
+)
+
+// priced returns snapshots at the given prices, a price of 0 meaning a snapshot without
+// bonding curve state.
+func priced(prices ...float64) []models.MemeInfo {
+	infos := make([]models.MemeInfo, 0, len(prices))
+	for _, price := range prices {
+		info := models.MemeInfo{TokenPrice: price}
+		if price > 0 {
+			info.BondingState = &models.BondingCurveState{}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-12*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func TestCalculateRSI(t *testing.T) {
+	tests := []struct {
+		gain, loss, want float64
+	}{
+		{0, 0, 50},
+		{1, 0, 100},
+		{0, 1, 0},
+		{1, 1, 50},
+		{3, 1, 75},
+	}
+	for _, test := range tests {
+		if got := CalculateRSI(test.gain, test.loss); !near(got, test.want) {
+			t.Errorf("CalculateRSI(%g, %g) = %g, want %g", test.gain, test.loss, got, test.want)
+		}
+	}
+}
+
+func TestMACDSignalSeededOnSecondSample(t *testing.T) {
+	one := UpdateIndicators(models.Indicators{}, priced(1))
+	if one.MACD != 0 || one.MACDSignal != 0 || one.MACDHistogram != 0 {
+		t.Fatalf("first sample MACD = %g, signal %g, histogram %g, want 0", one.MACD, one.MACDSignal, one.MACDHistogram)
+	}
+
+	two := UpdateIndicators(models.Indicators{}, priced(1, 2))
+	if two.MACD == 0 || two.MACDSignal != two.MACD || two.MACDHistogram != 0 {
+		t.Fatalf("second sample MACD = %g, signal %g, histogram %g, want the signal seeded with MACD", two.MACD, two.MACDSignal, two.MACDHistogram)
+	}
+
+	three := UpdateIndicators(two, priced(1, 2, 3))
+	if want := CalculateEMAStep(two.MACD, three.MACD, models.MACDSignalPeriod); !near(three.MACDSignal, want) {
+		t.Errorf("third sample signal = %g, want %g", three.MACDSignal, want)
+	}
+	if !near(three.MACDHistogram, three.MACD-three.MACDSignal) {
+		t.Errorf("histogram = %g, want MACD - signal = %g", three.MACDHistogram, three.MACD-three.MACDSignal)
+	}
+}
+
+func TestRSI(t *testing.T) {
+	rising := make([]float64, 0, models.RSIPeriod+1)
+	falling := make([]float64, 0, models.RSIPeriod+1)
+	flat := make([]float64, 0, models.RSIPeriod+1)
+	zigzag := make([]float64, 0, models.RSIPeriod+1)
+	for i := 0; i <= models.RSIPeriod; i++ {
+		rising = append(rising, float64(10+i))
+		falling = append(falling, float64(100-i))
+		flat = append(flat, 10)
+		zigzag = append(zigzag, float64(10+i%2))
+	}
+
+	tests := []struct {
+		name   string
+		prices []float64
+		want   float64
+	}{
+		{"cold", rising[:models.RSIPeriod], 0},
+		{"rising", rising, 100},
+		{"falling", falling, 0},
+		{"flat", flat, 50},
+		{"zigzag", zigzag, 50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ind := UpdateIndicators(models.Indicators{}, priced(test.prices...))
+			if !near(ind.RSI, test.want) {
+				t.Errorf("RSI = %g, want %g", ind.RSI, test.want)
+			}
+		})
+	}
+}
+
+func TestWindowedIndicators(t *testing.T) {
+	flat := UpdateIndicators(models.Indicators{}, priced(5, 5, 5))
+	if flat.BollingerMiddle != 5 || flat.BollingerUpper != 5 || flat.BollingerLower != 5 || flat.RateOfChange != 0 {
+		t.Errorf("flat prices gave bands %g/%g/%g and rate of change %g", flat.BollingerLower, flat.BollingerMiddle, flat.BollingerUpper, flat.RateOfChange)
+	}
+
+	prices := make([]float64, 0, models.RateOfChangePeriod+1)
+	for i := 0; i <= models.RateOfChangePeriod; i++ {
+		prices = append(prices, float64(100+10*i))
+	}
+	ind := UpdateIndicators(models.Indicators{}, priced(prices...))
+	if want := float64(10 * models.RateOfChangePeriod); !near(ind.RateOfChange, want) {
+		t.Errorf("RateOfChange = %g, want %g", ind.RateOfChange, want)
+	}
+	if ind.BollingerUpper <= ind.BollingerMiddle || !near(ind.BollingerMiddle-ind.BollingerLower, ind.BollingerUpper-ind.BollingerMiddle) {
+		t.Errorf("bands %g/%g/%g are not symmetric around the middle", ind.BollingerLower, ind.BollingerMiddle, ind.BollingerUpper)
+	}
+
+	peaked := UpdateIndicators(models.Indicators{}, priced(1, 4, 3))
+	if peaked.Peak != 4 || !near(peaked.Drawdown, 25) {
+		t.Errorf("Peak = %g, Drawdown = %g, want 4 and 25", peaked.Peak, peaked.Drawdown)
+	}
+}
+
+func TestUpdateIndicatorsFoldsIncrementally(t *testing.T) {
+	infos := priced(1, 0, 1.5, 1.2, 0, 2, 2.5, 1.8, 3, 2.9, 3.4, 4, 3.8, 4.2, 5, 4.4, 5.1)
+
+	all := UpdateIndicators(models.Indicators{}, infos)
+	var step models.Indicators
+	for i := 1; i <= len(infos); i++ {
+		step = UpdateIndicators(step, infos[:i])
+	}
+	if all.Samples != len(infos)-2 || all.Folded != len(infos) {
+		t.Fatalf("folded %d snapshots with %d samples, want %d and %d", all.Folded, all.Samples, len(infos), len(infos)-2)
+	}
+	fields := []struct {
+		name       string
+		all, steps float64
+	}{
+		{"EMAFast", all.EMAFast, step.EMAFast},
+		{"EMASlow", all.EMASlow, step.EMASlow},
+		{"MACDSignal", all.MACDSignal, step.MACDSignal},
+		{"RSI", all.RSI, step.RSI},
+		{"BollingerUpper", all.BollingerUpper, step.BollingerUpper},
+		{"RateOfChange", all.RateOfChange, step.RateOfChange},
+		{"Drawdown", all.Drawdown, step.Drawdown},
+	}
+	for _, field := range fields {
+		if !near(field.all, field.steps) {
+			t.Errorf("%s folded at once = %g, one snapshot at a time = %g", field.name, field.all, field.steps)
+		}
+	}
+
+	// Indicators that folded more snapshots than given, or none, start over.
+	if restarted := UpdateIndicators(all, infos[:3]); restarted != UpdateIndicators(models.Indicators{}, infos[:3]) {
+		t.Errorf("indicators ahead of the history were not started over: %+v", restarted)
+	}
+	logged := all
+	logged.Folded = 0
+	if restarted := UpdateIndicators(logged, infos); restarted != all {
+		t.Errorf("indicators read back from a log were not started over: %+v", restarted)
+	}
+}
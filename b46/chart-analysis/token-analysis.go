@@ -342,7 +342,14 @@ func AnalyzeTokenData(token models.MemeToken) models.TokenAnalysis {
 	// Define a price stability threshold (example).
 	priceStability := volatility < models.TokenStability
 
-	t := time.Now()
+	// Carry the indicators of the previous analysis forward.
+	var previous models.Indicators
+	if len(token.Analysis) > 0 {
+		previous = token.Analysis[len(token.Analysis)-1].Indicators
+	}
+	indicators := UpdateIndicators(previous, snapshots)
+
+	t := models.Now()
 	// Assemble the analysis result.
 	analysis := models.TokenAnalysis{
 		// Basic liquidity & valuation criteria:
@@ -368,6 +375,9 @@ func AnalyzeTokenData(token models.MemeToken) models.TokenAnalysis {
 		CurrentPrice:     prices[n-1],
 		RiskRewardScore:  riskRewardScore,
 		Snapshot:         t,
+
+		// Streaming indicators:
+		Indicators: indicators,
 		// Additional fields if desired:
 		// TokenID, TokenName, Timestamp, MarketCap, etc.
 		// (Make sure your models.TokenAnalysis struct includes these fields.)
@@ -0,0 +1,214 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DropPolicy decides what happens when a subscriber's buffer is full.
+type DropPolicy int
+
+const (
+	DropNewest DropPolicy = iota // the event being published is dropped
+	DropOldest                   // the oldest buffered event is dropped to make room
+	Block                        // the publisher waits, up to BlockTimeout when set
+)
+
+func (p DropPolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "DROP_NEWEST"
+	case DropOldest:
+		return "DROP_OLDEST"
+	case Block:
+		return "BLOCK"
+	default:
+		return fmt.Sprintf("DropPolicy(%d)", int(p))
+	}
+}
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	Buffer       int           // events buffered for the subscriber
+	Policy       DropPolicy    // what to do when the buffer is full
+	BlockTimeout time.Duration // with Block, how long a publisher waits before dropping; 0 waits until the subscriber unsubscribes
+	Types        []Type        // event types delivered, all types when empty
+}
+
+// Subscription receives the events matching its options on C.
+type Subscription struct {
+	Name      string
+	events    chan Event
+	options   SubscribeOptions
+	types     map[Type]bool
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+
+	// closing is closed by Unsubscribe to release blocked publishers, events is only
+	// closed once no delivery holds mutex anymore.
+	mutex   sync.RWMutex
+	closing chan struct{}
+	closed  bool
+}
+
+// C returns the channel events are delivered on. It is closed by Unsubscribe.
+func (s *Subscription) C() <-chan Event {
+	return s.events
+}
+
+// Dropped returns how many events were lost because the subscriber was too slow.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) wants(t Type) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// deliver applies the subscriber's drop policy to event. Events published while the
+// subscriber unsubscribes are dropped.
+func (s *Subscription) deliver(event Event) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return
+	}
+
+	switch s.options.Policy {
+	case DropOldest:
+		for {
+			select {
+			case s.events <- event:
+				s.delivered.Add(1)
+				return
+			default:
+			}
+			select {
+			case <-s.events:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case Block:
+		var timeout <-chan time.Time
+		if s.options.BlockTimeout > 0 {
+			timer := time.NewTimer(s.options.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case s.events <- event:
+			s.delivered.Add(1)
+		case <-timeout:
+			s.dropped.Add(1)
+		case <-s.closing:
+			s.dropped.Add(1)
+		}
+	default:
+		select {
+		case s.events <- event:
+			s.delivered.Add(1)
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Bus is a typed in-process publish/subscribe bus. A nil Bus discards every event, so
+// components can publish whether or not a bus has been wired in.
+type Bus struct {
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	published     atomic.Uint64
+}
+
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber. Events published before the call are not replayed.
+func (b *Bus) Subscribe(name string, options SubscribeOptions) *Subscription {
+	if options.Buffer < 0 {
+		options.Buffer = 0
+	}
+	// Dropping the oldest event needs somewhere to drop it from.
+	if options.Policy == DropOldest && options.Buffer == 0 {
+		options.Buffer = 1
+	}
+	sub := &Subscription{
+		Name:    name,
+		events:  make(chan Event, options.Buffer),
+		options: options,
+		types:   make(map[Type]bool, len(options.Types)),
+		closing: make(chan struct{}),
+	}
+	for _, t := range options.Types {
+		sub.types[t] = true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops delivery to sub and closes its channel. Publishers blocked on sub
+// give up their event.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mutex.Lock()
+	_, exists := b.subscriptions[sub]
+	delete(b.subscriptions, sub)
+	b.mutex.Unlock()
+	if !exists {
+		return
+	}
+
+	close(sub.closing)
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	sub.closed = true
+	close(sub.events)
+}
+
+// Publish delivers event to every subscriber interested in its type, applying each
+// subscriber's drop policy. Only subscribers with the Block policy can slow it down,
+// the bus itself is not locked while it waits for them.
+func (b *Bus) Publish(event Event) {
+	if b == nil || event == nil {
+		return
+	}
+	b.published.Add(1)
+
+	b.mutex.RLock()
+	subscribers := make([]*Subscription, 0, len(b.subscriptions))
+	for sub := range b.subscriptions {
+		if sub.wants(event.Type()) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.deliver(event)
+	}
+}
+
+func (b *Bus) String() string {
+	if b == nil {
+		return "Bus{disabled}"
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	stats := make([]string, 0, len(b.subscriptions))
+	for sub := range b.subscriptions {
+		stats = append(stats, fmt.Sprintf("%s: %d/%d queued, %d delivered, %d dropped (%s)",
+			sub.Name, len(sub.events), cap(sub.events), sub.delivered.Load(), sub.dropped.Load(), sub.options.Policy))
+	}
+	sort.Strings(stats)
+	return fmt.Sprintf("Bus{Published: %d, Subscribers: [%s]}", b.published.Load(), strings.Join(stats, "; "))
+}
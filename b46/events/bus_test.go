@@ -0,0 +1,162 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// testEvent is an event whose OccurredAt carries its sequence number in seconds.
+type testEvent struct {
+	eventType Type
+	sequence  int
+}
+
+func (e testEvent) Type() Type            { return e.eventType }
+func (e testEvent) Mint() string          { return "" }
+func (e testEvent) OccurredAt() time.Time { return time.Unix(int64(e.sequence), 0) }
+
+// drain returns the sequence numbers of the events buffered for sub.
+func drain(sub *Subscription) []int {
+	var sequences []int
+	for {
+		select {
+		case event := <-sub.C():
+			sequences = append(sequences, event.(testEvent).sequence)
+		default:
+			return sequences
+		}
+	}
+}
+
+func TestDropPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  SubscribeOptions
+		received []int
+		dropped  uint64
+	}{
+		{name: "drop newest", options: SubscribeOptions{Buffer: 2, Policy: DropNewest}, received: []int{1, 2}, dropped: 3},
+		{name: "drop oldest", options: SubscribeOptions{Buffer: 2, Policy: DropOldest}, received: []int{4, 5}, dropped: 3},
+		{name: "drop oldest unbuffered", options: SubscribeOptions{Policy: DropOldest}, received: []int{5}, dropped: 4},
+		{name: "block with timeout", options: SubscribeOptions{Buffer: 2, Policy: Block, BlockTimeout: time.Millisecond}, received: []int{1, 2}, dropped: 3},
+		{name: "unbuffered drop newest", options: SubscribeOptions{Policy: DropNewest}, dropped: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := NewBus()
+			sub := bus.Subscribe(test.name, test.options)
+			for sequence := 1; sequence <= 5; sequence++ {
+				bus.Publish(testEvent{eventType: TokenCreated, sequence: sequence})
+			}
+
+			received := drain(sub)
+			if len(received) != len(test.received) {
+				t.Fatalf("received %v, want %v", received, test.received)
+			}
+			for i := range received {
+				if received[i] != test.received[i] {
+					t.Fatalf("received %v, want %v", received, test.received)
+				}
+			}
+			if sub.Dropped() != test.dropped {
+				t.Errorf("dropped %d, want %d", sub.Dropped(), test.dropped)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForSubscriber(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("slow", SubscribeOptions{Buffer: 1, Policy: Block})
+	bus.Publish(testEvent{eventType: TokenCreated, sequence: 1})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(testEvent{eventType: TokenCreated, sequence: 2})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish did not wait for the full subscriber")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	var received []int
+	for len(received) < 2 {
+		select {
+		case event := <-sub.C():
+			received = append(received, event.(testEvent).sequence)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, want [1 2]", received)
+		}
+	}
+	<-published
+	if received[0] != 1 || received[1] != 2 || sub.Dropped() != 0 {
+		t.Errorf("received %v with %d dropped, want [1 2] and none dropped", received, sub.Dropped())
+	}
+}
+
+func TestSubscriptionTypes(t *testing.T) {
+	bus := NewBus()
+	fills := bus.Subscribe("fills", SubscribeOptions{Buffer: 4, Types: []Type{OrderFilled}})
+	all := bus.Subscribe("all", SubscribeOptions{Buffer: 4})
+
+	bus.Publish(testEvent{eventType: TokenCreated, sequence: 1})
+	bus.Publish(testEvent{eventType: OrderFilled, sequence: 2})
+	bus.Publish(nil)
+
+	if got := drain(fills); len(got) != 1 || got[0] != 2 {
+		t.Errorf("fills received %v, want [2]", got)
+	}
+	if got := drain(all); len(got) != 2 {
+		t.Errorf("all received %v, want [1 2]", got)
+	}
+
+	bus.Unsubscribe(fills)
+	bus.Unsubscribe(fills)
+	bus.Publish(testEvent{eventType: OrderFilled, sequence: 3})
+	if _, open := <-fills.C(); open {
+		t.Error("unsubscribed channel still open")
+	}
+
+	var disabled *Bus
+	disabled.Publish(testEvent{eventType: OrderFilled, sequence: 4})
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("stuck", SubscribeOptions{Policy: Block})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(testEvent{eventType: TokenCreated, sequence: 1})
+		close(published)
+	}()
+	// Wait until the publisher is blocked on the subscriber.
+	time.Sleep(20 * time.Millisecond)
+
+	unsubscribed := make(chan struct{})
+	go func() {
+		// Other subscribers come and go while the publisher waits.
+		other := bus.Subscribe("other", SubscribeOptions{Buffer: 1})
+		bus.Unsubscribe(other)
+		bus.Unsubscribe(sub)
+		close(unsubscribed)
+	}()
+	for name, done := range map[string]chan struct{}{"unsubscribe": unsubscribed, "publish": published} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s deadlocked", name)
+		}
+	}
+
+	if _, open := <-sub.C(); open {
+		t.Error("channel still open")
+	}
+	if sub.Dropped() != 1 {
+		t.Errorf("%d dropped, want the blocked event", sub.Dropped())
+	}
+	// Publishing to a bus whose subscriber is gone neither blocks nor panics.
+	bus.Publish(testEvent{eventType: TokenCreated, sequence: 2})
+}
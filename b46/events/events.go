@@ -0,0 +1,100 @@
+package events
+
+import (
+	"b46/b46/models"
+	"fmt"
+	"time"
+)
+
+// Type identifies the kind of an Event.
+type Type int
+
+const (
+	TokenCreated     Type = iota // a new token was announced by the listener
+	TradeObserved                // a pump.fun buy or sell by anyone was seen in the program logs
+	SnapshotUpdated              // a bonding curve snapshot was appended to a token
+	AnalysisComputed             // chart analysis was computed for a token
+	OrderFilled                  // one of our orders was confirmed and filled
+	TokenMigrated                // a token's bonding curve completed
+)
+
+func (t Type) String() string {
+	switch t {
+	case TokenCreated:
+		return "TOKEN_CREATED"
+	case TradeObserved:
+		return "TRADE_OBSERVED"
+	case SnapshotUpdated:
+		return "SNAPSHOT_UPDATED"
+	case AnalysisComputed:
+		return "ANALYSIS_COMPUTED"
+	case OrderFilled:
+		return "ORDER_FILLED"
+	case TokenMigrated:
+		return "TOKEN_MIGRATED"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
+// Event is published on the Bus. Subscribers switch on the concrete type to read the payload.
+type Event interface {
+	Type() Type
+	Mint() string
+	OccurredAt() time.Time
+}
+
+type TokenCreatedEvent struct {
+	Token models.MemeToken
+	Time  time.Time
+}
+
+func (e TokenCreatedEvent) Type() Type            { return TokenCreated }
+func (e TokenCreatedEvent) Mint() string          { return e.Token.Mint.String() }
+func (e TokenCreatedEvent) OccurredAt() time.Time { return e.Time }
+
+type TradeObservedEvent struct {
+	Trade models.PumpTrade
+	Time  time.Time
+}
+
+func (e TradeObservedEvent) Type() Type            { return TradeObserved }
+func (e TradeObservedEvent) Mint() string          { return e.Trade.Mint.String() }
+func (e TradeObservedEvent) OccurredAt() time.Time { return e.Time }
+
+type SnapshotUpdatedEvent struct {
+	Token    models.MemeToken
+	Snapshot models.MemeInfo
+}
+
+func (e SnapshotUpdatedEvent) Type() Type            { return SnapshotUpdated }
+func (e SnapshotUpdatedEvent) Mint() string          { return e.Token.Mint.String() }
+func (e SnapshotUpdatedEvent) OccurredAt() time.Time { return e.Snapshot.Snapshot }
+
+type AnalysisComputedEvent struct {
+	Token    models.MemeToken
+	Analysis models.TokenAnalysis
+}
+
+func (e AnalysisComputedEvent) Type() Type            { return AnalysisComputed }
+func (e AnalysisComputedEvent) Mint() string          { return e.Token.Mint.String() }
+func (e AnalysisComputedEvent) OccurredAt() time.Time { return e.Analysis.Snapshot }
+
+type OrderFilledEvent struct {
+	Token  models.MemeToken
+	Fill   models.Fill
+	Reason string
+}
+
+func (e OrderFilledEvent) Type() Type            { return OrderFilled }
+func (e OrderFilledEvent) Mint() string          { return e.Fill.Mint.String() }
+func (e OrderFilledEvent) OccurredAt() time.Time { return e.Fill.Time }
+
+type TokenMigratedEvent struct {
+	Token      models.MemeToken
+	Transition models.Transition
+}
+
+func (e TokenMigratedEvent) Type() Type            { return TokenMigrated }
+func (e TokenMigratedEvent) Mint() string          { return e.Token.Mint.String() }
+func (e TokenMigratedEvent) OccurredAt() time.Time { return e.Transition.Time }
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"b46/b46/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SchemaVersion is written with every event. Bump it whenever an event type or payload
+// changes in a way readers have to know about.
+const SchemaVersion = 1
+
+// EventType names the payload an event carries.
+type EventType string
+
+const (
+	EventTick        EventType = "tick" // a monitor or trading round starts, the # rows of the CSV logs
+	EventMonitor     EventType = "monitor"
+	EventAdd         EventType = "add"
+	EventRemove      EventType = "remove"
+	EventTrading     EventType = "trading"
+	EventFill        EventType = "fill"
+	EventOrderFailed EventType = "order_failed"
+	EventRejection   EventType = "rejection"
+	EventPosition    EventType = "position"
+	EventTotals      EventType = "totals"
+	EventTransition  EventType = "transition"
+)
+
+// Payload is the typed body of an event. Record returns the row the CSV sink writes for
+// it, in the column layout the CSV logs have always used.
+type Payload interface {
+	Type() EventType
+	Record(mint string) []string
+}
+
+// Event is one line of the event log.
+type Event struct {
+	Schema  int       `json:"schema"`
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	Mint    string    `json:"mint,omitempty"`
+	Payload Payload   `json:"payload"`
+}
+
+type eventLog struct {
+	file    *os.File
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+var sessionEvents eventLog
+
+// LogEvent writes an event to the session's JSON-lines log and, while models.EventLogCSV
+// is set, its CSV row to file. The CSV logger of file has to be initialized.
+func LogEvent(file string, mint string, payload Payload) error {
+	event := Event{
+		Schema:  SchemaVersion,
+		Type:    payload.Type(),
+		Time:    models.Now(),
+		Session: filepath.Base(currentSession),
+		Mint:    mint,
+		Payload: payload,
+	}
+	if err := sessionEvents.write(event); err != nil {
+		return err
+	}
+	if !models.EventLogCSV {
+		return nil
+	}
+	return PrintToLog(file, payload.Record(mint))
+}
+
+// write appends event to the event log, opening it on first use.
+func (l *eventLog) write(event Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		filename := filepath.Join(currentSession, models.EventLogFile)
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create file %q: %w", filename, err)
+		}
+		l.file = f
+		l.encoder = json.NewEncoder(f)
+	}
+	if err := l.encoder.Encode(event); err != nil {
+		return fmt.Errorf("error writing event to %s: %w", models.EventLogFile, err)
+	}
+	return nil
+}
+
+// close closes the event log, the next event opens it again.
+func (l *eventLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	l.encoder = nil
+	return err
+}
@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"b46/b46/helpers"
+	"b46/b46/models"
+	"strconv"
+	"time"
+)
+
+// TickPayload starts a monitor or trading round.
+type TickPayload struct {
+	Loop string `json:"loop"` // "monitor" or "trading"
+}
+
+func (p TickPayload) Type() EventType { return EventTick }
+
+func (p TickPayload) Record(string) []string {
+	return []string{"#", "#", "#", "#", "#", "#", "#", "#", "#", "#", "#", "#", "#"}
+}
+
+// SnapshotPayload is a token with its snapshot history: a monitor or trading round
+// refreshing it, or the monitor adding it to the trades or removing it.
+type SnapshotPayload struct {
+	Kind      EventType              `json:"-"`
+	Name      string                 `json:"name"`
+	Symbol    string                 `json:"symbol"`
+	AddedTime time.Time              `json:"added_time"`
+	State     models.TokenState      `json:"state"`
+	Strategy  string                 `json:"strategy,omitempty"`
+	Snapshots []models.MemeInfo      `json:"snapshots"`
+	Analyses  []models.TokenAnalysis `json:"analyses,omitempty"` // trading rounds only
+	Trading   bool                   `json:"trading"`
+	Sold      bool                   `json:"sold"`
+}
+
+// NewSnapshotPayload captures token for an EventMonitor, EventAdd, EventRemove or
+// EventTrading event.
+func NewSnapshotPayload(kind EventType, token models.MemeToken) SnapshotPayload {
+	payload := SnapshotPayload{
+		Kind:      kind,
+		Name:      token.Name,
+		Symbol:    token.Symbol,
+		AddedTime: token.AddedTime,
+		State:     token.State,
+		Strategy:  token.Strategy,
+		Snapshots: token.Info,
+		Trading:   token.Trading,
+		Sold:      token.Sold,
+	}
+	if kind == EventTrading {
+		payload.Analyses = token.Analysis
+	}
+	return payload
+}
+
+func (p SnapshotPayload) Type() EventType { return p.Kind }
+
+func (p SnapshotPayload) Record(mint string) []string {
+	switch p.Kind {
+	case EventTrading:
+		return []string{
+			"CURRENTLY TRADING", mint, p.Name, p.Symbol, p.AddedTime.String(), MemeInfosToString(p.Snapshots), AnalysisInfosToString(p.Analyses), strconv.FormatBool(p.Trading), strconv.FormatBool(p.Sold),
+		}
+	case EventAdd:
+		return []string{"ADD", mint, p.Name, p.Symbol, p.AddedTime.String(), MemeInfosToString(p.Snapshots), strconv.FormatBool(p.Trading)}
+	case EventRemove:
+		return []string{"REMOVE", mint, p.Name, p.Symbol, p.AddedTime.String(), MemeInfosToString(p.Snapshots), strconv.FormatBool(p.Trading)}
+	default:
+		return []string{"MONITOR", mint, p.Name, p.Symbol, p.AddedTime.String(), MemeInfosToString(p.Snapshots), strconv.FormatBool(p.Trading)}
+	}
+}
+
+// FillPayload is a confirmed order.
+type FillPayload struct {
+	Side      string  `json:"side"`
+	Name      string  `json:"name"`
+	Symbol    string  `json:"symbol"`
+	MarketCap float64 `json:"market_cap"`
+	Price     float64 `json:"price"`
+	Reason    string  `json:"reason"`
+	Strategy  string  `json:"strategy"`
+}
+
+func (p FillPayload) Type() EventType { return EventFill }
+
+func (p FillPayload) Record(mint string) []string {
+	return []string{
+		p.Side, mint, p.Name, p.Symbol, helpers.ConvertFloatToString(p.MarketCap), helpers.ConvertFloatToString(p.Price), p.Reason, p.Strategy,
+	}
+}
+
+// OrderFailedPayload is a failed attempt of an order. Outcome is FAILED, or PRICE RAN
+// AWAY when the price moved past the slippage bound.
+type OrderFailedPayload struct {
+	Outcome string `json:"outcome"`
+	Side    string `json:"side"`
+	Name    string `json:"name"`
+	Symbol  string `json:"symbol"`
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error"`
+}
+
+func (p OrderFailedPayload) Type() EventType { return EventOrderFailed }
+
+func (p OrderFailedPayload) Record(mint string) []string {
+	return []string{p.Outcome, mint, p.Name, p.Symbol, p.Side, strconv.Itoa(p.Attempt), p.Error}
+}
+
+// RejectionPayload is an order that was not queued. Outcome is the kind of rejection,
+// REJECT, RISK REJECT, ALLOCATION DOWNSIZE and so on.
+type RejectionPayload struct {
+	Outcome  string `json:"outcome"`
+	Side     string `json:"side"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Reason   string `json:"reason"`
+	Strategy string `json:"strategy"`
+}
+
+func (p RejectionPayload) Type() EventType { return EventRejection }
+
+func (p RejectionPayload) Record(mint string) []string {
+	return []string{p.Outcome, mint, p.Name, p.Symbol, p.Side, p.Reason, p.Strategy}
+}
+
+// PositionPayload is an open position at the end of a trading round.
+type PositionPayload struct {
+	Name          string  `json:"name"`
+	Symbol        string  `json:"symbol"`
+	Strategy      string  `json:"strategy"`
+	Tokens        uint64  `json:"tokens"`
+	EntryPrice    float64 `json:"entry_price"`
+	LastPrice     float64 `json:"last_price"`
+	CostBasis     float64 `json:"cost_basis"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+}
+
+func (p PositionPayload) Type() EventType { return EventPosition }
+
+func (p PositionPayload) Record(mint string) []string {
+	return []string{
+		"POSITION", mint, p.Name, p.Symbol, strconv.FormatUint(p.Tokens, 10), helpers.ConvertFloatToString(p.EntryPrice), helpers.ConvertFloatToString(p.LastPrice), helpers.ConvertFloatToString(p.CostBasis), helpers.ConvertFloatToString(p.RealizedPnL), helpers.ConvertFloatToString(p.UnrealizedPnL), p.Strategy,
+	}
+}
+
+// TotalsPayload is the totals of one strategy, or of the whole portfolio when Strategy
+// is empty, at the end of a trading round.
+type TotalsPayload struct {
+	Strategy        string  `json:"strategy,omitempty"`
+	OpenPositions   int     `json:"open_positions"`
+	ClosedPositions int     `json:"closed_positions"`
+	Invested        float64 `json:"invested"`
+	Proceeds        float64 `json:"proceeds"`
+	Fees            float64 `json:"fees"`
+	Rent            float64 `json:"rent"`
+	Exposure        float64 `json:"exposure"`
+	RealizedPnL     float64 `json:"realized_pnl"`
+	UnrealizedPnL   float64 `json:"unrealized_pnl"`
+	PnL             float64 `json:"pnl"`
+}
+
+func (p TotalsPayload) Type() EventType { return EventTotals }
+
+func (p TotalsPayload) Record(string) []string {
+	record := []string{"PORTFOLIO"}
+	if p.Strategy != "" {
+		record = []string{"STRATEGY", p.Strategy}
+	}
+	return append(record,
+		strconv.Itoa(p.OpenPositions), strconv.Itoa(p.ClosedPositions), helpers.ConvertFloatToString(p.Invested), helpers.ConvertFloatToString(p.Proceeds), helpers.ConvertFloatToString(p.Fees), helpers.ConvertFloatToString(p.Rent), helpers.ConvertFloatToString(p.RealizedPnL), helpers.ConvertFloatToString(p.UnrealizedPnL), helpers.ConvertFloatToString(p.PnL),
+	)
+}
+
+// TransitionPayload is a lifecycle change of a token.
+type TransitionPayload struct {
+	Name   string            `json:"name"`
+	Symbol string            `json:"symbol"`
+	From   models.TokenState `json:"from"`
+	To     models.TokenState `json:"to"`
+	Reason string            `json:"reason"`
+	Forced bool              `json:"forced"`
+	At     time.Time         `json:"at"`
+}
+
+func (p TransitionPayload) Type() EventType { return EventTransition }
+
+func (p TransitionPayload) Record(mint string) []string {
+	return []string{
+		"TRANSITION", mint, p.Name, p.Symbol, p.From.String(), p.To.String(), p.Reason, strconv.FormatBool(p.Forced), p.At.String(),
+	}
+}
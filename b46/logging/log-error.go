@@ -2,8 +2,17 @@ package logging
 
 import (
 	"log"
+	"sync/atomic"
 )
 
+var errorCount atomic.Uint64
+
 func PrintErrorToLog(errorDescription string, errorString interface{}) {
+	errorCount.Add(1)
 	log.Println(errorDescription, errorString.(string))
 }
+
+// ErrorCount returns how many errors have been logged since the process started.
+func ErrorCount() uint64 {
+	return errorCount.Load()
+}
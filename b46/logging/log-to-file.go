@@ -49,6 +49,18 @@ func InitLogSession() error {
 	return nil
 }
 
+// SessionDir returns the directory of the current logging session.
+func SessionDir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return currentSession
+}
+
+// LogDir returns the directory holding every session.
+func LogDir() string {
+	return logDir
+}
+
 // **Finds the next available session (e.g., session-0, session-1, session-2, ...)**
 func getNextSession() (string, error) {
 	files, err := os.ReadDir(logDir)
@@ -200,6 +212,10 @@ func CloseAllLoggers() {
 
 		logger.mutex.Unlock()
 	}
+
+	if err := sessionEvents.close(); err != nil {
+		PrintErrorToLog("Error close event log:		", err.Error())
+	}
 }
 
 // ClearFileLog empties the content of a given file.
@@ -255,3 +271,12 @@ func AnalysisInfosToString(infos []models.TokenAnalysis) string {
 
 	return sb.String()
 }
+
+// PrintTransitionToLog writes a token lifecycle transition to the event log and lifecycle.log.
+func PrintTransitionToLog(token models.MemeToken, transition models.Transition) {
+	if err := LogEvent("lifecycle.log", token.Mint.String(), TransitionPayload{
+		Name: token.Name, Symbol: token.Symbol, From: transition.From, To: transition.To, Reason: transition.Reason, Forced: transition.Forced, At: transition.Time,
+	}); err != nil {
+		PrintErrorToLog("logger write error:			", err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package reader
+
+import (
+	"b46/b46/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	memeInfoPattern      = regexp.MustCompile(`MemeInfo\{BondingState: (?:nil|BondingCurveState\{([^}]*)\}), TokenPrice: ([0-9.eE+-]+), MarketCap: ([0-9.eE+-]+)(?:, Time: ([^}]*))?\}`)
+	tokenAnalysisPattern = regexp.MustCompile(`TokenAnalysis\{([^}]*)\}`)
+)
+
+// parseMemeInfos reads a blob written by logging.MemeInfosToString. Snapshots logged
+// before their time was recorded have a zero Snapshot time.
+func parseMemeInfos(blob string) []models.MemeInfo {
+	var infos []models.MemeInfo
+	for _, match := range memeInfoPattern.FindAllStringSubmatch(blob, -1) {
+		var info models.MemeInfo
+		if match[1] != "" {
+			fields := parseFields(match[1])
+			info.BondingState = &models.BondingCurveState{
+				TokenTotalSupply:     parseUint(fields["CurrentSupply"]),
+				VirtualTokenReserves: parseUint(fields["VirtualTokenReserves"]),
+				RealTokenReserves:    parseUint(fields["RealTokenReserves"]),
+				VirtualSolReserves:   parseUint(fields["VirtualSolReserves"]),
+				RealSolReserves:      parseUint(fields["RealSolReserves"]),
+			}
+			// Completion was never logged, a curve is complete once its real tokens are sold.
+			info.BondingState.Complete = info.BondingState.RealTokenReserves == 0
+		}
+		info.TokenPrice = parseFloat(match[2])
+		info.MarketCap = parseFloat(match[3])
+		info.Snapshot, _ = parseLogTime(match[4])
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// parseAnalyses reads a blob written by logging.AnalysisInfosToString. Fields are matched
+// by name, so analyses written with fewer or more fields than today are read as well.
+func parseAnalyses(blob string) []models.TokenAnalysis {
+	var analyses []models.TokenAnalysis
+	for _, match := range tokenAnalysisPattern.FindAllStringSubmatch(blob, -1) {
+		fields := parseFields(match[1])
+		analysis := models.TokenAnalysis{
+			MarketCapSufficiency:   parseBool(fields["MarketCapSufficiency"]),
+			ReservesSufficiency:    parseBool(fields["ReservesSufficiency"]),
+			DataPoints:             int(parseUint(fields["DataPoints"])),
+			ReserveRatio:           parseFloat(fields["ReserveRatio"]),
+			SolReserveRatio:        parseFloat(fields["SolReserveRatio"]),
+			PriceStability:         parseBool(fields["PriceStability"]),
+			PriceConvergence:       parseFloat(fields["PriceConvergence"]),
+			SimpleMovingAverage:    parseFloat(fields["SimpleMovingAverage"]),
+			PercentageChange:       parseFloat(strings.TrimSuffix(fields["PercentageChange"], "%")),
+			PriceTrendSlope:        parseFloat(fields["PriceTrendSlope"]),
+			ConsistentlyTrendingUp: parseBool(fields["ConsistentlyTrendingUp"]),
+			Volatility:             parseFloat(fields["Volatility"]),
+			TheoreticalPrice:       parseFloat(fields["TheoreticalPrice"]),
+			CurrentPrice:           parseFloat(fields["CurrentPrice"]),
+			RiskRewardScore:        parseFloat(fields["RiskRewardScore"]),
+			Indicators: models.Indicators{
+				Samples:         int(parseUint(fields["Samples"])),
+				EMAFast:         parseFloat(fields["EMAFast"]),
+				EMASlow:         parseFloat(fields["EMASlow"]),
+				MACD:            parseFloat(fields["MACD"]),
+				MACDSignal:      parseFloat(fields["MACDSignal"]),
+				MACDHistogram:   parseFloat(fields["MACDHistogram"]),
+				RSI:             parseFloat(fields["RSI"]),
+				BollingerMiddle: parseFloat(fields["BollingerMiddle"]),
+				BollingerUpper:  parseFloat(fields["BollingerUpper"]),
+				BollingerLower:  parseFloat(fields["BollingerLower"]),
+				RateOfChange:    parseFloat(strings.TrimSuffix(fields["RateOfChange"], "%")),
+				Peak:            parseFloat(fields["Peak"]),
+				Drawdown:        parseFloat(strings.TrimSuffix(fields["Drawdown"], "%")),
+			},
+		}
+		analysis.Snapshot, _ = parseLogTime(fields["Time"])
+		analyses = append(analyses, analysis)
+	}
+	return analyses
+}
+
+// parseFields splits "Key: value, Key: value" into a map.
+func parseFields(body string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(body, ",") {
+		key, value, found := strings.Cut(field, ":")
+		if !found {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// parseLogTime reads a time written with time.Time.String, dropping the monotonic clock reading.
+func parseLogTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, " m="); i >= 0 {
+		value = value[:i]
+	}
+	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", value)
+}
+
+func parseUint(value string) uint64 {
+	parsed, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	return parsed
+}
+
+func parseFloat(value string) float64 {
+	parsed, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return parsed
+}
+
+func parseBool(value string) bool {
+	parsed, _ := strconv.ParseBool(strings.TrimSpace(value))
+	return parsed
+}
@@ -0,0 +1,175 @@
+package reader
+
+import (
+	"b46/b46/logging"
+	"b46/b46/models"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// eventLine is a line of the event log with its payload left undecoded until its type is known.
+type eventLine struct {
+	Schema  int               `json:"schema"`
+	Type    logging.EventType `json:"type"`
+	Mint    string            `json:"mint"`
+	Payload json.RawMessage   `json:"payload"`
+}
+
+// ReadEvents reads a JSON-lines event log into session. Tick events count the rounds like
+// the # rows of the CSV logs, lines that cannot be decoded or were written by a newer
+// schema are collected in Skipped.
+func ReadEvents(file string, session *Session) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Snapshot events repeat the token's whole history, lines can be long.
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	name := filepath.Base(file)
+	tick := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := Row{File: name, Line: line, Tick: tick}
+		var event eventLine
+		if err := json.Unmarshal([]byte(text), &event); err != nil {
+			session.Skipped = append(session.Skipped, SkippedRow{Row: row, Err: err})
+			continue
+		}
+		if event.Type == logging.EventTick {
+			tick++
+			continue
+		}
+		if err := session.addEvent(row, event); err != nil {
+			session.Skipped = append(session.Skipped, SkippedRow{Row: row, Kind: string(event.Type), Err: err})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return nil
+}
+
+// addEvent decodes the payload of event and appends it to the matching list.
+func (s *Session) addEvent(row Row, event eventLine) error {
+	if event.Schema > logging.SchemaVersion {
+		return fmt.Errorf("schema %d is newer than %d", event.Schema, logging.SchemaVersion)
+	}
+	switch event.Type {
+	case logging.EventMonitor, logging.EventTrading, logging.EventAdd, logging.EventRemove:
+		var payload logging.SnapshotPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		if len(payload.Snapshots) == 0 {
+			return fmt.Errorf("no snapshot in %s event", event.Type)
+		}
+		kind := snapshotKinds[event.Type]
+		if event.Type == logging.EventAdd || event.Type == logging.EventRemove {
+			s.Events = append(s.Events, EventRecord{
+				Row: row, Kind: kind, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol,
+				Time: payload.AddedTime, Snapshots: payload.Snapshots,
+			})
+			return nil
+		}
+		s.Snapshots = append(s.Snapshots, SnapshotRecord{
+			Row: row, Kind: kind, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol, Time: payload.AddedTime,
+			Snapshots: payload.Snapshots, Analyses: payload.Analyses, Trading: payload.Trading, Sold: payload.Sold,
+		})
+	case logging.EventTransition:
+		var payload logging.TransitionPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		s.Events = append(s.Events, EventRecord{
+			Row: row, Kind: KindTransition, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol, Time: payload.At,
+			From: payload.From, To: payload.To, Reason: payload.Reason, Forced: payload.Forced,
+		})
+	case logging.EventFill:
+		var payload logging.FillPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		s.Orders = append(s.Orders, OrderRecord{
+			Row: row, Outcome: payload.Side, Side: payload.Side, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol,
+			MarketCap: payload.MarketCap, Price: payload.Price, Reason: payload.Reason, Strategy: payload.Strategy,
+		})
+	case logging.EventOrderFailed:
+		var payload logging.OrderFailedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		s.Orders = append(s.Orders, OrderRecord{
+			Row: row, Outcome: payload.Outcome, Side: payload.Side, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol,
+			Attempt: payload.Attempt, Reason: payload.Error,
+		})
+	case logging.EventRejection:
+		var payload logging.RejectionPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		s.Orders = append(s.Orders, OrderRecord{
+			Row: row, Outcome: payload.Outcome, Side: payload.Side, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol,
+			Reason: payload.Reason, Strategy: payload.Strategy,
+		})
+	case logging.EventPosition:
+		var payload logging.PositionPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		s.Positions = append(s.Positions, PositionRecord{
+			Row: row, Mint: event.Mint, Name: payload.Name, Symbol: payload.Symbol, Strategy: payload.Strategy, Tokens: payload.Tokens,
+			EntryPrice: payload.EntryPrice, LastPrice: payload.LastPrice, CostBasis: payload.CostBasis,
+			RealizedPnL: payload.RealizedPnL, UnrealizedPnL: payload.UnrealizedPnL,
+		})
+	case logging.EventTotals:
+		var payload logging.TotalsPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		totals := TotalsRecord{Row: row, Strategy: payload.Strategy}
+		totals.OpenPositions = payload.OpenPositions
+		totals.ClosedPositions = payload.ClosedPositions
+		totals.Invested = payload.Invested
+		totals.Proceeds = payload.Proceeds
+		totals.Fees = payload.Fees
+		totals.Rent = payload.Rent
+		totals.Exposure = payload.Exposure
+		totals.RealizedPnL = payload.RealizedPnL
+		totals.UnrealizedPnL = payload.UnrealizedPnL
+		s.Totals = append(s.Totals, totals)
+	default:
+		return fmt.Errorf("unknown event type %q", event.Type)
+	}
+	return nil
+}
+
+// snapshotKinds maps the snapshot event types to the row kinds of the CSV logs.
+var snapshotKinds = map[logging.EventType]string{
+	logging.EventMonitor: KindMonitor,
+	logging.EventTrading: KindTrading,
+	logging.EventAdd:     KindAdd,
+	logging.EventRemove:  KindRemove,
+}
+
+// hasEvents reports whether dir holds an event log.
+func hasEvents(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, models.EventLogFile))
+	return err == nil
+}
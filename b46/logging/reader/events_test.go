@@ -0,0 +1,161 @@
+package reader
+
+import (
+	"b46/b46/logging"
+	"b46/b46/models"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// logSession writes a trading round through logging.LogEvent into the working directory,
+// which then holds both the event log and the CSV logs of the same events.
+func logSession(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, file := range SessionFiles {
+		if err := logging.InitLogger(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(logging.CloseAllLoggers)
+
+	at := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	token := models.MemeToken{
+		Mint:      solana.NewWallet().PublicKey(),
+		Name:      "Test",
+		Symbol:    "TST",
+		AddedTime: at.Add(10 * time.Second),
+		State:     models.StateCandidate,
+		Info: []models.MemeInfo{
+			{TokenPrice: 0.00000003, MarketCap: 30, Snapshot: at},
+			{BondingState: &models.BondingCurveState{VirtualTokenReserves: 1000, RealTokenReserves: 500, VirtualSolReserves: 30}, TokenPrice: 0.00000004, MarketCap: 40, Snapshot: at.Add(10 * time.Second)},
+		},
+		Analysis: []models.TokenAnalysis{{DataPoints: 2, PercentageChange: 33.3, Snapshot: at.Add(10 * time.Second)}},
+	}
+	mint := token.Mint.String()
+
+	events := []struct {
+		file    string
+		mint    string
+		payload logging.Payload
+	}{
+		{"monitor.log", "", logging.TickPayload{Loop: "monitor"}},
+		{"monitor.log", mint, logging.NewSnapshotPayload(logging.EventMonitor, token)},
+		{"monitor.log", mint, logging.NewSnapshotPayload(logging.EventAdd, token)},
+		{"trade.log", "", logging.TickPayload{Loop: "trading"}},
+		{"trade.log", mint, logging.NewSnapshotPayload(logging.EventTrading, token)},
+		{"lifecycle.log", mint, logging.TransitionPayload{Name: "Test", Symbol: "TST", From: models.StateCandidate, To: models.StateEntering, Reason: "entry", At: at.Add(11 * time.Second)}},
+		{"trades.log", mint, logging.OrderFailedPayload{Outcome: KindFailed, Side: "BUY", Name: "Test", Symbol: "TST", Attempt: 1, Error: "timeout"}},
+		{"trades.log", mint, logging.RejectionPayload{Outcome: "RISK REJECT", Side: "BUY", Name: "Test", Symbol: "TST", Reason: "max positions", Strategy: "kamikaze"}},
+		{"trades.log", mint, logging.FillPayload{Side: KindBuy, Name: "Test", Symbol: "TST", MarketCap: 40, Price: 0.00000004, Reason: "entry", Strategy: "kamikaze"}},
+		{"trade.log", mint, logging.PositionPayload{Name: "Test", Symbol: "TST", Strategy: "kamikaze", Tokens: 1000000, EntryPrice: 0.00000004, LastPrice: 0.00000005, CostBasis: 0.04, UnrealizedPnL: 0.01}},
+		{"trade.log", "", logging.TotalsPayload{Strategy: "kamikaze", OpenPositions: 1, Invested: 0.04, Exposure: 0.04, UnrealizedPnL: 0.01, PnL: 0.01}},
+		{"trade.log", "", logging.TotalsPayload{OpenPositions: 1, Invested: 0.04, Exposure: 0.04, UnrealizedPnL: 0.01, PnL: 0.01}},
+	}
+	for _, event := range events {
+		if err := logging.LogEvent(event.file, event.mint, event.payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logging.CloseAllLoggers()
+}
+
+func TestReadEvents(t *testing.T) {
+	logSession(t)
+
+	fromEvents, err := ReadSession(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromCSV := Session{}
+	for _, file := range SessionFiles {
+		if err := ReadFile(file, &fromCSV); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fromCSV.Analyses = collectAnalyses(fromCSV.Snapshots)
+
+	if len(fromEvents.Skipped) != 0 || len(fromCSV.Skipped) != 0 {
+		t.Fatalf("skipped %v from the event log and %v from the CSV logs", fromEvents.Skipped, fromCSV.Skipped)
+	}
+	if fromEvents.Snapshots[0].File != models.EventLogFile {
+		t.Errorf("session read from %s, want the event log", fromEvents.Snapshots[0].File)
+	}
+	if fromEvents.Snapshots[0].Tick != 1 || fromEvents.Snapshots[1].Tick != 2 {
+		t.Errorf("ticks %d and %d, want 1 and 2", fromEvents.Snapshots[0].Tick, fromEvents.Snapshots[1].Tick)
+	}
+
+	// Both logs describe the same events, the event log without the CSV rounding.
+	same := func(name string, events, csv any) {
+		if got, want := fmt.Sprintf("%+v", events), fmt.Sprintf("%+v", csv); got != want {
+			t.Errorf("%s differ:\nevents %s\ncsv    %s", name, got, want)
+		}
+	}
+	for _, session := range []*Session{&fromEvents, &fromCSV} {
+		for i := range session.Snapshots {
+			session.Snapshots[i].Row = Row{}
+		}
+		for i := range session.Events {
+			session.Events[i].Row = Row{}
+		}
+		for i := range session.Orders {
+			session.Orders[i].Row = Row{}
+		}
+		for i := range session.Positions {
+			session.Positions[i].Row = Row{}
+		}
+		for i := range session.Totals {
+			session.Totals[i].Row = Row{}
+			// Exposure is not a column of the CSV logs.
+			session.Totals[i].Exposure = 0
+		}
+	}
+	same("snapshots", fromEvents.Snapshots, fromCSV.Snapshots)
+	same("events", fromEvents.Events, fromCSV.Events)
+	same("analyses", fromEvents.Analyses, fromCSV.Analyses)
+	same("orders", fromEvents.Orders, fromCSV.Orders)
+	same("positions", fromEvents.Positions, fromCSV.Positions)
+	same("totals", fromEvents.Totals, fromCSV.Totals)
+
+	if len(fromEvents.Snapshots) != 2 || len(fromEvents.Events) != 2 || len(fromEvents.Orders) != 3 || len(fromEvents.Positions) != 1 || len(fromEvents.Totals) != 2 {
+		t.Errorf("read %d snapshots, %d events, %d orders, %d positions, %d totals",
+			len(fromEvents.Snapshots), len(fromEvents.Events), len(fromEvents.Orders), len(fromEvents.Positions), len(fromEvents.Totals))
+	}
+	if timelines := fromEvents.Timelines(); len(timelines) != 1 || len(timelines[0].Info) != 2 || len(timelines[0].Analysis) != 1 {
+		t.Errorf("timelines %v", timelines)
+	}
+}
+
+func TestReadEventsSkipsBadLines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), models.EventLogFile)
+	lines := `{"schema":1,"type":"tick","payload":{"loop":"trading"}}
+not json
+
+{"schema":99,"type":"fill","mint":"x","payload":{}}
+{"schema":1,"type":"teleport","payload":{}}
+{"schema":1,"type":"trading","mint":"x","payload":{"snapshots":[]}}
+{"schema":1,"type":"transition","mint":"x","payload":{"from":"HELD","to":"FLYING"}}
+{"schema":1,"type":"fill","mint":"x","payload":{"side":"SELL","reason":"exit"}}
+`
+	if err := os.WriteFile(file, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var session Session
+	if err := ReadEvents(file, &session); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Orders) != 1 || session.Orders[0].Line != 8 || session.Orders[0].Tick != 1 || session.Orders[0].Reason != "exit" {
+		t.Errorf("orders %+v", session.Orders)
+	}
+	var located []string
+	for _, skipped := range session.Skipped {
+		located = append(located, fmt.Sprintf("%d:%s", skipped.Line, skipped.Kind))
+	}
+	if got := fmt.Sprint(located); got != "[2: 4:fill 5:teleport 6:trading 7:transition]" {
+		t.Errorf("skipped %s", got)
+	}
+}
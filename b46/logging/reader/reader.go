@@ -0,0 +1,348 @@
+package reader
+
+import (
+	"b46/b46/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SessionFiles are the CSV logs a session directory may hold next to, or instead of, its
+// event log.
+var SessionFiles = []string{"monitor.log", "trade.log", "trades.log", "lifecycle.log"}
+
+// Session holds every record of a session directory, in file and row order.
+type Session struct {
+	Name string
+	Dir  string
+
+	Snapshots []SnapshotRecord
+	Events    []EventRecord
+	Analyses  []AnalysisRecord // every analysis once, grouped by mint in computation order
+	Orders    []OrderRecord
+	Positions []PositionRecord
+	Totals    []TotalsRecord
+	Skipped   []SkippedRow
+}
+
+// SessionDirs lists the session-N directories under root, in session order.
+func SessionDirs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+	}
+	var numbers []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "session-") {
+			continue
+		}
+		if number, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "session-")); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+
+	dirs := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		dirs = append(dirs, filepath.Join(root, fmt.Sprintf("session-%d", number)))
+	}
+	return dirs, nil
+}
+
+// ReadSession reads a session directory. Sessions with an event log are read from it,
+// older ones from their CSV logs, which only repeat the events when both were written.
+// Missing files are treated as empty, rows that cannot be parsed are collected in Skipped
+// instead of failing the session.
+func ReadSession(dir string) (Session, error) {
+	session := Session{Name: filepath.Base(dir), Dir: dir}
+	if hasEvents(dir) {
+		if err := ReadEvents(filepath.Join(dir, models.EventLogFile), &session); err != nil {
+			return session, err
+		}
+		session.Analyses = collectAnalyses(session.Snapshots)
+		return session, nil
+	}
+	for _, file := range SessionFiles {
+		if err := ReadFile(filepath.Join(dir, file), &session); err != nil {
+			return session, err
+		}
+	}
+	session.Analyses = collectAnalyses(session.Snapshots)
+	return session, nil
+}
+
+// ReadFile reads one session log into session. Rows are recognized by their kind rather
+// than by the file they are in, so renamed or merged logs are read as well.
+func ReadFile(file string, session *Session) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	name := filepath.Base(file)
+	tick := 0
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		line, _ := csvReader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				session.Skipped = append(session.Skipped, SkippedRow{Row: Row{File: name, Line: parseErr.StartLine, Tick: tick}, Err: err})
+				continue
+			}
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if len(record) == 0 {
+			continue
+		}
+		if record[0] == KindSeparator {
+			tick++
+			continue
+		}
+		row := Row{File: name, Line: line, Tick: tick}
+		if err := session.add(row, record); err != nil {
+			session.Skipped = append(session.Skipped, SkippedRow{Row: row, Kind: record[0], Err: err})
+		}
+	}
+}
+
+// add parses record and appends it to the matching list.
+func (s *Session) add(row Row, record []string) error {
+	switch record[0] {
+	case KindMonitor, KindTrading:
+		snapshot, err := parseSnapshot(row, record)
+		if err != nil {
+			return err
+		}
+		s.Snapshots = append(s.Snapshots, snapshot)
+	case KindAdd, KindRemove:
+		snapshot, err := parseSnapshot(row, record)
+		if err != nil {
+			return err
+		}
+		s.Events = append(s.Events, EventRecord{
+			Row: row, Kind: snapshot.Kind, Mint: snapshot.Mint, Name: snapshot.Name, Symbol: snapshot.Symbol,
+			Time: snapshot.Time, Snapshots: snapshot.Snapshots,
+		})
+	case KindTransition:
+		event, err := parseTransition(row, record)
+		if err != nil {
+			return err
+		}
+		s.Events = append(s.Events, event)
+	case KindPosition:
+		position, err := parsePosition(row, record)
+		if err != nil {
+			return err
+		}
+		s.Positions = append(s.Positions, position)
+	case KindPortfolio, KindStrategy:
+		totals, err := parseTotals(row, record)
+		if err != nil {
+			return err
+		}
+		s.Totals = append(s.Totals, totals)
+	default:
+		order, err := parseOrder(row, record)
+		if err != nil {
+			return err
+		}
+		s.Orders = append(s.Orders, order)
+	}
+	return nil
+}
+
+// parseSnapshot reads kind, mint, name, symbol, added time and snapshots, followed by the
+// trading flag for monitor rows, or by the analyses when logged and the trading and sold
+// flags for trading rows.
+func parseSnapshot(row Row, record []string) (SnapshotRecord, error) {
+	if len(record) < 6 {
+		return SnapshotRecord{}, fmt.Errorf("%s row has %d columns, expected at least 6", record[0], len(record))
+	}
+	addedTime, err := parseLogTime(record[4])
+	if err != nil {
+		return SnapshotRecord{}, fmt.Errorf("invalid added time: %w", err)
+	}
+	snapshot := SnapshotRecord{
+		Row:       row,
+		Kind:      record[0],
+		Mint:      record[1],
+		Name:      record[2],
+		Symbol:    record[3],
+		Time:      addedTime,
+		Snapshots: parseMemeInfos(record[5]),
+	}
+	if len(snapshot.Snapshots) == 0 {
+		return SnapshotRecord{}, fmt.Errorf("no snapshot in %s row", record[0])
+	}
+
+	flags := record[6:]
+	if len(flags) > 0 && strings.HasPrefix(flags[0], "[") {
+		snapshot.Analyses = parseAnalyses(flags[0])
+		flags = flags[1:]
+	}
+	if len(flags) > 0 {
+		snapshot.Trading = parseBool(flags[0])
+	}
+	if len(flags) > 1 {
+		snapshot.Sold = parseBool(flags[1])
+	}
+	return snapshot, nil
+}
+
+// parseTransition reads kind, mint, name, symbol, from, to, reason, forced and time.
+func parseTransition(row Row, record []string) (EventRecord, error) {
+	if len(record) < 9 {
+		return EventRecord{}, fmt.Errorf("TRANSITION row has %d columns, expected 9", len(record))
+	}
+	event := EventRecord{Row: row, Kind: KindTransition, Mint: record[1], Name: record[2], Symbol: record[3], Reason: record[6], Forced: parseBool(record[7])}
+	if err := event.From.UnmarshalText([]byte(record[4])); err != nil {
+		return EventRecord{}, err
+	}
+	if err := event.To.UnmarshalText([]byte(record[5])); err != nil {
+		return EventRecord{}, err
+	}
+	at, err := parseLogTime(record[8])
+	if err != nil {
+		return EventRecord{}, fmt.Errorf("invalid transition time: %w", err)
+	}
+	event.Time = at
+	return event, nil
+}
+
+// parseOrder reads the trades.log rows:
+//
+//	BUY|SELL, mint, name, symbol, reason                                   oldest sessions
+//	BUY|SELL, mint, name, symbol, market cap, price, reason[, strategy]
+//	FAILED|PRICE RAN AWAY, mint, name, symbol, side, attempt, error
+//	<rejection>, mint, name, symbol, side, reason[, strategy]
+func parseOrder(row Row, record []string) (OrderRecord, error) {
+	if len(record) < 5 {
+		return OrderRecord{}, fmt.Errorf("unknown %s row with %d columns", record[0], len(record))
+	}
+	order := OrderRecord{Row: row, Outcome: record[0], Mint: record[1], Name: record[2], Symbol: record[3]}
+	if _, err := solana.PublicKeyFromBase58(order.Mint); err != nil {
+		return OrderRecord{}, fmt.Errorf("unknown %s row: %w", record[0], err)
+	}
+
+	switch order.Outcome {
+	case KindBuy, KindSell:
+		order.Side = order.Outcome
+		if len(record) < 7 {
+			order.Reason = record[4]
+			break
+		}
+		order.MarketCap = parseFloat(record[4])
+		order.Price = parseFloat(record[5])
+		order.Reason = record[6]
+		if len(record) > 7 {
+			order.Strategy = record[7]
+		}
+	case KindFailed, KindRanAway:
+		if len(record) < 7 {
+			return OrderRecord{}, fmt.Errorf("%s row has %d columns, expected 7", order.Outcome, len(record))
+		}
+		order.Side = record[4]
+		order.Attempt, _ = strconv.Atoi(record[5])
+		order.Reason = record[6]
+	default:
+		if len(record) < 6 {
+			return OrderRecord{}, fmt.Errorf("%s row has %d columns, expected at least 6", order.Outcome, len(record))
+		}
+		order.Side = record[4]
+		order.Reason = record[5]
+		if len(record) > 6 {
+			order.Strategy = record[6]
+		}
+	}
+	return order, nil
+}
+
+// parsePosition reads mint, name, symbol, tokens, entry price, last price, cost basis,
+// realized and unrealized PnL and, since strategies are tracked, the strategy.
+func parsePosition(row Row, record []string) (PositionRecord, error) {
+	if len(record) < 10 {
+		return PositionRecord{}, fmt.Errorf("POSITION row has %d columns, expected at least 10", len(record))
+	}
+	position := PositionRecord{
+		Row:           row,
+		Mint:          record[1],
+		Name:          record[2],
+		Symbol:        record[3],
+		Tokens:        parseUint(record[4]),
+		EntryPrice:    parseFloat(record[5]),
+		LastPrice:     parseFloat(record[6]),
+		CostBasis:     parseFloat(record[7]),
+		RealizedPnL:   parseFloat(record[8]),
+		UnrealizedPnL: parseFloat(record[9]),
+	}
+	if len(record) > 10 {
+		position.Strategy = record[10]
+	}
+	return position, nil
+}
+
+// parseTotals reads PORTFOLIO rows and STRATEGY rows, which carry the strategy first.
+func parseTotals(row Row, record []string) (TotalsRecord, error) {
+	totals := TotalsRecord{Row: row}
+	values := record[1:]
+	if record[0] == KindStrategy && len(values) > 0 {
+		totals.Strategy = values[0]
+		values = values[1:]
+	}
+	if len(values) < 8 {
+		return TotalsRecord{}, fmt.Errorf("%s row has %d columns, expected at least %d", record[0], len(record), len(record)-len(values)+8)
+	}
+	totals.OpenPositions = int(parseUint(values[0]))
+	totals.ClosedPositions = int(parseUint(values[1]))
+	totals.Invested = parseFloat(values[2])
+	totals.Proceeds = parseFloat(values[3])
+	totals.Fees = parseFloat(values[4])
+	totals.Rent = parseFloat(values[5])
+	totals.RealizedPnL = parseFloat(values[6])
+	totals.UnrealizedPnL = parseFloat(values[7])
+	return totals, nil
+}
+
+// collectAnalyses keeps, for every mint, the analyses of its longest trading row, since
+// every row repeats the analyses logged before it.
+func collectAnalyses(snapshots []SnapshotRecord) []AnalysisRecord {
+	longest := make(map[string][]models.TokenAnalysis)
+	var mints []string
+	for _, snapshot := range snapshots {
+		if len(snapshot.Analyses) == 0 {
+			continue
+		}
+		if _, exists := longest[snapshot.Mint]; !exists {
+			mints = append(mints, snapshot.Mint)
+		}
+		if len(snapshot.Analyses) > len(longest[snapshot.Mint]) {
+			longest[snapshot.Mint] = snapshot.Analyses
+		}
+	}
+	var analyses []AnalysisRecord
+	for _, mint := range mints {
+		for i, analysis := range longest[mint] {
+			analyses = append(analyses, AnalysisRecord{Mint: mint, Index: i, Analysis: analysis})
+		}
+	}
+	return analyses
+}
@@ -0,0 +1,195 @@
+package reader
+
+import (
+	"b46/b46/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	mintA = "6nvjGZux8hkG5QFdEKBkCxBiBRMXCK9YubbgKg4hRhSp"
+	mintB = "HRrMEMPXwKurG2PS7MUstrUARK52T6NeqbLVzAeJn83v"
+)
+
+// writeLog writes content to file in a new session directory and returns the directory.
+func writeLog(t *testing.T, file, content string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "session-0")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReadOrders(t *testing.T) {
+	dir := writeLog(t, "trades.log", strings.Join([]string{
+		`BUY,` + mintA + `,Old,OLD,Entry market cap`,
+		`SELL,` + mintA + `,Old,OLD,4200.5,0.00000003,Take profit,kamikaze`,
+		`BUY,` + mintB + `,New,NEW,4000,0.00000002,Entry`,
+		`FAILED,` + mintB + `,New,NEW,SELL,2,timeout`,
+		`PRICE RAN AWAY,` + mintB + `,New,NEW,BUY,1,slippage`,
+		`RISK REJECT,` + mintB + `,New,NEW,BUY,max positions,kamikaze`,
+		`REJECT,` + mintB + `,New,NEW,BUY,duplicate`,
+		`BUY,not-a-mint,Bad,BAD,Entry`,
+		`FAILED,` + mintB + `,New,NEW,SELL`,
+		`GARBAGE`,
+	}, "\n")+"\n")
+
+	session, err := ReadSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OrderRecord{
+		{Outcome: KindBuy, Side: KindBuy, Mint: mintA, Name: "Old", Symbol: "OLD", Reason: "Entry market cap"},
+		{Outcome: KindSell, Side: KindSell, Mint: mintA, Name: "Old", Symbol: "OLD", MarketCap: 4200.5, Price: 0.00000003, Reason: "Take profit", Strategy: "kamikaze"},
+		{Outcome: KindBuy, Side: KindBuy, Mint: mintB, Name: "New", Symbol: "NEW", MarketCap: 4000, Price: 0.00000002, Reason: "Entry"},
+		{Outcome: KindFailed, Side: "SELL", Mint: mintB, Name: "New", Symbol: "NEW", Attempt: 2, Reason: "timeout"},
+		{Outcome: KindRanAway, Side: "BUY", Mint: mintB, Name: "New", Symbol: "NEW", Attempt: 1, Reason: "slippage"},
+		{Outcome: "RISK REJECT", Side: "BUY", Mint: mintB, Name: "New", Symbol: "NEW", Reason: "max positions", Strategy: "kamikaze"},
+		{Outcome: "REJECT", Side: "BUY", Mint: mintB, Name: "New", Symbol: "NEW", Reason: "duplicate"},
+	}
+	if len(session.Orders) != len(want) {
+		t.Fatalf("read %d orders, want %d: %+v", len(session.Orders), len(want), session.Orders)
+	}
+	for i, order := range session.Orders {
+		if order.Line != i+1 || order.File != "trades.log" {
+			t.Errorf("order %d located at %s:%d", i, order.File, order.Line)
+		}
+		order.Row = Row{}
+		if order != want[i] {
+			t.Errorf("order %d: %+v, want %+v", i, order, want[i])
+		}
+	}
+	if session.Orders[0].Filled() != true || session.Orders[3].Filled() {
+		t.Error("Filled does not match the outcome")
+	}
+
+	if len(session.Skipped) != 3 {
+		t.Fatalf("skipped %+v, want 3 rows", session.Skipped)
+	}
+	for i, kind := range []string{"BUY", "FAILED", "GARBAGE"} {
+		if skipped := session.Skipped[i]; skipped.Kind != kind || skipped.Line != 8+i || skipped.Err == nil {
+			t.Errorf("skipped %d: %+v, want a %s row at line %d", i, skipped, kind, 8+i)
+		}
+	}
+}
+
+func TestReadSnapshots(t *testing.T) {
+	dir := writeLog(t, "trade.log", strings.Join([]string{
+		`#,#,#,#,#,#,#,#,#,#,#,#,#`,
+		`MONITOR,` + mintA + `,Old,OLD,2025-02-20 17:20:13.626746 +0200 EET m=+8.708767576,"[`,
+		`  0: MemeInfo{BondingState: nil, TokenPrice: 0.00000000000000000000, MarketCap: 0.00}`,
+		`]",false`,
+		`#,#,#,#,#,#,#,#,#,#,#,#,#`,
+		`CURRENTLY TRADING,` + mintB + `,New,NEW,2025-03-01 10:00:20 +0000 UTC,"[`,
+		`  0: MemeInfo{BondingState: BondingCurveState{CurrentSupply: 1000000000000000, VirtualTokenReserves: 1000,  RealTokenReserves: 0,  VirtualSolReserves: 30,  RealSolReserves: 5}, TokenPrice: 0.00000003000000000000, MarketCap: 30.00, Time: 2025-03-01 10:00:10 +0000 UTC}`,
+		`  1: MemeInfo{BondingState: nil, TokenPrice: 0.00000004, MarketCap: 40.00, Time: 2025-03-01 10:00:20 +0000 UTC m=+3.5}`,
+		`]","[`,
+		`  0: TokenAnalysis{DataPoints: 2, PercentageChange: 33.3%, Volatility: 0.1, Unknown: x}`,
+		`]",true,false`,
+		`MONITOR,` + mintA + `,Empty,EMPTY,2025-02-20 17:20:13 +0200 EET,"[]",false`,
+		`MONITOR,` + mintA + `,Bad,BAD,yesterday,"[]",false`,
+		`TRANSITION,` + mintB + `,New,NEW,CANDIDATE,ENTERING,buy,false,2025-03-01 10:00:21 +0000 UTC`,
+		`TRANSITION,` + mintB + `,New,NEW,CANDIDATE,FLYING,buy,false,2025-03-01 10:00:21 +0000 UTC`,
+		`POSITION,` + mintB + `,New,NEW,1000000,0.00000003,0.00000004,0.03,0,0.01`,
+		`PORTFOLIO,1,0,0.03,0,0.0001,0.002,0,0.01,0.01`,
+		`STRATEGY,kamikaze,1,0,0.03,0,0.0001,0.002,0,0.01,0.01`,
+		`STRATEGY,kamikaze,1`,
+		`UNKNOWN,1,2`,
+	}, "\n")+"\n")
+
+	session, err := ReadSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Snapshots) != 2 {
+		t.Fatalf("read %d snapshots, want 2", len(session.Snapshots))
+	}
+	monitor, trading := session.Snapshots[0], session.Snapshots[1]
+	if monitor.Kind != KindMonitor || monitor.Tick != 1 || monitor.Trading || len(monitor.Snapshots) != 1 || monitor.Snapshots[0].BondingState != nil {
+		t.Errorf("monitor row %+v", monitor)
+	}
+	if trading.Kind != KindTrading || trading.Tick != 2 || !trading.Trading || trading.Sold {
+		t.Errorf("trading row %+v", trading)
+	}
+	if len(trading.Snapshots) != 2 || !trading.Snapshots[0].BondingState.Complete || trading.Snapshots[0].BondingState.VirtualSolReserves != 30 {
+		t.Errorf("trading snapshots %v", trading.Snapshots)
+	}
+	if want := time.Date(2025, 3, 1, 10, 0, 20, 0, time.UTC); !trading.Snapshots[1].Snapshot.Equal(want) || !trading.Time.Equal(want) {
+		t.Errorf("snapshot time %s, added time %s, want %s", trading.Snapshots[1].Snapshot, trading.Time, want)
+	}
+	if len(session.Analyses) != 1 || session.Analyses[0].Analysis.DataPoints != 2 || session.Analyses[0].Analysis.PercentageChange != 33.3 {
+		t.Errorf("analyses %+v", session.Analyses)
+	}
+
+	if len(session.Events) != 1 || session.Events[0].From != models.StateCandidate || session.Events[0].To != models.StateEntering {
+		t.Errorf("events %+v", session.Events)
+	}
+	if len(session.Positions) != 1 || session.Positions[0].Tokens != 1000000 || session.Positions[0].Strategy != "" {
+		t.Errorf("positions %+v", session.Positions)
+	}
+	if len(session.Totals) != 2 || session.Totals[0].Strategy != "" || session.Totals[1].Strategy != "kamikaze" || session.Totals[1].Invested != 0.03 {
+		t.Errorf("totals %+v", session.Totals)
+	}
+
+	var kinds []string
+	for _, skipped := range session.Skipped {
+		kinds = append(kinds, skipped.Kind)
+	}
+	if got := strings.Join(kinds, ","); got != "MONITOR,MONITOR,TRANSITION,STRATEGY,UNKNOWN" {
+		t.Errorf("skipped kinds %q", got)
+	}
+}
+
+// TestReadExampleSessions reads every session checked in under examples, which were
+// written by every format the bot has used so far.
+func TestReadExampleSessions(t *testing.T) {
+	dirs, err := SessionDirs(filepath.Join("..", "..", "..", "examples", "trade-sessions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no example session")
+	}
+	for _, dir := range dirs {
+		session, err := ReadSession(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, skipped := range session.Skipped {
+			t.Errorf("%s: skipped %s:%d %s: %v", session.Name, skipped.File, skipped.Line, skipped.Kind, skipped.Err)
+		}
+		for _, token := range session.Timelines() {
+			for i := 1; i < len(token.Info); i++ {
+				if token.Info[i].Snapshot.Before(token.Info[i-1].Snapshot) {
+					t.Errorf("%s: %s snapshot %d dated before the previous one", session.Name, token.Mint, i)
+				}
+			}
+			if token.Info[0].Snapshot.IsZero() || !token.AddedTime.Equal(token.Info[0].Snapshot) {
+				t.Errorf("%s: %s not dated", session.Name, token.Mint)
+			}
+		}
+	}
+}
+
+func TestSessionDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"session-10", "session-2", "session-x", "other"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs, err := SessionDirs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || filepath.Base(dirs[0]) != "session-2" || filepath.Base(dirs[1]) != "session-10" {
+		t.Errorf("dirs %v, want session-2 and session-10", dirs)
+	}
+}
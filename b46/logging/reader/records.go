@@ -0,0 +1,122 @@
+package reader
+
+import (
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"time"
+)
+
+// Row kinds, the first column of every session log row.
+const (
+	KindSeparator  = "#"
+	KindMonitor    = "MONITOR"
+	KindAdd        = "ADD"
+	KindRemove     = "REMOVE"
+	KindTrading    = "CURRENTLY TRADING"
+	KindPosition   = "POSITION"
+	KindPortfolio  = "PORTFOLIO"
+	KindStrategy   = "STRATEGY"
+	KindTransition = "TRANSITION"
+	KindBuy        = "BUY"
+	KindSell       = "SELL"
+	KindFailed     = "FAILED"
+	KindRanAway    = "PRICE RAN AWAY"
+)
+
+// Row locates a record in its log file. Tick counts the # separator rows written before
+// it, so records of the same monitor or trading round share a tick.
+type Row struct {
+	File string
+	Line int
+	Tick int
+}
+
+// SnapshotRecord is a MONITOR or CURRENTLY TRADING row: a token with its whole snapshot
+// history up to the round it was written in.
+type SnapshotRecord struct {
+	Row
+	Kind      string
+	Mint      string
+	Name      string
+	Symbol    string
+	Time      time.Time // the token's added time, set when its latest snapshot was stored
+	Snapshots []models.MemeInfo
+	Analyses  []models.TokenAnalysis // only logged by the trading loop, and not by the oldest sessions
+	Trading   bool
+	Sold      bool
+}
+
+// EventRecord is a change in a token's life: the monitor adding a token to the trades or
+// removing it (ADD, REMOVE), or a lifecycle transition (TRANSITION).
+type EventRecord struct {
+	Row
+	Kind      string
+	Mint      string
+	Name      string
+	Symbol    string
+	Time      time.Time
+	Snapshots []models.MemeInfo // ADD and REMOVE only
+
+	// TRANSITION only.
+	From   models.TokenState
+	To     models.TokenState
+	Reason string
+	Forced bool
+}
+
+// AnalysisRecord is one chart analysis of a traded token.
+type AnalysisRecord struct {
+	Mint     string
+	Index    int
+	Analysis models.TokenAnalysis
+}
+
+// OrderRecord is a trades.log row. Outcome is BUY or SELL for a filled order, otherwise
+// FAILED, PRICE RAN AWAY or the kind of rejection (REJECT, RISK REJECT, ...).
+type OrderRecord struct {
+	Row
+	Outcome   string
+	Side      string
+	Mint      string
+	Name      string
+	Symbol    string
+	MarketCap float64 // filled orders of recent sessions only
+	Price     float64 // filled orders of recent sessions only
+	Reason    string  // the order's reason, or why it failed or was rejected
+	Attempt   int     // failed orders only
+	Strategy  string
+}
+
+// Filled reports whether the order was confirmed.
+func (o OrderRecord) Filled() bool {
+	return o.Outcome == KindBuy || o.Outcome == KindSell
+}
+
+// PositionRecord is an open position as logged at the end of a trading round.
+type PositionRecord struct {
+	Row
+	Mint          string
+	Name          string
+	Symbol        string
+	Strategy      string
+	Tokens        uint64
+	EntryPrice    float64
+	LastPrice     float64
+	CostBasis     float64
+	RealizedPnL   float64
+	UnrealizedPnL float64
+}
+
+// TotalsRecord is a PORTFOLIO row, or a STRATEGY row with the totals of one strategy.
+type TotalsRecord struct {
+	Row
+	Strategy string // empty for the whole portfolio
+	portfolio.Totals
+}
+
+// SkippedRow is a row that could not be parsed.
+type SkippedRow struct {
+	Row
+	Kind string
+	Err  error
+}
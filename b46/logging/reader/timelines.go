@@ -0,0 +1,134 @@
+package reader
+
+import (
+	"b46/b46/models"
+	"github.com/gagliardetto/solana-go"
+	"sort"
+	"time"
+)
+
+// Timelines rebuilds every token of the session with its full snapshot history, oldest
+// token first. Every row repeats the token's history, so the longest one seen for a mint
+// is kept and the analyses of its longest trading row are attached.
+//
+// Older sessions did not log snapshot times, but a row's added time is set when its latest
+// snapshot was stored, which dates that snapshot. Those sessions also kept logging the
+// monitor's copy of a traded token, whose history diverged from the trading one, so
+// only rows whose history is a prefix of the kept one date their latest snapshot. The
+// snapshots no row dates are estimated from their neighbours and the monitor intervals.
+// AddedTime is the first snapshot's time.
+func (s Session) Timelines() []models.MemeToken {
+	longest := make(map[string]SnapshotRecord)
+	var records []SnapshotRecord
+
+	record := func(snapshot SnapshotRecord) {
+		records = append(records, snapshot)
+		if current, exists := longest[snapshot.Mint]; !exists || len(snapshot.Snapshots) > len(current.Snapshots) {
+			longest[snapshot.Mint] = snapshot
+		}
+	}
+	for _, snapshot := range s.Snapshots {
+		record(snapshot)
+	}
+	for _, event := range s.Events {
+		if len(event.Snapshots) > 0 {
+			record(SnapshotRecord{Mint: event.Mint, Name: event.Name, Symbol: event.Symbol, Time: event.Time, Snapshots: event.Snapshots})
+		}
+	}
+
+	dated := make(map[string]map[int]time.Time)
+	for _, snapshot := range records {
+		if !isPrefix(snapshot.Snapshots, longest[snapshot.Mint].Snapshots) {
+			continue
+		}
+		latest := len(snapshot.Snapshots) - 1
+		if dated[snapshot.Mint] == nil {
+			dated[snapshot.Mint] = make(map[int]time.Time)
+		}
+		if _, exists := dated[snapshot.Mint][latest]; !exists {
+			dated[snapshot.Mint][latest] = snapshot.Time
+		}
+	}
+
+	analyses := make(map[string][]models.TokenAnalysis)
+	for _, analysis := range s.Analyses {
+		analyses[analysis.Mint] = append(analyses[analysis.Mint], analysis.Analysis)
+	}
+
+	tokens := make([]models.MemeToken, 0, len(longest))
+	for key, snapshot := range longest {
+		mint, err := solana.PublicKeyFromBase58(key)
+		if err != nil {
+			continue
+		}
+		token := models.MemeToken{
+			Name:     snapshot.Name,
+			Symbol:   snapshot.Symbol,
+			Mint:     mint,
+			Info:     append([]models.MemeInfo(nil), snapshot.Snapshots...),
+			Analysis: analyses[key],
+			State:    models.StateDiscovered,
+		}
+		dateSnapshots(&token, dated[key])
+		token.AddedTime = token.Info[0].Snapshot
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].AddedTime.Before(tokens[j].AddedTime)
+	})
+	return tokens
+}
+
+// isPrefix reports whether history starts with snapshots.
+func isPrefix(snapshots, history []models.MemeInfo) bool {
+	if len(snapshots) > len(history) {
+		return false
+	}
+	for i := range snapshots {
+		if snapshots[i].String() != history[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// dateSnapshots fills in the snapshot times older sessions did not log, from the times
+// rows dated them with. Snapshots before the first dated one are spaced by the monitor
+// interval, the ones after a dated snapshot by the trading interval, or closer when the
+// next dated snapshot would come before them. Every row dates its latest snapshot, so at
+// least one snapshot is dated.
+func dateSnapshots(token *models.MemeToken, dated map[int]time.Time) {
+	var known []int
+	for i := range token.Info {
+		if token.Info[i].Snapshot.IsZero() {
+			token.Info[i].Snapshot = dated[i]
+		}
+		if token.Info[i].Snapshot.IsZero() {
+			continue
+		}
+		// Rows of diverged histories holding the same values can still date a snapshot
+		// out of order, such a date is dropped.
+		if len(known) > 0 && !token.Info[i].Snapshot.After(token.Info[known[len(known)-1]].Snapshot) {
+			token.Info[i].Snapshot = time.Time{}
+			continue
+		}
+		known = append(known, i)
+	}
+	if len(known) == 0 {
+		return
+	}
+	for i := known[0] - 1; i >= 0; i-- {
+		token.Info[i].Snapshot = token.Info[i+1].Snapshot.Add(-models.MONITOR_DURATION * time.Second)
+	}
+	for k, from := range known {
+		to := len(token.Info)
+		step := models.MONITOR_DURATION_TRADES * time.Second
+		if k+1 < len(known) {
+			to = known[k+1]
+			step = min(step, token.Info[to].Snapshot.Sub(token.Info[from].Snapshot)/time.Duration(to-from))
+		}
+		for i := from + 1; i < to; i++ {
+			token.Info[i].Snapshot = token.Info[i-1].Snapshot.Add(step)
+		}
+	}
+}
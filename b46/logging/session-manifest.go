@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"b46/b46/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Manifest describes what a session ran with and, once it has stopped, how it went. It is
+// written to session.json when the session starts and rewritten with the summary at
+// shutdown, so a session without EndTime did not shut down cleanly.
+type Manifest struct {
+	Schema    int        `json:"schema"`
+	Session   string     `json:"session"`
+	Revision  string     `json:"revision"`
+	Profile   string     `json:"profile"`
+	Wallet    string     `json:"wallet"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Config    any        `json:"config"`
+	Summary   *Summary   `json:"summary,omitempty"`
+}
+
+// Summary is the outcome of a session.
+type Summary struct {
+	TokensSeen     uint64  `json:"tokens_seen"`
+	TokensPromoted uint64  `json:"tokens_promoted"`
+	Orders         uint64  `json:"orders"`
+	Fills          uint64  `json:"fills"`
+	FailedOrders   uint64  `json:"failed_orders"`
+	RejectedOrders uint64  `json:"rejected_orders"`
+	OpenPositions  int     `json:"open_positions"`
+	Invested       float64 `json:"invested"`
+	Proceeds       float64 `json:"proceeds"`
+	Fees           float64 `json:"fees"`
+	RealizedPnL    float64 `json:"realized_pnl"`
+	UnrealizedPnL  float64 `json:"unrealized_pnl"`
+	PnL            float64 `json:"pnl"`
+	Errors         uint64  `json:"errors"`
+}
+
+// NewManifest starts the manifest of the current session.
+func NewManifest(profile, wallet string, config any) Manifest {
+	return Manifest{
+		Schema:    SchemaVersion,
+		Session:   filepath.Base(SessionDir()),
+		Revision:  Revision(),
+		Profile:   profile,
+		Wallet:    wallet,
+		StartTime: models.Now(),
+		Config:    config,
+	}
+}
+
+// WriteManifest writes manifest to session.json in the current session, replacing the
+// previous one in a single rename so a crash never leaves half a manifest behind.
+func WriteManifest(manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session manifest: %w", err)
+	}
+	filename := filepath.Join(SessionDir(), models.SessionManifestFile)
+	if err := os.WriteFile(filename+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write session manifest: %w", err)
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("failed to replace session manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads the session.json of a session directory. Config is decoded into
+// generic maps, since it holds whatever the session was configured with.
+func ReadManifest(dir string) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(filepath.Join(dir, models.SessionManifestFile))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to decode session manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Revision returns the git revision the binary was built from, marked "-dirty" when the
+// tree had local changes. Binaries built without VCS information, e.g. by go run, ask git.
+func Revision() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		var revision, modified string
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value
+			}
+		}
+		if revision != "" {
+			if modified == "true" {
+				revision += "-dirty"
+			}
+			return revision
+		}
+	}
+	output, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(output))
+}
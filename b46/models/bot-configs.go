@@ -6,6 +6,8 @@ const (
 	Slippage                = 0.3
 	TOKEN_DECIMALS          = 6
 	PriorityFeeLamport      = 50000
+	EstimatedTxFeeLamports  = 15000 // base fee plus priority fee at the default compute limit
+	PumpFeeBasisPoints      = 100   // pump.fun trading fee charged on the SOL side of every trade
 	MONITOR_DURATION        = 30
 	MONITOR_DURATION_TRADES = 15
 	History                 = 10
@@ -23,6 +25,29 @@ const (
 	PositionAmount = 0.004
 )
 
+const (
+	MinWalletBalanceSOL    = 0.01    // SOL a buy may never dip the wallet below
+	AtaRentLamports        = 2039280 // rent exempt minimum of a token account
+	BalanceRefreshInterval = 10      // seconds between polls while the account subscription is down
+)
+
+const (
+	MaxOpenPositions      = 5
+	MaxExposureSOL        = 0.02
+	MaxCreatorExposureSOL = 0.008
+	DailyLossLimitSOL     = 0.01
+	SessionBudgetSOL      = 0.05
+	MinPositionAmount     = 0.001
+)
+
+const (
+	MaxOrderRetries   = 3
+	OrderRetryBackoff = 5 // seconds, doubled on every attempt
+	OrderQueueSize    = 100
+	OrderWorkers      = 2
+	OrderTimeout      = 60 // seconds
+)
+
 const (
 	EntryMarketCap  = 35.00
 	MinEntryHistory = 2
@@ -35,7 +60,47 @@ const (
 	ExitMarketCap = 45
 )
 
+// Periods of the streaming indicators, counted in priced snapshots.
+const (
+	EMAFastPeriod      = 12
+	EMASlowPeriod      = 26
+	MACDSignalPeriod   = 9
+	RSIPeriod          = 14
+	BollingerPeriod    = 20
+	BollingerWidth     = 2.0 // standard deviations between the middle and the outer bands
+	RateOfChangePeriod = 10
+)
+
+const (
+	// MaxPriceDrift bounds how far a requoted price may move from the price the
+	// order was decided on before the order is aborted.
+	MaxPriceDrift = 0.15
+)
+
+const (
+	StateStoreFile         = "state.db"
+	StoreFlushInterval     = 5  // seconds between two writes of the changed tokens
+	PersistedHistory       = 30 // snapshots of every token kept in the state store
+	KillSwitchStateFile    = "kill-switch.json"
+	KillSwitchPollInterval = 2 // seconds
+)
+
+const (
+	EventLogFile = "events.jsonl"
+	EventLogCSV  = true // also write every event to its CSV log
+
+	SessionManifestFile = "session.json"
+
+	StreamCaptureFile = "stream.jsonl.gz"
+	RecordStream      = true // capture the raw pump.fun websocket frames of every session
+)
+
 const (
 	TOKEN_EXISTS    = "TOKEN ALREADY EXISTS IN ACCOUNT"
 	NO_TOKEN_EXISTS = "TOKEN DOES NOT EXIST IN ACCOUNT"
 )
+
+const (
+	DefaultStrategy     = "kamikaze" // used when STRATEGY is not set
+	StrategyEventBuffer = 1024
+)
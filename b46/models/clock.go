@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the engine what time it is and wakes it up. The engine, the token maps and
+// the chart analysis read the time through Now and friends below, so they run unmodified
+// on the wall clock or on a SimulatedClock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker delivers ticks on C until it is stopped, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer runs a function once, like the time.Timer of time.AfterFunc.
+type Timer interface {
+	Stop() bool
+}
+
+var (
+	clockMutex sync.RWMutex
+	clock      Clock = SystemClock{}
+)
+
+// SetClock replaces the clock, before the engine is started.
+func SetClock(c Clock) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	clock = c
+}
+
+// CurrentClock returns the clock in use.
+func CurrentClock() Clock {
+	clockMutex.RLock()
+	defer clockMutex.RUnlock()
+	return clock
+}
+
+// Now returns the current time of the clock in use.
+func Now() time.Time {
+	return CurrentClock().Now()
+}
+
+// NewTicker starts a ticker on the clock in use.
+func NewTicker(d time.Duration) Ticker {
+	return CurrentClock().NewTicker(d)
+}
+
+// AfterFunc calls f once d has passed on the clock in use, in its own goroutine on the
+// wall clock and from Advance on a SimulatedClock.
+func AfterFunc(d time.Duration, f func()) Timer {
+	return CurrentClock().AfterFunc(d, f)
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+func (SystemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.ticker.C }
+func (t systemTicker) Stop()               { t.ticker.Stop() }
+
+// SimulatedClock is a clock that only moves when told to, by Advance or by Run at a
+// multiple of the wall clock. Tickers and timers due within an advance fire in time
+// order, with the clock set to their due time.
+type SimulatedClock struct {
+	advancing sync.Mutex // one Advance at a time
+	mutex     sync.Mutex
+	now       time.Time
+	wakers    []*simulatedWaker
+}
+
+// simulatedWaker is a pending ticker or timer.
+type simulatedWaker struct {
+	clock  *SimulatedClock
+	due    time.Time
+	period time.Duration // 0 for timers
+	ticks  chan time.Time
+	f      func()
+}
+
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	return &SimulatedClock{now: start}
+}
+
+func (c *SimulatedClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for SimulatedClock.NewTicker")
+	}
+	return simulatedTicker{c.schedule(&simulatedWaker{period: d, ticks: make(chan time.Time, 1)}, d)}
+}
+
+func (c *SimulatedClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.schedule(&simulatedWaker{f: f}, d)
+}
+
+func (c *SimulatedClock) schedule(waker *simulatedWaker, d time.Duration) *simulatedWaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	waker.clock = c
+	waker.due = c.now.Add(d)
+	c.wakers = append(c.wakers, waker)
+	return waker
+}
+
+// Advance moves the clock forward by d, firing every ticker and timer due on the way.
+// Timer functions run before Advance returns, with the clock at their due time, so they
+// may read the clock and schedule new timers but must not call Advance themselves.
+// Like time.Ticker, a ticker whose last tick has not been received drops the next one.
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.advancing.Lock()
+	defer c.advancing.Unlock()
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.wakers, func(i, j int) bool {
+			return c.wakers[i].due.Before(c.wakers[j].due)
+		})
+		if len(c.wakers) == 0 || c.wakers[0].due.After(target) {
+			break
+		}
+		waker := c.wakers[0]
+		c.now = waker.due
+		if waker.period > 0 {
+			waker.due = waker.due.Add(waker.period)
+			select {
+			case waker.ticks <- c.now:
+			default:
+			}
+			continue
+		}
+		c.wakers = c.wakers[1:]
+		c.mutex.Unlock()
+		waker.f()
+		c.mutex.Lock()
+	}
+	c.now = target
+	c.mutex.Unlock()
+}
+
+// Run advances the clock by step every step/speed of wall time until ctx is canceled,
+// so a speed of 10 runs ten simulated seconds per second.
+func (c *SimulatedClock) Run(ctx context.Context, step time.Duration, speed float64) {
+	ticker := time.NewTicker(time.Duration(float64(step) / speed))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Advance(step)
+		}
+	}
+}
+
+// remove drops waker from the pending ones and reports whether it was pending.
+func (c *SimulatedClock) remove(waker *simulatedWaker) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, pending := range c.wakers {
+		if pending == waker {
+			c.wakers = append(c.wakers[:i], c.wakers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *simulatedWaker) Stop() bool { return w.clock.remove(w) }
+
+type simulatedTicker struct {
+	*simulatedWaker
+}
+
+func (t simulatedTicker) C() <-chan time.Time { return t.ticks }
+func (t simulatedTicker) Stop()               { t.clock.remove(t.simulatedWaker) }
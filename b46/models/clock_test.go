@@ -0,0 +1,115 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSimulatedClockRunsTimersInOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		timers  []time.Duration
+		stopped []int // indexes of timers stopped before advancing
+		advance time.Duration
+		want    []time.Duration // due times seen by the timers that fired, in firing order
+	}{
+		{"in due order", []time.Duration{3 * time.Second, time.Second, 2 * time.Second}, nil, 5 * time.Second, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{"only the due ones", []time.Duration{time.Second, 10 * time.Second}, nil, 5 * time.Second, []time.Duration{time.Second}},
+		{"due at the target", []time.Duration{5 * time.Second}, nil, 5 * time.Second, []time.Duration{5 * time.Second}},
+		{"stopped", []time.Duration{time.Second, 2 * time.Second}, []int{0}, 5 * time.Second, []time.Duration{2 * time.Second}},
+		{"none", nil, nil, 5 * time.Second, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := NewSimulatedClock(epoch)
+			var fired []time.Duration
+			var timers []Timer
+			for _, d := range test.timers {
+				timers = append(timers, clock.AfterFunc(d, func() {
+					fired = append(fired, clock.Now().Sub(epoch))
+				}))
+			}
+			for _, i := range test.stopped {
+				if !timers[i].Stop() {
+					t.Fatalf("Stop() of pending timer %d = false", i)
+				}
+			}
+			clock.Advance(test.advance)
+			if !reflect.DeepEqual(fired, test.want) {
+				t.Errorf("timers fired at %v, want %v", fired, test.want)
+			}
+			if now := clock.Now(); !now.Equal(epoch.Add(test.advance)) {
+				t.Errorf("Now() = %v after Advance, want %v", now, epoch.Add(test.advance))
+			}
+		})
+	}
+}
+
+func TestSimulatedClockTimerSchedulesTimer(t *testing.T) {
+	clock := NewSimulatedClock(epoch)
+	var fired []time.Duration
+	var retry func()
+	retry = func() {
+		fired = append(fired, clock.Now().Sub(epoch))
+		if len(fired) < 3 {
+			clock.AfterFunc(time.Duration(len(fired))*time.Second, retry)
+		}
+	}
+	clock.AfterFunc(time.Second, retry)
+
+	clock.Advance(3 * time.Second)
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(fired, want) {
+		t.Fatalf("retries fired at %v, want %v", fired, want)
+	}
+	clock.Advance(time.Second)
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !reflect.DeepEqual(fired, want) {
+		t.Fatalf("retries fired at %v, want %v", fired, want)
+	}
+}
+
+func TestSimulatedClockTicker(t *testing.T) {
+	clock := NewSimulatedClock(epoch)
+	ticker := clock.NewTicker(time.Second)
+
+	clock.Advance(3 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if want := epoch.Add(time.Second); !tick.Equal(want) {
+			t.Errorf("kept tick = %v, want the first unreceived one %v", tick, want)
+		}
+	default:
+		t.Fatal("no tick after advancing past the interval")
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("unexpected second tick %v, ticks are dropped while one is pending", tick)
+	default:
+	}
+
+	ticker.Stop()
+	clock.Advance(3 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("tick %v after Stop", tick)
+	default:
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	clock := NewSimulatedClock(epoch)
+	SetClock(clock)
+	t.Cleanup(func() { SetClock(SystemClock{}) })
+
+	if now := Now(); !now.Equal(epoch) {
+		t.Fatalf("Now() = %v, want %v", now, epoch)
+	}
+	fired := false
+	AfterFunc(time.Minute, func() { fired = true })
+	clock.Advance(time.Minute)
+	if !fired {
+		t.Fatal("AfterFunc did not fire by the end of Advance")
+	}
+}
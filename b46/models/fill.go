@@ -0,0 +1,34 @@
+package models
+
+import (
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"time"
+)
+
+const (
+	FillSideBuy  = "BUY"
+	FillSideSell = "SELL"
+)
+
+// Fill is the confirmed result of an order as it landed on chain.
+type Fill struct {
+	Mint         solana.PublicKey
+	Side         string
+	TokenAmount  uint64  // raw token units moved by the order
+	SolLamports  uint64  // SOL spent by a buy or received by a sell, fees excluded
+	FeeLamports  uint64  // network and priority fees paid by the order
+	RentLamports uint64  // rent paid for accounts created by the order (e.g. the ATA)
+	Price        float64 // effective SOL price per token
+	Signature    solana.Signature
+	Time         time.Time
+	Simulated    bool   // true when the fill was produced without sending a transaction
+	Strategy     string // strategy whose order produced the fill
+}
+
+func (f Fill) String() string {
+	return fmt.Sprintf(
+		"Fill{Side: %s, Mint: %s, Strategy: %s, Tokens: %d, Sol: %d, Fee: %d, Rent: %d, Price: %.20f, Simulated: %t, Signature: %s, Time: %s}",
+		f.Side, f.Mint, f.Strategy, f.TokenAmount, f.SolLamports, f.FeeLamports, f.RentLamports, f.Price, f.Simulated, f.Signature, f.Time,
+	)
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// TokenState is the lifecycle stage of a token, from its creation on pump.fun until the
+// bot is done with it. PumpMemes holds tokens up to Candidate, from there on TradesMap
+// owns the token and drives it through the order states.
+type TokenState int
+
+const (
+	StateDiscovered TokenState = iota // seen by the listener, no snapshot yet
+	StateWatching                     // snapshotted by MonitorMemes
+	StateCandidate                    // passed the entry rules, moved to TradesMap
+	StateEntering                     // buy order in flight
+	StateHeld                         // buy confirmed, position open
+	StateExiting                      // sell order in flight
+	StateClosed                       // sell confirmed
+	StateMigrated                     // bonding curve complete, no longer tradable on pump.fun
+	StateRejected                     // dropped by the entry rules
+)
+
+var tokenStateNames = map[TokenState]string{
+	StateDiscovered: "DISCOVERED",
+	StateWatching:   "WATCHING",
+	StateCandidate:  "CANDIDATE",
+	StateEntering:   "ENTERING",
+	StateHeld:       "HELD",
+	StateExiting:    "EXITING",
+	StateClosed:     "CLOSED",
+	StateMigrated:   "MIGRATED",
+	StateRejected:   "REJECTED",
+}
+
+func (s TokenState) String() string {
+	if name, exists := tokenStateNames[s]; exists {
+		return name
+	}
+	return fmt.Sprintf("TokenState(%d)", int(s))
+}
+
+func (s TokenState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *TokenState) UnmarshalText(text []byte) error {
+	for state, name := range tokenStateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token state %q", text)
+}
+
+// transitions lists the states every state may move to. A failed buy or sell moves the
+// token back to where the order started.
+var transitions = map[TokenState][]TokenState{
+	StateDiscovered: {StateWatching, StateRejected, StateMigrated},
+	StateWatching:   {StateCandidate, StateRejected, StateMigrated},
+	StateCandidate:  {StateEntering, StateRejected, StateMigrated},
+	StateEntering:   {StateHeld, StateCandidate, StateMigrated},
+	StateHeld:       {StateExiting, StateMigrated},
+	StateExiting:    {StateClosed, StateHeld, StateMigrated},
+}
+
+// CanTransition reports whether a token may move from s to next.
+func (s TokenState) CanTransition(next TokenState) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal reports whether no further transition is possible.
+func (s TokenState) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Ordered reports whether s is reached through an order: an order in flight, or the
+// position it opened or closed.
+func (s TokenState) Ordered() bool {
+	switch s {
+	case StateEntering, StateHeld, StateExiting, StateClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Transition records one lifecycle change of a token.
+type Transition struct {
+	From   TokenState
+	To     TokenState
+	Reason string
+	Time   time.Time
+	Forced bool // set when the state was restored rather than reached through a valid transition
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("Transition{%s -> %s, Reason: %s, Forced: %t, Time: %s}", t.From, t.To, t.Reason, t.Forced, t.Time)
+}
+
+// Transition moves the token to next at the time of the clock in use, or fails without
+// changes if the move is not allowed.
+func (meme *MemeToken) Transition(next TokenState, reason string) (Transition, error) {
+	return meme.TransitionAt(next, reason, Now())
+}
+
+// TransitionAt is Transition at a given time. Runs on their own clock, e.g. backtests
+// replayed side by side, date transitions with it instead of the clock in use.
+func (meme *MemeToken) TransitionAt(next TokenState, reason string, at time.Time) (Transition, error) {
+	if !meme.State.CanTransition(next) {
+		return Transition{}, fmt.Errorf("invalid transition for %s: %s -> %s (%s)", meme.Mint.String(), meme.State, next, reason)
+	}
+	return meme.setState(next, reason, false, at), nil
+}
+
+// ForceState moves the token to state regardless of the transition rules. It is used to
+// restore tokens whose state is known from outside the lifecycle, e.g. wallet holdings.
+func (meme *MemeToken) ForceState(state TokenState, reason string) Transition {
+	return meme.setState(state, reason, true, Now())
+}
+
+// setState records the transition and keeps the legacy Trading, Sold and Migrated flags
+// in line with the state: Trading is set once a position has been bought.
+func (meme *MemeToken) setState(state TokenState, reason string, forced bool, at time.Time) Transition {
+	transition := Transition{From: meme.State, To: state, Reason: reason, Time: at, Forced: forced}
+	meme.State = state
+	meme.Transitions = append(meme.Transitions, transition)
+	meme.Trading = state == StateHeld || state == StateExiting || state == StateClosed
+	meme.Sold = state == StateClosed
+	meme.Migrated = state == StateMigrated
+	return transition
+}
+
+// inferState gives tokens saved before the lifecycle existed a state from their flags.
+func (meme *MemeToken) inferState(bucket string) {
+	if meme.State != StateDiscovered || len(meme.Transitions) > 0 {
+		return
+	}
+	switch {
+	case meme.Migrated:
+		meme.ForceState(StateMigrated, "inferred from flags")
+	case bucket == TradesBucket && meme.Sold:
+		meme.ForceState(StateClosed, "inferred from flags")
+	case bucket == TradesBucket && meme.Trading:
+		meme.ForceState(StateHeld, "inferred from flags")
+	case bucket == TradesBucket, meme.Trading:
+		meme.ForceState(StateCandidate, "inferred from flags")
+	case len(meme.Info) > 0:
+		meme.ForceState(StateWatching, "inferred from flags")
+	}
+}
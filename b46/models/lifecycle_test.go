@@ -0,0 +1,141 @@
+package models
+
+import (
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	states := []TokenState{
+		StateDiscovered, StateWatching, StateCandidate, StateEntering, StateHeld,
+		StateExiting, StateClosed, StateMigrated, StateRejected,
+	}
+	allowed := map[TokenState][]TokenState{
+		StateDiscovered: {StateWatching, StateRejected, StateMigrated},
+		StateWatching:   {StateCandidate, StateRejected, StateMigrated},
+		StateCandidate:  {StateEntering, StateRejected, StateMigrated},
+		StateEntering:   {StateHeld, StateCandidate, StateMigrated},
+		StateHeld:       {StateExiting, StateMigrated},
+		StateExiting:    {StateClosed, StateHeld, StateMigrated},
+	}
+
+	for _, from := range states {
+		for _, to := range states {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			if got := from.CanTransition(to); got != want {
+				t.Errorf("%s -> %s allowed: %t, want %t", from, to, got, want)
+			}
+
+			token := MemeToken{State: from}
+			_, err := token.Transition(to, "test")
+			if (err == nil) != want {
+				t.Errorf("%s -> %s: error %v", from, to, err)
+			}
+			if err != nil && (token.State != from || len(token.Transitions) != 0) {
+				t.Errorf("%s -> %s: rejected transition changed the token to %s", from, to, token.State)
+			}
+		}
+		if terminal := len(allowed[from]) == 0; from.Terminal() != terminal {
+			t.Errorf("%s terminal: %t, want %t", from, from.Terminal(), terminal)
+		}
+	}
+}
+
+func TestTransitionFlags(t *testing.T) {
+	tests := []struct {
+		path                    []TokenState
+		trading, sold, migrated bool
+	}{
+		{path: []TokenState{StateWatching, StateCandidate}},
+		{path: []TokenState{StateWatching, StateCandidate, StateEntering, StateHeld}, trading: true},
+		{path: []TokenState{StateWatching, StateCandidate, StateEntering, StateHeld, StateExiting, StateClosed}, trading: true, sold: true},
+		{path: []TokenState{StateWatching, StateCandidate, StateEntering, StateHeld, StateMigrated}, migrated: true},
+		{path: []TokenState{StateWatching, StateCandidate, StateEntering, StateCandidate}},
+	}
+	for _, test := range tests {
+		token := MemeToken{}
+		for _, next := range test.path {
+			if _, err := token.Transition(next, "test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if token.Trading != test.trading || token.Sold != test.sold || token.Migrated != test.migrated {
+			t.Errorf("%v: Trading %t Sold %t Migrated %t, want %t %t %t",
+				test.path, token.Trading, token.Sold, token.Migrated, test.trading, test.sold, test.migrated)
+		}
+		if len(token.Transitions) != len(test.path) || token.Transitions[len(token.Transitions)-1].To != token.State {
+			t.Errorf("%v: transitions %v", test.path, token.Transitions)
+		}
+	}
+}
+
+func TestAddSnapshot(t *testing.T) {
+	InitializePumpMemes()
+	complete := MemeInfo{BondingState: &BondingCurveState{Complete: true}, TokenPrice: 2}
+
+	tests := []struct {
+		state    TokenState
+		info     MemeInfo
+		want     TokenState
+		migrated bool
+	}{
+		{state: StateCandidate, info: MemeInfo{TokenPrice: 1}, want: StateCandidate},
+		{state: StateHeld, info: MemeInfo{TokenPrice: 1}, want: StateHeld},
+		{state: StateCandidate, info: complete, want: StateMigrated, migrated: true},
+		{state: StateHeld, info: complete, want: StateMigrated, migrated: true},
+		{state: StateEntering, info: complete, want: StateEntering},
+		{state: StateExiting, info: complete, want: StateExiting},
+		{state: StateClosed, info: complete, want: StateClosed},
+	}
+	for _, test := range tests {
+		token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: test.state, Info: []MemeInfo{{TokenPrice: 0.5}}}
+		key := token.Mint.String()
+		TradesMap.SetToken(token)
+
+		updated, migrated, err := TradesMap.AddSnapshot(key, test.info, TokenAnalysis{DataPoints: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := TradesMap.Get(key)
+		if updated.State != test.want || stored.State != test.want {
+			t.Errorf("%s: state %s, stored %s, want %s", test.state, updated.State, stored.State, test.want)
+		}
+		if (migrated != nil) != test.migrated {
+			t.Errorf("%s: migrated %v, want %t", test.state, migrated, test.migrated)
+		}
+		if migrated != nil && (migrated.From != test.state || migrated.To != StateMigrated) {
+			t.Errorf("%s: transition %s", test.state, migrated)
+		}
+		if len(stored.Info) != 2 || stored.Info[1].TokenPrice != test.info.TokenPrice || len(stored.Analysis) != 1 {
+			t.Errorf("%s: stored %d snapshots and %d analyses", test.state, len(stored.Info), len(stored.Analysis))
+		}
+	}
+
+	if _, _, err := TradesMap.AddSnapshot("unknown", MemeInfo{}, TokenAnalysis{}); err == nil {
+		t.Error("snapshot added to an untracked token")
+	}
+}
+
+// TestAddSnapshotKeepsTraderState checks that a transition made by the trader between
+// reading a token and adding its snapshot is not overwritten.
+func TestAddSnapshotKeepsTraderState(t *testing.T) {
+	InitializePumpMemes()
+	token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: StateCandidate}
+	key := token.Mint.String()
+	TradesMap.SetToken(token)
+
+	polled, _ := TradesMap.Get(key)
+	if _, err := TradesMap.Transition(key, StateEntering, "buy"); err != nil {
+		t.Fatal(err)
+	}
+	updated, _, err := TradesMap.AddSnapshot(key, MemeInfo{TokenPrice: 1}, TokenAnalysis{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polled.State != StateCandidate || updated.State != StateEntering || len(updated.Transitions) != 1 {
+		t.Errorf("state %s with %d transitions, want %s with 1", updated.State, len(updated.Transitions), StateEntering)
+	}
+}
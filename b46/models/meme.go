@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"github.com/gagliardetto/solana-go"
+	"log"
 	"sync"
 	"time"
 )
@@ -21,6 +22,13 @@ type MemeToken struct {
 	Migrated        bool
 	Trading         bool
 	Sold            bool
+
+	// State is the lifecycle stage, the flags above follow it. See Transition.
+	State       TokenState
+	Transitions []Transition
+
+	// Strategy is the strategy that promoted the token, it alone decides its orders.
+	Strategy string
 }
 type MemeInfo struct {
 	BondingState *BondingCurveState
@@ -54,6 +62,43 @@ type TokenAnalysis struct {
 	CurrentPrice     float64 // current observed token price (or last snapshot price)
 	RiskRewardScore  float64 // a normalized score (e.g., discount divided by volatility)
 	Snapshot         time.Time
+
+	// Streaming indicators, carried from one analysis to the next:
+	Indicators Indicators
+}
+
+// Indicators are technical indicators over the priced snapshots of a token. Each
+// analysis folds the snapshots taken since the previous one into its indicators, so a
+// tick costs the same however long the history is. Snapshots without a bonding curve
+// state are skipped.
+type Indicators struct {
+	Folded  int // snapshots of Info folded in so far
+	Samples int // priced snapshots among them
+
+	EMAFast       float64 // exponential moving average over EMAFastPeriod
+	EMASlow       float64 // exponential moving average over EMASlowPeriod
+	MACD          float64 // EMAFast - EMASlow
+	MACDSignal    float64 // exponential moving average of MACD over MACDSignalPeriod
+	MACDHistogram float64 // MACD - MACDSignal
+
+	RSI     float64 // Wilder's relative strength index over RSIPeriod, 0 to 100, 0 until warm
+	AvgGain float64 // smoothed gain between samples
+	AvgLoss float64 // smoothed loss between samples
+
+	BollingerMiddle float64 // simple moving average over BollingerPeriod, or the samples so far until warm
+	BollingerUpper  float64 // middle plus BollingerWidth standard deviations
+	BollingerLower  float64 // middle minus BollingerWidth standard deviations
+
+	RateOfChange float64 // percentage change over RateOfChangePeriod samples, 0 until warm
+	Peak         float64 // highest price seen
+	Drawdown     float64 // percentage the last price is below Peak
+	LastPrice    float64
+}
+
+// Warm reports whether enough priced snapshots were seen for an indicator over period
+// to be meaningful.
+func (ind Indicators) Warm(period int) bool {
+	return ind.Samples > period
 }
 
 type Meme_Sync struct {
@@ -68,6 +113,7 @@ type Trades_Sync struct {
 var PumpMemes Meme_Sync
 var TradesMap Trades_Sync
 
+// InitializePumpMemes creates both maps and reloads the tokens saved in Store, if any.
 func InitializePumpMemes() {
 	PumpMemes = Meme_Sync{
 		Tokens: make(map[string]MemeToken),
@@ -75,6 +121,34 @@ func InitializePumpMemes() {
 	TradesMap = Trades_Sync{
 		Tokens: make(map[string]MemeToken),
 	}
+
+	if memes, err := loadTokens(PumpMemesBucket); err != nil {
+		log.Println("state store: failed to reload pump memes:", err)
+	} else {
+		PumpMemes.Tokens = memes
+	}
+	if trades, err := loadTokens(TradesBucket); err != nil {
+		log.Println("state store: failed to reload trades:", err)
+	} else {
+		TradesMap.Tokens = trades
+	}
+
+	// Stores written before terminal tokens were archived still hold them.
+	for key, token := range PumpMemes.Tokens {
+		if token.State.Terminal() {
+			delete(PumpMemes.Tokens, key)
+			unpersist(PumpMemesBucket, key)
+		}
+	}
+	for key, token := range TradesMap.Tokens {
+		if token.State.Terminal() {
+			TradesMap.Archive(key)
+		}
+	}
+	FlushStore()
+	if Store != nil {
+		log.Printf("state store: reloaded %d pump memes and %d trades\n", len(PumpMemes.Tokens), len(TradesMap.Tokens))
+	}
 }
 
 func (post *Meme_Sync) Get(key string) (MemeToken, bool) {
@@ -108,10 +182,53 @@ func (post *Meme_Sync) CountTokens() int {
 func (post *Meme_Sync) SetToken(meme MemeToken) {
 	post.Lock()
 	defer post.Unlock()
-	t := time.Now()
+	t := Now()
 	meme.AddedTime = t
 
 	post.Tokens[meme.Mint.String()] = meme
+	persist(PumpMemesBucket, meme.Mint.String(), persistedToken(meme))
+}
+
+// AddSnapshot appends a polled snapshot to a watched token, leaving the rest of the token
+// as it is in the map now. A Discovered token moves to Watching with its first snapshot,
+// the transition is returned then. It fails when the token was promoted or removed
+// while the snapshot was taken.
+func (post *Meme_Sync) AddSnapshot(key string, info MemeInfo) (MemeToken, *Transition, error) {
+	post.Lock()
+	defer post.Unlock()
+	tok, exists := post.Tokens[key]
+	if !exists {
+		return MemeToken{}, nil, fmt.Errorf("token %s is not watched", key)
+	}
+	tok.Info = append(tok.Info, info)
+
+	var watching *Transition
+	if tok.State == StateDiscovered {
+		if transition, err := tok.Transition(StateWatching, "first snapshot"); err == nil {
+			watching = &transition
+		}
+	}
+	post.Tokens[key] = tok
+	persist(PumpMemesBucket, key, persistedToken(tok))
+	return deepCopyMemeToken(tok), watching, nil
+}
+
+// Take moves a watched token to next and removes it from the map, e.g. when it is promoted
+// to TradesMap or rejected. Only one caller can take a token, the others fail.
+func (post *Meme_Sync) Take(key string, next TokenState, reason string) (MemeToken, Transition, error) {
+	post.Lock()
+	defer post.Unlock()
+	tok, exists := post.Tokens[key]
+	if !exists {
+		return MemeToken{}, Transition{}, fmt.Errorf("token %s is not watched", key)
+	}
+	transition, err := tok.Transition(next, reason)
+	if err != nil {
+		return MemeToken{}, Transition{}, err
+	}
+	delete(post.Tokens, key)
+	unpersist(PumpMemesBucket, key)
+	return deepCopyMemeToken(tok), transition, nil
 }
 
 func (post *Meme_Sync) DeleteAllTokens() {
@@ -120,11 +237,13 @@ func (post *Meme_Sync) DeleteAllTokens() {
 	for key, _ := range post.Tokens {
 		delete(post.Tokens, key)
 	}
+	unpersistAll(PumpMemesBucket)
 }
 func (post *Meme_Sync) DeleteToken(key string) {
 	post.Lock()
 	defer post.Unlock()
 	delete(post.Tokens, key)
+	unpersist(PumpMemesBucket, key)
 }
 
 func (post *Trades_Sync) Get(key string) (MemeToken, bool) {
@@ -160,10 +279,79 @@ func (post *Trades_Sync) CountTokens() int {
 func (post *Trades_Sync) SetToken(meme MemeToken) {
 	post.Lock()
 	defer post.Unlock()
-	t := time.Now()
+	t := Now()
 	meme.AddedTime = t
 
 	post.Tokens[meme.Mint.String()] = meme
+	persist(TradesBucket, meme.Mint.String(), persistedToken(meme))
+}
+
+// Transition moves a tracked token to next without touching its snapshot history.
+// It fails when the token is not tracked or the transition is not allowed. The states
+// an order moves a token to are flushed to the store before Transition returns, so a
+// restart never finds a token behind the position booked for it.
+func (post *Trades_Sync) Transition(key string, next TokenState, reason string) (Transition, error) {
+	transition, err := post.transition(key, next, reason)
+	if err == nil && next.Ordered() {
+		FlushStore()
+	}
+	return transition, err
+}
+
+func (post *Trades_Sync) transition(key string, next TokenState, reason string) (Transition, error) {
+	post.Lock()
+	defer post.Unlock()
+	tok, exists := post.Tokens[key]
+	if !exists {
+		return Transition{}, fmt.Errorf("token %s is not traded", key)
+	}
+	transition, err := tok.Transition(next, reason)
+	if err != nil {
+		return Transition{}, err
+	}
+	post.Tokens[key] = tok
+	persist(TradesBucket, key, persistedToken(tok))
+	return transition, nil
+}
+
+// AddSnapshot appends a polled snapshot and its analysis to a tracked token, leaving its
+// state to the trader. A token whose bonding curve completed is moved to Migrated in the
+// same update unless an order is in flight for it, the transition is returned then.
+func (post *Trades_Sync) AddSnapshot(key string, info MemeInfo, analysis TokenAnalysis) (MemeToken, *Transition, error) {
+	post.Lock()
+	defer post.Unlock()
+	tok, exists := post.Tokens[key]
+	if !exists {
+		return MemeToken{}, nil, fmt.Errorf("token %s is not traded", key)
+	}
+	tok.Info = append(tok.Info, info)
+	tok.Analysis = append(tok.Analysis, analysis)
+
+	var migrated *Transition
+	if info.BondingState != nil && info.BondingState.Complete && tok.State != StateEntering && tok.State != StateExiting {
+		if transition, err := tok.Transition(StateMigrated, "bonding curve complete"); err == nil {
+			migrated = &transition
+		}
+	}
+	post.Tokens[key] = tok
+	persist(TradesBucket, key, persistedToken(tok))
+	return deepCopyMemeToken(tok), migrated, nil
+}
+
+// Archive moves a token that reached a terminal state out of the map, and in the store
+// from the trades to the archive bucket, so it is neither polled nor reloaded again.
+// Tokens that are still trading are left alone.
+func (post *Trades_Sync) Archive(key string) bool {
+	post.Lock()
+	defer post.Unlock()
+	tok, exists := post.Tokens[key]
+	if !exists || !tok.State.Terminal() {
+		return false
+	}
+	delete(post.Tokens, key)
+	unpersist(TradesBucket, key)
+	persist(ArchiveBucket, key, persistedToken(tok))
+	return true
 }
 
 func (post *Trades_Sync) DeleteAllTokens() {
@@ -172,11 +360,13 @@ func (post *Trades_Sync) DeleteAllTokens() {
 	for key, _ := range post.Tokens {
 		delete(post.Tokens, key)
 	}
+	unpersistAll(TradesBucket)
 }
 func (post *Trades_Sync) DeleteToken(key string) {
 	post.Lock()
 	defer post.Unlock()
 	delete(post.Tokens, key)
+	unpersist(TradesBucket, key)
 }
 
 func (m MemeInfo) String() string {
@@ -192,6 +382,9 @@ func deepCopyMemeToken(src MemeToken) MemeToken {
 	dst.Info = make([]MemeInfo, len(src.Info))
 	copy(dst.Info, src.Info)
 
+	dst.Transitions = make([]Transition, len(src.Transitions))
+	copy(dst.Transitions, src.Transitions)
+
 	// Also deep copy BondingCurveState pointers, if you ever mutate them
 	for i := range dst.Info {
 		if src.Info[i].BondingState != nil {
@@ -204,7 +397,7 @@ func deepCopyMemeToken(src MemeToken) MemeToken {
 
 func (ta TokenAnalysis) String() string {
 	return fmt.Sprintf(
-		"TokenAnalysis{MarketCapSufficiency: %t, ReservesSufficiency: %t, DataPoints: %d, ReserveRatio: %.4f, SolReserveRatio: %.4f, PriceStability: %t, PriceConvergence: %.10f, SimpleMovingAverage: %.10f, PercentageChange: %.3f%%, PriceTrendSlope: %.10f, ConsistentlyTrendingUp: %t, Volatility: %.10f, TheoreticalPrice: %.8f, CurrentPrice: %.8f, RiskRewardScore: %.8f, Time: %s}",
+		"TokenAnalysis{MarketCapSufficiency: %t, ReservesSufficiency: %t, DataPoints: %d, ReserveRatio: %.4f, SolReserveRatio: %.4f, PriceStability: %t, PriceConvergence: %.10f, SimpleMovingAverage: %.10f, PercentageChange: %.3f%%, PriceTrendSlope: %.10f, ConsistentlyTrendingUp: %t, Volatility: %.10f, TheoreticalPrice: %.8f, CurrentPrice: %.8f, RiskRewardScore: %.8f, Samples: %d, EMAFast: %.6e, EMASlow: %.6e, MACD: %.6e, MACDSignal: %.6e, MACDHistogram: %.6e, RSI: %.3f, BollingerMiddle: %.6e, BollingerUpper: %.6e, BollingerLower: %.6e, RateOfChange: %.3f%%, Peak: %.6e, Drawdown: %.3f%%, Time: %s}",
 		ta.MarketCapSufficiency,
 		ta.ReservesSufficiency,
 		ta.DataPoints,
@@ -220,6 +413,19 @@ func (ta TokenAnalysis) String() string {
 		ta.TheoreticalPrice,
 		ta.CurrentPrice,
 		ta.RiskRewardScore,
+		ta.Indicators.Samples,
+		ta.Indicators.EMAFast,
+		ta.Indicators.EMASlow,
+		ta.Indicators.MACD,
+		ta.Indicators.MACDSignal,
+		ta.Indicators.MACDHistogram,
+		ta.Indicators.RSI,
+		ta.Indicators.BollingerMiddle,
+		ta.Indicators.BollingerUpper,
+		ta.Indicators.BollingerLower,
+		ta.Indicators.RateOfChange,
+		ta.Indicators.Peak,
+		ta.Indicators.Drawdown,
 		ta.Snapshot,
 	)
 }
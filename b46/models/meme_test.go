@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+func TestWatchedTokenTakenOnce(t *testing.T) {
+	InitializePumpMemes()
+	token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: StateDiscovered}
+	key := token.Mint.String()
+	PumpMemes.SetToken(token)
+
+	updated, watching, err := PumpMemes.AddSnapshot(key, MemeInfo{TokenPrice: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watching == nil || watching.To != StateWatching || updated.State != StateWatching || len(updated.Info) != 1 {
+		t.Fatalf("first snapshot gave %+v, %v, want the token watched", updated, watching)
+	}
+	if _, watching, _ = PumpMemes.AddSnapshot(key, MemeInfo{TokenPrice: 2}); watching != nil {
+		t.Errorf("second snapshot moved the token again: %v", watching)
+	}
+
+	taken, transition, err := PumpMemes.Take(key, StateCandidate, "promoted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taken.State != StateCandidate || transition.From != StateWatching || len(taken.Info) != 2 {
+		t.Errorf("took %+v, %v, want the candidate with both snapshots", taken, transition)
+	}
+	if _, _, err := PumpMemes.Take(key, StateRejected, "rejected"); err == nil {
+		t.Error("token taken twice")
+	}
+	// A snapshot taken while the token was promoted does not bring it back.
+	if _, _, err := PumpMemes.AddSnapshot(key, MemeInfo{TokenPrice: 3}); err == nil {
+		t.Error("snapshot added to a promoted token")
+	}
+	if _, exists := PumpMemes.Get(key); exists {
+		t.Error("promoted token still watched")
+	}
+}
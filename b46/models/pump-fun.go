@@ -35,6 +35,19 @@ type BondingCurveState struct {
 
 //1000000000 000000
 
+// PumpTrade is a buy or sell on a pump.fun bonding curve, decoded from the program's TradeEvent.
+type PumpTrade struct {
+	Signature            string
+	Mint                 solana.PublicKey
+	User                 solana.PublicKey
+	IsBuy                bool
+	SolAmount            uint64
+	TokenAmount          uint64
+	Timestamp            int64
+	VirtualSolReserves   uint64
+	VirtualTokenReserves uint64
+}
+
 type PumpFun struct {
 	Version      string `json:"version"`
 	Name         string `json:"name"`
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Buckets of the persistent state store.
+const (
+	PumpMemesBucket = "pump_memes"
+	TradesBucket    = "trades"
+	PositionsBucket = "positions"
+	ArchiveBucket   = "archive" // traded tokens that reached a terminal state
+)
+
+// StateStore is a durable key value store, values are stored as JSON. It is implemented
+// by the store package; models only depends on this interface.
+type StateStore interface {
+	Put(bucket, key string, value interface{}) error
+	Delete(bucket, key string) error
+	DeleteAll(bucket string) error
+	ForEach(bucket string, fn func(key string, data []byte) error) error
+
+	// Write applies every write in a single transaction.
+	Write(writes []StoreWrite) error
+}
+
+// StoreWrite is one change of a StateStore.Write, a nil Value deletes the key.
+type StoreWrite struct {
+	Bucket string
+	Key    string
+	Value  interface{}
+}
+
+// Store persists PumpMemes, TradesMap and the portfolio. When nil, state is kept in memory only.
+var Store StateStore
+
+// Token writes are not sent to the store as they happen: the latest value of every key is
+// kept in pendingWrites and FlushStore writes them all in one transaction, so the token
+// maps never wait on the disk and a token updated on every tick costs one write per flush.
+// Transitions to the states of an order are the exception, they are flushed at once.
+var (
+	pendingMutex  sync.Mutex
+	pendingWrites = make(map[storeKey]interface{})
+	flushMutex    sync.Mutex
+)
+
+type storeKey struct {
+	bucket, key string
+}
+
+// tombstone marks a pending delete in pendingWrites.
+type tombstone struct{}
+
+// persist queues value to be written to the store by the next flush.
+func persist(bucket, key string, value interface{}) {
+	if Store == nil {
+		return
+	}
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	pendingWrites[storeKey{bucket, key}] = value
+}
+
+// unpersist queues the delete of key.
+func unpersist(bucket, key string) {
+	if Store == nil {
+		return
+	}
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	pendingWrites[storeKey{bucket, key}] = tombstone{}
+}
+
+// unpersistAll clears bucket at once, dropping its pending writes.
+func unpersistAll(bucket string) {
+	if Store == nil {
+		return
+	}
+	flushMutex.Lock()
+	defer flushMutex.Unlock()
+	pendingMutex.Lock()
+	for key := range pendingWrites {
+		if key.bucket == bucket {
+			delete(pendingWrites, key)
+		}
+	}
+	pendingMutex.Unlock()
+	if err := Store.DeleteAll(bucket); err != nil {
+		log.Printf("state store: failed to clear %s: %v", bucket, err)
+	}
+}
+
+// FlushStore writes every pending token write to the store. A failed flush is logged and
+// its writes are queued again, unless a newer value was queued meanwhile.
+func FlushStore() {
+	if Store == nil {
+		return
+	}
+	flushMutex.Lock()
+	defer flushMutex.Unlock()
+
+	pendingMutex.Lock()
+	flushing := pendingWrites
+	pendingWrites = make(map[storeKey]interface{})
+	pendingMutex.Unlock()
+	if len(flushing) == 0 {
+		return
+	}
+
+	writes := make([]StoreWrite, 0, len(flushing))
+	for key, value := range flushing {
+		if _, deleted := value.(tombstone); deleted {
+			value = nil
+		}
+		writes = append(writes, StoreWrite{Bucket: key.bucket, Key: key.key, Value: value})
+	}
+	if err := Store.Write(writes); err != nil {
+		log.Printf("state store: failed to save %d token(s): %v", len(writes), err)
+		pendingMutex.Lock()
+		for key, value := range flushing {
+			if _, newer := pendingWrites[key]; !newer {
+				pendingWrites[key] = value
+			}
+		}
+		pendingMutex.Unlock()
+	}
+}
+
+// WatchStore flushes the pending token writes every StoreFlushInterval seconds, and a
+// last time once ctx is canceled.
+func WatchStore(ctx context.Context) {
+	ticker := NewTicker(StoreFlushInterval * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			FlushStore()
+			return
+		case <-ticker.C():
+			FlushStore()
+		}
+	}
+}
+
+// persistedToken is what the store keeps of a token: everything but its history, of
+// which only the last PersistedHistory snapshots and the last analysis are kept.
+func persistedToken(meme MemeToken) MemeToken {
+	persisted := meme
+	persisted.Info = append([]MemeInfo(nil), meme.Info[max(0, len(meme.Info)-PersistedHistory):]...)
+	persisted.Analysis = append([]TokenAnalysis(nil), meme.Analysis[max(0, len(meme.Analysis)-1):]...)
+	persisted.Transitions = append([]Transition(nil), meme.Transitions...)
+	return persisted
+}
+
+// loadTokens reads every token saved in bucket.
+func loadTokens(bucket string) (map[string]MemeToken, error) {
+	tokens := make(map[string]MemeToken)
+	if Store == nil {
+		return tokens, nil
+	}
+	err := Store.ForEach(bucket, func(key string, data []byte) error {
+		var token MemeToken
+		if err := json.Unmarshal(data, &token); err != nil {
+			return fmt.Errorf("failed to decode token %s: %w", key, err)
+		}
+		token.inferState(bucket)
+		tokens[key] = token
+		return nil
+	})
+	return tokens, err
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"errors"
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+// memoryStore is a StateStore keeping values in memory, counting the Write calls.
+type memoryStore struct {
+	buckets map[string]map[string]interface{}
+	writes  int
+	fail    bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{buckets: make(map[string]map[string]interface{})}
+}
+
+func (s *memoryStore) Put(bucket, key string, value interface{}) error {
+	return s.Write([]StoreWrite{{Bucket: bucket, Key: key, Value: value}})
+}
+
+func (s *memoryStore) Delete(bucket, key string) error {
+	return s.Write([]StoreWrite{{Bucket: bucket, Key: key}})
+}
+
+func (s *memoryStore) DeleteAll(bucket string) error {
+	delete(s.buckets, bucket)
+	return nil
+}
+
+func (s *memoryStore) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return nil
+}
+
+func (s *memoryStore) Write(writes []StoreWrite) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	s.writes++
+	for _, write := range writes {
+		if s.buckets[write.Bucket] == nil {
+			s.buckets[write.Bucket] = make(map[string]interface{})
+		}
+		if write.Value == nil {
+			delete(s.buckets[write.Bucket], write.Key)
+			continue
+		}
+		s.buckets[write.Bucket][write.Key] = write.Value
+	}
+	return nil
+}
+
+func (s *memoryStore) token(bucket, key string) (MemeToken, bool) {
+	value, exists := s.buckets[bucket][key]
+	if !exists {
+		return MemeToken{}, false
+	}
+	return value.(MemeToken), true
+}
+
+func useMemoryStore(t *testing.T) *memoryStore {
+	t.Helper()
+	store := newMemoryStore()
+	Store = store
+	InitializePumpMemes()
+	t.Cleanup(func() {
+		FlushStore()
+		Store = nil
+	})
+	return store
+}
+
+func TestTokenWritesAreBatched(t *testing.T) {
+	store := useMemoryStore(t)
+	token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: StateCandidate}
+	key := token.Mint.String()
+
+	for i := 0; i < 3*PersistedHistory; i++ {
+		token.Info = append(token.Info, MemeInfo{TokenPrice: float64(i)})
+		token.Analysis = append(token.Analysis, TokenAnalysis{DataPoints: i + 1})
+		TradesMap.SetToken(token)
+	}
+	if _, err := TradesMap.Transition(key, StateRejected, "no momentum"); err != nil {
+		t.Fatal(err)
+	}
+	if store.writes != 0 {
+		t.Fatalf("%d writes before the flush", store.writes)
+	}
+
+	FlushStore()
+	if store.writes != 1 {
+		t.Fatalf("%d writes, want 1", store.writes)
+	}
+	saved, exists := store.token(TradesBucket, key)
+	if !exists {
+		t.Fatal("token not saved")
+	}
+	if saved.State != StateRejected {
+		t.Errorf("saved state %s, want %s", saved.State, StateRejected)
+	}
+	if len(saved.Info) != PersistedHistory || saved.Info[0].TokenPrice != float64(2*PersistedHistory) {
+		t.Errorf("saved %d snapshots starting at %v, want the last %d", len(saved.Info), saved.Info[0].TokenPrice, PersistedHistory)
+	}
+	if len(saved.Analysis) != 1 || saved.Analysis[0].DataPoints != 3*PersistedHistory {
+		t.Errorf("saved analyses %v, want the last one only", saved.Analysis)
+	}
+	if current, _ := TradesMap.Get(key); len(current.Info) != 3*PersistedHistory {
+		t.Errorf("history in memory trimmed to %d snapshots", len(current.Info))
+	}
+
+	FlushStore()
+	if store.writes != 1 {
+		t.Errorf("empty flush wrote to the store")
+	}
+}
+
+func TestOrderStatesAreWrittenThrough(t *testing.T) {
+	tests := []struct {
+		from, to TokenState
+		written  bool
+	}{
+		{from: StateWatching, to: StateCandidate},
+		{from: StateCandidate, to: StateEntering, written: true},
+		{from: StateEntering, to: StateHeld, written: true},
+		{from: StateEntering, to: StateCandidate},
+		{from: StateHeld, to: StateExiting, written: true},
+		{from: StateExiting, to: StateHeld, written: true},
+		{from: StateExiting, to: StateClosed, written: true},
+		{from: StateHeld, to: StateMigrated},
+	}
+	for _, test := range tests {
+		t.Run(test.from.String()+"->"+test.to.String(), func(t *testing.T) {
+			store := useMemoryStore(t)
+			token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: test.from}
+			key := token.Mint.String()
+			TradesMap.SetToken(token)
+
+			if _, err := TradesMap.Transition(key, test.to, "test"); err != nil {
+				t.Fatal(err)
+			}
+			saved, exists := store.token(TradesBucket, key)
+			if written := exists && saved.State == test.to; written != test.written {
+				t.Errorf("written before the flush %v, want %v", written, test.written)
+			}
+		})
+	}
+}
+
+func TestFailedFlushIsRetried(t *testing.T) {
+	store := useMemoryStore(t)
+	token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: StateCandidate}
+	key := token.Mint.String()
+
+	store.fail = true
+	TradesMap.SetToken(token)
+	FlushStore()
+
+	// A value queued after the failed flush wins over the one being retried.
+	token.Strategy = "newer"
+	TradesMap.SetToken(token)
+	store.fail = false
+	FlushStore()
+	if saved, exists := store.token(TradesBucket, key); !exists || saved.Strategy != "newer" {
+		t.Errorf("saved %+v, want the newer token", saved)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	store := useMemoryStore(t)
+	token := MemeToken{Mint: solana.NewWallet().PublicKey(), State: StateExiting}
+	key := token.Mint.String()
+	TradesMap.SetToken(token)
+	FlushStore()
+
+	if TradesMap.Archive(key) {
+		t.Fatal("archived a token that is still trading")
+	}
+	if _, err := TradesMap.Transition(key, StateClosed, "sell confirmed"); err != nil {
+		t.Fatal(err)
+	}
+	if !TradesMap.Archive(key) {
+		t.Fatal("closed token not archived")
+	}
+	FlushStore()
+
+	if _, exists := TradesMap.Get(key); exists {
+		t.Error("archived token still in TradesMap")
+	}
+	if _, exists := store.token(TradesBucket, key); exists {
+		t.Error("archived token still in the trades bucket")
+	}
+	if archived, exists := store.token(ArchiveBucket, key); !exists || archived.State != StateClosed {
+		t.Errorf("archive holds %+v, want the closed token", archived)
+	}
+}
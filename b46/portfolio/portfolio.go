@@ -0,0 +1,292 @@
+package portfolio
+
+import (
+	"b46/b46/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Position is built from the fills of one mint. Amounts are in SOL unless noted.
+type Position struct {
+	Mint     string
+	Name     string
+	Symbol   string
+	Strategy string // strategy whose orders built the position
+
+	Tokens      uint64  // raw token units still held
+	CostBasis   float64 // cost of the tokens still held, fees and rent included
+	Invested    float64 // total spent on buys, fees and rent included
+	Proceeds    float64 // total received from sells, net of fees
+	Fees        float64 // network fees paid on every fill
+	Rent        float64 // rent paid for accounts created by buys
+	RealizedPnL float64
+
+	EntryPrice float64 // average entry price of the tokens still held
+	LastPrice  float64 // latest observed price, used for the unrealized PnL
+	Fills      int
+
+	OpenedAt time.Time
+	ClosedAt time.Time
+}
+
+// Open reports whether the position still holds tokens.
+func (p Position) Open() bool {
+	return p.Tokens > 0
+}
+
+// MarketValue is the SOL value of the tokens still held at the last price.
+func (p Position) MarketValue() float64 {
+	return float64(p.Tokens) / math.Pow10(models.TOKEN_DECIMALS) * p.LastPrice
+}
+
+// UnrealizedPnL is the market value of the tokens still held minus their cost basis.
+func (p Position) UnrealizedPnL() float64 {
+	if !p.Open() || p.LastPrice <= 0 {
+		return 0
+	}
+	return p.MarketValue() - p.CostBasis
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf(
+		"Position{Mint: %s, Symbol: %s, Strategy: %s, Open: %t, Tokens: %d, EntryPrice: %.20f, LastPrice: %.20f, CostBasis: %.6f, Invested: %.6f, Proceeds: %.6f, Fees: %.6f, Rent: %.6f, Realized: %.6f, Unrealized: %.6f}",
+		p.Mint, p.Symbol, p.Strategy, p.Open(), p.Tokens, p.EntryPrice, p.LastPrice, p.CostBasis, p.Invested, p.Proceeds, p.Fees, p.Rent, p.RealizedPnL, p.UnrealizedPnL(),
+	)
+}
+
+// Totals aggregates every position of the session.
+type Totals struct {
+	OpenPositions   int
+	ClosedPositions int
+	Invested        float64
+	Proceeds        float64
+	Fees            float64
+	Rent            float64
+	Exposure        float64 // cost basis still at risk
+	RealizedPnL     float64
+	UnrealizedPnL   float64
+}
+
+// PnL is the realized plus unrealized PnL.
+func (t Totals) PnL() float64 {
+	return t.RealizedPnL + t.UnrealizedPnL
+}
+
+func (t Totals) String() string {
+	return fmt.Sprintf(
+		"Portfolio{Open: %d, Closed: %d, Invested: %.6f, Proceeds: %.6f, Fees: %.6f, Rent: %.6f, Exposure: %.6f, Realized: %.6f, Unrealized: %.6f, PnL: %.6f}",
+		t.OpenPositions, t.ClosedPositions, t.Invested, t.Proceeds, t.Fees, t.Rent, t.Exposure, t.RealizedPnL, t.UnrealizedPnL, t.PnL(),
+	)
+}
+
+// Portfolio records positions from fills and marks them to the latest snapshots.
+type Portfolio struct {
+	sync.Mutex
+	positions map[string]*Position
+}
+
+func New() *Portfolio {
+	return &Portfolio{positions: make(map[string]*Position)}
+}
+
+// ApplyFill books a fill and returns the updated position. For sells the cost of the
+// tokens sold is taken at the average cost of the tokens held.
+func (p *Portfolio) ApplyFill(token models.MemeToken, fill models.Fill) Position {
+	p.Lock()
+	defer p.Unlock()
+
+	mint := fill.Mint.String()
+	position, exists := p.positions[mint]
+	if !exists {
+		position = &Position{Mint: mint, Name: token.Name, Symbol: token.Symbol}
+		p.positions[mint] = position
+	}
+
+	sol := float64(fill.SolLamports) / models.LamportsPerSOL
+	fee := float64(fill.FeeLamports) / models.LamportsPerSOL
+	rent := float64(fill.RentLamports) / models.LamportsPerSOL
+	if fill.Strategy != "" {
+		position.Strategy = fill.Strategy
+	}
+	position.Fees += fee
+	position.Rent += rent
+	position.Fills++
+	if fill.Price > 0 {
+		position.LastPrice = fill.Price
+	}
+
+	switch fill.Side {
+	case models.FillSideBuy:
+		cost := sol + fee + rent
+		if !position.Open() {
+			position.OpenedAt = fill.Time
+			position.ClosedAt = time.Time{}
+		}
+		position.Tokens += fill.TokenAmount
+		position.CostBasis += cost
+		position.Invested += cost
+	case models.FillSideSell:
+		sold := fill.TokenAmount
+		if sold > position.Tokens || sold == 0 {
+			sold = position.Tokens
+		}
+		costSold := position.CostBasis
+		if position.Tokens > 0 {
+			costSold = position.CostBasis * float64(sold) / float64(position.Tokens)
+		}
+		proceeds := sol - fee
+		position.Proceeds += proceeds
+		position.RealizedPnL += proceeds - costSold
+		position.CostBasis -= costSold
+		position.Tokens -= sold
+		if !position.Open() {
+			position.CostBasis = 0
+			position.ClosedAt = fill.Time
+		}
+	}
+
+	position.EntryPrice = 0
+	if position.Tokens > 0 {
+		position.EntryPrice = position.CostBasis / (float64(position.Tokens) / math.Pow10(models.TOKEN_DECIMALS))
+	}
+	save(position)
+	return *position
+}
+
+// WriteOff closes the open position for mint without proceeds, e.g. once its token migrated
+// off the bonding curve and cannot be sold here anymore. The cost basis of the tokens still
+// held is booked as a realized loss.
+func (p *Portfolio) WriteOff(mint string, at time.Time) (Position, bool) {
+	p.Lock()
+	defer p.Unlock()
+	position, exists := p.positions[mint]
+	if !exists || !position.Open() {
+		return Position{}, false
+	}
+	position.RealizedPnL -= position.CostBasis
+	position.CostBasis = 0
+	position.Tokens = 0
+	position.EntryPrice = 0
+	position.ClosedAt = at
+	save(position)
+	return *position, true
+}
+
+// Load reloads the positions saved in models.Store, replacing the ones in memory.
+func (p *Portfolio) Load() error {
+	if models.Store == nil {
+		return nil
+	}
+	positions := make(map[string]*Position)
+	err := models.Store.ForEach(models.PositionsBucket, func(key string, data []byte) error {
+		var position Position
+		if err := json.Unmarshal(data, &position); err != nil {
+			return fmt.Errorf("failed to decode position %s: %w", key, err)
+		}
+		positions[key] = &position
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.positions = positions
+	return nil
+}
+
+// save writes the position to models.Store, a failed write is logged.
+func save(position *Position) {
+	if models.Store == nil {
+		return
+	}
+	if err := models.Store.Put(models.PositionsBucket, position.Mint, position); err != nil {
+		log.Printf("state store: failed to save position %s: %v", position.Mint, err)
+	}
+}
+
+// Mark updates the last price of an open position from the token's latest snapshot.
+func (p *Portfolio) Mark(token models.MemeToken) {
+	if len(token.Info) == 0 {
+		return
+	}
+	info := token.Info[len(token.Info)-1]
+	if info.TokenPrice <= 0 {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if position, exists := p.positions[token.Mint.String()]; exists && position.Open() {
+		position.LastPrice = info.TokenPrice
+	}
+}
+
+// Position returns a copy of the position for mint.
+func (p *Portfolio) Position(mint string) (Position, bool) {
+	p.Lock()
+	defer p.Unlock()
+	position, exists := p.positions[mint]
+	if !exists {
+		return Position{}, false
+	}
+	return *position, true
+}
+
+// Positions returns copies of every position, oldest first.
+func (p *Portfolio) Positions() []Position {
+	p.Lock()
+	defer p.Unlock()
+	positions := make([]Position, 0, len(p.positions))
+	for _, position := range p.positions {
+		positions = append(positions, *position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].OpenedAt.Before(positions[j].OpenedAt)
+	})
+	return positions
+}
+
+// Totals sums every position of the session.
+func (p *Portfolio) Totals() Totals {
+	p.Lock()
+	defer p.Unlock()
+	var totals Totals
+	for _, position := range p.positions {
+		totals.add(position)
+	}
+	return totals
+}
+
+// TotalsByStrategy sums the positions of the session per strategy. Positions that were
+// never tagged, e.g. opened before strategies were tracked, are summed under "".
+func (p *Portfolio) TotalsByStrategy() map[string]Totals {
+	p.Lock()
+	defer p.Unlock()
+	byStrategy := make(map[string]Totals)
+	for _, position := range p.positions {
+		totals := byStrategy[position.Strategy]
+		totals.add(position)
+		byStrategy[position.Strategy] = totals
+	}
+	return byStrategy
+}
+
+func (t *Totals) add(position *Position) {
+	if position.Open() {
+		t.OpenPositions++
+		t.Exposure += position.CostBasis
+	} else {
+		t.ClosedPositions++
+	}
+	t.Invested += position.Invested
+	t.Proceeds += position.Proceeds
+	t.Fees += position.Fees
+	t.Rent += position.Rent
+	t.RealizedPnL += position.RealizedPnL
+	t.UnrealizedPnL += position.UnrealizedPnL()
+}
@@ -0,0 +1,178 @@
+package portfolio
+
+import (
+	"b46/b46/models"
+	"github.com/gagliardetto/solana-go"
+	"math"
+	"testing"
+	"time"
+)
+
+const tokenUnit = 1_000_000 // raw units of one token, models.TOKEN_DECIMALS
+
+func lamports(sol float64) uint64 {
+	return uint64(math.Round(sol * models.LamportsPerSOL))
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func buy(sol float64, tokens uint64, fee, rent float64) models.Fill {
+	return models.Fill{Side: models.FillSideBuy, SolLamports: lamports(sol), TokenAmount: tokens, FeeLamports: lamports(fee), RentLamports: lamports(rent)}
+}
+
+func sell(sol float64, tokens uint64, fee float64) models.Fill {
+	return models.Fill{Side: models.FillSideSell, SolLamports: lamports(sol), TokenAmount: tokens, FeeLamports: lamports(fee)}
+}
+
+func TestApplyFill(t *testing.T) {
+	tests := []struct {
+		name      string
+		fills     []models.Fill
+		tokens    uint64
+		costBasis float64
+		entry     float64
+		invested  float64
+		proceeds  float64
+		realized  float64
+	}{
+		{
+			name:      "buy with fee and rent",
+			fills:     []models.Fill{buy(1, tokenUnit, 0.01, 0.002)},
+			tokens:    tokenUnit,
+			costBasis: 1.012, entry: 1.012, invested: 1.012,
+		},
+		{
+			name:      "two buys average the entry",
+			fills:     []models.Fill{buy(1, tokenUnit, 0, 0), buy(3, tokenUnit, 0, 0)},
+			tokens:    2 * tokenUnit,
+			costBasis: 4, entry: 2, invested: 4,
+		},
+		{
+			name:      "partial sell at average cost",
+			fills:     []models.Fill{buy(1, tokenUnit, 0.01, 0.002), sell(0.6, tokenUnit/2, 0.01)},
+			tokens:    tokenUnit / 2,
+			costBasis: 0.506, entry: 1.012, invested: 1.012, proceeds: 0.59, realized: 0.084,
+		},
+		{
+			name:     "full sell at a loss",
+			fills:    []models.Fill{buy(1, tokenUnit, 0, 0), buy(1, tokenUnit, 0, 0), sell(1.5, 2*tokenUnit, 0.005)},
+			invested: 2, proceeds: 1.495, realized: -0.505,
+		},
+		{
+			name:     "sell of more than held is clamped",
+			fills:    []models.Fill{buy(1, tokenUnit, 0, 0), sell(2, 5*tokenUnit, 0)},
+			invested: 1, proceeds: 2, realized: 1,
+		},
+		{
+			name:     "sell without amount sells everything",
+			fills:    []models.Fill{buy(1, tokenUnit, 0, 0), sell(0.5, 0, 0)},
+			invested: 1, proceeds: 0.5, realized: -0.5,
+		},
+		{
+			name:      "reopened position keeps the realized PnL",
+			fills:     []models.Fill{buy(1, tokenUnit, 0, 0), sell(2, tokenUnit, 0), buy(1, 2*tokenUnit, 0, 0)},
+			tokens:    2 * tokenUnit,
+			costBasis: 1, entry: 0.5, invested: 2, proceeds: 2, realized: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := New()
+			token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "TST"}
+			var position Position
+			for i, fill := range test.fills {
+				fill.Mint = token.Mint
+				fill.Time = time.Unix(int64(i+1), 0)
+				position = p.ApplyFill(token, fill)
+			}
+
+			if position.Tokens != test.tokens {
+				t.Errorf("tokens %d, want %d", position.Tokens, test.tokens)
+			}
+			if position.Open() != (test.tokens > 0) {
+				t.Errorf("open %t, want %t", position.Open(), test.tokens > 0)
+			}
+			if !position.Open() && !position.ClosedAt.Equal(time.Unix(int64(len(test.fills)), 0)) {
+				t.Errorf("closed at %s, want the last fill", position.ClosedAt)
+			}
+			checks := []struct {
+				field     string
+				got, want float64
+			}{
+				{"cost basis", position.CostBasis, test.costBasis},
+				{"entry price", position.EntryPrice, test.entry},
+				{"invested", position.Invested, test.invested},
+				{"proceeds", position.Proceeds, test.proceeds},
+				{"realized PnL", position.RealizedPnL, test.realized},
+			}
+			for _, check := range checks {
+				if !near(check.got, check.want) {
+					t.Errorf("%s %.9f, want %.9f", check.field, check.got, check.want)
+				}
+			}
+			if stored, _ := p.Position(token.Mint.String()); stored != position {
+				t.Errorf("stored %s, want %s", stored, position)
+			}
+		})
+	}
+}
+
+func TestMarkAndTotals(t *testing.T) {
+	p := New()
+	held := models.MemeToken{Mint: solana.NewWallet().PublicKey()}
+	closed := models.MemeToken{Mint: solana.NewWallet().PublicKey()}
+
+	p.ApplyFill(held, models.Fill{Mint: held.Mint, Side: models.FillSideBuy, SolLamports: lamports(1), TokenAmount: 2 * tokenUnit, Strategy: "a"})
+	p.ApplyFill(closed, models.Fill{Mint: closed.Mint, Side: models.FillSideBuy, SolLamports: lamports(1), TokenAmount: tokenUnit, Strategy: "b"})
+	p.ApplyFill(closed, models.Fill{Mint: closed.Mint, Side: models.FillSideSell, SolLamports: lamports(1.5), TokenAmount: tokenUnit})
+
+	held.Info = []models.MemeInfo{{TokenPrice: 0.75}}
+	p.Mark(held)
+	closed.Info = []models.MemeInfo{{TokenPrice: 9}}
+	p.Mark(closed)
+
+	position, _ := p.Position(held.Mint.String())
+	if !near(position.MarketValue(), 1.5) || !near(position.UnrealizedPnL(), 0.5) {
+		t.Errorf("market value %.6f unrealized %.6f, want 1.5 and 0.5", position.MarketValue(), position.UnrealizedPnL())
+	}
+	if position, _ := p.Position(closed.Mint.String()); position.LastPrice == 9 {
+		t.Error("closed position was marked")
+	}
+
+	totals := p.Totals()
+	if totals.OpenPositions != 1 || totals.ClosedPositions != 1 {
+		t.Errorf("open %d closed %d, want 1 and 1", totals.OpenPositions, totals.ClosedPositions)
+	}
+	if !near(totals.Exposure, 1) || !near(totals.RealizedPnL, 0.5) || !near(totals.UnrealizedPnL, 0.5) || !near(totals.PnL(), 1) {
+		t.Errorf("totals %s", totals)
+	}
+	byStrategy := p.TotalsByStrategy()
+	if !near(byStrategy["a"].UnrealizedPnL, 0.5) || !near(byStrategy["b"].RealizedPnL, 0.5) {
+		t.Errorf("totals by strategy %v", byStrategy)
+	}
+}
+
+func TestWriteOff(t *testing.T) {
+	p := New()
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey()}
+	mint := token.Mint.String()
+	p.ApplyFill(token, models.Fill{Mint: token.Mint, Side: models.FillSideBuy, SolLamports: lamports(1), TokenAmount: 2 * tokenUnit})
+	p.ApplyFill(token, models.Fill{Mint: token.Mint, Side: models.FillSideSell, SolLamports: lamports(0.8), TokenAmount: tokenUnit})
+
+	at := time.Unix(100, 0)
+	position, written := p.WriteOff(mint, at)
+	if !written || position.Open() || position.CostBasis != 0 || !position.ClosedAt.Equal(at) {
+		t.Fatalf("written %t, position %s", written, position)
+	}
+	if !near(position.RealizedPnL, -0.2) {
+		t.Errorf("realized %.6f, want -0.2", position.RealizedPnL)
+	}
+	if _, written := p.WriteOff(mint, at); written {
+		t.Error("closed position written off again")
+	}
+	if _, written := p.WriteOff("unknown", at); written {
+		t.Error("unknown position written off")
+	}
+}
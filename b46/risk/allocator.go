@@ -0,0 +1,286 @@
+package risk
+
+import (
+	"b46/b46/models"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Allocation is the share of the wallet a single strategy instance may trade with.
+type Allocation struct {
+	Strategy     string             // name of the instance, unique within a session
+	Kind         string             `json:",omitempty"` // registered strategy the instance runs, Strategy when empty
+	BudgetSOL    float64            // SOL the strategy may have committed at once, grown or shrunk by its realized PnL
+	MaxPositions int                // open and pending positions of the strategy at the same time
+	Parameters   map[string]float64 `json:",omitempty"` // parameters set on the instance, defaults when missing
+}
+
+// StrategyKind returns the registered strategy the allocation runs.
+func (allocation Allocation) StrategyKind() string {
+	if allocation.Kind != "" {
+		return allocation.Kind
+	}
+	return allocation.Strategy
+}
+
+// ParseAllocations reads a comma separated list of [name=]kind[:budget[:positions[:parameters]]]
+// entries, e.g. "kamikaze:0.02:3,other:0.01". The same strategy runs several times under
+// different instance names, each with its own parameters separated by semicolons, e.g.
+// "fast=kamikaze:0.02:3:EntryMarketCap=6000,slow=kamikaze:0.01::ExitMarketCap=90000".
+// Missing budgets and position limits split the global risk limits evenly between the
+// strategies.
+func ParseAllocations(spec string) ([]Allocation, error) {
+	var allocations []Allocation
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) > 4 {
+			return nil, fmt.Errorf("invalid strategy allocation %q, expected [name=]kind[:budget[:positions[:parameters]]]", entry)
+		}
+		name, kind, named := strings.Cut(fields[0], "=")
+		allocation := Allocation{Strategy: strings.TrimSpace(name), Kind: strings.TrimSpace(kind)}
+		if !named {
+			allocation.Kind = allocation.Strategy
+		}
+		if allocation.Strategy == "" || allocation.Kind == "" {
+			return nil, fmt.Errorf("invalid strategy allocation %q, missing strategy name", entry)
+		}
+		if seen[allocation.Strategy] {
+			return nil, fmt.Errorf("strategy %s allocated twice", allocation.Strategy)
+		}
+		seen[allocation.Strategy] = true
+
+		if len(fields) > 1 && strings.TrimSpace(fields[1]) != "" {
+			budget, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+			if err != nil || budget <= 0 {
+				return nil, fmt.Errorf("invalid budget for strategy %s: %q", allocation.Strategy, fields[1])
+			}
+			allocation.BudgetSOL = budget
+		}
+		if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+			positions, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+			if err != nil || positions <= 0 {
+				return nil, fmt.Errorf("invalid position limit for strategy %s: %q", allocation.Strategy, fields[2])
+			}
+			allocation.MaxPositions = positions
+		}
+		if len(fields) > 3 {
+			parameters, err := parseParameters(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameters for strategy %s: %w", allocation.Strategy, err)
+			}
+			allocation.Parameters = parameters
+		}
+		allocations = append(allocations, allocation)
+	}
+	if len(allocations) == 0 {
+		return nil, fmt.Errorf("no strategy in %q", spec)
+	}
+
+	for i := range allocations {
+		if allocations[i].BudgetSOL == 0 {
+			allocations[i].BudgetSOL = models.MaxExposureSOL / float64(len(allocations))
+		}
+		if allocations[i].MaxPositions == 0 {
+			allocations[i].MaxPositions = max(models.MaxOpenPositions/len(allocations), 1)
+		}
+	}
+	return allocations, nil
+}
+
+// parseParameters reads semicolon separated Name=value pairs.
+func parseParameters(spec string) (map[string]float64, error) {
+	parameters := make(map[string]float64)
+	for _, pair := range strings.Split(spec, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("%q, expected Name=value", pair)
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q, %s is not a number", pair, name)
+		}
+		parameters[name] = number
+	}
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+	return parameters, nil
+}
+
+// allocatedPosition is a position charged to a strategy's budget.
+type allocatedPosition struct {
+	Strategy  string
+	AmountSOL float64
+	Open      bool // false while the buy is still pending
+}
+
+// strategyBook tracks what one strategy has committed and earned.
+type strategyBook struct {
+	Allocation
+	committed   float64
+	positions   int
+	realizedPnL float64
+}
+
+func (book *strategyBook) available() float64 {
+	return book.BudgetSOL + book.realizedPnL - book.committed
+}
+
+// Allocator splits the wallet between strategies. Every buy is charged to the budget and
+// position limit of the strategy that placed it, on top of the global risk limits.
+type Allocator struct {
+	sync.Mutex
+	books     map[string]*strategyBook
+	positions map[string]allocatedPosition
+}
+
+func NewAllocator(allocations []Allocation) *Allocator {
+	a := &Allocator{
+		books:     make(map[string]*strategyBook, len(allocations)),
+		positions: make(map[string]allocatedPosition),
+	}
+	for _, allocation := range allocations {
+		a.books[allocation.Strategy] = &strategyBook{Allocation: allocation}
+	}
+	return a
+}
+
+// HasCapacity reports whether strategy may still open a position of at least the minimum order size.
+func (a *Allocator) HasCapacity(strategy string) bool {
+	a.Lock()
+	defer a.Unlock()
+	book, exists := a.books[strategy]
+	if !exists {
+		return false
+	}
+	return book.positions < book.MaxPositions && book.available() >= models.MinPositionAmount
+}
+
+// ApproveBuy charges a buy of amount SOL to strategy. It returns the amount that may be
+// bought, downsized to what is left of the strategy's budget, and reserves it until
+// CancelBuy or ConfirmBuy is called.
+func (a *Allocator) ApproveBuy(strategy, mint string, amount float64) (float64, error) {
+	a.Lock()
+	defer a.Unlock()
+	book, exists := a.books[strategy]
+	if !exists {
+		return 0, fmt.Errorf("strategy %q has no allocation", strategy)
+	}
+	if _, exists := a.positions[mint]; exists {
+		return 0, fmt.Errorf("position already open or pending for %s", mint)
+	}
+	if book.positions >= book.MaxPositions {
+		return 0, fmt.Errorf("strategy %s reached its max positions (%d)", strategy, book.MaxPositions)
+	}
+
+	approved := min(amount, book.available())
+	if approved <= 0 || approved < models.MinPositionAmount {
+		return 0, fmt.Errorf("strategy %s budget exhausted (%.4f SOL left, minimum order %.4f SOL)", strategy, approved, models.MinPositionAmount)
+	}
+	if approved < amount {
+		log.Printf("Allocator: downsized buy of %s for %s from %.4f to %.4f SOL", strategy, mint, amount, approved)
+	}
+
+	a.positions[mint] = allocatedPosition{Strategy: strategy, AmountSOL: approved}
+	book.committed += approved
+	book.positions++
+	return approved, nil
+}
+
+// CancelBuy releases the reservation of a buy that was never filled.
+func (a *Allocator) CancelBuy(mint string) {
+	a.Lock()
+	defer a.Unlock()
+	position, exists := a.positions[mint]
+	if !exists || position.Open {
+		return
+	}
+	a.release(mint, position)
+}
+
+// ConfirmBuy marks a reserved position as open.
+func (a *Allocator) ConfirmBuy(mint string) {
+	a.Lock()
+	defer a.Unlock()
+	position, exists := a.positions[mint]
+	if !exists {
+		return
+	}
+	position.Open = true
+	a.positions[mint] = position
+}
+
+// ConfirmSell closes a position, returns its capital to the strategy's budget and books
+// its realized PnL.
+func (a *Allocator) ConfirmSell(mint string, realizedPnL float64) {
+	a.Lock()
+	defer a.Unlock()
+	position, exists := a.positions[mint]
+	if !exists {
+		return
+	}
+	a.release(mint, position)
+	if book, exists := a.books[position.Strategy]; exists {
+		book.realizedPnL += realizedPnL
+	}
+}
+
+// RestorePosition charges a position that was already open before the session started
+// to strategy. Positions of strategies that are not allocated anymore are ignored.
+func (a *Allocator) RestorePosition(strategy, mint string, amount float64) {
+	a.Lock()
+	defer a.Unlock()
+	book, exists := a.books[strategy]
+	if !exists {
+		log.Printf("Allocator: %s belongs to unallocated strategy %q, not charged", mint, strategy)
+		return
+	}
+	if _, exists := a.positions[mint]; exists {
+		return
+	}
+	a.positions[mint] = allocatedPosition{Strategy: strategy, AmountSOL: amount, Open: true}
+	book.committed += amount
+	book.positions++
+}
+
+// Strategy returns the strategy a pending or open position is charged to.
+func (a *Allocator) Strategy(mint string) (string, bool) {
+	a.Lock()
+	defer a.Unlock()
+	position, exists := a.positions[mint]
+	return position.Strategy, exists
+}
+
+func (a *Allocator) String() string {
+	a.Lock()
+	defer a.Unlock()
+	books := make([]string, 0, len(a.books))
+	for _, book := range a.books {
+		books = append(books, fmt.Sprintf("%s: %d/%d positions, %.4f/%.4f SOL committed, realized %.4f SOL",
+			book.Strategy, book.positions, book.MaxPositions, book.committed, book.BudgetSOL+book.realizedPnL, book.realizedPnL))
+	}
+	sort.Strings(books)
+	return fmt.Sprintf("Allocator{%s}", strings.Join(books, "; "))
+}
+
+func (a *Allocator) release(mint string, position allocatedPosition) {
+	delete(a.positions, mint)
+	if book, exists := a.books[position.Strategy]; exists {
+		book.committed -= position.AmountSOL
+		book.positions--
+	}
+}
@@ -0,0 +1,211 @@
+package risk
+
+import (
+	"b46/b46/models"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAllocations(t *testing.T) {
+	half := max(models.MaxOpenPositions/2, 1)
+	tests := []struct {
+		spec  string
+		want  []Allocation
+		error string
+	}{
+		{spec: "kamikaze:0.02:3", want: []Allocation{{Strategy: "kamikaze", Kind: "kamikaze", BudgetSOL: 0.02, MaxPositions: 3}}},
+		{spec: " a:0.01 , b:0.03:2 ,", want: []Allocation{
+			{Strategy: "a", Kind: "a", BudgetSOL: 0.01, MaxPositions: half},
+			{Strategy: "b", Kind: "b", BudgetSOL: 0.03, MaxPositions: 2},
+		}},
+		{spec: "a,b", want: []Allocation{
+			{Strategy: "a", Kind: "a", BudgetSOL: models.MaxExposureSOL / 2, MaxPositions: half},
+			{Strategy: "b", Kind: "b", BudgetSOL: models.MaxExposureSOL / 2, MaxPositions: half},
+		}},
+		{spec: "fast=kamikaze:0.02:3:EntryMarketCap=6000; PositionAmount=0.01,slow=kamikaze:::ExitMarketCap=90000", want: []Allocation{
+			{Strategy: "fast", Kind: "kamikaze", BudgetSOL: 0.02, MaxPositions: 3, Parameters: map[string]float64{"EntryMarketCap": 6000, "PositionAmount": 0.01}},
+			{Strategy: "slow", Kind: "kamikaze", BudgetSOL: models.MaxExposureSOL / 2, MaxPositions: half, Parameters: map[string]float64{"ExitMarketCap": 90000}},
+		}},
+		{spec: "", error: "no strategy"},
+		{spec: ":0.1", error: "missing strategy name"},
+		{spec: "fast=:0.1", error: "missing strategy name"},
+		{spec: "a,a", error: "allocated twice"},
+		{spec: "fast=kamikaze,fast=other", error: "allocated twice"},
+		{spec: "a:x", error: "invalid budget"},
+		{spec: "a:-1", error: "invalid budget"},
+		{spec: "a:0.1:0", error: "invalid position limit"},
+		{spec: "a:0.1:2:EntryMarketCap", error: "invalid parameters"},
+		{spec: "a:0.1:2:EntryMarketCap=high", error: "invalid parameters"},
+		{spec: "a:0.1:2:A=1:3", error: "expected [name=]kind[:budget[:positions[:parameters]]]"},
+	}
+	for _, test := range tests {
+		got, err := ParseAllocations(test.spec)
+		if test.error != "" {
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("%q: error %v, want %q", test.spec, err, test.error)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestAllocatorBudgets(t *testing.T) {
+	type step struct {
+		action   string // buy, cancel, confirm or sell
+		strategy string
+		mint     string
+		amount   float64 // SOL requested by a buy, realized PnL of a sell
+		approved float64
+		error    string
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		available map[string]float64
+	}{
+		{
+			name: "budgets are per strategy",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.01, approved: 0.01},
+				{action: "buy", strategy: "b", mint: "2", amount: 0.02, approved: 0.02},
+			},
+			available: map[string]float64{"a": 0.01, "b": 0.01},
+		},
+		{
+			name: "buy downsized to the budget left",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.015, approved: 0.015},
+				{action: "buy", strategy: "a", mint: "2", amount: 0.01, approved: 0.005},
+			},
+			available: map[string]float64{"a": 0, "b": 0.03},
+		},
+		{
+			name: "exhausted budget",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.0195, approved: 0.0195},
+				{action: "buy", strategy: "a", mint: "2", amount: 0.01, error: "budget exhausted"},
+			},
+			available: map[string]float64{"a": 0.0005, "b": 0.03},
+		},
+		{
+			name: "max positions",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.001, approved: 0.001},
+				{action: "buy", strategy: "a", mint: "2", amount: 0.001, approved: 0.001},
+				{action: "buy", strategy: "a", mint: "3", amount: 0.001, error: "max positions"},
+			},
+			available: map[string]float64{"a": 0.018, "b": 0.03},
+		},
+		{
+			name: "duplicate and unknown strategy",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.01, approved: 0.01},
+				{action: "buy", strategy: "b", mint: "1", amount: 0.01, error: "already open or pending"},
+				{action: "buy", strategy: "c", mint: "2", amount: 0.01, error: "no allocation"},
+			},
+			available: map[string]float64{"a": 0.01, "b": 0.03},
+		},
+		{
+			name: "cancel releases a pending buy only",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.01, approved: 0.01},
+				{action: "cancel", mint: "1"},
+				{action: "buy", strategy: "a", mint: "2", amount: 0.01, approved: 0.01},
+				{action: "confirm", mint: "2"},
+				{action: "cancel", mint: "2"},
+			},
+			available: map[string]float64{"a": 0.01, "b": 0.03},
+		},
+		{
+			name: "realized PnL grows and shrinks the budget",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.01, approved: 0.01},
+				{action: "confirm", mint: "1"},
+				{action: "sell", mint: "1", amount: 0.005},
+				{action: "buy", strategy: "b", mint: "2", amount: 0.01, approved: 0.01},
+				{action: "confirm", mint: "2"},
+				{action: "sell", mint: "2", amount: -0.008},
+			},
+			available: map[string]float64{"a": 0.025, "b": 0.022},
+		},
+		{
+			name: "losses below the minimum order stop the strategy",
+			steps: []step{
+				{action: "buy", strategy: "a", mint: "1", amount: 0.02, approved: 0.02},
+				{action: "confirm", mint: "1"},
+				{action: "sell", mint: "1", amount: -0.0195},
+				{action: "buy", strategy: "a", mint: "2", amount: 0.01, error: "budget exhausted"},
+			},
+			available: map[string]float64{"a": 0.0005, "b": 0.03},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAllocator([]Allocation{{Strategy: "a", BudgetSOL: 0.02, MaxPositions: 2}, {Strategy: "b", BudgetSOL: 0.03, MaxPositions: 1}})
+			for i, s := range test.steps {
+				switch s.action {
+				case "buy":
+					approved, err := a.ApproveBuy(s.strategy, s.mint, s.amount)
+					if s.error != "" {
+						if err == nil || !strings.Contains(err.Error(), s.error) {
+							t.Fatalf("step %d: error %v, want %q", i, err, s.error)
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatalf("step %d: %v", i, err)
+					}
+					if math.Abs(approved-s.approved) > 1e-12 {
+						t.Fatalf("step %d: approved %.6f, want %.6f", i, approved, s.approved)
+					}
+				case "cancel":
+					a.CancelBuy(s.mint)
+				case "confirm":
+					a.ConfirmBuy(s.mint)
+				case "sell":
+					a.ConfirmSell(s.mint, s.amount)
+				}
+			}
+			for strategy, want := range test.available {
+				if got := a.books[strategy].available(); math.Abs(got-want) > 1e-12 {
+					t.Errorf("%s has %.6f SOL available, want %.6f (%s)", strategy, got, want, a)
+				}
+			}
+		})
+	}
+}
+
+func TestRestorePosition(t *testing.T) {
+	a := NewAllocator([]Allocation{{Strategy: "a", BudgetSOL: 0.02, MaxPositions: 1}})
+	a.RestorePosition("a", "1", 0.015)
+	a.RestorePosition("a", "1", 0.015)
+	a.RestorePosition("gone", "2", 0.01)
+
+	if strategy, exists := a.Strategy("1"); !exists || strategy != "a" {
+		t.Errorf("restored position charged to %q", strategy)
+	}
+	if _, exists := a.Strategy("2"); exists {
+		t.Error("position of an unallocated strategy charged")
+	}
+	if a.HasCapacity("a") {
+		t.Error("restored position does not count towards the position limit")
+	}
+	if got := a.books["a"].available(); math.Abs(got-0.005) > 1e-12 {
+		t.Errorf("%.6f SOL available, want 0.005", got)
+	}
+	// A restored position is open, a cancel does not release it.
+	a.CancelBuy("1")
+	a.ConfirmSell("1", 0.001)
+	if !a.HasCapacity("a") {
+		t.Errorf("sold position not released: %s", a)
+	}
+}
@@ -0,0 +1,198 @@
+package risk
+
+import (
+	"b46/b46/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Limits holds every bound the risk manager enforces on new buys. Sells are never blocked.
+type Limits struct {
+	MaxPositions          int     // open and pending positions at the same time
+	MaxExposureSOL        float64 // SOL committed across all open and pending positions
+	MaxCreatorExposureSOL float64 // SOL committed to tokens of a single creator
+	DailyLossLimitSOL     float64 // realized loss after which buys stop for the day
+	SessionBudgetSOL      float64 // total SOL the session may spend on buys
+	MinOrderSOL           float64 // orders downsized below this amount are rejected
+}
+
+// DefaultLimits returns the limits configured in models.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPositions:          models.MaxOpenPositions,
+		MaxExposureSOL:        models.MaxExposureSOL,
+		MaxCreatorExposureSOL: models.MaxCreatorExposureSOL,
+		DailyLossLimitSOL:     models.DailyLossLimitSOL,
+		SessionBudgetSOL:      models.SessionBudgetSOL,
+		MinOrderSOL:           models.MinPositionAmount,
+	}
+}
+
+// Position is the risk manager's view of a pending or open position.
+type Position struct {
+	Mint       string
+	Creator    string
+	AmountSOL  float64
+	EntryPrice float64
+	Open       bool // false while the buy is still pending
+}
+
+// Manager gates every order against the configured limits.
+type Manager struct {
+	sync.Mutex
+	limits       Limits
+	positions    map[string]Position
+	sessionSpent float64
+	dailyPnL     float64
+	day          time.Time
+	clock        models.Clock // nil reads the clock in use
+}
+
+func NewManager(limits Limits) *Manager {
+	return NewManagerWithClock(limits, nil)
+}
+
+// NewManagerWithClock returns a manager that rolls its days on clock rather than on the
+// clock in use, so that backtests running side by side each keep their own time.
+func NewManagerWithClock(limits Limits, clock models.Clock) *Manager {
+	m := &Manager{
+		limits:    limits,
+		positions: make(map[string]Position),
+		clock:     clock,
+	}
+	m.day = startOfDay(m.now())
+	return m
+}
+
+func (m *Manager) now() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	return models.Now()
+}
+
+// ApproveBuy checks a buy of amount SOL against every limit. It returns the amount that
+// may be bought, which is lower than requested when the order had to be downsized, and
+// reserves it until CancelBuy or ConfirmBuy is called.
+func (m *Manager) ApproveBuy(mint, creator string, amount float64) (float64, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.rollDay()
+
+	if _, exists := m.positions[mint]; exists {
+		return 0, fmt.Errorf("position already open or pending for %s", mint)
+	}
+	if m.limits.MaxPositions > 0 && len(m.positions) >= m.limits.MaxPositions {
+		return 0, fmt.Errorf("max concurrent positions reached (%d)", m.limits.MaxPositions)
+	}
+	if m.limits.DailyLossLimitSOL > 0 && -m.dailyPnL >= m.limits.DailyLossLimitSOL {
+		return 0, fmt.Errorf("daily loss limit reached (%.4f SOL lost, limit %.4f SOL)", -m.dailyPnL, m.limits.DailyLossLimitSOL)
+	}
+
+	approved := amount
+	reason := "order size"
+	if m.limits.MaxExposureSOL > 0 {
+		if remaining := m.limits.MaxExposureSOL - m.exposure(""); remaining < approved {
+			approved, reason = remaining, "max SOL exposure"
+		}
+	}
+	if m.limits.MaxCreatorExposureSOL > 0 && creator != "" {
+		if remaining := m.limits.MaxCreatorExposureSOL - m.exposure(creator); remaining < approved {
+			approved, reason = remaining, "max creator exposure"
+		}
+	}
+	if m.limits.SessionBudgetSOL > 0 {
+		if remaining := m.limits.SessionBudgetSOL - m.sessionSpent; remaining < approved {
+			approved, reason = remaining, "session budget"
+		}
+	}
+	if approved <= 0 || approved < m.limits.MinOrderSOL {
+		return 0, fmt.Errorf("%s exhausted (%.4f SOL left, minimum order %.4f SOL)", reason, approved, m.limits.MinOrderSOL)
+	}
+	if approved < amount {
+		log.Printf("Risk: downsized buy for %s from %.4f to %.4f SOL (%s)", mint, amount, approved, reason)
+	}
+
+	m.positions[mint] = Position{Mint: mint, Creator: creator, AmountSOL: approved}
+	m.sessionSpent += approved
+	return approved, nil
+}
+
+// CancelBuy releases the reservation of a buy that was never filled.
+func (m *Manager) CancelBuy(mint string) {
+	m.Lock()
+	defer m.Unlock()
+	position, exists := m.positions[mint]
+	if !exists || position.Open {
+		return
+	}
+	m.sessionSpent -= position.AmountSOL
+	delete(m.positions, mint)
+}
+
+// ConfirmBuy marks a reserved position as open at the given entry price.
+func (m *Manager) ConfirmBuy(mint string, entryPrice float64) {
+	m.Lock()
+	defer m.Unlock()
+	position, exists := m.positions[mint]
+	if !exists {
+		return
+	}
+	position.Open = true
+	position.EntryPrice = entryPrice
+	m.positions[mint] = position
+}
+
+// ConfirmSell closes a position and books its realized PnL, as measured by the portfolio.
+func (m *Manager) ConfirmSell(mint string, realizedPnL float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.rollDay()
+	if _, exists := m.positions[mint]; !exists {
+		return
+	}
+	delete(m.positions, mint)
+	m.dailyPnL += realizedPnL
+}
+
+// RestorePosition registers a position that was already open before the session started.
+// It counts towards the position and exposure limits but not towards the session budget.
+func (m *Manager) RestorePosition(mint, creator string, amount float64, entryPrice float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.positions[mint] = Position{Mint: mint, Creator: creator, AmountSOL: amount, EntryPrice: entryPrice, Open: true}
+}
+
+func (m *Manager) String() string {
+	m.Lock()
+	defer m.Unlock()
+	return fmt.Sprintf("Risk{Positions: %d/%d, Exposure: %.4f/%.4f SOL, SessionSpent: %.4f/%.4f SOL, DailyPnL: %.4f SOL}",
+		len(m.positions), m.limits.MaxPositions, m.exposure(""), m.limits.MaxExposureSOL, m.sessionSpent, m.limits.SessionBudgetSOL, m.dailyPnL)
+}
+
+// exposure sums the SOL committed to open and pending positions, optionally for one creator.
+func (m *Manager) exposure(creator string) float64 {
+	var total float64
+	for _, position := range m.positions {
+		if creator == "" || position.Creator == creator {
+			total += position.AmountSOL
+		}
+	}
+	return total
+}
+
+// rollDay resets the daily PnL when the day changes.
+func (m *Manager) rollDay() {
+	today := startOfDay(m.now())
+	if today.After(m.day) {
+		m.day = today
+		m.dailyPnL = 0
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,188 @@
+package risk
+
+import (
+	"b46/b46/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useClock runs the test on a simulated clock starting at start.
+func useClock(t *testing.T, start time.Time) *models.SimulatedClock {
+	t.Helper()
+	clock := models.NewSimulatedClock(start)
+	models.SetClock(clock)
+	t.Cleanup(func() { models.SetClock(models.SystemClock{}) })
+	return clock
+}
+
+func TestApproveBuy(t *testing.T) {
+	limits := Limits{
+		MaxPositions:          3,
+		MaxExposureSOL:        0.05,
+		MaxCreatorExposureSOL: 0.03,
+		DailyLossLimitSOL:     0.02,
+		SessionBudgetSOL:      0.1,
+		MinOrderSOL:           0.001,
+	}
+	tests := []struct {
+		name    string
+		limits  Limits
+		setup   func(m *Manager)
+		mint    string
+		creator string
+		amount  float64
+		want    float64
+		error   string
+	}{
+		{name: "within limits", limits: limits, mint: "a", creator: "x", amount: 0.01, want: 0.01},
+		{name: "no limits", limits: Limits{}, mint: "a", amount: 5, want: 5},
+		{
+			name: "duplicate mint", limits: limits, mint: "a", amount: 0.01, error: "already open or pending",
+			setup: func(m *Manager) { m.ApproveBuy("a", "", 0.01) },
+		},
+		{
+			name: "max positions", limits: limits, mint: "d", amount: 0.01, error: "max concurrent positions",
+			setup: func(m *Manager) {
+				m.ApproveBuy("a", "", 0.01)
+				m.ApproveBuy("b", "", 0.01)
+				m.RestorePosition("c", "", 0.01, 1)
+			},
+		},
+		{
+			name: "daily loss", limits: limits, mint: "b", amount: 0.01, error: "daily loss limit",
+			setup: func(m *Manager) {
+				m.ApproveBuy("a", "", 0.01)
+				m.ConfirmBuy("a", 1)
+				m.ConfirmSell("a", -0.02)
+			},
+		},
+		{
+			name: "downsized to exposure", limits: limits, mint: "c", amount: 0.03, want: 0.02,
+			setup: func(m *Manager) {
+				m.ApproveBuy("a", "", 0.015)
+				m.RestorePosition("b", "", 0.015, 1)
+			},
+		},
+		{
+			name: "downsized to creator exposure", limits: limits, mint: "b", creator: "x", amount: 0.02, want: 0.01,
+			setup: func(m *Manager) { m.ApproveBuy("a", "x", 0.02) },
+		},
+		{
+			name: "other creators do not count", limits: limits, mint: "b", creator: "y", amount: 0.02, want: 0.02,
+			setup: func(m *Manager) { m.ApproveBuy("a", "x", 0.02) },
+		},
+		{
+			name: "session budget", limits: Limits{SessionBudgetSOL: 0.02, MinOrderSOL: 0.001}, mint: "c", amount: 0.01, want: 0.005,
+			setup: func(m *Manager) {
+				m.ApproveBuy("a", "", 0.01)
+				m.ConfirmBuy("a", 1)
+				m.ConfirmSell("a", 0.01)
+				m.ApproveBuy("b", "", 0.005)
+			},
+		},
+		{
+			name: "below minimum order", limits: limits, mint: "b", amount: 0.01, error: "max SOL exposure exhausted",
+			setup: func(m *Manager) { m.RestorePosition("a", "", 0.0495, 1) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useClock(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+			m := NewManager(test.limits)
+			if test.setup != nil {
+				test.setup(m)
+			}
+			approved, err := m.ApproveBuy(test.mint, test.creator, test.amount)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Fatalf("ApproveBuy = %v, %v, want error %q", approved, err, test.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApproveBuy failed: %v", err)
+			}
+			if diff := approved - test.want; diff > 1e-12 || diff < -1e-12 {
+				t.Errorf("approved %.6f SOL, want %.6f", approved, test.want)
+			}
+		})
+	}
+}
+
+func TestDailyLossRollsOverAtMidnight(t *testing.T) {
+	clock := useClock(t, time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC))
+	m := NewManager(Limits{DailyLossLimitSOL: 0.02})
+
+	m.ApproveBuy("a", "", 0.05)
+	m.ConfirmBuy("a", 1)
+	m.ConfirmSell("a", -0.03)
+	if _, err := m.ApproveBuy("b", "", 0.01); err == nil {
+		t.Fatal("buy approved past the daily loss limit")
+	}
+
+	clock.Advance(59 * time.Minute)
+	if _, err := m.ApproveBuy("b", "", 0.01); err == nil {
+		t.Fatal("daily loss reset before midnight")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, err := m.ApproveBuy("b", "", 0.01); err != nil {
+		t.Fatalf("daily loss not reset after midnight: %v", err)
+	}
+
+	// A loss booked on the new day counts towards the new day only.
+	m.ConfirmBuy("b", 1)
+	m.ConfirmSell("b", -0.01)
+	if _, err := m.ApproveBuy("c", "", 0.01); err != nil {
+		t.Fatalf("buy rejected below the new day's limit: %v", err)
+	}
+}
+
+func TestManagerWithClockIgnoresClockInUse(t *testing.T) {
+	useClock(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	clock := models.NewSimulatedClock(time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC))
+	m := NewManagerWithClock(Limits{DailyLossLimitSOL: 0.02}, clock)
+
+	m.ApproveBuy("a", "", 0.05)
+	m.ConfirmBuy("a", 1)
+	m.ConfirmSell("a", -0.03)
+	if _, err := m.ApproveBuy("b", "", 0.01); err == nil {
+		t.Fatal("buy approved past the daily loss limit")
+	}
+	clock.Advance(2 * time.Hour)
+	if _, err := m.ApproveBuy("b", "", 0.01); err != nil {
+		t.Fatalf("daily loss not reset after midnight of the manager's clock: %v", err)
+	}
+}
+
+func TestMaxPositionsAccounting(t *testing.T) {
+	useClock(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	m := NewManager(Limits{MaxPositions: 2})
+	approve := func(mint string) error {
+		_, err := m.ApproveBuy(mint, "", 0.01)
+		return err
+	}
+
+	steps := []struct {
+		name   string
+		action func()
+		mint   string
+		allow  bool
+	}{
+		{"first pending", func() {}, "a", true},
+		{"second pending", func() {}, "b", true},
+		{"full with pending buys", func() {}, "c", false},
+		{"canceled pending buy frees its slot", func() { m.CancelBuy("a") }, "c", true},
+		{"confirmed buy keeps its slot", func() { m.ConfirmBuy("b", 1) }, "d", false},
+		{"cancel does not release an open position", func() { m.CancelBuy("b") }, "d", false},
+		{"sold position frees its slot", func() { m.ConfirmSell("b", 0) }, "d", true},
+		{"restored positions count", func() { m.CancelBuy("d"); m.RestorePosition("e", "", 0.01, 1) }, "f", false},
+	}
+	for _, step := range steps {
+		step.action()
+		if err := approve(step.mint); (err == nil) != step.allow {
+			t.Fatalf("%s: ApproveBuy(%s) = %v, want allowed %t (%s)", step.name, step.mint, err, step.allow, m)
+		}
+	}
+}
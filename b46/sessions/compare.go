@@ -0,0 +1,270 @@
+package sessions
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats are the outcome figures compared between sessions. Amounts are in SOL.
+type Stats struct {
+	Tokens      int
+	Entries     int
+	Closed      int
+	Wins        int
+	HitRate     float64 // share of trades that made money
+	AvgHold     time.Duration
+	PnL         Distribution
+	ExitReasons map[string]int
+}
+
+// Distribution summarizes the PnL of a session's trades.
+type Distribution struct {
+	Total  float64
+	Mean   float64
+	Min    float64
+	P25    float64
+	Median float64
+	P75    float64
+	Max    float64
+}
+
+// ConfigRow is one setting of the compared sessions, with the value of every session or
+// "-" when the session did not record it.
+type ConfigRow struct {
+	Key    string
+	Values []string
+}
+
+// Comparison lines up sessions, the first one is the baseline the others are measured against.
+type Comparison struct {
+	Sessions []Recorded
+	Stats    []Stats
+	Config   []ConfigRow // the settings that differ between sessions
+	Equal    int         // settings every session shares
+}
+
+// Summarize computes the stats of a recorded session.
+func Summarize(recorded Recorded) Stats {
+	stats := Stats{Tokens: recorded.Tokens, Entries: len(recorded.Trades), ExitReasons: make(map[string]int)}
+	var pnls []float64
+	var hold time.Duration
+	for _, trade := range recorded.Trades {
+		pnls = append(pnls, trade.PnL)
+		hold += trade.HoldTime(recorded.End)
+		if trade.PnL > 0 {
+			stats.Wins++
+		}
+		if !trade.Open {
+			stats.Closed++
+		}
+		reason := trade.ExitReason
+		if reason == "" {
+			reason = "open at end"
+		}
+		stats.ExitReasons[reason]++
+	}
+	if len(pnls) == 0 {
+		return stats
+	}
+	stats.HitRate = float64(stats.Wins) / float64(len(pnls))
+	stats.AvgHold = hold / time.Duration(len(pnls))
+
+	sort.Float64s(pnls)
+	for _, pnl := range pnls {
+		stats.PnL.Total += pnl
+	}
+	stats.PnL.Mean = stats.PnL.Total / float64(len(pnls))
+	stats.PnL.Min = pnls[0]
+	stats.PnL.P25 = quantile(pnls, 0.25)
+	stats.PnL.Median = quantile(pnls, 0.5)
+	stats.PnL.P75 = quantile(pnls, 0.75)
+	stats.PnL.Max = pnls[len(pnls)-1]
+	return stats
+}
+
+// Compare lines up the configs and the stats of sessions.
+func Compare(sessions []Recorded) Comparison {
+	comparison := Comparison{Sessions: sessions}
+	configs := make([]map[string]string, len(sessions))
+	keys := make(map[string]bool)
+	for i, session := range sessions {
+		comparison.Stats = append(comparison.Stats, Summarize(session))
+		configs[i] = flattenManifest(session)
+		for key := range configs[i] {
+			keys[key] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		row := ConfigRow{Key: key}
+		differs := false
+		for i := range sessions {
+			value, exists := configs[i][key]
+			if !exists {
+				value = "-"
+			}
+			if i > 0 && value != row.Values[0] {
+				differs = true
+			}
+			row.Values = append(row.Values, value)
+		}
+		if differs {
+			comparison.Config = append(comparison.Config, row)
+		} else {
+			comparison.Equal++
+		}
+	}
+	return comparison
+}
+
+// Write prints the comparison as a table with one column per session. Numbers of every
+// session after the first are followed by their difference to the first.
+func (c Comparison) Write(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	// Every row has a cell per session, so that the whole table is aligned as one block.
+	row := func(label string, cells []string) {
+		for len(cells) < len(c.Sessions) {
+			cells = append(cells, "")
+		}
+		fmt.Fprintln(table, label+"\t"+strings.Join(cells, "\t")+"\t")
+	}
+	figure := func(label string, format func(float64) string, value func(Stats) float64) {
+		var cells []string
+		for i, stats := range c.Stats {
+			cell := format(value(stats))
+			if i > 0 {
+				cell += " (" + signed(format(value(stats)-value(c.Stats[0]))) + ")"
+			}
+			cells = append(cells, cell)
+		}
+		row("  "+label, cells)
+	}
+
+	var names []string
+	for _, session := range c.Sessions {
+		names = append(names, session.Name)
+	}
+	row("", names)
+
+	row("Config", nil)
+	var manifests []string
+	for _, session := range c.Sessions {
+		if session.Manifest == nil {
+			manifests = append(manifests, "missing")
+		} else {
+			manifests = append(manifests, "recorded")
+		}
+	}
+	row("  manifest", manifests)
+	if len(c.Config) == 0 {
+		row("  no differences", nil)
+	}
+	for _, config := range c.Config {
+		row("  "+config.Key, config.Values)
+	}
+	row(fmt.Sprintf("  %d settings equal", c.Equal), nil)
+
+	count := func(value float64) string { return strconv.Itoa(int(value)) }
+	percent := func(value float64) string { return fmt.Sprintf("%.1f%%", value*100) }
+	sol := func(value float64) string { return fmt.Sprintf("%.6f", value) }
+	duration := func(value float64) string { return time.Duration(value).Round(time.Second).String() }
+
+	row("Outcome", nil)
+	figure("tokens", count, func(s Stats) float64 { return float64(s.Tokens) })
+	figure("entries", count, func(s Stats) float64 { return float64(s.Entries) })
+	figure("closed", count, func(s Stats) float64 { return float64(s.Closed) })
+	figure("hit rate", percent, func(s Stats) float64 { return s.HitRate })
+	figure("avg hold", duration, func(s Stats) float64 { return float64(s.AvgHold) })
+
+	row("PnL", nil)
+	figure("total", sol, func(s Stats) float64 { return s.PnL.Total })
+	figure("mean", sol, func(s Stats) float64 { return s.PnL.Mean })
+	figure("min", sol, func(s Stats) float64 { return s.PnL.Min })
+	figure("p25", sol, func(s Stats) float64 { return s.PnL.P25 })
+	figure("median", sol, func(s Stats) float64 { return s.PnL.Median })
+	figure("p75", sol, func(s Stats) float64 { return s.PnL.P75 })
+	figure("max", sol, func(s Stats) float64 { return s.PnL.Max })
+
+	row("Exit reasons", nil)
+	reasons := make(map[string]bool)
+	for _, stats := range c.Stats {
+		for reason := range stats.ExitReasons {
+			reasons[reason] = true
+		}
+	}
+	sortedReasons := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		sortedReasons = append(sortedReasons, reason)
+	}
+	sort.Strings(sortedReasons)
+	for _, reason := range sortedReasons {
+		figure(reason, count, func(s Stats) float64 { return float64(s.ExitReasons[reason]) })
+	}
+	return table.Flush()
+}
+
+// flattenManifest turns the manifest of a session into "path: value" settings, naming
+// list entries by their Name field when they have one.
+func flattenManifest(session Recorded) map[string]string {
+	settings := make(map[string]string)
+	if session.Manifest == nil {
+		return settings
+	}
+	settings["revision"] = session.Manifest.Revision
+	settings["profile"] = session.Manifest.Profile
+	flatten("", session.Manifest.Config, settings)
+	return settings
+}
+
+func flatten(prefix string, value any, settings map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			flatten(join(key), child, settings)
+		}
+	case []any:
+		for i, child := range v {
+			key := strconv.Itoa(i)
+			if entry, ok := child.(map[string]any); ok {
+				if name, ok := entry["Name"].(string); ok {
+					key = name
+				}
+			}
+			flatten(join(key), child, settings)
+		}
+	default:
+		settings[prefix] = fmt.Sprint(v)
+	}
+}
+
+// quantile interpolates the q quantile of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+func signed(value string) string {
+	if strings.HasPrefix(value, "-") {
+		return value
+	}
+	return "+" + value
+}
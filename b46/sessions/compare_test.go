@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"b46/b46/backtest"
+	"b46/b46/logging"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		q      float64
+		want   float64
+	}{
+		{sorted: []float64{5}, q: 0.25, want: 5},
+		{sorted: []float64{5}, q: 0.75, want: 5},
+		{sorted: []float64{1, 3}, q: 0.5, want: 2},
+		{sorted: []float64{1, 3}, q: 0.25, want: 1.5},
+		{sorted: []float64{1, 2, 3, 4}, q: 0, want: 1},
+		{sorted: []float64{1, 2, 3, 4}, q: 1, want: 4},
+		{sorted: []float64{1, 2, 3, 4}, q: 0.5, want: 2.5},
+		{sorted: []float64{1, 2, 3, 4, 5}, q: 0.25, want: 2},
+		{sorted: []float64{1, 2, 3, 4, 5}, q: 0.75, want: 4},
+		{sorted: []float64{-3, -1, 0, 10}, q: 0.75, want: 2.5},
+	}
+	for _, test := range tests {
+		if got := quantile(test.sorted, test.q); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("quantile(%v, %v) = %v, want %v", test.sorted, test.q, got, test.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	recorded := Recorded{
+		Tokens: 7,
+		End:    start.Add(100 * time.Second),
+		Trades: []backtest.Trade{
+			{PnL: 0.02, OpenedAt: start, ClosedAt: start.Add(10 * time.Second), ExitReason: "take profit"},
+			{PnL: -0.01, OpenedAt: start, ClosedAt: start.Add(20 * time.Second), ExitReason: "stop loss"},
+			{PnL: 0.04, OpenedAt: start, ClosedAt: start.Add(30 * time.Second), ExitReason: "take profit"},
+			{PnL: 0, OpenedAt: start.Add(60 * time.Second), Open: true},
+		},
+	}
+	stats := Summarize(recorded)
+
+	if stats.Tokens != 7 || stats.Entries != 4 || stats.Closed != 3 || stats.Wins != 2 || stats.HitRate != 0.5 {
+		t.Errorf("stats %+v", stats)
+	}
+	if stats.AvgHold != 25*time.Second {
+		t.Errorf("average hold %s, want 25s", stats.AvgHold)
+	}
+	want := Distribution{Total: 0.05, Mean: 0.0125, Min: -0.01, P25: -0.0025, Median: 0.01, P75: 0.025, Max: 0.04}
+	got := []float64{stats.PnL.Total, stats.PnL.Mean, stats.PnL.Min, stats.PnL.P25, stats.PnL.Median, stats.PnL.P75, stats.PnL.Max}
+	for i, value := range []float64{want.Total, want.Mean, want.Min, want.P25, want.Median, want.P75, want.Max} {
+		if math.Abs(got[i]-value) > 1e-12 {
+			t.Errorf("PnL %+v, want %+v", stats.PnL, want)
+			break
+		}
+	}
+	if stats.ExitReasons["take profit"] != 2 || stats.ExitReasons["stop loss"] != 1 || stats.ExitReasons["open at end"] != 1 {
+		t.Errorf("exit reasons %v", stats.ExitReasons)
+	}
+
+	if empty := Summarize(Recorded{Tokens: 3}); empty.Entries != 0 || empty.HitRate != 0 || empty.PnL != (Distribution{}) {
+		t.Errorf("stats without trades %+v", empty)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	manifest := func(revision string, config any) *logging.Manifest {
+		return &logging.Manifest{Revision: revision, Profile: "default", Config: config}
+	}
+	sessions := []Recorded{
+		{Name: "session-1", Manifest: manifest("abc", map[string]any{
+			"Risk":       map[string]any{"MaxPositions": 3.0, "DailyLoss": 0.05},
+			"Strategies": []any{map[string]any{"Name": "kamikaze", "Stop": 0.1}, "plain"},
+		}), Trades: []backtest.Trade{{PnL: 0.01}}},
+		{Name: "session-2", Manifest: manifest("abc", map[string]any{
+			"Risk":       map[string]any{"MaxPositions": 5.0, "DailyLoss": 0.05},
+			"Strategies": []any{map[string]any{"Name": "kamikaze", "Stop": 0.2}, "plain"},
+		}), Trades: []backtest.Trade{{PnL: 0.03}, {PnL: -0.01}}},
+		{Name: "session-0"},
+	}
+	comparison := Compare(sessions)
+
+	if len(comparison.Stats) != 3 || comparison.Stats[1].Entries != 2 {
+		t.Fatalf("stats %+v", comparison.Stats)
+	}
+	rows := make(map[string][]string)
+	for _, row := range comparison.Config {
+		rows[row.Key] = row.Values
+	}
+	want := map[string][]string{
+		"Risk.MaxPositions":        {"3", "5", "-"},
+		"Strategies.kamikaze.Stop": {"0.1", "0.2", "-"},
+		"Risk.DailyLoss":           {"0.05", "0.05", "-"},
+		"Strategies.1":             {"plain", "plain", "-"},
+		"revision":                 {"abc", "abc", "-"},
+		"profile":                  {"default", "default", "-"},
+		"Strategies.kamikaze.Name": {"kamikaze", "kamikaze", "-"},
+	}
+	if len(rows) != len(want) || comparison.Equal != 0 {
+		t.Errorf("config rows %v with %d equal, want %v", rows, comparison.Equal, want)
+	}
+	for key, values := range want {
+		if strings.Join(rows[key], ",") != strings.Join(values, ",") {
+			t.Errorf("%s: %v, want %v", key, rows[key], values)
+		}
+	}
+
+	// Without the session missing its manifest only the differing settings are listed.
+	pair := Compare(sessions[:2])
+	if len(pair.Config) != 2 || pair.Config[0].Key != "Risk.MaxPositions" || pair.Config[1].Key != "Strategies.kamikaze.Stop" || pair.Equal != 5 {
+		t.Errorf("config %v with %d equal", pair.Config, pair.Equal)
+	}
+
+	var table strings.Builder
+	if err := pair.Write(&table); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"session-1", "Risk.MaxPositions", "5 settings equal", "0.020000 (+0.010000)", "50.0% (-50.0%)"} {
+		if !strings.Contains(table.String(), line) {
+			t.Errorf("table misses %q:\n%s", line, table.String())
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package sessions
+
+import (
+	"b46/b46/backtest"
+	"b46/b46/logging"
+	"b46/b46/logging/reader"
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/sol"
+	"errors"
+	"os"
+	"time"
+)
+
+// Recorded is what a trading session actually did, rebuilt from its logs.
+type Recorded struct {
+	Name     string
+	Dir      string
+	Manifest *logging.Manifest // nil for sessions recorded before manifests were written
+	Start    time.Time
+	End      time.Time
+	Tokens   int
+
+	Trades []backtest.Trade
+	Totals portfolio.Totals
+}
+
+// Load rebuilds the trades of a session directory from its fills. The fills of older
+// sessions carry no price or amount, so every fill is repriced with sol.CurveFill against
+// the snapshot it was filled on, spending the position amount the session ran with. This
+// way sessions with and without logged prices compare alike, and alike to backtests.
+func Load(dir string) (Recorded, error) {
+	logs, err := reader.ReadSession(dir)
+	if err != nil {
+		return Recorded{}, err
+	}
+	recorded := Recorded{Name: logs.Name, Dir: dir}
+	manifest, err := logging.ReadManifest(dir)
+	if err == nil {
+		recorded.Manifest = &manifest
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Recorded{}, err
+	}
+
+	timelines := make(map[string]models.MemeToken)
+	for _, token := range logs.Timelines() {
+		timelines[token.Mint.String()] = token
+		if recorded.Start.IsZero() || token.AddedTime.Before(recorded.Start) {
+			recorded.Start = token.AddedTime
+		}
+		if last := token.Info[len(token.Info)-1].Snapshot; last.After(recorded.End) {
+			recorded.End = last
+		}
+	}
+	recorded.Tokens = len(timelines)
+
+	entries, exits := fillTimes(logs)
+	book := portfolio.New()
+	entryReasons := make(map[string]string)
+	exitReasons := make(map[string]string)
+	for _, order := range logs.Orders {
+		token, exists := timelines[order.Mint]
+		if !order.Filled() || !exists {
+			continue
+		}
+		position, held := book.Position(order.Mint)
+		open := held && position.Open()
+
+		// Older sessions repeated the sell of a closed token on every round, only the
+		// first sell after a buy closes the trade.
+		if (order.Side == reader.KindBuy) == open {
+			continue
+		}
+		var at time.Time
+		var fill models.Fill
+		if order.Side == reader.KindBuy {
+			at = nextTime(entries, order.Mint, token)
+			amount := recorded.positionAmount(order.Strategy)
+			fill = sol.CurveFill(snapshotAt(token, at), models.FillSideBuy, amount, 0, at)
+			entryReasons[order.Mint] = order.Reason
+		} else {
+			at = nextTime(exits, order.Mint, token)
+			fill = sol.CurveFill(snapshotAt(token, at), models.FillSideSell, 0, position.Tokens, at)
+			exitReasons[order.Mint] = order.Reason
+		}
+		fill.Strategy = order.Strategy
+		book.ApplyFill(token, fill)
+	}
+
+	for _, token := range timelines {
+		book.Mark(token)
+	}
+	for _, position := range book.Positions() {
+		token := timelines[position.Mint]
+		trade := backtest.Trade{
+			Mint:        position.Mint,
+			Name:        position.Name,
+			Symbol:      position.Symbol,
+			OpenedAt:    position.OpenedAt,
+			ClosedAt:    position.ClosedAt,
+			Invested:    position.Invested,
+			Proceeds:    position.Proceeds,
+			PnL:         position.RealizedPnL + position.UnrealizedPnL(),
+			EntryReason: entryReasons[position.Mint],
+			ExitReason:  exitReasons[position.Mint],
+			Open:        position.Open(),
+		}
+		if last := token.Info[len(token.Info)-1].BondingState; trade.Open && last != nil && last.Complete {
+			trade.ExitReason = "migrated while held"
+		}
+		recorded.Trades = append(recorded.Trades, trade)
+	}
+	recorded.Totals = book.Totals()
+	return recorded, nil
+}
+
+// positionAmount is the SOL the session spent on every buy of strategy, as written to its
+// manifest, or the configured position amount for sessions without one.
+func (r Recorded) positionAmount(strategy string) float64 {
+	if r.Manifest == nil {
+		return models.PositionAmount
+	}
+	config, _ := r.Manifest.Config.(map[string]any)
+	running, _ := config["Strategies"].([]any)
+	for _, entry := range running {
+		settings, _ := entry.(map[string]any)
+		if name, _ := settings["Name"].(string); name != strategy && strategy != "" {
+			continue
+		}
+		parameters, _ := settings["Parameters"].(map[string]any)
+		if amount, ok := parameters["PositionAmount"].(float64); ok && amount > 0 {
+			return amount
+		}
+	}
+	return models.PositionAmount
+}
+
+// fillTimes dates the buys and sells of every mint, in order. Sessions with a lifecycle
+// log date them with the transitions to Held and Closed. Older ones with the first trading
+// row of a token after its Trading or Sold flag was raised, which is dated by the
+// snapshot taken in the round that followed the fill.
+func fillTimes(logs reader.Session) (map[string][]time.Time, map[string][]time.Time) {
+	entries := make(map[string][]time.Time)
+	exits := make(map[string][]time.Time)
+	for _, event := range logs.Events {
+		if event.Kind != reader.KindTransition || event.Forced {
+			continue
+		}
+		switch event.To {
+		case models.StateHeld:
+			entries[event.Mint] = append(entries[event.Mint], event.Time)
+		case models.StateClosed:
+			exits[event.Mint] = append(exits[event.Mint], event.Time)
+		}
+	}
+
+	logged := make(map[string]bool)
+	for mint := range entries {
+		logged[mint] = true
+	}
+	trading := make(map[string]bool)
+	sold := make(map[string]bool)
+	for _, snapshot := range logs.Snapshots {
+		if snapshot.Kind != reader.KindTrading || logged[snapshot.Mint] {
+			continue
+		}
+		if snapshot.Trading && !trading[snapshot.Mint] {
+			entries[snapshot.Mint] = append(entries[snapshot.Mint], snapshot.Time)
+		}
+		if snapshot.Sold && !sold[snapshot.Mint] {
+			exits[snapshot.Mint] = append(exits[snapshot.Mint], snapshot.Time)
+		}
+		trading[snapshot.Mint] = snapshot.Trading
+		sold[snapshot.Mint] = snapshot.Sold
+	}
+	return entries, exits
+}
+
+// nextTime takes the next fill time of mint off times, or the token's last snapshot when
+// no time is left.
+func nextTime(times map[string][]time.Time, mint string, token models.MemeToken) time.Time {
+	if pending := times[mint]; len(pending) > 0 {
+		times[mint] = pending[1:]
+		return pending[0]
+	}
+	return token.Info[len(token.Info)-1].Snapshot
+}
+
+// snapshotAt returns token with the snapshots taken up to at, and at least its first one.
+func snapshotAt(token models.MemeToken, at time.Time) models.MemeToken {
+	count := 1
+	for count < len(token.Info) && !token.Info[count].Snapshot.After(at) {
+		count++
+	}
+	token.Info = token.Info[:count]
+	return token
+}
@@ -0,0 +1,94 @@
+package sessions
+
+import (
+	"b46/b46/_sys_init"
+	"b46/b46/logging"
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/risk"
+	"b46/b46/strategies"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := logging.InitLogSession(); err != nil {
+		t.Fatal(err)
+	}
+	env := _sys_init.Env
+	_sys_init.Env = &_sys_init.Enviro{DEVELOPMENT: "TRUE"}
+	t.Cleanup(func() { _sys_init.Env = env })
+
+	allocations, err := risk.ParseAllocations("fast=kamikaze:0.01:1:PositionAmount=0.006,slow=kamikaze:0.02:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := strategies.NewStrategies(allocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := strategies.NewEngine(running, allocations)
+	engine.Wallet = solana.NewWallet().PublicKey()
+	engine.Trader = &strategies.Trader{Portfolio: portfolio.New()}
+
+	// session.json is written when the session starts...
+	engine.StartSession()
+	started, err := Load(logging.SessionDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := started.Manifest
+	if manifest == nil {
+		t.Fatal("no manifest read back")
+	}
+	if manifest.Session != started.Name || manifest.Wallet != engine.Wallet.String() || manifest.Profile != "development" || manifest.Schema != logging.SchemaVersion {
+		t.Errorf("started manifest %+v", manifest)
+	}
+	if !manifest.StartTime.Equal(engine.Manifest.StartTime) || manifest.EndTime != nil || manifest.Summary != nil {
+		t.Errorf("started manifest from %s to %v with %+v, want only a start", manifest.StartTime, manifest.EndTime, manifest.Summary)
+	}
+	if amount := started.positionAmount("fast"); amount != 0.006 {
+		t.Errorf("fast spent %v per buy, want 0.006", amount)
+	}
+	if amount := started.positionAmount("slow"); amount != models.PositionAmount {
+		t.Errorf("slow spent %v per buy, want %v", amount, models.PositionAmount)
+	}
+	settings := flattenManifest(started)
+	for key, want := range map[string]string{
+		"Settings.Live":                             "false",
+		"Strategies.fast.Allocation.Kind":           "kamikaze",
+		"Strategies.fast.Parameters.EntryMarketCap": fmt.Sprint(models.EntryMarketCap),
+		"Strategies.slow.Allocation.MaxPositions":   "2",
+	} {
+		if got := settings[key]; got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// ...and updated with the summary when it ends.
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Symbol: "TEST"}
+	engine.Trader.Portfolio.ApplyFill(token, models.Fill{
+		Mint: token.Mint, Side: models.FillSideBuy, TokenAmount: 1_000_000, SolLamports: models.LamportsPerSOL / 100, Strategy: "fast",
+	})
+	engine.CloseSession()
+	ended, err := Load(logging.SessionDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest = ended.Manifest
+	if manifest == nil || manifest.EndTime == nil || manifest.Summary == nil {
+		t.Fatalf("ended manifest %+v, want an end and a summary", manifest)
+	}
+	if !manifest.StartTime.Equal(started.Manifest.StartTime) || manifest.EndTime.Before(manifest.StartTime) {
+		t.Errorf("ended manifest from %s to %s", manifest.StartTime, manifest.EndTime)
+	}
+	totals := engine.Trader.Portfolio.Totals()
+	if manifest.Summary.OpenPositions != 1 || manifest.Summary.Invested != totals.Invested || manifest.Summary.PnL != totals.PnL() {
+		t.Errorf("summary %+v, want the totals %s", manifest.Summary, totals)
+	}
+	if ended.positionAmount("fast") != 0.006 {
+		t.Errorf("config lost when the manifest was rewritten: %+v", manifest.Config)
+	}
+}
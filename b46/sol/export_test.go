@@ -0,0 +1,5 @@
+package sol
+
+// CreateAssociatedAccountWithRetry exposes the creation of the associated token account
+// to the tests running against the fake node.
+var CreateAssociatedAccountWithRetry = createAssociatedAccountWithRetry
@@ -0,0 +1,327 @@
+package fakenode
+
+import (
+	"b46/b46/models"
+	"b46/b46/sol"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"math/big"
+)
+
+const (
+	baseFeeLamports      = 5000    // fee of every signature
+	defaultComputeUnits  = 200_000 // compute limit of an instruction without SetComputeUnitLimit
+	maxComputeUnits      = 1_400_000
+	consumedComputeUnits = 30_000 // compute units reported for every instruction
+)
+
+// Errors of the pump.fun program and the programs it calls, as custom instruction errors.
+const (
+	errorInsufficientFunds     = 1
+	errorAccountNotInitialized = 3012
+	errorTooMuchSolRequired    = 6002
+	errorTooLittleSolReceived  = 6003
+	errorMintDoesNotMatchCurve = 6004
+	errorBondingCurveComplete  = 6005
+)
+
+// Instruction tags of the compute budget and associated token account programs.
+const (
+	computeBudgetSetUnitLimit    = 2
+	computeBudgetSetUnitPrice    = 3
+	associatedTokenCreateIfEmpty = 1
+)
+
+// instructionError fails the instruction at index with a custom program error, or with a
+// builtin one like "InvalidInstructionData" when custom is 0. An index of -1 fails the
+// whole transaction before any instruction runs.
+type instructionError struct {
+	index   int
+	custom  uint32
+	builtin string
+	message string
+}
+
+func (e *instructionError) Error() string {
+	if e.index < 0 {
+		return e.message
+	}
+	return fmt.Sprintf("instruction %d: %s", e.index, e.message)
+}
+
+// rpc returns the error the way transaction results carry it.
+func (e *instructionError) rpc() any {
+	if e.index < 0 {
+		return e.builtin
+	}
+	var detail any = e.builtin
+	if e.builtin == "" {
+		detail = map[string]any{"Custom": e.custom}
+	}
+	return map[string]any{"InstructionError": []any{e.index, detail}}
+}
+
+// outcome is what executing a transaction did.
+type outcome struct {
+	err    *instructionError
+	fee    uint64
+	units  uint64
+	logs   []string
+	trades []models.PumpTrade
+}
+
+// execute runs the instructions of tx against a clone of ledger and returns the clone, or
+// a clone with only the fee charged when an instruction fails. A payer that cannot pay
+// the fee fails the transaction with ledger unchanged. timestamp dates the trades.
+func execute(ledger *ledger, tx *solana.Transaction, timestamp int64) (*ledger, outcome) {
+	keys := tx.Message.AccountKeys
+	payer := keys[0]
+
+	var price, limit uint64
+	instructions := 0
+	for _, ix := range tx.Message.Instructions {
+		program := keys[ix.ProgramIDIndex]
+		if !program.Equals(solana.ComputeBudget) {
+			instructions++
+			continue
+		}
+		switch {
+		case len(ix.Data) >= 9 && ix.Data[0] == computeBudgetSetUnitPrice:
+			price = binary.LittleEndian.Uint64(ix.Data[1:])
+		case len(ix.Data) >= 5 && ix.Data[0] == computeBudgetSetUnitLimit:
+			limit = uint64(binary.LittleEndian.Uint32(ix.Data[1:]))
+		}
+	}
+	if limit == 0 {
+		limit = min(uint64(instructions)*defaultComputeUnits, maxComputeUnits)
+	}
+	result := outcome{fee: uint64(len(tx.Signatures))*baseFeeLamports + (price*limit+999_999)/1_000_000}
+
+	if ledger.lamports[payer] < result.fee {
+		result.err = &instructionError{index: -1, builtin: "InsufficientFundsForFee", message: "insufficient funds for fee"}
+		return ledger, result
+	}
+	working := ledger.clone()
+	working.lamports[payer] -= result.fee
+	for i, ix := range tx.Message.Instructions {
+		program := keys[ix.ProgramIDIndex]
+		accounts := make([]solana.PublicKey, len(ix.Accounts))
+		for j, index := range ix.Accounts {
+			accounts[j] = keys[index]
+		}
+		result.logs = append(result.logs, fmt.Sprintf("Program %s invoke [1]", program))
+		var err *instructionError
+		switch {
+		case program.Equals(solana.ComputeBudget):
+		case program.Equals(models.SystemAssociatedTokenAccountProgram):
+			result.logs = append(result.logs, "Program log: Create")
+			err = createAssociatedAccount(working, accounts, ix.Data)
+		case program.Equals(models.PumpProgramPublic):
+			var trade models.PumpTrade
+			trade, err = pumpInstruction(working, accounts, ix.Data, tx.IsSigner, &result)
+			if err == nil {
+				trade.Timestamp = timestamp
+				result.trades = append(result.trades, trade)
+				result.logs = append(result.logs, "Program data: "+base64.StdEncoding.EncodeToString(encodeTradeEvent(trade)))
+			}
+		default:
+			err = &instructionError{builtin: "UnsupportedProgramId", message: "unsupported program " + program.String()}
+		}
+		if err != nil {
+			err.index = i
+			result.logs = append(result.logs, fmt.Sprintf("Program %s failed: %s", program, err.message))
+			result.err = err
+			charged := ledger.clone()
+			charged.lamports[payer] -= result.fee
+			return charged, result
+		}
+		if !program.Equals(solana.ComputeBudget) {
+			result.units += consumedComputeUnits
+			result.logs = append(result.logs, fmt.Sprintf("Program %s consumed %d of %d compute units", program, consumedComputeUnits, limit))
+		}
+		result.logs = append(result.logs, fmt.Sprintf("Program %s success", program))
+	}
+	return working, result
+}
+
+// createAssociatedAccount creates the token account of wallet for mint, paid by payer.
+func createAssociatedAccount(ledger *ledger, accounts []solana.PublicKey, data []byte) *instructionError {
+	if len(accounts) < 4 {
+		return &instructionError{builtin: "NotEnoughAccountKeys", message: "not enough account keys"}
+	}
+	payer, address, wallet, mint := accounts[0], accounts[1], accounts[2], accounts[3]
+	expected, _, err := solana.FindAssociatedTokenAddress(wallet, mint)
+	if err != nil || !expected.Equals(address) {
+		return &instructionError{builtin: "InvalidSeeds", message: "associated address does not match seed derivation"}
+	}
+	if _, exists := ledger.tokens[address]; exists {
+		if len(data) > 0 && data[0] == associatedTokenCreateIfEmpty {
+			return nil
+		}
+		return &instructionError{builtin: "AccountAlreadyInitialized", message: "account already in use"}
+	}
+	if ledger.lamports[payer] < models.AtaRentLamports {
+		return &instructionError{custom: errorInsufficientFunds, message: "insufficient lamports for rent"}
+	}
+	ledger.lamports[payer] -= models.AtaRentLamports
+	ledger.lamports[address] += models.AtaRentLamports
+	ledger.tokens[address] = tokenAccount{Mint: mint, Owner: wallet}
+	return nil
+}
+
+// pumpInstruction executes a pump.fun buy or sell. Both take the accounts global, fee
+// recipient, mint, bonding curve, associated bonding curve, token account and user.
+func pumpInstruction(ledger *ledger, accounts []solana.PublicKey, data []byte, signer func(solana.PublicKey) bool, result *outcome) (models.PumpTrade, *instructionError) {
+	if len(data) < 24 {
+		return models.PumpTrade{}, &instructionError{builtin: "InvalidInstructionData", message: "invalid instruction data"}
+	}
+	if len(accounts) < 7 {
+		return models.PumpTrade{}, &instructionError{builtin: "NotEnoughAccountKeys", message: "not enough account keys"}
+	}
+	amount := binary.LittleEndian.Uint64(data[8:])
+	limit := binary.LittleEndian.Uint64(data[16:])
+	fee, mint, bondingCurve, associatedCurve, tokenAddress, user := accounts[1], accounts[2], accounts[3], accounts[4], accounts[5], accounts[6]
+
+	if !signer(user) {
+		return models.PumpTrade{}, &instructionError{builtin: "MissingRequiredSignature", message: "missing required signature for instruction"}
+	}
+	found, exists := ledger.curves[bondingCurve]
+	if !exists {
+		return models.PumpTrade{}, &instructionError{custom: errorAccountNotInitialized, message: "bonding curve not initialized"}
+	}
+	if !found.Mint.Equals(mint) {
+		return models.PumpTrade{}, &instructionError{custom: errorMintDoesNotMatchCurve, message: "mint does not match bonding curve"}
+	}
+	if found.State.Complete {
+		return models.PumpTrade{}, &instructionError{custom: errorBondingCurveComplete, message: "bonding curve complete"}
+	}
+	holding, exists := ledger.tokens[tokenAddress]
+	if !exists || !holding.Owner.Equals(user) || !holding.Mint.Equals(mint) {
+		return models.PumpTrade{}, &instructionError{custom: errorAccountNotInitialized, message: "token account not initialized"}
+	}
+
+	switch {
+	case bytes.Equal(data[:8], sol.Discriminator):
+		result.logs = append(result.logs, "Program log: Instruction: Buy")
+		return buy(ledger, &found, bondingCurve, associatedCurve, tokenAddress, user, fee, amount, limit)
+	case bytes.Equal(data[:8], sol.SellDiscriminator):
+		result.logs = append(result.logs, "Program log: Instruction: Sell")
+		return sell(ledger, &found, bondingCurve, associatedCurve, tokenAddress, user, fee, amount, limit)
+	default:
+		return models.PumpTrade{}, &instructionError{builtin: "InvalidInstructionData", message: "unknown pump.fun instruction"}
+	}
+}
+
+// buy takes up to tokens off the curve for at most maxSolCost lamports, fee included.
+func buy(ledger *ledger, found *curve, bondingCurve, associatedCurve, tokenAddress, user, feeRecipient solana.PublicKey, tokens, maxSolCost uint64) (models.PumpTrade, *instructionError) {
+	state := &found.State
+	tokens = min(tokens, state.RealTokenReserves)
+	if tokens == 0 {
+		return models.PumpTrade{}, &instructionError{custom: errorBondingCurveComplete, message: "no tokens left on the bonding curve"}
+	}
+	// cost = tokens * virtualSol / (virtualTokens - tokens) + 1
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(tokens), new(big.Int).SetUint64(state.VirtualSolReserves))
+	cost.Quo(cost, new(big.Int).SetUint64(state.VirtualTokenReserves-tokens))
+	solCost := cost.Uint64() + 1
+	fee := solCost * models.PumpFeeBasisPoints / 10000
+	if solCost+fee > maxSolCost {
+		return models.PumpTrade{}, &instructionError{custom: errorTooMuchSolRequired, message: fmt.Sprintf("too much SOL required: %d > %d", solCost+fee, maxSolCost)}
+	}
+	if ledger.lamports[user] < solCost+fee {
+		return models.PumpTrade{}, &instructionError{custom: errorInsufficientFunds, message: "insufficient lamports"}
+	}
+
+	state.VirtualTokenReserves -= tokens
+	state.RealTokenReserves -= tokens
+	state.VirtualSolReserves += solCost
+	state.RealSolReserves += solCost
+	state.Complete = state.RealTokenReserves == 0
+	ledger.curves[bondingCurve] = *found
+
+	ledger.lamports[user] -= solCost + fee
+	ledger.lamports[bondingCurve] += solCost
+	ledger.lamports[feeRecipient] += fee
+	moveTokens(ledger, associatedCurve, tokenAddress, tokens)
+	return tradeOf(found, user, true, solCost, tokens), nil
+}
+
+// sell puts tokens back on the curve for at least minSolOutput lamports, fee deducted.
+func sell(ledger *ledger, found *curve, bondingCurve, associatedCurve, tokenAddress, user, feeRecipient solana.PublicKey, tokens, minSolOutput uint64) (models.PumpTrade, *instructionError) {
+	state := &found.State
+	if ledger.tokens[tokenAddress].Amount < tokens {
+		return models.PumpTrade{}, &instructionError{custom: errorInsufficientFunds, message: "insufficient token balance"}
+	}
+	// output = tokens * virtualSol / (virtualTokens + tokens)
+	output := new(big.Int).Mul(new(big.Int).SetUint64(tokens), new(big.Int).SetUint64(state.VirtualSolReserves))
+	output.Quo(output, new(big.Int).SetUint64(state.VirtualTokenReserves+tokens))
+	solOut := min(output.Uint64(), state.RealSolReserves)
+	fee := solOut * models.PumpFeeBasisPoints / 10000
+	if solOut-fee < minSolOutput {
+		return models.PumpTrade{}, &instructionError{custom: errorTooLittleSolReceived, message: fmt.Sprintf("too little SOL received: %d < %d", solOut-fee, minSolOutput)}
+	}
+
+	state.VirtualTokenReserves += tokens
+	state.RealTokenReserves += tokens
+	state.VirtualSolReserves -= solOut
+	state.RealSolReserves -= solOut
+	ledger.curves[bondingCurve] = *found
+
+	ledger.lamports[bondingCurve] -= solOut
+	ledger.lamports[user] += solOut - fee
+	ledger.lamports[feeRecipient] += fee
+	moveTokens(ledger, tokenAddress, associatedCurve, tokens)
+	return tradeOf(found, user, false, solOut, tokens), nil
+}
+
+func moveTokens(ledger *ledger, from, to solana.PublicKey, amount uint64) {
+	source, destination := ledger.tokens[from], ledger.tokens[to]
+	source.Amount -= amount
+	destination.Amount += amount
+	ledger.tokens[from], ledger.tokens[to] = source, destination
+}
+
+func tradeOf(found *curve, user solana.PublicKey, isBuy bool, solAmount, tokenAmount uint64) models.PumpTrade {
+	return models.PumpTrade{
+		Mint:                 found.Mint,
+		User:                 user,
+		IsBuy:                isBuy,
+		SolAmount:            solAmount,
+		TokenAmount:          tokenAmount,
+		VirtualSolReserves:   found.State.VirtualSolReserves,
+		VirtualTokenReserves: found.State.VirtualTokenReserves,
+	}
+}
+
+// encodeTradeEvent lays trade out like the pump.fun TradeEvent, see sol.ParseTradeEvent.
+func encodeTradeEvent(trade models.PumpTrade) []byte {
+	data := append([]byte{}, sol.TradeEventDiscriminator...)
+	data = append(data, trade.Mint.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, trade.SolAmount)
+	data = binary.LittleEndian.AppendUint64(data, trade.TokenAmount)
+	if trade.IsBuy {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	data = append(data, trade.User.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(trade.Timestamp))
+	data = binary.LittleEndian.AppendUint64(data, trade.VirtualSolReserves)
+	data = binary.LittleEndian.AppendUint64(data, trade.VirtualTokenReserves)
+	return data
+}
+
+// encodeCreateEvent lays a launch out like the pump.fun CreateEvent, see sol.ParseCreateInstruction.
+func encodeCreateEvent(token models.MemeToken, creator solana.PublicKey) []byte {
+	data := append([]byte{}, sol.CreateEventDiscriminator...)
+	for _, field := range []string{token.Name, token.Symbol, token.URI} {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(field)))
+		data = append(data, field...)
+	}
+	data = append(data, token.Mint.Bytes()...)
+	data = append(data, token.BondingCurve.Bytes()...)
+	data = append(data, creator.Bytes()...)
+	return data
+}
@@ -0,0 +1,152 @@
+package fakenode
+
+import (
+	"b46/b46/models"
+	"b46/b46/sol"
+	"bytes"
+	"encoding/binary"
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"maps"
+	"math/big"
+)
+
+// Reserves of a freshly launched pump.fun bonding curve, in raw units.
+const (
+	InitialVirtualTokenReserves = 1_073_000_000_000_000
+	InitialVirtualSolReserves   = 30_000_000_000
+	InitialRealTokenReserves    = 793_100_000_000_000
+	InitialTokenTotalSupply     = 1_000_000_000_000_000
+
+	curveRentLamports = 1_461_600 // rent exempt minimum of a bonding curve account
+)
+
+// curve is a bonding curve account.
+type curve struct {
+	Mint  solana.PublicKey
+	State models.BondingCurveState
+}
+
+// tokenAccount is an SPL token account.
+type tokenAccount struct {
+	Mint   solana.PublicKey
+	Owner  solana.PublicKey
+	Amount uint64
+}
+
+// ledger is the account state of the node. Transactions execute against a clone that
+// replaces the ledger when they succeed.
+type ledger struct {
+	lamports map[solana.PublicKey]uint64
+	curves   map[solana.PublicKey]curve        // by bonding curve address
+	tokens   map[solana.PublicKey]tokenAccount // by token account address
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		lamports: make(map[solana.PublicKey]uint64),
+		curves:   make(map[solana.PublicKey]curve),
+		tokens:   make(map[solana.PublicKey]tokenAccount),
+	}
+}
+
+func (l *ledger) clone() *ledger {
+	return &ledger{lamports: maps.Clone(l.lamports), curves: maps.Clone(l.curves), tokens: maps.Clone(l.tokens)}
+}
+
+// launch creates the bonding curve of mint with its token account holding the supply
+// for sale.
+func (l *ledger) launch(mint solana.PublicKey) (solana.PublicKey, solana.PublicKey) {
+	bondingCurve, _, _ := sol.GetBondingCurveAddress(mint, models.PumpProgramPublic)
+	associatedCurve := sol.FindAssociatedBondingCurve(mint, bondingCurve)
+	l.curves[bondingCurve] = curve{Mint: mint, State: models.BondingCurveState{
+		VirtualTokenReserves: InitialVirtualTokenReserves,
+		VirtualSolReserves:   InitialVirtualSolReserves,
+		RealTokenReserves:    InitialRealTokenReserves,
+		TokenTotalSupply:     InitialTokenTotalSupply,
+	}}
+	l.lamports[bondingCurve] = curveRentLamports
+	l.tokens[associatedCurve] = tokenAccount{Mint: mint, Owner: bondingCurve, Amount: InitialRealTokenReserves}
+	l.lamports[associatedCurve] = models.AtaRentLamports
+	return bondingCurve, associatedCurve
+}
+
+// curveOf finds the bonding curve of mint.
+func (l *ledger) curveOf(mint solana.PublicKey) (solana.PublicKey, curve, bool) {
+	bondingCurve, _, err := sol.GetBondingCurveAddress(mint, models.PumpProgramPublic)
+	if err != nil {
+		return solana.PublicKey{}, curve{}, false
+	}
+	found, exists := l.curves[bondingCurve]
+	return bondingCurve, found, exists
+}
+
+// exists reports whether the account holds lamports or data.
+func (l *ledger) exists(key solana.PublicKey) bool {
+	_, isCurve := l.curves[key]
+	_, isToken := l.tokens[key]
+	return l.lamports[key] > 0 || isCurve || isToken
+}
+
+// account encodes the account at key as getAccountInfo returns it, nil when it does not exist.
+func (l *ledger) account(key solana.PublicKey) *rpc.Account {
+	if !l.exists(key) {
+		return nil
+	}
+	owner := solana.SystemProgramID
+	var data []byte
+	if found, isCurve := l.curves[key]; isCurve {
+		owner = models.PumpProgramPublic
+		data = encodeCurve(found.State)
+	} else if found, isToken := l.tokens[key]; isToken {
+		owner = solana.TokenProgramID
+		data = encodeTokenAccount(found)
+	}
+	return &rpc.Account{
+		Lamports:  l.lamports[key],
+		Owner:     owner,
+		Data:      rpc.DataBytesOrJSONFromBytes(data),
+		RentEpoch: big.NewInt(0),
+		Space:     uint64(len(data)),
+	}
+}
+
+// tokenBalance encodes a token amount as the RPC does.
+func tokenBalance(amount uint64) *rpc.UiTokenAmount {
+	ui := new(big.Float).Quo(new(big.Float).SetUint64(amount), big.NewFloat(1e6))
+	value, _ := ui.Float64()
+	return &rpc.UiTokenAmount{
+		Amount:         new(big.Int).SetUint64(amount).String(),
+		Decimals:       models.TOKEN_DECIMALS,
+		UiAmount:       &value,
+		UiAmountString: ui.Text('f', -1),
+	}
+}
+
+// encodeCurve lays the curve state out like the pump.fun BondingCurve account.
+func encodeCurve(state models.BondingCurveState) []byte {
+	data := make([]byte, 8+5*8+1)
+	copy(data, sol.ExpectedDiscriminator)
+	binary.LittleEndian.PutUint64(data[8:], state.VirtualTokenReserves)
+	binary.LittleEndian.PutUint64(data[16:], state.VirtualSolReserves)
+	binary.LittleEndian.PutUint64(data[24:], state.RealTokenReserves)
+	binary.LittleEndian.PutUint64(data[32:], state.RealSolReserves)
+	binary.LittleEndian.PutUint64(data[40:], state.TokenTotalSupply)
+	if state.Complete {
+		data[48] = 1
+	}
+	return data
+}
+
+func encodeTokenAccount(account tokenAccount) []byte {
+	var buf bytes.Buffer
+	_ = bin.NewBinEncoder(&buf).Encode(token.Account{
+		Mint:   account.Mint,
+		Owner:  account.Owner,
+		Amount: account.Amount,
+		State:  token.Initialized,
+	})
+	return buf.Bytes()
+}
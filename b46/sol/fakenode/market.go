@@ -0,0 +1,174 @@
+package fakenode
+
+import (
+	"b46/b46/models"
+	"b46/b46/sol"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// Fund credits account with lamports, like an airdrop.
+func (node *Node) Fund(account solana.PublicKey, lamports uint64) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	node.ledger.lamports[account] += lamports
+	node.notifyAccounts([]solana.PublicKey{account})
+}
+
+// Launch creates a token on a fresh bonding curve and announces it to the log
+// subscriptions like pump.fun does, so PumpFunListener picks it up. The returned token is
+// the one the listener sends on.
+func (node *Node) Launch(name, symbol, uri string, creator solana.PublicKey) models.MemeToken {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	mint := solana.NewWallet().PublicKey()
+	bondingCurve, associatedCurve := node.ledger.launch(mint)
+	token := sol.ParseTokenInfo(map[string]string{
+		"name":         name,
+		"symbol":       symbol,
+		"uri":          uri,
+		"mint":         mint.String(),
+		"bondingCurve": bondingCurve.String(),
+		"user":         creator.String(),
+	})
+
+	node.slot++
+	logs := []string{
+		fmt.Sprintf("Program %s invoke [1]", models.PumpProgramPublic),
+		"Program log: Instruction: Create",
+		"Program data: " + base64.StdEncoding.EncodeToString(encodeCreateEvent(token, creator)),
+		fmt.Sprintf("Program %s success", models.PumpProgramPublic),
+	}
+	keys := []solana.PublicKey{creator, mint, bondingCurve, associatedCurve, models.PumpProgramPublic}
+	node.notifyLogs(randomSignature(), nil, logs, keys)
+	return token
+}
+
+// Trade buys or sells mint on behalf of trader, outside of any transaction sent to the
+// node, to move the curve like other traders do. A buy spends amount lamports, fee
+// included, a sell disposes of amount raw token units. The trade is announced to the log
+// subscriptions.
+func (node *Node) Trade(trader, mint solana.PublicKey, isBuy bool, amount uint64) (models.PumpTrade, error) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	bondingCurve, found, exists := node.ledger.curveOf(mint)
+	if !exists {
+		return models.PumpTrade{}, fmt.Errorf("no bonding curve for %s", mint)
+	}
+	if found.State.Complete {
+		return models.PumpTrade{}, fmt.Errorf("bonding curve of %s is complete", mint)
+	}
+	associatedCurve := sol.FindAssociatedBondingCurve(mint, bondingCurve)
+	tokenAddress, _, _ := solana.FindAssociatedTokenAddress(trader, mint)
+
+	working := node.ledger.clone()
+	if _, held := working.tokens[tokenAddress]; !held {
+		if err := createAssociatedAccount(working, []solana.PublicKey{trader, tokenAddress, trader, mint}, nil); err != nil {
+			return models.PumpTrade{}, err
+		}
+	}
+	var trade models.PumpTrade
+	var err *instructionError
+	if isBuy {
+		// The tokens amount lamports buy once the fee is set aside.
+		solIn := amount * 10000 / (10000 + models.PumpFeeBasisPoints)
+		product := new(big.Int).Mul(new(big.Int).SetUint64(found.State.VirtualSolReserves), new(big.Int).SetUint64(found.State.VirtualTokenReserves))
+		remaining := product.Quo(product, new(big.Int).SetUint64(found.State.VirtualSolReserves+solIn))
+		tokens := found.State.VirtualTokenReserves - remaining.Uint64()
+		trade, err = buy(working, &found, bondingCurve, associatedCurve, tokenAddress, trader, models.PumpFee, tokens, math.MaxUint64)
+	} else {
+		trade, err = sell(working, &found, bondingCurve, associatedCurve, tokenAddress, trader, models.PumpFee, amount, 0)
+	}
+	if err != nil {
+		return models.PumpTrade{}, err
+	}
+	node.ledger = working
+	node.slot++
+	trade.Timestamp = node.now()
+
+	logs := []string{
+		fmt.Sprintf("Program %s invoke [1]", models.PumpProgramPublic),
+		"Program log: Instruction: Sell",
+		"Program data: " + base64.StdEncoding.EncodeToString(encodeTradeEvent(trade)),
+		fmt.Sprintf("Program %s success", models.PumpProgramPublic),
+	}
+	if isBuy {
+		logs[1] = "Program log: Instruction: Buy"
+	}
+	signature := randomSignature()
+	trade.Signature = signature.String()
+	keys := []solana.PublicKey{trader, mint, bondingCurve, associatedCurve, tokenAddress, models.PumpProgramPublic}
+	node.notifyLogs(signature, nil, logs, keys)
+	node.notifyAccounts(keys)
+	return trade, nil
+}
+
+// Curve returns the bonding curve state of mint.
+func (node *Node) Curve(mint solana.PublicKey) (models.BondingCurveState, bool) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	_, found, exists := node.ledger.curveOf(mint)
+	return found.State, exists
+}
+
+// Balance returns the lamports of account.
+func (node *Node) Balance(account solana.PublicKey) uint64 {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	return node.ledger.lamports[account]
+}
+
+// TokenBalance returns the raw units of mint held by owner's associated token account.
+func (node *Node) TokenBalance(owner, mint solana.PublicKey) uint64 {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	address, _, _ := solana.FindAssociatedTokenAddress(owner, mint)
+	return node.ledger.tokens[address].Amount
+}
+
+// Sent counts the transactions sent to the node, whether they landed or not.
+func (node *Node) Sent() int {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	return node.sent
+}
+
+// Mints lists the mints launched on the node, in address order.
+func (node *Node) Mints() []solana.PublicKey {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	var mints []solana.PublicKey
+	for _, found := range node.ledger.curves {
+		mints = append(mints, found.Mint)
+	}
+	sort.Slice(mints, func(i, j int) bool { return bytes.Compare(mints[i][:], mints[j][:]) < 0 })
+	return mints
+}
+
+// now is the block time of the current slot, on the engine's clock.
+func (node *Node) now() int64 {
+	return models.Now().Unix()
+}
+
+func randomSignature() solana.Signature {
+	var signature solana.Signature
+	_, _ = rand.Read(signature[:])
+	return signature
+}
+
+func sortedKeys[V any](accounts map[solana.PublicKey]V) []solana.PublicKey {
+	keys := make([]solana.PublicKey, 0, len(accounts))
+	for key := range accounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	return keys
+}
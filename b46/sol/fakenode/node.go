@@ -0,0 +1,405 @@
+// Package fakenode is an in-process stand-in for a Solana RPC node with pump.fun deployed,
+// so the trading pipeline of b46/sol can run offline against known bonding curves.
+package fakenode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Node serves JSON-RPC over HTTP and subscriptions over a websocket on the same address,
+// like a validator does. It keeps the lamports, bonding curves and token accounts it
+// knows about and executes the pump.fun buys and sells sent to it against them, each
+// transaction landing in a slot of its own.
+type Node struct {
+	mutex        sync.Mutex
+	ledger       *ledger
+	slot         uint64
+	blockhashes  map[solana.Hash]bool
+	transactions map[solana.Signature]*transaction
+	sent         int
+
+	subscriptions map[uint64]*subscription
+	lastID        uint64
+
+	listener net.Listener
+	server   *http.Server
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// transaction is a landed transaction, with what getTransaction reports about it.
+type transaction struct {
+	tx        *solana.Transaction
+	slot      uint64
+	blockTime int64
+	outcome   outcome
+	meta      rpc.TransactionMeta
+}
+
+// Start serves a fresh node on addr, e.g. "127.0.0.1:8899". An empty addr picks a free
+// local port.
+func Start(addr string) (*Node, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	node := &Node{
+		ledger:        newLedger(),
+		slot:          1,
+		blockhashes:   make(map[solana.Hash]bool),
+		transactions:  make(map[solana.Signature]*transaction),
+		subscriptions: make(map[uint64]*subscription),
+		listener:      listener,
+	}
+	node.ctx, node.cancel = context.WithCancel(context.Background())
+	node.server = &http.Server{Handler: node}
+	go node.server.Serve(listener)
+	return node, nil
+}
+
+// URL is the JSON-RPC endpoint, for rpc.New.
+func (node *Node) URL() string {
+	return "http://" + node.listener.Addr().String()
+}
+
+// WebsocketURL is the subscription endpoint, for ws.Connect and websocket.Dial.
+func (node *Node) WebsocketURL() string {
+	return "ws://" + node.listener.Addr().String()
+}
+
+// Close stops serving and drops every websocket connection.
+func (node *Node) Close() error {
+	node.cancel()
+	return node.server.Close()
+}
+
+// ServeHTTP answers JSON-RPC requests, and upgrades websocket requests to a subscription
+// connection.
+func (node *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		node.serveWebsocket(w, r)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: -32700, Message: "parse error"}})
+		return
+	}
+	result, err := node.call(req)
+	writeJSON(w, newResponse(req.ID, result, err))
+}
+
+// request is a JSON-RPC request.
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is a JSON-RPC response, with either a result or an error.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+func invalidParams(format string, args ...any) *rpcError {
+	return &rpcError{Code: -32602, Message: "Invalid params: " + fmt.Sprintf(format, args...)}
+}
+
+func newResponse(id json.RawMessage, result any, err *rpcError) response {
+	if err != nil {
+		return response{JSONRPC: "2.0", ID: id, Error: err}
+	}
+	data, errMarshal := json.Marshal(result)
+	if errMarshal != nil {
+		return response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: -32603, Message: errMarshal.Error()}}
+	}
+	return response{JSONRPC: "2.0", ID: id, Result: data}
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// param decodes the index-th parameter into value, reporting whether it was given.
+func param(params []json.RawMessage, index int, value any) (bool, *rpcError) {
+	if index >= len(params) || string(params[index]) == "null" {
+		return false, nil
+	}
+	if err := json.Unmarshal(params[index], value); err != nil {
+		return false, invalidParams("parameter %d: %v", index, err)
+	}
+	return true, nil
+}
+
+// publicKeyParam decodes the index-th parameter as a base58 public key.
+func publicKeyParam(params []json.RawMessage, index int) (solana.PublicKey, *rpcError) {
+	var key solana.PublicKey
+	given, err := param(params, index, &key)
+	if err != nil {
+		return key, err
+	}
+	if !given {
+		return key, invalidParams("missing parameter %d", index)
+	}
+	return key, nil
+}
+
+// transactionParam decodes the index-th parameter as a base64 encoded transaction.
+func transactionParam(params []json.RawMessage, index int) (*solana.Transaction, *rpcError) {
+	var encoded string
+	if given, err := param(params, index, &encoded); err != nil || !given {
+		return nil, invalidParams("missing transaction")
+	}
+	tx, err := solana.TransactionFromBase64(encoded)
+	if err != nil {
+		return nil, invalidParams("failed to deserialize transaction: %v", err)
+	}
+	return tx, nil
+}
+
+func (node *Node) context() rpc.RPCContext {
+	return rpc.RPCContext{Context: rpc.Context{Slot: node.slot}}
+}
+
+// call runs one JSON-RPC method.
+func (node *Node) call(req request) (any, *rpcError) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	switch req.Method {
+	case "getAccountInfo":
+		key, err := publicKeyParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		return rpc.GetAccountInfoResult{RPCContext: node.context(), Value: node.ledger.account(key)}, nil
+
+	case "getBalance":
+		key, err := publicKeyParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		return rpc.GetBalanceResult{RPCContext: node.context(), Value: node.ledger.lamports[key]}, nil
+
+	case "getLatestBlockhash":
+		hash := node.blockhash()
+		return rpc.GetLatestBlockhashResult{RPCContext: node.context(), Value: &rpc.LatestBlockhashResult{Blockhash: hash, LastValidBlockHeight: node.slot + 150}}, nil
+
+	case "getTokenAccountBalance":
+		key, err := publicKeyParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		account, exists := node.ledger.tokens[key]
+		if !exists {
+			return nil, invalidParams("could not find account")
+		}
+		return rpc.GetTokenAccountBalanceResult{RPCContext: node.context(), Value: tokenBalance(account.Amount)}, nil
+
+	case "getTokenAccountsByOwner":
+		owner, err := publicKeyParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		var filter struct {
+			Mint      *solana.PublicKey `json:"mint"`
+			ProgramID *solana.PublicKey `json:"programId"`
+		}
+		if _, err := param(req.Params, 1, &filter); err != nil {
+			return nil, err
+		}
+		if filter.ProgramID != nil && !filter.ProgramID.Equals(solana.TokenProgramID) {
+			return rpc.GetTokenAccountsResult{RPCContext: node.context()}, nil
+		}
+		result := rpc.GetTokenAccountsResult{RPCContext: node.context(), Value: []*rpc.TokenAccount{}}
+		for _, address := range sortedKeys(node.ledger.tokens) {
+			account := node.ledger.tokens[address]
+			if !account.Owner.Equals(owner) || (filter.Mint != nil && !account.Mint.Equals(*filter.Mint)) {
+				continue
+			}
+			result.Value = append(result.Value, &rpc.TokenAccount{Pubkey: address, Account: *node.ledger.account(address)})
+		}
+		return result, nil
+
+	case "simulateTransaction":
+		tx, err := transactionParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		value := &rpc.SimulateTransactionResult{}
+		if errCheck := node.check(tx); errCheck != nil {
+			value.Err = errCheck.rpc()
+		} else {
+			_, result := execute(node.ledger, tx, node.now())
+			value.Logs = result.logs
+			value.UnitsConsumed = &result.units
+			if result.err != nil {
+				value.Err = result.err.rpc()
+			}
+		}
+		return rpc.SimulateTransactionResponse{RPCContext: node.context(), Value: value}, nil
+
+	case "sendTransaction":
+		node.sent++
+		tx, err := transactionParam(req.Params, 0)
+		if err != nil {
+			return nil, err
+		}
+		if errCheck := node.check(tx); errCheck != nil {
+			return nil, &rpcError{Code: -32002, Message: "Transaction simulation failed: " + errCheck.Error(), Data: map[string]any{"err": errCheck.rpc(), "logs": []string{}}}
+		}
+		signature := tx.Signatures[0]
+		if _, landed := node.transactions[signature]; !landed {
+			node.land(tx)
+		}
+		return signature, nil
+
+	case "getSignatureStatuses":
+		var signatures []solana.Signature
+		if _, err := param(req.Params, 0, &signatures); err != nil {
+			return nil, err
+		}
+		statuses := make([]*rpc.SignatureStatusesResult, len(signatures))
+		for i, signature := range signatures {
+			landed, exists := node.transactions[signature]
+			if !exists {
+				continue
+			}
+			statuses[i] = &rpc.SignatureStatusesResult{Slot: landed.slot, ConfirmationStatus: rpc.ConfirmationStatusFinalized}
+			if landed.outcome.err != nil {
+				statuses[i].Err = landed.outcome.err.rpc()
+			}
+		}
+		return rpc.GetSignatureStatusesResult{RPCContext: node.context(), Value: statuses}, nil
+
+	case "getTransaction":
+		var signature solana.Signature
+		if _, err := param(req.Params, 0, &signature); err != nil {
+			return nil, err
+		}
+		landed, exists := node.transactions[signature]
+		if !exists {
+			return nil, nil
+		}
+		encoded, errEncode := landed.tx.ToBase64()
+		if errEncode != nil {
+			return nil, &rpcError{Code: -32603, Message: errEncode.Error()}
+		}
+		blockTime := solana.UnixTimeSeconds(landed.blockTime)
+		return struct {
+			Slot        uint64                  `json:"slot"`
+			BlockTime   *solana.UnixTimeSeconds `json:"blockTime"`
+			Transaction []string                `json:"transaction"`
+			Meta        *rpc.TransactionMeta    `json:"meta"`
+			Version     rpc.TransactionVersion  `json:"version"`
+		}{landed.slot, &blockTime, []string{encoded, "base64"}, &landed.meta, rpc.LegacyTransactionVersion}, nil
+
+	default:
+		return nil, &rpcError{Code: -32601, Message: "Method not found: " + req.Method}
+	}
+}
+
+// blockhash returns the blockhash of the current slot.
+func (node *Node) blockhash() solana.Hash {
+	hash := solana.Hash(sha256.Sum256(binary.LittleEndian.AppendUint64([]byte("fakenode"), node.slot)))
+	node.blockhashes[hash] = true
+	return hash
+}
+
+// check rejects transactions that would not be executed at all.
+func (node *Node) check(tx *solana.Transaction) *instructionError {
+	if len(tx.Signatures) == 0 || len(tx.Message.AccountKeys) == 0 {
+		return &instructionError{index: -1, builtin: "MissingSignatureForFee", message: "transaction has no signature"}
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		return &instructionError{index: -1, builtin: "SignatureFailure", message: "signature verification failure"}
+	}
+	if !node.blockhashes[tx.Message.RecentBlockhash] {
+		return &instructionError{index: -1, builtin: "BlockhashNotFound", message: "blockhash not found"}
+	}
+	return nil
+}
+
+// land executes tx in the next slot and tells the subscribers. Failed transactions land
+// too, paying their fee, like they do on chain when preflight is skipped.
+func (node *Node) land(tx *solana.Transaction) {
+	node.slot++
+	keys := tx.Message.AccountKeys
+	before := node.ledger
+	after, result := execute(before, tx, node.now())
+	node.ledger = after
+
+	landed := &transaction{tx: tx, slot: node.slot, blockTime: node.now(), outcome: result}
+	landed.meta = rpc.TransactionMeta{
+		Fee:                  result.fee,
+		PreBalances:          balances(before, keys),
+		PostBalances:         balances(after, keys),
+		PreTokenBalances:     tokenBalances(before, keys),
+		PostTokenBalances:    tokenBalances(after, keys),
+		LogMessages:          result.logs,
+		ComputeUnitsConsumed: &result.units,
+	}
+	if result.err != nil {
+		landed.meta.Err = result.err.rpc()
+	}
+	node.transactions[tx.Signatures[0]] = landed
+
+	node.notifyLogs(tx.Signatures[0], landed.meta.Err, result.logs, keys)
+	node.notifySignature(tx.Signatures[0], landed.meta.Err)
+	node.notifyAccounts(keys)
+}
+
+func balances(ledger *ledger, keys []solana.PublicKey) []uint64 {
+	result := make([]uint64, len(keys))
+	for i, key := range keys {
+		result[i] = ledger.lamports[key]
+	}
+	return result
+}
+
+func tokenBalances(ledger *ledger, keys []solana.PublicKey) []rpc.TokenBalance {
+	result := []rpc.TokenBalance{}
+	for i, key := range keys {
+		account, exists := ledger.tokens[key]
+		if !exists {
+			continue
+		}
+		owner := account.Owner
+		program := solana.TokenProgramID
+		result = append(result, rpc.TokenBalance{
+			AccountIndex:  uint16(i),
+			Owner:         &owner,
+			ProgramId:     &program,
+			Mint:          account.Mint,
+			UiTokenAmount: tokenBalance(account.Amount),
+		})
+	}
+	return result
+}
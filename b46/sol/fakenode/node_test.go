@@ -0,0 +1,144 @@
+package fakenode_test
+
+import (
+	"b46/b46/_sys_init"
+	"b46/b46/events"
+	"b46/b46/models"
+	"b46/b46/sol"
+	"b46/b46/sol/fakenode"
+	"context"
+	"github.com/coder/websocket"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"sync"
+	"testing"
+	"time"
+)
+
+// subscribedConn signals subscribed once the first frame, the reply to the listener's
+// subscription, has been read.
+type subscribedConn struct {
+	sol.StreamConn
+	once       sync.Once
+	subscribed chan struct{}
+}
+
+func (c *subscribedConn) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	typ, data, err := c.StreamConn.Read(ctx)
+	c.once.Do(func() { close(c.subscribed) })
+	return typ, data, err
+}
+
+// observed waits for the next trade of mint published on sub.
+func observed(t *testing.T, sub *events.Subscription, mint solana.PublicKey) models.PumpTrade {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-sub.C():
+			if trade := event.(events.TradeObservedEvent).Trade; trade.Mint.Equals(mint) {
+				return trade
+			}
+		case <-timeout:
+			t.Fatal("no trade observed")
+		}
+	}
+}
+
+// TestLaunchBuySell runs a token from its launch to a sell through the listener and the
+// live pipelines of b46/sol.
+func TestLaunchBuySell(t *testing.T) {
+	t.Chdir(t.TempDir())
+	payer := solana.NewWallet().PrivateKey
+	_sys_init.Env = &_sys_init.Enviro{PK: payer.String()}
+	buyDelay, sellDelay := sol.BuySettleDelay, sol.SellSettleDelay
+	sol.BuySettleDelay, sol.SellSettleDelay = 0, 0
+	t.Cleanup(func() { sol.BuySettleDelay, sol.SellSettleDelay = buyDelay, sellDelay })
+
+	node, err := fakenode.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	const funded = 2 * models.LamportsPerSOL
+	node.Fund(payer.PublicKey(), funded)
+	rpcClient := rpc.New(node.URL())
+	wsClient, err := ws.Connect(t.Context(), node.WebsocketURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+
+	// The listener sees the launch.
+	stream, _, err := websocket.Dial(t.Context(), node.WebsocketURL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &subscribedConn{StreamConn: stream, subscribed: make(chan struct{})}
+	bus := events.NewBus()
+	trades := bus.Subscribe("test", events.SubscribeOptions{Buffer: 16, Types: []events.Type{events.TradeObserved}})
+	tokens := make(chan models.MemeToken, 1)
+	go sol.PumpFunListener(conn, tokens, bus)
+	<-conn.subscribed
+
+	launched := node.Launch("End To End", "E2E", "https://example.com/e2e.json", solana.NewWallet().PublicKey())
+	var token models.MemeToken
+	select {
+	case token = <-tokens:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener did not see the launch")
+	}
+	if !token.Mint.Equals(launched.Mint) || token.Symbol != "E2E" || !token.BondingCurve.Equals(launched.BondingCurve) || !token.AssociatedCurve.Equals(launched.AssociatedCurve) {
+		t.Fatalf("listener sent %+v, want the launched %+v", token, launched)
+	}
+
+	// The buy lands, and shows up in the program logs.
+	executor := &sol.PumpFunExecutor{Live: true}
+	bought, err := executor.ExecuteBuyOrder(t.Context(), rpcClient, wsClient, token, 0.5, 0)
+	if err != nil {
+		t.Fatalf("ExecuteBuyOrder() error = %v", err)
+	}
+	if trade := observed(t, trades, token.Mint); !trade.IsBuy || !trade.User.Equals(payer.PublicKey()) || trade.TokenAmount != bought.TokenAmount || trade.Signature != bought.Signature.String() {
+		t.Errorf("observed %+v, want the buy of %d tokens in %s", trade, bought.TokenAmount, bought.Signature)
+	}
+
+	// Another trader lifts the price before the sell.
+	other := solana.NewWallet().PublicKey()
+	node.Fund(other, 10*models.LamportsPerSOL)
+	if _, err := node.Trade(other, token.Mint, true, 3*models.LamportsPerSOL); err != nil {
+		t.Fatal(err)
+	}
+	if trade := observed(t, trades, token.Mint); !trade.User.Equals(other) {
+		t.Errorf("observed %+v, want the other trader's buy", trade)
+	}
+
+	sold, err := executor.ExecuteSellOrder(t.Context(), rpcClient, wsClient, token, 0)
+	if err != nil {
+		t.Fatalf("ExecuteSellOrder() error = %v", err)
+	}
+	if trade := observed(t, trades, token.Mint); trade.IsBuy || trade.TokenAmount != bought.TokenAmount {
+		t.Errorf("observed %+v, want the sell of the %d tokens bought", trade, bought.TokenAmount)
+	}
+	if held := node.TokenBalance(payer.PublicKey(), token.Mint); held != 0 {
+		t.Errorf("%d tokens left after the sell", held)
+	}
+	if sold.SolLamports <= bought.SolLamports {
+		t.Errorf("sold for %d lamports after buying for %d, want a profit after the price rose", sold.SolLamports, bought.SolLamports)
+	}
+	balance := node.Balance(payer.PublicKey())
+	if want := funded - bought.SolLamports - bought.FeeLamports - bought.RentLamports + sold.SolLamports - sold.FeeLamports; balance != want {
+		t.Errorf("wallet holds %d lamports, the fills account for %d", balance, want)
+	}
+
+	// The listener stops with the node.
+	node.Close()
+	select {
+	case _, open := <-tokens:
+		if open {
+			t.Error("unexpected token after the node closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the listener did not stop with the node")
+	}
+}
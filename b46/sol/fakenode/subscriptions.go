@@ -0,0 +1,234 @@
+package fakenode
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/coder/websocket"
+	"github.com/gagliardetto/solana-go"
+	"net/http"
+)
+
+// clientBuffer is how many messages a websocket client may fall behind before it is
+// dropped, like a validator drops subscribers that do not keep up.
+const clientBuffer = 1024
+
+// client is a websocket connection. Replies and notifications are queued on outbox in
+// the order the node produces them, so a subscription is always confirmed before its
+// first notification.
+type client struct {
+	outbox chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// subscription is a logsSubscribe, signatureSubscribe or accountSubscribe of a client.
+type subscription struct {
+	id     uint64
+	client *client
+	method string
+
+	mentions  *solana.PublicKey // logs, nil for every transaction
+	signature solana.Signature  // signature
+	account   solana.PublicKey  // account
+}
+
+// notification is a subscription message, which unlike replies carries no id.
+type notification struct {
+	JSONRPC string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  notificationParams `json:"params"`
+}
+
+type notificationParams struct {
+	Result       any    `json:"result"`
+	Subscription uint64 `json:"subscription"`
+}
+
+func (node *Node) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(1 << 20)
+	c := &client{outbox: make(chan []byte, clientBuffer)}
+	c.ctx, c.cancel = context.WithCancel(node.ctx)
+
+	defer func() {
+		c.cancel()
+		node.mutex.Lock()
+		for id, sub := range node.subscriptions {
+			if sub.client == c {
+				delete(node.subscriptions, id)
+			}
+		}
+		node.mutex.Unlock()
+		conn.Close(websocket.StatusNormalClosure, "")
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case message := <-c.outbox:
+				if err := conn.Write(c.ctx, websocket.MessageText, message); err != nil {
+					c.cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.Read(c.ctx)
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue
+		}
+		node.subscribe(c, req)
+	}
+}
+
+// send queues message for c, dropping c when it has fallen too far behind. It is called
+// with the node locked.
+func (c *client) send(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	select {
+	case c.outbox <- data:
+	default:
+		c.cancel()
+	}
+}
+
+// subscribe handles a subscription request of c.
+func (node *Node) subscribe(c *client, req request) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	reply := func(result any, err *rpcError) {
+		c.send(newResponse(req.ID, result, err))
+	}
+	sub := &subscription{client: c, method: req.Method}
+	switch req.Method {
+	case "logsSubscribe":
+		var mentioned struct {
+			Mentions []solana.PublicKey `json:"mentions"`
+		}
+		var filter string
+		if _, err := param(req.Params, 0, &filter); err != nil {
+			if _, errParam := param(req.Params, 0, &mentioned); errParam != nil || len(mentioned.Mentions) != 1 {
+				reply(nil, invalidParams("expected \"all\" or one mentioned account"))
+				return
+			}
+			sub.mentions = &mentioned.Mentions[0]
+		}
+
+	case "signatureSubscribe":
+		if _, err := param(req.Params, 0, &sub.signature); err != nil {
+			reply(nil, err)
+			return
+		}
+
+	case "accountSubscribe":
+		key, err := publicKeyParam(req.Params, 0)
+		if err != nil {
+			reply(nil, err)
+			return
+		}
+		sub.account = key
+
+	case "logsUnsubscribe", "signatureUnsubscribe", "accountUnsubscribe":
+		var id uint64
+		if _, err := param(req.Params, 0, &id); err != nil {
+			reply(nil, err)
+			return
+		}
+		_, exists := node.subscriptions[id]
+		delete(node.subscriptions, id)
+		reply(exists, nil)
+		return
+
+	default:
+		reply(nil, &rpcError{Code: -32601, Message: "Method not found: " + req.Method})
+		return
+	}
+
+	node.lastID++
+	sub.id = node.lastID
+	node.subscriptions[sub.id] = sub
+	reply(sub.id, nil)
+
+	// A transaction may land before its confirmation is subscribed to.
+	if landed, exists := node.transactions[sub.signature]; exists && sub.method == "signatureSubscribe" {
+		node.notifySignature(sub.signature, landed.meta.Err)
+	}
+}
+
+// notifyLogs sends the logs of a transaction to the log subscriptions mentioning one of
+// its accounts.
+func (node *Node) notifyLogs(signature solana.Signature, err any, logs []string, keys []solana.PublicKey) {
+	for _, sub := range node.subscriptions {
+		if sub.method != "logsSubscribe" || (sub.mentions != nil && !mentions(keys, *sub.mentions)) {
+			continue
+		}
+		sub.client.send(notification{JSONRPC: "2.0", Method: "logsNotification", Params: notificationParams{
+			Result: map[string]any{
+				"context": node.context().Context,
+				"value":   map[string]any{"signature": signature, "err": err, "logs": logs},
+			},
+			Subscription: sub.id,
+		}})
+	}
+}
+
+// notifySignature confirms a transaction to its signature subscriptions, which end there.
+func (node *Node) notifySignature(signature solana.Signature, err any) {
+	for id, sub := range node.subscriptions {
+		if sub.method != "signatureSubscribe" || sub.signature != signature {
+			continue
+		}
+		sub.client.send(notification{JSONRPC: "2.0", Method: "signatureNotification", Params: notificationParams{
+			Result: map[string]any{
+				"context": node.context().Context,
+				"value":   map[string]any{"err": err},
+			},
+			Subscription: sub.id,
+		}})
+		delete(node.subscriptions, id)
+	}
+}
+
+// notifyAccounts sends the state of the given accounts to their subscriptions.
+func (node *Node) notifyAccounts(keys []solana.PublicKey) {
+	for _, sub := range node.subscriptions {
+		if sub.method != "accountSubscribe" || !mentions(keys, sub.account) {
+			continue
+		}
+		account := node.ledger.account(sub.account)
+		if account == nil {
+			continue
+		}
+		sub.client.send(notification{JSONRPC: "2.0", Method: "accountNotification", Params: notificationParams{
+			Result: map[string]any{
+				"context": node.context().Context,
+				"value":   account,
+			},
+			Subscription: sub.id,
+		}})
+	}
+}
+
+func mentions(keys []solana.PublicKey, key solana.PublicKey) bool {
+	for _, k := range keys {
+		if k.Equals(key) {
+			return true
+		}
+	}
+	return false
+}
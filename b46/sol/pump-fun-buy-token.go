@@ -5,6 +5,7 @@ import (
 	"b46/b46/models"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/gagliardetto/solana-go"
@@ -15,13 +16,16 @@ import (
 	"github.com/gagliardetto/solana-go/rpc/ws"
 	"github.com/gagliardetto/solana-go/text"
 	"log"
+	"math"
 	"os"
 	"strings"
 	"time"
 )
 
 // executeBuy is the top‐level function that performs the buy pipeline.
-func executeBuy(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve, associatedBondingCurve solana.PublicKey, amount float64) error {
+// maxPrice is the highest token price the order accepts, 0 disables the check.
+// The returned fill includes the rent and fee of the associated account when it had to be created.
+func executeBuy(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve, associatedBondingCurve solana.PublicKey, amount float64, maxPrice float64) (models.Fill, error) {
 
 	// Decode the payer’s private key.
 	// Decode the private key and create the payer
@@ -33,13 +37,16 @@ func executeBuy(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve,
 	// (1) Pre-fetch bonding curve state concurrently.
 	curveState, err := GetPumpCurveState(rpcClient, bondingCurve)
 	if err != nil {
-		return fmt.Errorf("failed to fetch bonding curve state: %v", err)
+		return models.Fill{}, fmt.Errorf("failed to fetch bonding curve state: %w", err)
 	}
 
 	// (2) Calculate token price and amount.
 	tokenPrice, err := CalculatePumpCurvePrice(curveState)
 	if err != nil {
-		return fmt.Errorf("failed to calculate pump curve price: %v", err)
+		return models.Fill{}, fmt.Errorf("failed to calculate pump curve price: %w", err)
+	}
+	if err := CheckPriceLimit("buy", tokenPrice, maxPrice); err != nil {
+		return models.Fill{}, err
 	}
 	tokenAmount := amount / tokenPrice
 	maxAmountLamports := uint64(float64(amountLamports) * (1 + models.Slippage))
@@ -55,18 +62,27 @@ func executeBuy(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve,
 		mint,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to derive associated token address: %v", err)
+		return models.Fill{}, fmt.Errorf("failed to derive associated token address: %w", err)
 	}
 	//log.Println("Associated token account:", associatedTokenAddress)
 
 	// (4) Check if the associated token account exists; if not, create it.
-	_, errAssociated := rpcClient.GetAccountInfo(context.TODO(), associatedTokenAddress)
+	var ataFill models.Fill
+	_, errAssociated := rpcClient.GetAccountInfo(ctx, associatedTokenAddress)
 	if errAssociated != nil {
 		if strings.Contains(errAssociated.Error(), "not found") {
-			errCreateAssociated := createAssociatedAccountWithRetry(payer, mint, rpcClient, wsClient, associatedTokenAddress)
+			ataSig, errCreateAssociated := createAssociatedAccountWithRetry(ctx, payer, mint, rpcClient, wsClient, associatedTokenAddress)
 			if errCreateAssociated != nil {
 				log.Printf("Failed to create associated token account: %v", errCreateAssociated)
-				return errCreateAssociated
+				return models.Fill{}, errCreateAssociated
+			}
+			// The payer's SOL delta of the ATA transaction is the account rent. It is unknown
+			// when the account turned out to be created by an attempt that reported an error.
+			if !ataSig.IsZero() {
+				ataFill, err = FillFromTransaction(ctx, rpcClient, ataSig, payer.PublicKey(), mint, models.FillSideBuy)
+				if err != nil {
+					log.Printf("Failed to measure associated account rent: %v", err)
+				}
 			}
 		} else {
 			log.Printf("Unexpected error checking associated token account: %v", errAssociated)
@@ -74,37 +90,69 @@ func executeBuy(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve,
 	}
 
 	// (5) Wait briefly for the associated account creation to propagate.
-	time.Sleep(5 * time.Second)
+	select {
+	case <-ctx.Done():
+		return models.Fill{}, ctx.Err()
+	case <-time.After(BuySettleDelay):
+	}
 
 	// (6) Create and send the buy transaction (with retries).
-	errBuy := buyTokenWithRetry(payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, tokenAmount, maxAmountLamports)
+	sig, errBuy := buyTokenWithRetry(ctx, payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, amount, maxPrice, tokenAmount, maxAmountLamports)
 	if errBuy != nil {
 		log.Printf("Buy transaction failed: %v", errBuy)
-		return errBuy
+		return models.Fill{}, errBuy
+	}
+
+	// (7) Measure the fill from the confirmed transaction, falling back to the quote.
+	fill, errFill := FillFromTransaction(ctx, rpcClient, sig, payer.PublicKey(), mint, models.FillSideBuy)
+	if errFill != nil {
+		log.Printf("Failed to measure buy fill, using quote: %v", errFill)
+		fill = models.Fill{
+			Mint:        mint,
+			Side:        models.FillSideBuy,
+			TokenAmount: uint64(tokenAmount * math.Pow10(models.TOKEN_DECIMALS)),
+			SolLamports: uint64(amountLamports),
+			FeeLamports: models.EstimatedTxFeeLamports,
+			Price:       tokenPrice,
+			Signature:   sig,
+			Time:        models.Now(),
+		}
 	}
+	fill.RentLamports = ataFill.SolLamports
+	fill.FeeLamports += ataFill.FeeLamports
 
-	return nil
+	return fill, nil
 }
 
-// buyTokenWithRetry calls buyToken with retry logic.
-func buyTokenWithRetry(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount float64, maxAmountLamports uint64) error {
-	var err error
-	for attempt := 0; attempt < models.MaxRetries; attempt++ {
-		err = buyToken(payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, tokenAmount, maxAmountLamports)
-		if err == nil {
-			return nil
+// buyTokenWithRetry calls buyToken under the shared retry policy. When the price moved
+// past the slippage bound the curve is re-fetched and the token amount requoted for the
+// same SOL amount, unless the new price is above maxPrice.
+func buyTokenWithRetry(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, amount float64, maxPrice float64, tokenAmount float64, maxAmountLamports uint64) (solana.Signature, error) {
+	requote := func() error {
+		tokenPrice, err := QuotePumpCurve(rpcClient, bondingCurve)
+		if err != nil {
+			return err
 		}
-		//log.Printf("Buy attempt %d failed: %v. Retrying...", attempt+1, err)
-		time.Sleep(time.Duration(1<<attempt) * time.Second) // exponential backoff
+		if err := CheckPriceLimit("buy", tokenPrice, maxPrice); err != nil {
+			log.Printf("Aborting buy for %s: %v", mint, err)
+			return err
+		}
+		tokenAmount = amount / tokenPrice
+		log.Printf("Requoted buy for %s: price=%.20f tokens=%f", mint, tokenPrice, tokenAmount)
+		return nil
 	}
-	return fmt.Errorf("failed to execute buy after %d retries: %v", models.MaxRetries, err)
+	var sig solana.Signature
+	err := DefaultRetryPolicy.Do(ctx, "buy", func(attempt int) error {
+		var errBuy error
+		sig, errBuy = buyToken(ctx, payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, tokenAmount, maxAmountLamports)
+		return errBuy
+	}, requote)
+	return sig, err
 }
 
 // buyToken builds, simulates, and sends the buy transaction.
 // It uses the ComputeBudget instruction for priority fees and performs a simulation pre-check.
-func buyToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount float64, maxAmountLamports uint64) error {
-	ctx := context.TODO()
-
+func buyToken(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount float64, maxAmountLamports uint64) (solana.Signature, error) {
 	// Prepare the instruction data.
 	data := append(Discriminator, make([]byte, 16)...)
 	// tokenAmount is converted to token units (e.g. if token has 6 decimals, multiply by 1e6)
@@ -139,13 +187,13 @@ func buyToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cli
 	// This helps ensure your transaction is processed faster in a congested network.
 	priorityIx, errPriority := computebudget.NewSetComputeUnitPriceInstruction(models.PriorityFeeLamport).ValidateAndBuild()
 	if errPriority != nil {
-		return fmt.Errorf("failed to set priority: %v", errPriority)
+		return solana.Signature{}, fmt.Errorf("failed to set priority: %w", errPriority)
 	}
 
 	// Pre-fetch a recent blockhash (to avoid stale blockhash issues).
 	blockhashResp, err := rpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
-		return fmt.Errorf("failed to fetch blockhash: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to fetch blockhash: %w", err)
 	}
 	blockhash := blockhashResp.Value.Blockhash
 
@@ -159,7 +207,7 @@ func buyToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cli
 		solana.TransactionPayer(payer.PublicKey()),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create transaction: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
 	// Sign the transaction.
@@ -179,10 +227,10 @@ func buyToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cli
 
 	simResult, errSim := rpcClient.SimulateTransaction(ctx, tx)
 	if errSim != nil {
-		return fmt.Errorf("transaction simulation failed: %v", err)
+		return solana.Signature{}, fmt.Errorf("transaction simulation failed: %w", errSim)
 	}
 	if simResult.Value.Err != nil {
-		return fmt.Errorf("simulation error: %v", simResult.Value.Err)
+		return solana.Signature{}, NewTransactionError("simulation", simResult.Value.Err)
 	}
 	//log.Println("Transaction simulation succeeded.")
 
@@ -194,57 +242,69 @@ func buyToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cli
 	timeout := 10 * time.Second
 	sig, errSend := confirm.SendAndConfirmTransactionWithOpts(ctx, rpcClient, wsClient, tx, opts, &timeout)
 	//log.Println(errSend)
-	if errSend != nil && errSend.Error() != "timeout" {
+	if errSend != nil && !errors.Is(errSend, confirm.ErrTimeout) {
 		log.Println(errSend)
-		return fmt.Errorf("failed to send transaction: %v", errSend)
+		return solana.Signature{}, sendError(ctx, rpcClient, sig, errSend)
+	}
+	if errSend != nil {
+		// The websocket confirmation timed out, check the signature status directly.
+		if errConfirm := ConfirmSignature(ctx, rpcClient, sig, timeout); errConfirm != nil {
+			return solana.Signature{}, fmt.Errorf("buy not confirmed: %w", errConfirm)
+		}
 	}
 
 	//spew.Dump(tx)
 	tx.EncodeTree(text.NewTreeEncoder(log.Writer(), "Buy Token"))
 	log.Println("Transaction confirmed. Signature:", sig)
-	return nil
+	return sig, nil
 }
 
-func createAssociatedAccountWithRetry(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress solana.PublicKey) error {
-
-	var err error
-	// Retry up to maxRetries times
-	for attempt := 0; attempt < models.MaxRetries; attempt++ {
-		err = createAssociateAccount(payer, mint, rpcClient, wsClient)
-		if err == nil {
-			_, errAssociated := rpcClient.GetAccountInfo(context.TODO(), associatedTokenAddress)
-			if errAssociated != nil {
-				if strings.Contains(errAssociated.Error(), "not found") {
-					// Log the error and retry
-					fmt.Printf("Attempt %d failed: %v\n", attempt+1, err)
-				}
-			} else {
-				return nil // Success
+// associatedTokenCreateIdempotent is the CreateIdempotent instruction of the associated
+// token account program.
+const associatedTokenCreateIdempotent = 1
+
+func createAssociatedAccountWithRetry(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress solana.PublicKey) (solana.Signature, error) {
+	var sig solana.Signature
+	err := DefaultRetryPolicy.Do(ctx, "create associated account", func(attempt int) error {
+		// An earlier attempt may have landed even though it reported an error.
+		if attempt > 0 {
+			if _, errAssociated := rpcClient.GetAccountInfo(ctx, associatedTokenAddress); errAssociated == nil {
+				return nil
 			}
 		}
-		// Exponential backoff (2^attempt seconds)
-		time.Sleep(time.Duration(attempt) * time.Second)
-	}
-	return fmt.Errorf("failed to create associated account after %d retries: %v", models.MaxRetries, err)
+		var errCreate error
+		sig, errCreate = createAssociateAccount(ctx, payer, mint, rpcClient, wsClient)
+		if errCreate != nil {
+			return errCreate
+		}
+		if _, errAssociated := rpcClient.GetAccountInfo(ctx, associatedTokenAddress); errAssociated != nil {
+			return fmt.Errorf("associated account %s not visible yet: %w", associatedTokenAddress, errAssociated)
+		}
+		return nil
+	}, nil)
+	return sig, err
 }
-func createAssociateAccount(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client) error {
-	ctx := context.TODO()
+
+func createAssociateAccount(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client) (solana.Signature, error) {
 	log.Println("Creating Associated account")
-	// Derive the associated token address
-	ata := associatedtokenaccount.NewCreateInstruction(
+	// Derive the associated token address. The account is created with CreateIdempotent,
+	// which succeeds when the account already exists, so a resent create cannot fail on
+	// an account created by the transaction it replaces.
+	create := associatedtokenaccount.NewCreateInstruction(
 		payer.PublicKey(),
 		payer.PublicKey(),
 		mint,
 	).Build()
+	ata := solana.NewInstruction(associatedtokenaccount.ProgramID, create.Accounts(), []byte{associatedTokenCreateIdempotent})
 
 	recentBlockhash, err := rpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
-		return fmt.Errorf("failed to fetch blockhash: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to fetch blockhash: %w", err)
 	}
 
 	priorityIx, errPriority := computebudget.NewSetComputeUnitPriceInstruction(models.PriorityFeeLamport).ValidateAndBuild()
 	if errPriority != nil {
-		return fmt.Errorf("failed to set priority: %v", errPriority)
+		return solana.Signature{}, fmt.Errorf("failed to set priority: %w", errPriority)
 	}
 	tx, err := solana.NewTransaction(
 		[]solana.Instruction{
@@ -255,7 +315,7 @@ func createAssociateAccount(payer solana.PrivateKey, mint solana.PublicKey, rpcC
 		solana.TransactionPayer(payer.PublicKey()),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create ATA transaction: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to create ATA transaction: %w", err)
 	}
 	_, err = tx.Sign(
 		func(key solana.PublicKey) *solana.PrivateKey {
@@ -266,16 +326,16 @@ func createAssociateAccount(payer solana.PrivateKey, mint solana.PublicKey, rpcC
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("unable to sign transaction:: %w", err)
+		return solana.Signature{}, fmt.Errorf("unable to sign transaction:: %w", err)
 	}
 	spew.Dump(tx)
 
 	simResult, errSim := rpcClient.SimulateTransaction(ctx, tx)
 	if errSim != nil {
-		return fmt.Errorf("transaction simulation failed: %v", err)
+		return solana.Signature{}, fmt.Errorf("transaction simulation failed: %w", errSim)
 	}
 	if simResult.Value.Err != nil {
-		return fmt.Errorf("simulation error: %v", simResult.Value.Err)
+		return solana.Signature{}, NewTransactionError("simulation", simResult.Value.Err)
 	}
 	log.Println("Transaction simulation succeeded.")
 
@@ -289,7 +349,7 @@ func createAssociateAccount(payer solana.PrivateKey, mint solana.PublicKey, rpcC
 	t := 10 * time.Second // random default timeout
 	timeout := &t
 	sig, errSend := confirm.SendAndConfirmTransactionWithOpts(
-		context.TODO(),
+		ctx,
 		rpcClient,
 		wsClient,
 		tx,
@@ -297,12 +357,17 @@ func createAssociateAccount(payer solana.PrivateKey, mint solana.PublicKey, rpcC
 		timeout,
 	)
 	//log.Println(errSend)
-	if errSend != nil && errSend.Error() != "timeout" {
+	if errSend != nil && !errors.Is(errSend, confirm.ErrTimeout) {
 		log.Println(errSend)
-		return fmt.Errorf("failed to send transaction: %v", errSend)
+		return solana.Signature{}, sendError(ctx, rpcClient, sig, errSend)
+	}
+	if errSend != nil {
+		if errConfirm := ConfirmSignature(ctx, rpcClient, sig, t); errConfirm != nil {
+			return solana.Signature{}, fmt.Errorf("associated account not confirmed: %w", errConfirm)
+		}
 	}
 
 	log.Println("Assoicate Account Created.")
 	spew.Dump(sig)
-	return nil
+	return sig, nil
 }
@@ -0,0 +1,153 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"context"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// FillFromTransaction reads a confirmed transaction and measures what it actually cost or
+// returned: the payer's SOL delta, the fee and the owner's token delta for mint.
+func FillFromTransaction(ctx context.Context, client *rpc.Client, sig solana.Signature, owner, mint solana.PublicKey, side string) (models.Fill, error) {
+	fill := models.Fill{Mint: mint, Side: side, Signature: sig, Time: models.Now()}
+
+	maxVersion := uint64(0)
+	out, err := client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return fill, fmt.Errorf("failed to fetch transaction %s: %w", sig, err)
+	}
+	if out == nil || out.Meta == nil || len(out.Meta.PreBalances) == 0 || len(out.Meta.PostBalances) == 0 {
+		return fill, fmt.Errorf("transaction %s has no metadata", sig)
+	}
+	meta := out.Meta
+	if out.BlockTime != nil {
+		fill.Time = out.BlockTime.Time()
+	}
+	fill.FeeLamports = meta.Fee
+
+	// The payer is always the first account.
+	pre, post := meta.PreBalances[0], meta.PostBalances[0]
+	if side == models.FillSideBuy {
+		if pre > post+meta.Fee {
+			fill.SolLamports = pre - post - meta.Fee
+		}
+	} else if post+meta.Fee > pre {
+		fill.SolLamports = post + meta.Fee - pre
+	}
+
+	preTokens := ownerTokenBalance(meta.PreTokenBalances, owner, mint)
+	postTokens := ownerTokenBalance(meta.PostTokenBalances, owner, mint)
+	if postTokens > preTokens {
+		fill.TokenAmount = postTokens - preTokens
+	} else {
+		fill.TokenAmount = preTokens - postTokens
+	}
+	fill.Price = fillPrice(fill.SolLamports, fill.TokenAmount)
+	return fill, nil
+}
+
+func ownerTokenBalance(balances []rpc.TokenBalance, owner, mint solana.PublicKey) uint64 {
+	var total uint64
+	for _, balance := range balances {
+		if balance.Owner == nil || !balance.Owner.Equals(owner) || !balance.Mint.Equals(mint) || balance.UiTokenAmount == nil {
+			continue
+		}
+		amount, err := strconv.ParseUint(balance.UiTokenAmount.Amount, 10, 64)
+		if err == nil {
+			total += amount
+		}
+	}
+	return total
+}
+
+// fillPrice returns the SOL price of one token for the given raw amounts.
+func fillPrice(solLamports, tokenAmount uint64) float64 {
+	if tokenAmount == 0 {
+		return 0
+	}
+	return (float64(solLamports) / models.LamportsPerSOL) / (float64(tokenAmount) / math.Pow10(models.TOKEN_DECIMALS))
+}
+
+// SimulatedFill prices an order against the token's latest snapshot without sending a
+// transaction. A buy spends amount SOL, a sell disposes of tokenAmount raw units.
+func SimulatedFill(token models.MemeToken, side string, amount float64, tokenAmount uint64) models.Fill {
+	fill := models.Fill{
+		Mint:        token.Mint,
+		Side:        side,
+		FeeLamports: models.EstimatedTxFeeLamports,
+		Time:        models.Now(),
+		Simulated:   true,
+	}
+	if len(token.Info) == 0 || token.Info[len(token.Info)-1].TokenPrice <= 0 {
+		return fill
+	}
+	price := token.Info[len(token.Info)-1].TokenPrice
+	fill.Price = price
+	if side == models.FillSideBuy {
+		fill.SolLamports = uint64(amount * models.LamportsPerSOL)
+		fill.TokenAmount = uint64(amount / price * math.Pow10(models.TOKEN_DECIMALS))
+	} else {
+		fill.TokenAmount = tokenAmount
+		fill.SolLamports = uint64(float64(tokenAmount) / math.Pow10(models.TOKEN_DECIMALS) * price * models.LamportsPerSOL)
+	}
+	return fill
+}
+
+// CurveFill fills an order against the constant product curve of the token's latest
+// snapshot, so larger orders move the price like they would on chain. A buy spends
+// amount SOL, a sell disposes of tokenAmount raw units, the pump.fun fee is taken on the
+// SOL side and buys pay the rent of the associated token account. Tokens without curve
+// state fall back to SimulatedFill.
+func CurveFill(token models.MemeToken, side string, amount float64, tokenAmount uint64, at time.Time) models.Fill {
+	if len(token.Info) == 0 || token.Info[len(token.Info)-1].BondingState == nil {
+		fill := SimulatedFill(token, side, amount, tokenAmount)
+		fill.Time = at
+		return fill
+	}
+	curve := token.Info[len(token.Info)-1].BondingState
+	fill := models.Fill{
+		Mint:        token.Mint,
+		Side:        side,
+		FeeLamports: models.EstimatedTxFeeLamports,
+		Time:        at,
+		Simulated:   true,
+	}
+	virtualSol := new(big.Int).SetUint64(curve.VirtualSolReserves)
+	virtualTokens := new(big.Int).SetUint64(curve.VirtualTokenReserves)
+	product := new(big.Int).Mul(virtualSol, virtualTokens)
+
+	if side == models.FillSideBuy {
+		spent := uint64(amount * models.LamportsPerSOL)
+		fee := spent * models.PumpFeeBasisPoints / 10000
+		solIn := new(big.Int).SetUint64(spent - fee)
+		remaining := new(big.Int).Quo(product, new(big.Int).Add(virtualSol, solIn))
+		tokensOut := new(big.Int).Sub(virtualTokens, remaining).Uint64()
+		if tokensOut > curve.RealTokenReserves {
+			tokensOut = curve.RealTokenReserves
+		}
+		fill.SolLamports = spent
+		fill.TokenAmount = tokensOut
+		fill.RentLamports = models.AtaRentLamports
+	} else {
+		tokensIn := new(big.Int).SetUint64(tokenAmount)
+		remaining := new(big.Int).Quo(product, new(big.Int).Add(virtualTokens, tokensIn))
+		solOut := new(big.Int).Sub(virtualSol, remaining).Uint64()
+		if solOut > curve.RealSolReserves {
+			solOut = curve.RealSolReserves
+		}
+		fill.SolLamports = solOut - solOut*models.PumpFeeBasisPoints/10000
+		fill.TokenAmount = tokenAmount
+	}
+	fill.Price = fillPrice(fill.SolLamports, fill.TokenAmount)
+	return fill
+}
@@ -0,0 +1,88 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"github.com/gagliardetto/solana-go"
+	"testing"
+	"time"
+)
+
+// curveToken returns a token whose latest snapshot holds curve.
+func curveToken(curve models.BondingCurveState) models.MemeToken {
+	return models.MemeToken{
+		Mint: solana.NewWallet().PublicKey(),
+		Info: []models.MemeInfo{{BondingState: &curve}},
+	}
+}
+
+// launchCurve is the state of a freshly created pump.fun bonding curve.
+var launchCurve = models.BondingCurveState{
+	VirtualTokenReserves: 1_073_000_000_000_000,
+	VirtualSolReserves:   30_000_000_000,
+	RealTokenReserves:    793_100_000_000_000,
+	TokenTotalSupply:     1_000_000_000_000_000,
+}
+
+func TestCurveFill(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	afterBuy := launchCurve
+	afterBuy.VirtualSolReserves += 990_000_000
+	afterBuy.VirtualTokenReserves -= 34_277_831_558_568
+	afterBuy.RealSolReserves = 990_000_000
+	drained := afterBuy
+	drained.RealSolReserves = 500_000_000
+
+	tests := []struct {
+		name        string
+		curve       models.BondingCurveState
+		side        string
+		amount      float64
+		tokenAmount uint64
+		sol         uint64
+		tokens      uint64
+		rent        uint64
+	}{
+		{name: "buy at launch", curve: launchCurve, side: models.FillSideBuy, amount: 1, sol: 1_000_000_000, tokens: 34_277_831_558_568, rent: models.AtaRentLamports},
+		{name: "buy capped by the real reserves", curve: models.BondingCurveState{VirtualTokenReserves: launchCurve.VirtualTokenReserves, VirtualSolReserves: launchCurve.VirtualSolReserves, RealTokenReserves: 1_000_000}, side: models.FillSideBuy, amount: 1, sol: 1_000_000_000, tokens: 1_000_000, rent: models.AtaRentLamports},
+		{name: "sell back after the buy", curve: afterBuy, side: models.FillSideSell, tokenAmount: 34_277_831_558_568, sol: 980_100_000, tokens: 34_277_831_558_568},
+		{name: "sell capped by the real reserves", curve: drained, side: models.FillSideSell, tokenAmount: 34_277_831_558_568, sol: 495_000_000, tokens: 34_277_831_558_568},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := curveToken(test.curve)
+			fill := CurveFill(token, test.side, test.amount, test.tokenAmount, at)
+			if fill.SolLamports != test.sol || fill.TokenAmount != test.tokens || fill.RentLamports != test.rent {
+				t.Errorf("sol %d tokens %d rent %d, want %d %d %d", fill.SolLamports, fill.TokenAmount, fill.RentLamports, test.sol, test.tokens, test.rent)
+			}
+			if fill.Side != test.side || !fill.Mint.Equals(token.Mint) || !fill.Time.Equal(at) || !fill.Simulated {
+				t.Errorf("fill %s", fill)
+			}
+			if fill.FeeLamports != models.EstimatedTxFeeLamports || fill.Price != fillPrice(fill.SolLamports, fill.TokenAmount) {
+				t.Errorf("fee %d price %.20f", fill.FeeLamports, fill.Price)
+			}
+		})
+	}
+}
+
+func TestCurveFillSlippage(t *testing.T) {
+	token := curveToken(launchCurve)
+	small := CurveFill(token, models.FillSideBuy, 0.1, 0, time.Time{})
+	large := CurveFill(token, models.FillSideBuy, 10, 0, time.Time{})
+	if large.Price <= small.Price {
+		t.Errorf("10 SOL buy priced %.20f, not above the 0.1 SOL buy at %.20f", large.Price, small.Price)
+	}
+}
+
+func TestCurveFillWithoutCurve(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), Info: []models.MemeInfo{{TokenPrice: 0.00000002}}}
+	fill := CurveFill(token, models.FillSideBuy, 0.01, 0, at)
+	if fill.TokenAmount != 500_000_000_000 || fill.SolLamports != 10_000_000 || !fill.Time.Equal(at) {
+		t.Errorf("fill %s, want the snapshot price fill at %s", fill, at)
+	}
+
+	empty := CurveFill(models.MemeToken{}, models.FillSideBuy, 0.01, 0, at)
+	if empty.TokenAmount != 0 || empty.SolLamports != 0 {
+		t.Errorf("token without snapshot filled: %s", empty)
+	}
+}
@@ -1,16 +1,20 @@
 package sol
 
 import (
+	"b46/b46/events"
 	"b46/b46/logging"
 	"b46/b46/models"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/coder/websocket"
 	"github.com/gagliardetto/solana-go"
 	"github.com/mr-tron/base58"
+	"io"
 	"log"
 	"strings"
 )
@@ -21,7 +25,17 @@ type Field struct {
 	Type string
 }
 
-func PumpFunListener(conn *websocket.Conn, outputChanel chan<- models.MemeToken) {
+// TradeEventDiscriminator prefixes the pump.fun TradeEvent, sha256("event:TradeEvent")[:8].
+var TradeEventDiscriminator = []byte{189, 219, 127, 211, 78, 230, 97, 238}
+
+// CreateEventDiscriminator prefixes the pump.fun CreateEvent, sha256("event:CreateEvent")[:8].
+var CreateEventDiscriminator = []byte{27, 114, 169, 77, 222, 235, 99, 118}
+
+// PumpFunListener sends every token created on pump.fun to outputChanel. When bus is not
+// nil, every buy and sell seen in the program logs is published on it as TradeObserved.
+// It returns and closes outputChanel once conn can no longer be read, e.g. at the end of
+// a StreamReplay.
+func PumpFunListener(conn StreamConn, outputChanel chan<- models.MemeToken, bus *events.Bus) {
 	//// Create a context that cancels on SIGINT or SIGTERM.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -57,8 +71,12 @@ func PumpFunListener(conn *websocket.Conn, outputChanel chan<- models.MemeToken)
 		for {
 			msgType, msg, err := conn.Read(ctx)
 			if err != nil {
-				// When context is canceled, the read error is expected.
-				logging.PrintErrorToLog("Error reading message:		", err.Error())
+				if errors.Is(err, io.EOF) {
+					log.Println("End of stream")
+				} else {
+					logging.PrintErrorToLog("Error reading message:		", err.Error())
+				}
+				cancel()
 				return
 			}
 
@@ -93,6 +111,7 @@ func PumpFunListener(conn *websocket.Conn, outputChanel chan<- models.MemeToken)
 					}
 
 					createFound := false
+					tradeFound := false
 					for _, logItem := range logsIface {
 						logStr, ok := logItem.(string)
 						if !ok {
@@ -100,10 +119,17 @@ func PumpFunListener(conn *websocket.Conn, outputChanel chan<- models.MemeToken)
 						}
 						if strings.Contains(logStr, "Program log: Instruction: Create") {
 							createFound = true
-							break
+						}
+						if strings.Contains(logStr, "Program log: Instruction: Buy") || strings.Contains(logStr, "Program log: Instruction: Sell") {
+							tradeFound = true
 						}
 					}
 
+					if tradeFound && bus != nil {
+						signature, _ := value["signature"].(string)
+						publishTrades(bus, signature, logsIface)
+					}
+
 					if createFound {
 						// Process each log that contains "Program data:".
 						for _, logItem := range logsIface {
@@ -161,6 +187,57 @@ func PumpFunListener(conn *websocket.Conn, outputChanel chan<- models.MemeToken)
 
 }
 
+// publishTrades decodes every TradeEvent in a transaction's logs and publishes it on bus.
+func publishTrades(bus *events.Bus, signature string, logs []interface{}) {
+	for _, logItem := range logs {
+		logStr, ok := logItem.(string)
+		if !ok || !strings.Contains(logStr, "Program data:") {
+			continue
+		}
+		parts := strings.SplitN(logStr, ": ", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		decodedData, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		trade, ok := ParseTradeEvent(decodedData)
+		if !ok {
+			continue
+		}
+		trade.Signature = signature
+		bus.Publish(events.TradeObservedEvent{Trade: trade, Time: models.Now()})
+	}
+}
+
+// ParseTradeEvent decodes the leading fields of a pump.fun TradeEvent. Newer program
+// versions append fields after the reserves, those are ignored.
+func ParseTradeEvent(data []byte) (models.PumpTrade, bool) {
+	const size = 8 + 32 + 8 + 8 + 1 + 32 + 8 + 8 + 8
+	if len(data) < size || !bytes.Equal(data[:8], TradeEventDiscriminator) {
+		return models.PumpTrade{}, false
+	}
+	offset := 8
+	trade := models.PumpTrade{}
+	trade.Mint = solana.PublicKeyFromBytes(data[offset : offset+32])
+	offset += 32
+	trade.SolAmount = binary.LittleEndian.Uint64(data[offset : offset+8])
+	offset += 8
+	trade.TokenAmount = binary.LittleEndian.Uint64(data[offset : offset+8])
+	offset += 8
+	trade.IsBuy = data[offset] != 0
+	offset++
+	trade.User = solana.PublicKeyFromBytes(data[offset : offset+32])
+	offset += 32
+	trade.Timestamp = int64(binary.LittleEndian.Uint64(data[offset : offset+8]))
+	offset += 8
+	trade.VirtualSolReserves = binary.LittleEndian.Uint64(data[offset : offset+8])
+	offset += 8
+	trade.VirtualTokenReserves = binary.LittleEndian.Uint64(data[offset : offset+8])
+	return trade, true
+}
+
 // ParseCreateInstruction parses the "create" instruction data
 func ParseCreateInstruction(data []byte) map[string]string {
 	if len(data) < 8 {
@@ -222,6 +299,7 @@ func ParseTokenInfo(parsedData map[string]string) models.MemeToken {
 	meme.Analysis = make([]models.TokenAnalysis, 0)
 	meme.Trading = false
 	meme.Sold = false
+	meme.State = models.StateDiscovered
 
 	return meme
 }
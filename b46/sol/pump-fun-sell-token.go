@@ -5,6 +5,7 @@ import (
 	"b46/b46/models"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/gagliardetto/solana-go"
 	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
@@ -18,9 +19,9 @@ import (
 	"time"
 )
 
-func executeSell(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve, associatedBondingCurve solana.PublicKey) error {
-
-	ctx := context.Background()
+// executeSell sells the full token balance held for mint.
+// minPrice is the lowest token price the order accepts, 0 disables the check.
+func executeSell(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve, associatedBondingCurve solana.PublicKey, minPrice float64) (models.Fill, error) {
 
 	// Decode the private key and create the payer
 	payer := solana.MustPrivateKeyFromBase58(_sys_init.Env.PK)
@@ -36,26 +37,27 @@ func executeSell(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve,
 	//log.Println(associatedTokenAddress)
 	balance, err := GetTokenBalance(ctx, rpcClient, associatedTokenAddress)
 	if err != nil {
-		fmt.Printf("Failed to get token balance: %v\n", err)
-
+		return models.Fill{}, fmt.Errorf("failed to get token balance: %w", err)
 	}
 
 	// Convert to a decimal amount (i.e. human-readable token balance)
 	tokenBalanceDecimal := float64(balance) / math.Pow10(models.TOKEN_DECIMALS)
 	//fmt.Printf("Token balance: %f\n", tokenBalanceDecimal)
 	if balance == 0 {
-		fmt.Println("No tokens to sell.")
-
+		return models.Fill{}, fmt.Errorf("no tokens to sell for %s", mint)
 	}
 	// Fetch bonding curve state (assumed implemented as getPumpCurveState)
 	curveState, err := GetPumpCurveState(rpcClient, bondingCurve)
 	if err != nil {
-		return fmt.Errorf("failed to fetch bonding curve state: %v", err)
+		return models.Fill{}, fmt.Errorf("failed to fetch bonding curve state: %w", err)
 	}
 
 	tokenPrice, err := CalculatePumpCurvePrice(curveState)
 	if err != nil {
-		return fmt.Errorf("calculate pump curve: %v", err)
+		return models.Fill{}, fmt.Errorf("calculate pump curve: %w", err)
+	}
+	if err := CheckPriceLimit("sell", tokenPrice, minPrice); err != nil {
+		return models.Fill{}, err
 	}
 
 	//fmt.Printf("Token Balance: %f\n", tokenBalanceDecimal)
@@ -75,36 +77,69 @@ func executeSell(rpcClient *rpc.Client, wsClient *ws.Client, mint, bondingCurve,
 	//fmt.Printf("Selling %f tokens\n", tokenBalanceDecimal)
 	//fmt.Printf("Minimum SOL output: %.10f SOL\n", float64(minSolOutput)/models.LamportsPerSOL)
 
-	time.Sleep(3 * time.Second)
+	select {
+	case <-ctx.Done():
+		return models.Fill{}, ctx.Err()
+	case <-time.After(SellSettleDelay):
+	}
 	//Create and send the buy transaction
-	errBuy := sellTokenWithRetry(payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, amount, minSolOutput)
-	if errBuy != nil {
-		log.Printf("Failed to create associated token account: %v", errBuy)
+	sig, errSell := sellTokenWithRetry(ctx, payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, amount, minPrice, minSolOutput)
+	if errSell != nil {
+		log.Printf("Sell transaction failed: %v", errSell)
+		return models.Fill{}, errSell
 	}
 
-	return nil
-}
+	// Measure the fill from the confirmed transaction, falling back to the quote.
+	fill, errFill := FillFromTransaction(ctx, rpcClient, sig, payer.PublicKey(), mint, models.FillSideSell)
+	if errFill != nil {
+		log.Printf("Failed to measure sell fill, using quote: %v", errFill)
+		fill = models.Fill{
+			Mint:        mint,
+			Side:        models.FillSideSell,
+			TokenAmount: uint64(balance),
+			SolLamports: uint64(minSolOutputFloat * models.LamportsPerSOL),
+			FeeLamports: models.EstimatedTxFeeLamports,
+			Price:       tokenPrice,
+			Signature:   sig,
+			Time:        models.Now(),
+		}
+	}
 
-func sellTokenWithRetry(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount int, minSolOutput float64) error {
+	return fill, nil
+}
 
-	var err error
-	// Retry up to maxRetries times
-	for attempt := 0; attempt < models.MaxRetries; attempt++ {
-		err = sellToken(payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, tokenAmount, minSolOutput)
-		if err == nil {
-			return nil
+// sellTokenWithRetry calls sellToken under the shared retry policy. When the price moved
+// below the minimum output the curve is re-fetched and the minimum requoted, unless the
+// new price is below minPrice.
+func sellTokenWithRetry(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount int, minPrice float64, minSolOutput float64) (solana.Signature, error) {
+	requote := func() error {
+		tokenPrice, err := QuotePumpCurve(rpcClient, bondingCurve)
+		if err != nil {
+			return err
+		}
+		if err := CheckPriceLimit("sell", tokenPrice, minPrice); err != nil {
+			log.Printf("Aborting sell for %s: %v", mint, err)
+			return err
 		}
-		// Exponential backoff (2^attempt seconds)
-		time.Sleep(time.Duration(attempt) * time.Second)
+		tokenBalanceDecimal := float64(tokenAmount) / math.Pow10(models.TOKEN_DECIMALS)
+		minSolOutput = tokenBalanceDecimal * tokenPrice * (1 - models.Slippage) * models.LamportsPerSOL
+		log.Printf("Requoted sell for %s: price=%.20f minSolOutput=%.0f", mint, tokenPrice, minSolOutput)
+		return nil
 	}
-	return fmt.Errorf("failed to create associated account after %d retries: %v", models.MaxRetries, err)
+	var sig solana.Signature
+	err := DefaultRetryPolicy.Do(ctx, "sell", func(attempt int) error {
+		var errSell error
+		sig, errSell = sellToken(ctx, payer, mint, rpcClient, wsClient, associatedTokenAddress, bondingCurve, associatedBondingCurve, tokenAmount, minSolOutput)
+		return errSell
+	}, requote)
+	return sig, err
 }
 
-func sellToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount int, minSolOutput float64) error {
+func sellToken(ctx context.Context, payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Client, wsClient *ws.Client, associatedTokenAddress, bondingCurve, associatedBondingCurve solana.PublicKey, tokenAmount int, minSolOutput float64) (solana.Signature, error) {
 
 	data := make([]byte, 24)
 
-	binary.LittleEndian.PutUint64(data[0:], 12502976635542562355)
+	copy(data[0:], SellDiscriminator)
 	// Write the amount (little-endian uint64) at offset 8.
 	binary.LittleEndian.PutUint64(data[8:], uint64(tokenAmount))
 	// Write the min_sol_output (little-endian uint64) at offset 16.
@@ -144,11 +179,11 @@ func sellToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cl
 	// This helps ensure your transaction is processed faster in a congested network.
 	priorityIx, errPriority := computebudget.NewSetComputeUnitPriceInstruction(models.PriorityFeeLamport).ValidateAndBuild()
 	if errPriority != nil {
-		return fmt.Errorf("failed to set priority: %v", errPriority)
+		return solana.Signature{}, fmt.Errorf("failed to set priority: %w", errPriority)
 	}
-	recentBlockhash, err := rpcClient.GetLatestBlockhash(context.TODO(), rpc.CommitmentFinalized)
+	recentBlockhash, err := rpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
-		return fmt.Errorf("failed to fetch blockhash: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to fetch blockhash: %w", err)
 	}
 
 	tx, err := solana.NewTransaction(
@@ -160,7 +195,7 @@ func sellToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cl
 		solana.TransactionPayer(payer.PublicKey()),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create buy transaction: %v", err)
+		return solana.Signature{}, fmt.Errorf("failed to create buy transaction: %w", err)
 	}
 	tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
 		if key.Equals(payer.PublicKey()) {
@@ -179,19 +214,26 @@ func sellToken(payer solana.PrivateKey, mint solana.PublicKey, rpcClient *rpc.Cl
 	t := 3 * time.Second // random default timeout
 	timeout := &t
 	sig, err := confirm.SendAndConfirmTransactionWithOpts(
-		context.TODO(),
+		ctx,
 		rpcClient,
 		wsClient,
 		tx,
 		opts,
 		timeout,
 	)
-	if err != nil {
+	if err != nil && !errors.Is(err, confirm.ErrTimeout) {
 		log.Println(err)
+		return solana.Signature{}, sendError(ctx, rpcClient, sig, err)
+	}
+	if err != nil {
+		// The websocket confirmation timed out, check the signature status directly.
+		if errConfirm := ConfirmSignature(ctx, rpcClient, sig, 10*time.Second); errConfirm != nil {
+			return solana.Signature{}, fmt.Errorf("sell not confirmed: %w", errConfirm)
+		}
 	}
 	//spew.Dump(sig)
 	log.Println("Transaction confirmed. Signature:", sig)
 
 	//log.Println("Transaction confirmed.")
-	return nil
+	return sig, nil
 }
@@ -2,37 +2,91 @@ package sol
 
 import (
 	"b46/b46/models"
+	"context"
 	"fmt"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
 	"log"
+	"sync"
+	"time"
+)
+
+// Pauses of the live pipelines: the buy waits for a new associated token account to
+// propagate, the sell for the balance it read to settle.
+var (
+	BuySettleDelay  = 5 * time.Second
+	SellSettleDelay = 3 * time.Second
 )
 
 // PumpFunExecutor implements the orderhandler.Executor interface.
 type PumpFunExecutor struct {
 	// Provide any fields you need: Solana client, credentials, etc.
 	// solanaClient *solana_sdk.Client
+
+	// Live sends the orders on chain. Otherwise orders are paper traded, filled against
+	// the latest snapshot, and the simulated token holdings are tracked here.
+	Live     bool
+	mutex    sync.Mutex
+	holdings map[string]uint64
 }
 
 // ExecuteSellOrder places a SELL transaction on Solana.
-func (s *PumpFunExecutor) ExecuteSellOrder(rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken) error {
-	//err := executeSell(rpcClient, wsClient, token.Mint, token.BondingCurve, token.AssociatedCurve)
-	//if err != nil {
-	//	log.Printf("Failed to sell token: %v", err)
-	//}
+// minPrice is the lowest acceptable token price after a requote.
+func (s *PumpFunExecutor) ExecuteSellOrder(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken, minPrice float64) (models.Fill, error) {
+	var fill models.Fill
+	if s.Live {
+		var err error
+		fill, err = executeSell(ctx, rpcClient, wsClient, token.Mint, token.BondingCurve, token.AssociatedCurve, minPrice)
+		if err != nil {
+			log.Printf("Failed to sell token: %v", err)
+			return fill, err
+		}
+	} else {
+		s.mutex.Lock()
+		held := s.holdings[token.Mint.String()]
+		delete(s.holdings, token.Mint.String())
+		s.mutex.Unlock()
+		fill = SimulatedFill(token, models.FillSideSell, 0, held)
+	}
 	log.Printf("[SolanaExecutor - PumpFun] SELL order for token %s (%s)", token.Name, token.Symbol)
-	fmt.Println("Sell order completed on Solana for:", token.Mint.String())
-	return nil
+	fmt.Println("Sell order completed on Solana for:", token.Mint.String(), fill)
+	return fill, nil
 }
 
 // ExecuteBuyOrder places a Buy transaction on Solana.
-func (s *PumpFunExecutor) ExecuteBuyOrder(rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken) error {
-	//amount := models.PositionAmount
-	//err := executeBuy(rpcClient, wsClient, token.Mint, token.BondingCurve, token.AssociatedCurve, amount)
-	//if err != nil {
-	//	log.Printf("Failed to buy token: %v", err)
-	//}
+// maxPrice is the highest acceptable token price after a requote.
+// amount is the SOL to spend, as approved by the risk manager.
+func (s *PumpFunExecutor) ExecuteBuyOrder(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken, amount float64, maxPrice float64) (models.Fill, error) {
+	var fill models.Fill
+	if s.Live {
+		var err error
+		fill, err = executeBuy(ctx, rpcClient, wsClient, token.Mint, token.BondingCurve, token.AssociatedCurve, amount, maxPrice)
+		if err != nil {
+			log.Printf("Failed to buy token: %v", err)
+			return fill, err
+		}
+	} else {
+		fill = SimulatedFill(token, models.FillSideBuy, amount, 0)
+		s.mutex.Lock()
+		if s.holdings == nil {
+			s.holdings = make(map[string]uint64)
+		}
+		s.holdings[token.Mint.String()] += fill.TokenAmount
+		s.mutex.Unlock()
+	}
+
 	log.Printf("[SolanaExecutor - PumpFun] Buy order for token %s (%s)", token.Name, token.Symbol)
-	fmt.Println("Buy order completed on Solana for:", token.Mint.String())
-	return nil
+	fmt.Println("Buy order completed on Solana for:", token.Mint.String(), fill)
+	return fill, nil
+}
+
+// RestoreHolding registers tokens found in the wallet at startup, so that paper traded
+// sells of reconciled positions dispose of them. Live sells read the wallet instead.
+func (s *PumpFunExecutor) RestoreHolding(mint string, amount uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.holdings == nil {
+		s.holdings = make(map[string]uint64)
+	}
+	s.holdings[mint] = amount
 }
@@ -0,0 +1,359 @@
+package sol_test
+
+import (
+	"b46/b46/_sys_init"
+	"b46/b46/models"
+	"b46/b46/sol"
+	"b46/b46/sol/fakenode"
+	"errors"
+	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// payer is the wallet the live pipelines sign with, through _sys_init.Env.PK.
+var payer = solana.NewWallet().PrivateKey
+
+func TestMain(m *testing.M) {
+	_sys_init.Env = &_sys_init.Enviro{PK: payer.String()}
+	// Retries back off quickly and the pipelines barely wait for the accounts to settle.
+	sol.DefaultRetryPolicy.BaseDelay = 10 * time.Millisecond
+	sol.DefaultRetryPolicy.MaxDelay = 50 * time.Millisecond
+	sol.BuySettleDelay = 200 * time.Millisecond
+	sol.SellSettleDelay = 200 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+// chain is a fake node with a freshly launched token and clients connected to it.
+type chain struct {
+	node  *fakenode.Node
+	rpc   *rpc.Client
+	ws    *ws.Client
+	token models.MemeToken
+}
+
+// startChain starts a node crediting the payer with lamports and launches a token on it.
+func startChain(t *testing.T, lamports uint64) *chain {
+	t.Helper()
+	node, err := fakenode.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+	wsClient, err := ws.Connect(t.Context(), node.WebsocketURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(wsClient.Close)
+
+	node.Fund(payer.PublicKey(), lamports)
+	token := node.Launch("Test", "TEST", "https://example.com/test.json", solana.NewWallet().PublicKey())
+	return &chain{node: node, rpc: rpc.New(node.URL()), ws: wsClient, token: token}
+}
+
+// price is the spot price of the token's curve.
+func (c *chain) price(t *testing.T) float64 {
+	t.Helper()
+	price, err := sol.QuotePumpCurve(c.rpc, c.token.BondingCurve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return price
+}
+
+// send signs and sends a transaction of instructions paid by the payer, without preflight.
+func (c *chain) send(t *testing.T, instructions ...solana.Instruction) solana.Signature {
+	t.Helper()
+	blockhash, err := c.rpc.GetLatestBlockhash(t.Context(), rpc.CommitmentFinalized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := solana.NewTransaction(instructions, blockhash.Value.Blockhash, solana.TransactionPayer(payer.PublicKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+		if key.Equals(payer.PublicKey()) {
+			return &payer
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := c.rpc.SendTransactionWithOpts(t.Context(), tx, rpc.TransactionOpts{SkipPreflight: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestLiveBuyAndSell(t *testing.T) {
+	t.Parallel()
+	c := startChain(t, 2*models.LamportsPerSOL)
+	executor := &sol.PumpFunExecutor{Live: true}
+
+	bought, err := executor.ExecuteBuyOrder(t.Context(), c.rpc, c.ws, c.token, 0.1, 0)
+	if err != nil {
+		t.Fatalf("ExecuteBuyOrder() error = %v", err)
+	}
+	held := c.node.TokenBalance(payer.PublicKey(), c.token.Mint)
+	if held == 0 || bought.TokenAmount != held {
+		t.Fatalf("buy fill has %d tokens, the wallet holds %d", bought.TokenAmount, held)
+	}
+	if bought.Simulated || bought.Signature.IsZero() || bought.RentLamports != models.AtaRentLamports {
+		t.Errorf("buy fill = %+v, want a confirmed fill paying the account rent", bought)
+	}
+	// The pump.fun fee comes on top of the SOL spent on the curve.
+	if spent := 2*models.LamportsPerSOL - c.node.Balance(payer.PublicKey()); spent != bought.SolLamports+bought.FeeLamports+bought.RentLamports {
+		t.Errorf("wallet spent %d lamports, fill accounts for %d", spent, bought.SolLamports+bought.FeeLamports+bought.RentLamports)
+	}
+
+	sold, err := executor.ExecuteSellOrder(t.Context(), c.rpc, c.ws, c.token, 0)
+	if err != nil {
+		t.Fatalf("ExecuteSellOrder() error = %v", err)
+	}
+	if sold.TokenAmount != held || c.node.TokenBalance(payer.PublicKey(), c.token.Mint) != 0 {
+		t.Errorf("sell fill has %d of the %d tokens held, %d left in the wallet", sold.TokenAmount, held, c.node.TokenBalance(payer.PublicKey(), c.token.Mint))
+	}
+	if sold.SolLamports == 0 || sold.SolLamports >= bought.SolLamports {
+		t.Errorf("sold for %d lamports after buying for %d, want less than the cost after fees", sold.SolLamports, bought.SolLamports)
+	}
+}
+
+func TestPaperTradingLeavesChainAlone(t *testing.T) {
+	t.Parallel()
+	c := startChain(t, 2*models.LamportsPerSOL)
+	token := c.token
+	curve, _ := c.node.Curve(token.Mint)
+	token.Info = []models.MemeInfo{{BondingState: &curve, TokenPrice: c.price(t)}}
+	executor := &sol.PumpFunExecutor{}
+
+	bought, err := executor.ExecuteBuyOrder(t.Context(), c.rpc, c.ws, token, 0.1, 0)
+	if err != nil || !bought.Simulated || bought.TokenAmount == 0 {
+		t.Fatalf("paper buy = %+v, %v", bought, err)
+	}
+	sold, err := executor.ExecuteSellOrder(t.Context(), c.rpc, c.ws, token, 0)
+	if err != nil || !sold.Simulated || sold.TokenAmount != bought.TokenAmount {
+		t.Fatalf("paper sell = %+v, %v, want the %d tokens bought", sold, err, bought.TokenAmount)
+	}
+	if balance := c.node.Balance(payer.PublicKey()); balance != 2*models.LamportsPerSOL {
+		t.Errorf("paper trades moved the wallet to %d lamports", balance)
+	}
+}
+
+func TestConfirmSignature(t *testing.T) {
+	t.Parallel()
+	c := startChain(t, models.LamportsPerSOL)
+	ctx := t.Context()
+
+	landed := c.send(t, system.NewTransferInstruction(1000, payer.PublicKey(), solana.NewWallet().PublicKey()).Build())
+	err := sol.ConfirmSignature(ctx, c.rpc, landed, time.Second)
+	var txErr *sol.TransactionError
+	if !errors.As(err, &txErr) || txErr.Stage != "confirmation" {
+		t.Errorf("ConfirmSignature() of a failed transaction = %v, want its runtime error", err)
+	}
+
+	priority, err := computebudget.NewSetComputeUnitPriceInstruction(models.PriorityFeeLamport).ValidateAndBuild()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed := c.send(t, priority)
+	if err := sol.ConfirmSignature(ctx, c.rpc, confirmed, time.Second); err != nil {
+		t.Errorf("ConfirmSignature() of a landed transaction = %v", err)
+	}
+
+	var unknown solana.Signature
+	unknown[0] = 1
+	if err := sol.ConfirmSignature(ctx, c.rpc, unknown, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "not confirmed") {
+		t.Errorf("ConfirmSignature() of an unknown transaction = %v, want a timeout", err)
+	}
+}
+
+func TestLiveBuyRetries(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		lamports uint64
+		amount   float64
+		prepare  func(t *testing.T, c *chain)
+		class    sol.ErrorClass
+		attempts int
+	}{
+		{
+			name:     "insufficient funds stop at once",
+			lamports: 10_000_000,
+			amount:   1,
+			class:    sol.ErrorClassInsufficientFunds,
+			attempts: 1,
+		},
+		{
+			name:     "complete curve stops at once",
+			lamports: models.LamportsPerSOL,
+			amount:   0.1,
+			prepare: func(t *testing.T, c *chain) {
+				whale := solana.NewWallet().PublicKey()
+				c.node.Fund(whale, 200*models.LamportsPerSOL)
+				if _, err := c.node.Trade(whale, c.token.Mint, true, 150*models.LamportsPerSOL); err != nil {
+					t.Fatal(err)
+				}
+			},
+			class:    sol.ErrorClassCurveComplete,
+			attempts: 1,
+		},
+		{
+			// Buying most of the curve costs far more than the quote allows for, however often
+			// it is requoted.
+			name:     "slippage retried until the attempts run out",
+			lamports: 100 * models.LamportsPerSOL,
+			amount:   20,
+			class:    sol.ErrorClassSlippageExceeded,
+			attempts: sol.DefaultRetryPolicy.MaxAttempts,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c := startChain(t, test.lamports)
+			if test.prepare != nil {
+				test.prepare(t, c)
+			}
+			_, err := (&sol.PumpFunExecutor{Live: true}).ExecuteBuyOrder(t.Context(), c.rpc, c.ws, c.token, test.amount, 0)
+			var pipelineErr *sol.PipelineError
+			if !errors.As(err, &pipelineErr) {
+				t.Fatalf("ExecuteBuyOrder() error = %v, want a pipeline error", err)
+			}
+			if pipelineErr.Class != test.class || pipelineErr.Attempts != test.attempts {
+				t.Errorf("gave up with %s after %d attempt(s), want %s after %d", pipelineErr.Class, pipelineErr.Attempts, test.class, test.attempts)
+			}
+			if held := c.node.TokenBalance(payer.PublicKey(), c.token.Mint); held != 0 {
+				t.Errorf("failed buy left %d tokens in the wallet", held)
+			}
+		})
+	}
+}
+
+// pumpOnAccount buys whale lamports of the token as soon as the payer's token account
+// is created, between the quote of a buy and its first attempt.
+func (c *chain) pumpOnAccount(t *testing.T, lamports uint64) <-chan error {
+	t.Helper()
+	account, _, err := solana.FindAssociatedTokenAddress(payer.PublicKey(), c.token.Mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := c.ws.AccountSubscribe(account, rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sub.Unsubscribe)
+	whale := solana.NewWallet().PublicKey()
+	c.node.Fund(whale, 2*lamports)
+
+	done := make(chan error, 1)
+	go func() {
+		if _, err := sub.Recv(t.Context()); err != nil {
+			done <- err
+			return
+		}
+		_, err := c.node.Trade(whale, c.token.Mint, true, lamports)
+		done <- err
+	}()
+	return done
+}
+
+func TestLiveBuyRequotes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		maxPrice float64 // times the launch price, 0 for no limit
+		class    sol.ErrorClass
+	}{
+		{name: "resubmitted at the new price"},
+		{name: "aborted past the limit", maxPrice: 1.1, class: sol.ErrorClassPriceRanAway},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c := startChain(t, models.LamportsPerSOL)
+			launch := c.price(t)
+			// Five SOL lift the price by about a third, past the slippage of the order.
+			pumped := c.pumpOnAccount(t, 5*models.LamportsPerSOL)
+
+			fill, err := (&sol.PumpFunExecutor{Live: true}).ExecuteBuyOrder(t.Context(), c.rpc, c.ws, c.token, 0.1, test.maxPrice*launch)
+			if errPump := <-pumped; errPump != nil {
+				t.Fatalf("failed to move the curve: %v", errPump)
+			}
+			if test.class != sol.ErrorClassUnknown {
+				if class := sol.ClassifyError(err); class != test.class {
+					t.Fatalf("ExecuteBuyOrder() error = %v, want %s", err, test.class)
+				}
+				if held := c.node.TokenBalance(payer.PublicKey(), c.token.Mint); held != 0 {
+					t.Errorf("aborted buy left %d tokens in the wallet", held)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecuteBuyOrder() error = %v", err)
+			}
+			quoted := uint64(0.1 / launch * 1e6)
+			if fill.TokenAmount == 0 || fill.TokenAmount > quoted*8/10 {
+				t.Errorf("bought %d tokens, want the requoted amount well below the %d quoted at launch", fill.TokenAmount, quoted)
+			}
+			if fill.Price < c.price(t)/1.1 {
+				t.Errorf("filled at %g, want about the pumped price %g", fill.Price, c.price(t))
+			}
+		})
+	}
+}
+
+func TestPriceLimits(t *testing.T) {
+	t.Parallel()
+	const lamports = models.LamportsPerSOL
+	c := startChain(t, lamports)
+	executor := &sol.PumpFunExecutor{Live: true}
+	price := c.price(t)
+
+	_, err := executor.ExecuteBuyOrder(t.Context(), c.rpc, c.ws, c.token, 0.1, price/2)
+	if sol.ClassifyError(err) != sol.ErrorClassPriceRanAway {
+		t.Errorf("buy above the limit error = %v, want %s", err, sol.ErrorClassPriceRanAway)
+	}
+	if balance := c.node.Balance(payer.PublicKey()); balance != lamports {
+		t.Errorf("buy above the limit spent %d lamports", lamports-balance)
+	}
+
+	trade, err := c.node.Trade(payer.PublicKey(), c.token.Mint, true, lamports/10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.ExecuteSellOrder(t.Context(), c.rpc, c.ws, c.token, 2*c.price(t))
+	if sol.ClassifyError(err) != sol.ErrorClassPriceRanAway {
+		t.Errorf("sell below the limit error = %v, want %s", err, sol.ErrorClassPriceRanAway)
+	}
+	if held := c.node.TokenBalance(payer.PublicKey(), c.token.Mint); held != trade.TokenAmount {
+		t.Errorf("sell below the limit left %d of %d tokens", held, trade.TokenAmount)
+	}
+}
+
+func TestCreateAssociatedAccountTwice(t *testing.T) {
+	t.Parallel()
+	c := startChain(t, models.LamportsPerSOL)
+	ata, _, err := solana.FindAssociatedTokenAddress(payer.PublicKey(), c.token.Mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second create stands for a retry after the first attempt landed.
+	for i := 0; i < 2; i++ {
+		if _, err := sol.CreateAssociatedAccountWithRetry(t.Context(), payer, c.token.Mint, c.rpc, c.ws, ata); err != nil {
+			t.Fatalf("create %d: %v", i+1, err)
+		}
+	}
+	if rent := c.node.Balance(ata); rent != models.AtaRentLamports {
+		t.Errorf("account holds %d lamports, want the rent of a single create", rent)
+	}
+}
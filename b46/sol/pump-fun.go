@@ -11,6 +11,7 @@ import (
 	"math"
 	"math/big"
 	"strconv"
+	"time"
 )
 
 var ExpectedDiscriminator = func() []byte {
@@ -27,6 +28,13 @@ var Discriminator = func() []byte {
 	return discriminator
 }()
 
+var SellDiscriminator = func() []byte {
+	var value uint64 = 12502976635542562355
+	discriminator := make([]byte, 8)
+	binary.LittleEndian.PutUint64(discriminator, value)
+	return discriminator
+}()
+
 // FindAssociatedBondingCurve derives the associated bonding curve address (using the ATA derivation)
 // from the bonding curve and the mint address. The seeds used here are:
 // bondingCurve, token program, and mint.
@@ -63,6 +71,19 @@ func CalculatePumpCurvePrice(curveState *models.BondingCurveState) (float64, err
 	return tokenPrice, nil
 }
 
+// QuotePumpCurve fetches the current bonding curve state and returns the token price.
+// A completed curve can no longer be traded and is reported as a fatal pipeline error.
+func QuotePumpCurve(client *rpc.Client, curveAddress solana.PublicKey) (float64, error) {
+	curveState, err := GetPumpCurveState(client, curveAddress)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch bonding curve state: %w", err)
+	}
+	if curveState.Complete {
+		return 0, &PipelineError{Class: ErrorClassCurveComplete, Attempts: 1, Err: fmt.Errorf("bonding curve %s is complete", curveAddress)}
+	}
+	return CalculatePumpCurvePrice(curveState)
+}
+
 // GetTokenMarketCap calculates the price of the token in SOL based on the bonding curve state
 func GetTokenMarketCap(curveState *models.BondingCurveState, tokenPrice float64) float64 {
 
@@ -83,7 +104,7 @@ func GetPumpCurveState(client *rpc.Client, curveAddress solana.PublicKey) (*mode
 	// Fetch the account info
 	accountInfo, err := client.GetAccountInfo(context.Background(), curveAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch account info: %v", err)
+		return nil, fmt.Errorf("failed to fetch account info: %w", err)
 	}
 
 	accountVal := accountInfo.Value.Data.GetBinary()
@@ -99,7 +120,7 @@ func GetPumpCurveState(client *rpc.Client, curveAddress solana.PublicKey) (*mode
 	// Parse the bonding curve state
 	state, err := ParseBondingCurveState(accountVal)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse bonding curve state: %v", err)
+		return nil, fmt.Errorf("failed to parse bonding curve state: %w", err)
 	}
 
 	return state, nil
@@ -144,3 +165,43 @@ func GetTokenBalance(ctx context.Context, client *rpc.Client, associatedTokenAcc
 	// If the response value is nil, return 0.
 	return 0, nil
 }
+
+// ConfirmSignature polls the signature status until the transaction is confirmed,
+// failed on chain, or the timeout elapses. It is used when the websocket
+// confirmation timed out and the transaction may still have landed.
+func ConfirmSignature(ctx context.Context, client *rpc.Client, sig solana.Signature, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.GetSignatureStatuses(ctx, true, sig)
+		if err == nil && resp != nil && len(resp.Value) > 0 && resp.Value[0] != nil {
+			status := resp.Value[0]
+			if status.Err != nil {
+				return fmt.Errorf("transaction %s failed on chain: %w", sig, NewTransactionError("confirmation", status.Err))
+			}
+			if status.ConfirmationStatus == rpc.ConfirmationStatusConfirmed || status.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("transaction %s not confirmed after %s", sig, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// sendError wraps an error of SendAndConfirmTransactionWithOpts. A transaction that
+// landed but failed carries its runtime error, read back from its signature status, so
+// that ClassifyError can tell what went wrong.
+func sendError(ctx context.Context, client *rpc.Client, sig solana.Signature, err error) error {
+	if !sig.IsZero() {
+		resp, errStatus := client.GetSignatureStatuses(ctx, true, sig)
+		if errStatus == nil && resp != nil && len(resp.Value) > 0 && resp.Value[0] != nil && resp.Value[0].Err != nil {
+			return fmt.Errorf("failed to send transaction: %w", NewTransactionError("confirmation", resp.Value[0].Err))
+		}
+	}
+	return fmt.Errorf("failed to send transaction: %w", err)
+}
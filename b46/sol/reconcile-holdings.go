@@ -0,0 +1,98 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"context"
+	"fmt"
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"log"
+	"math"
+)
+
+// Holding is a pump.fun token still held by the wallet, found at startup.
+type Holding struct {
+	Token            models.MemeToken
+	AssociateAccount solana.PublicKey
+	Amount           uint64 // raw token units
+}
+
+// FindPumpHoldings enumerates the owner's token accounts and keeps the non empty ones
+// whose mint has a pump.fun bonding curve. The returned tokens carry one snapshot of
+// the curve so they can be priced straight away.
+func FindPumpHoldings(ctx context.Context, rpcClient *rpc.Client, owner solana.PublicKey) ([]Holding, error) {
+	out, err := rpcClient.GetTokenAccountsByOwner(
+		ctx,
+		owner,
+		&rpc.GetTokenAccountsConfig{
+			ProgramId: &solana.TokenProgramID,
+		},
+		&rpc.GetTokenAccountsOpts{
+			Encoding: solana.EncodingBase64,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token accounts: %w", err)
+	}
+
+	var holdings []Holding
+	for _, rawAccount := range out.Value {
+		var tokAcc token.Account
+		if err := bin.NewBinDecoder(rawAccount.Account.Data.GetBinary()).Decode(&tokAcc); err != nil {
+			log.Printf("Reconcile: skipping undecodable token account %s: %v", rawAccount.Pubkey, err)
+			continue
+		}
+		if tokAcc.Amount == 0 {
+			continue
+		}
+
+		bondingCurve, _, err := GetBondingCurveAddress(tokAcc.Mint, models.PumpProgramPublic)
+		if err != nil {
+			log.Printf("Reconcile: no bonding curve address for %s: %v", tokAcc.Mint, err)
+			continue
+		}
+		curveState, err := GetPumpCurveState(rpcClient, bondingCurve)
+		if err != nil {
+			// Not a pump.fun token, or its curve account is gone.
+			log.Printf("Reconcile: %s is not a pump.fun token: %v", tokAcc.Mint, err)
+			continue
+		}
+
+		info := models.MemeInfo{BondingState: curveState, Snapshot: models.Now()}
+		if tokenPrice, err := CalculatePumpCurvePrice(curveState); err == nil {
+			info.TokenPrice = tokenPrice
+			info.MarketCap = GetTokenMarketCap(curveState, tokenPrice)
+		}
+
+		holdings = append(holdings, Holding{
+			Token: models.MemeToken{
+				Mint:            tokAcc.Mint,
+				BondingCurve:    bondingCurve,
+				AssociatedCurve: FindAssociatedBondingCurve(tokAcc.Mint, bondingCurve),
+				Info:            []models.MemeInfo{info},
+				Migrated:        curveState.Complete,
+			},
+			AssociateAccount: rawAccount.Pubkey,
+			Amount:           tokAcc.Amount,
+		})
+	}
+	return holdings, nil
+}
+
+// ReconciledFill books a holding found at startup as a buy at the current price. The
+// original cost is unknown, so PnL of reconciled positions is measured from startup.
+func ReconciledFill(holding Holding) models.Fill {
+	fill := models.Fill{
+		Mint:        holding.Token.Mint,
+		Side:        models.FillSideBuy,
+		TokenAmount: holding.Amount,
+		Time:        models.Now(),
+	}
+	if len(holding.Token.Info) > 0 {
+		fill.Price = holding.Token.Info[len(holding.Token.Info)-1].TokenPrice
+		fill.SolLamports = uint64(fill.Price * float64(holding.Amount) / math.Pow10(models.TOKEN_DECIMALS) * models.LamportsPerSOL)
+	}
+	return fill
+}
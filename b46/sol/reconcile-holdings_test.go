@@ -0,0 +1,81 @@
+package sol_test
+
+import (
+	"b46/b46/models"
+	"b46/b46/sol"
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+func TestFindPumpHoldings(t *testing.T) {
+	t.Parallel()
+	c := startChain(t, models.LamportsPerSOL)
+	whale := solana.NewWallet().PublicKey()
+	c.node.Fund(whale, 1000*models.LamportsPerSOL)
+
+	launch := func() solana.PublicKey {
+		return c.node.Launch("Test", "TEST", "https://example.com/test.json", solana.NewWallet().PublicKey()).Mint
+	}
+	trade := func(trader, mint solana.PublicKey, isBuy bool, amount uint64) {
+		t.Helper()
+		if _, err := c.node.Trade(trader, mint, isBuy, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held := c.token.Mint
+	trade(payer.PublicKey(), held, true, models.LamportsPerSOL/10)
+
+	soldOut := launch()
+	trade(payer.PublicKey(), soldOut, true, models.LamportsPerSOL/10)
+	trade(payer.PublicKey(), soldOut, false, c.node.TokenBalance(payer.PublicKey(), soldOut))
+
+	completed := launch()
+	trade(payer.PublicKey(), completed, true, models.LamportsPerSOL/10)
+	trade(whale, completed, true, 500*models.LamportsPerSOL)
+
+	othersOnly := launch()
+	trade(whale, othersOnly, true, models.LamportsPerSOL/10)
+
+	tests := []struct {
+		name     string
+		mint     solana.PublicKey
+		found    bool
+		migrated bool
+	}{
+		{name: "held", mint: held, found: true},
+		{name: "sold out", mint: soldOut},
+		{name: "curve complete", mint: completed, found: true, migrated: true},
+		{name: "held by others", mint: othersOnly},
+	}
+
+	holdings, err := sol.FindPumpHoldings(t.Context(), c.rpc, payer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[solana.PublicKey]sol.Holding)
+	for _, holding := range holdings {
+		found[holding.Token.Mint] = holding
+	}
+	for _, test := range tests {
+		holding, exists := found[test.mint]
+		if exists != test.found {
+			t.Errorf("%s: found %v, want %v", test.name, exists, test.found)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		if holding.Amount != c.node.TokenBalance(payer.PublicKey(), test.mint) || holding.Token.Migrated != test.migrated {
+			t.Errorf("%s: %d tokens, migrated %v, want %d tokens, migrated %v",
+				test.name, holding.Amount, holding.Token.Migrated, c.node.TokenBalance(payer.PublicKey(), test.mint), test.migrated)
+		}
+		fill := sol.ReconciledFill(holding)
+		if !test.migrated && (fill.Price <= 0 || fill.SolLamports == 0 || fill.TokenAmount != holding.Amount) {
+			t.Errorf("%s: reconciled fill %s, want it priced at the curve", test.name, fill)
+		}
+	}
+	if len(holdings) != 2 {
+		t.Errorf("found %d holdings, want 2", len(holdings))
+	}
+}
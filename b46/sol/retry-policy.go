@@ -0,0 +1,294 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ErrorClass groups transaction pipeline errors by how they should be retried.
+type ErrorClass int
+
+const (
+	ErrorClassUnknown ErrorClass = iota
+	ErrorClassBlockhashExpired
+	ErrorClassRateLimited
+	ErrorClassSlippageExceeded
+	ErrorClassInsufficientFunds
+	ErrorClassCurveComplete
+	ErrorClassPriceRanAway
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassBlockhashExpired:
+		return "BLOCKHASH_EXPIRED"
+	case ErrorClassRateLimited:
+		return "RATE_LIMITED"
+	case ErrorClassSlippageExceeded:
+		return "SLIPPAGE_EXCEEDED"
+	case ErrorClassInsufficientFunds:
+		return "INSUFFICIENT_FUNDS"
+	case ErrorClassCurveComplete:
+		return "CURVE_COMPLETE"
+	case ErrorClassPriceRanAway:
+		return "PRICE_RAN_AWAY"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Fatal reports whether retrying can never succeed for this class of error.
+func (c ErrorClass) Fatal() bool {
+	return c == ErrorClassInsufficientFunds || c == ErrorClassCurveComplete || c == ErrorClassPriceRanAway
+}
+
+// NeedsRequote reports whether the order amounts must be recomputed before the next attempt.
+func (c ErrorClass) NeedsRequote() bool {
+	return c == ErrorClassSlippageExceeded
+}
+
+// Program error codes, see the pump.fun IDL. Custom error 1 is what the system and token
+// programs fail with when an account cannot cover a transfer.
+const (
+	pumpErrTooMuchSolRequired   = 6002
+	pumpErrTooLittleSolReceived = 6003
+	pumpErrBondingCurveComplete = 6005
+	errInsufficientFunds        = 1
+)
+
+// JSON-RPC error codes of the Solana RPC, and the code some providers rate limit with.
+const (
+	rpcErrSendTransactionPreflightFailure = -32002
+	rpcErrTooManyRequests                 = 429
+)
+
+// TransactionError is a transaction the runtime rejected, decoded from the err value of a
+// simulation, a preflight failure or a signature status, e.g. "BlockhashNotFound" or
+// {"InstructionError":[1,{"Custom":6002}]}.
+type TransactionError struct {
+	Stage  string // simulation, preflight or confirmation
+	Name   string // e.g. BlockhashNotFound, InsufficientFundsForRent or InstructionError
+	Index  int    // instruction that failed, for instruction errors
+	Detail string // builtin instruction error, e.g. InvalidAccountData, empty for custom ones
+	Custom uint32 // program error code, when Detail is empty
+	Raw    any
+}
+
+// NewTransactionError decodes the err value reported by the RPC for a transaction.
+func NewTransactionError(stage string, value any) *TransactionError {
+	txErr := &TransactionError{Stage: stage, Raw: value}
+	switch v := value.(type) {
+	case string:
+		txErr.Name = v
+	case map[string]any:
+		for name, detail := range v {
+			txErr.Name = name
+			fields, isInstruction := detail.([]any)
+			if name != "InstructionError" || !isInstruction || len(fields) != 2 {
+				continue
+			}
+			index, _ := errorCode(fields[0])
+			txErr.Index = int(index)
+			switch instruction := fields[1].(type) {
+			case string:
+				txErr.Detail = instruction
+			case map[string]any:
+				txErr.Custom, _ = errorCode(instruction["Custom"])
+			}
+		}
+	}
+	return txErr
+}
+
+func (e *TransactionError) Error() string {
+	if e.Name == "InstructionError" && e.Detail == "" {
+		return fmt.Sprintf("%s error: instruction %d failed with custom program error %d", e.Stage, e.Index, e.Custom)
+	}
+	if e.Name == "InstructionError" {
+		return fmt.Sprintf("%s error: instruction %d failed with %s", e.Stage, e.Index, e.Detail)
+	}
+	return fmt.Sprintf("%s error: %v", e.Stage, e.Raw)
+}
+
+// Class maps the runtime error to an ErrorClass.
+func (e *TransactionError) Class() ErrorClass {
+	switch e.Name {
+	case "BlockhashNotFound":
+		return ErrorClassBlockhashExpired
+	case "InsufficientFundsForFee", "InsufficientFundsForRent":
+		return ErrorClassInsufficientFunds
+	case "InstructionError":
+		if e.Detail != "" {
+			return ErrorClassUnknown
+		}
+		switch e.Custom {
+		case pumpErrBondingCurveComplete:
+			return ErrorClassCurveComplete
+		case pumpErrTooMuchSolRequired, pumpErrTooLittleSolReceived:
+			return ErrorClassSlippageExceeded
+		case errInsufficientFunds:
+			return ErrorClassInsufficientFunds
+		}
+	}
+	return ErrorClassUnknown
+}
+
+// errorCode reads a number decoded from JSON, as a float64 or a json.Number.
+func errorCode(value any) (uint32, bool) {
+	switch v := value.(type) {
+	case float64:
+		return uint32(v), true
+	case json.Number:
+		code, err := v.Int64()
+		return uint32(code), err == nil
+	}
+	return 0, false
+}
+
+// ClassifyError maps an error from the transaction pipeline to an ErrorClass, from the
+// class a policy gave up with, the runtime error of the transaction, or the JSON-RPC error
+// code and HTTP status of a failed call. Pipeline steps wrap these errors with %w.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+	var pipelineErr *PipelineError
+	if errors.As(err, &pipelineErr) {
+		return pipelineErr.Class
+	}
+	var txErr *TransactionError
+	if errors.As(err, &txErr) {
+		return txErr.Class()
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		if rpcErr.Code == rpcErrTooManyRequests {
+			return ErrorClassRateLimited
+		}
+		if data, isMap := rpcErr.Data.(map[string]any); isMap && rpcErr.Code == rpcErrSendTransactionPreflightFailure && data["err"] != nil {
+			return NewTransactionError("preflight", data["err"]).Class()
+		}
+		return ErrorClassUnknown
+	}
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code == http.StatusTooManyRequests {
+		return ErrorClassRateLimited
+	}
+	return ErrorClassUnknown
+}
+
+// PipelineError is returned once a retry policy gives up, carrying the class of the last error.
+type PipelineError struct {
+	Class    ErrorClass
+	Attempts int
+	Err      error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("%s after %d attempt(s): %v", e.Class, e.Attempts, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// IsFatalError reports whether an error should stop every further retry, including order level retries.
+func IsFatalError(err error) bool {
+	return ClassifyError(err).Fatal()
+}
+
+// CheckPriceLimit aborts an order whose requoted price moved past the order's acceptable price.
+// For buys the limit is the highest acceptable price, for sells the lowest. A zero limit disables the check.
+func CheckPriceLimit(side string, price, limit float64) error {
+	if limit <= 0 {
+		return nil
+	}
+	ranAway := price > limit
+	if side == "sell" {
+		ranAway = price < limit
+	}
+	if !ranAway {
+		return nil
+	}
+	return &PipelineError{
+		Class:    ErrorClassPriceRanAway,
+		Attempts: 1,
+		Err:      fmt.Errorf("price ran away: %s quote %.20f is past the acceptable %.20f", side, price, limit),
+	}
+}
+
+// RetryPolicy describes how a transaction pipeline step is retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is shared by the buy, sell and associated account pipelines.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: models.MaxRetries,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    8 * time.Second,
+}
+
+// Backoff returns how long to wait before the given (zero based) attempt is retried.
+// An expired blockhash is retried straight away since the next attempt fetches a new one,
+// rate limits back off twice as long.
+func (p RetryPolicy) Backoff(attempt int, class ErrorClass) time.Duration {
+	if class == ErrorClassBlockhashExpired {
+		return 0
+	}
+	delay := p.BaseDelay << attempt
+	if class == ErrorClassRateLimited {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Do runs step until it succeeds, a fatal error occurs, the context ends or the attempts run out.
+// When an error needs a requote, requote is called before the next attempt; a requote error aborts.
+func (p RetryPolicy) Do(ctx context.Context, name string, step func(attempt int) error, requote func() error) error {
+	var err error
+	class := ErrorClassUnknown
+	attempts := 0
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		attempts = attempt + 1
+		err = step(attempt)
+		if err == nil {
+			return nil
+		}
+		class = ClassifyError(err)
+		log.Printf("%s attempt %d failed [%s]: %v", name, attempts, class, err)
+		if class.Fatal() || attempts == p.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return &PipelineError{Class: class, Attempts: attempts, Err: fmt.Errorf("%s canceled: %v (last error: %w)", name, ctx.Err(), err)}
+		case <-time.After(p.Backoff(attempt, class)):
+		}
+
+		if class.NeedsRequote() && requote != nil {
+			if errRequote := requote(); errRequote != nil {
+				var requoteErr *PipelineError
+				if errors.As(errRequote, &requoteErr) {
+					requoteErr.Attempts = attempts
+					return requoteErr
+				}
+				return &PipelineError{Class: ClassifyError(errRequote), Attempts: attempts, Err: errRequote}
+			}
+		}
+	}
+	return &PipelineError{Class: class, Attempts: attempts, Err: fmt.Errorf("%s failed: %w", name, err)}
+}
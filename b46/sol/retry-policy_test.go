@@ -0,0 +1,137 @@
+package sol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	instruction := func(code any) map[string]any {
+		return map[string]any{"InstructionError": []any{float64(1), map[string]any{"Custom": code}}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ErrorClassUnknown},
+		{"plain", errors.New("connection reset"), ErrorClassUnknown},
+		{"digits are not a rate limit", fmt.Errorf("transaction 4Kd429xQ failed, 1429000 lamports at slot 342901"), ErrorClassUnknown},
+		{"custom formatting is not matched", errors.New("simulation error: map[InstructionError:[1 map[Custom:1]]]"), ErrorClassUnknown},
+		{"blockhash not found", NewTransactionError("simulation", "BlockhashNotFound"), ErrorClassBlockhashExpired},
+		{"fee", NewTransactionError("simulation", "InsufficientFundsForFee"), ErrorClassInsufficientFunds},
+		{"rent", NewTransactionError("confirmation", map[string]any{"InsufficientFundsForRent": map[string]any{"account_index": float64(2)}}), ErrorClassInsufficientFunds},
+		{"too much sol required", NewTransactionError("simulation", instruction(float64(6002))), ErrorClassSlippageExceeded},
+		{"too little sol received", NewTransactionError("simulation", instruction(json.Number("6003"))), ErrorClassSlippageExceeded},
+		{"curve complete", NewTransactionError("confirmation", instruction(float64(6005))), ErrorClassCurveComplete},
+		{"custom insufficient funds", NewTransactionError("simulation", instruction(float64(1))), ErrorClassInsufficientFunds},
+		{"other custom error", NewTransactionError("simulation", instruction(float64(6004))), ErrorClassUnknown},
+		{"builtin instruction error", NewTransactionError("simulation", map[string]any{"InstructionError": []any{float64(0), "InvalidAccountData"}}), ErrorClassUnknown},
+		{"wrapped", fmt.Errorf("sell not confirmed: %w", NewTransactionError("confirmation", instruction(float64(6003)))), ErrorClassSlippageExceeded},
+		{"rpc rate limit", fmt.Errorf("failed to fetch blockhash: %w", &jsonrpc.RPCError{Code: 429, Message: "Too many requests"}), ErrorClassRateLimited},
+		{"http rate limit", fmt.Errorf("failed to fetch blockhash: %w", jsonrpc.NewHTTPError(429, errors.New("429 Too Many Requests"))), ErrorClassRateLimited},
+		{"http server error", jsonrpc.NewHTTPError(503, errors.New("503 Service Unavailable")), ErrorClassUnknown},
+		{"preflight", &jsonrpc.RPCError{Code: -32002, Message: "Transaction simulation failed", Data: map[string]any{"err": "BlockhashNotFound"}}, ErrorClassBlockhashExpired},
+		{"other rpc error", &jsonrpc.RPCError{Code: -32005, Message: "Node is unhealthy"}, ErrorClassUnknown},
+		{"pipeline", &PipelineError{Class: ErrorClassPriceRanAway, Attempts: 2, Err: errors.New("price ran away")}, ErrorClassPriceRanAway},
+		{"price limit", CheckPriceLimit("buy", 2, 1), ErrorClassPriceRanAway},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ClassifyError(test.err); got != test.want {
+				t.Errorf("ClassifyError(%v) = %s, want %s", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPriceLimit(t *testing.T) {
+	tests := []struct {
+		side         string
+		price, limit float64
+		ranAway      bool
+	}{
+		{"buy", 1, 0, false},
+		{"buy", 1, 1, false},
+		{"buy", 1.1, 1, true},
+		{"sell", 0.9, 1, true},
+		{"sell", 1.1, 1, false},
+	}
+	for _, test := range tests {
+		if err := CheckPriceLimit(test.side, test.price, test.limit); (err != nil) != test.ranAway {
+			t.Errorf("CheckPriceLimit(%s, %v, %v) = %v, want ran away %t", test.side, test.price, test.limit, err, test.ranAway)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 500 * time.Millisecond, MaxDelay: 8 * time.Second}
+	tests := []struct {
+		attempt int
+		class   ErrorClass
+		want    time.Duration
+	}{
+		{0, ErrorClassUnknown, 500 * time.Millisecond},
+		{1, ErrorClassUnknown, time.Second},
+		{3, ErrorClassSlippageExceeded, 4 * time.Second},
+		{5, ErrorClassUnknown, 8 * time.Second},
+		{1, ErrorClassRateLimited, 2 * time.Second},
+		{4, ErrorClassRateLimited, 8 * time.Second},
+		{3, ErrorClassBlockhashExpired, 0},
+	}
+	for _, test := range tests {
+		if got := policy.Backoff(test.attempt, test.class); got != test.want {
+			t.Errorf("Backoff(%d, %s) = %s, want %s", test.attempt, test.class, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3}
+	slippage := NewTransactionError("simulation", map[string]any{"InstructionError": []any{float64(1), map[string]any{"Custom": float64(6002)}}})
+
+	tests := []struct {
+		name      string
+		errs      []error
+		requote   error
+		attempts  int
+		requotes  int
+		wantClass ErrorClass
+		success   bool
+	}{
+		{name: "succeeds after a retry", errs: []error{errors.New("timeout"), nil}, attempts: 2, success: true},
+		{name: "gives up", errs: []error{errors.New("a"), errors.New("b"), errors.New("c")}, attempts: 3, wantClass: ErrorClassUnknown},
+		{name: "fatal stops at once", errs: []error{NewTransactionError("simulation", "InsufficientFundsForFee")}, attempts: 1, wantClass: ErrorClassInsufficientFunds},
+		{name: "slippage requotes", errs: []error{slippage, nil}, attempts: 2, requotes: 1, success: true},
+		{name: "requote aborts", errs: []error{slippage, nil}, requote: CheckPriceLimit("buy", 2, 1), attempts: 1, requotes: 1, wantClass: ErrorClassPriceRanAway},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, requotes := 0, 0
+			err := policy.Do(t.Context(), test.name, func(attempt int) error {
+				attempts++
+				return test.errs[attempt]
+			}, func() error {
+				requotes++
+				return test.requote
+			})
+			if attempts != test.attempts || requotes != test.requotes {
+				t.Errorf("%d attempts and %d requotes, want %d and %d", attempts, requotes, test.attempts, test.requotes)
+			}
+			if test.success {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			var pipelineErr *PipelineError
+			if !errors.As(err, &pipelineErr) || pipelineErr.Class != test.wantClass || pipelineErr.Attempts != test.attempts {
+				t.Errorf("error %v, want %s after %d attempts", err, test.wantClass, test.attempts)
+			}
+		})
+	}
+}
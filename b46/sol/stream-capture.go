@@ -0,0 +1,208 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coder/websocket"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// StreamConn is the websocket PumpFunListener subscribes and reads from: a live
+// *websocket.Conn, a StreamRecorder wrapping one, or a StreamReplay of a capture.
+type StreamConn interface {
+	Read(ctx context.Context) (websocket.MessageType, []byte, error)
+	Write(ctx context.Context, typ websocket.MessageType, p []byte) error
+}
+
+// CapturedFrame is one websocket frame of a capture, as received.
+type CapturedFrame struct {
+	Time time.Time             `json:"time"`
+	Type websocket.MessageType `json:"type"`
+	Data []byte                `json:"data"`
+}
+
+// StreamRecorder passes a StreamConn through and writes every frame read from it, with
+// the time it was received, to a gzip compressed JSON-lines capture. The capture is
+// flushed after every frame, so the capture of a session that was killed is readable up
+// to its last frame.
+type StreamRecorder struct {
+	conn StreamConn
+
+	mutex   sync.Mutex
+	file    *os.File
+	zip     *gzip.Writer
+	encoder *json.Encoder
+	frames  uint64
+	err     error // the first write error, recording stops there
+}
+
+// NewStreamRecorder records the frames read from conn to filename.
+func NewStreamRecorder(conn StreamConn, filename string) (*StreamRecorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream capture: %w", err)
+	}
+	zip := gzip.NewWriter(file)
+	return &StreamRecorder{conn: conn, file: file, zip: zip, encoder: json.NewEncoder(zip)}, nil
+}
+
+// Read reads the next frame from the recorded conn and captures it. Capture errors do not
+// fail the read, the listener keeps running and Err reports them.
+func (r *StreamRecorder) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	typ, data, err := r.conn.Read(ctx)
+	if err != nil {
+		return typ, data, err
+	}
+	received := models.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil || r.zip == nil {
+		return typ, data, nil
+	}
+	if err := r.encoder.Encode(CapturedFrame{Time: received, Type: typ, Data: data}); err != nil {
+		r.err = fmt.Errorf("failed to capture frame: %w", err)
+	} else if err := r.zip.Flush(); err != nil {
+		r.err = fmt.Errorf("failed to flush stream capture: %w", err)
+	} else {
+		r.frames++
+	}
+	return typ, data, nil
+}
+
+// Write writes to the recorded conn. Sent frames are not captured, a replay answers the
+// subscription with the frames that followed it.
+func (r *StreamRecorder) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	return r.conn.Write(ctx, typ, p)
+}
+
+// Frames returns how many frames have been captured.
+func (r *StreamRecorder) Frames() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.frames
+}
+
+// Err returns the error that stopped the recording, if any.
+func (r *StreamRecorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// Close finishes the capture file. The recorded conn is left open.
+func (r *StreamRecorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.zip == nil {
+		return nil
+	}
+	errZip := r.zip.Close()
+	errFile := r.file.Close()
+	r.zip = nil
+	return errors.Join(errZip, errFile)
+}
+
+// StreamReplay reads a capture back as a StreamConn, each frame being returned when its
+// time comes. With a Speed of 1 frames are as far apart as when they were received, 10
+// replays ten times faster and 0 as fast as the listener reads. When Clock is set, it is
+// advanced to the receive time of every frame before the frame is returned, so tokens and
+// trades are dated as in the recorded session.
+type StreamReplay struct {
+	Speed float64
+	Clock *models.SimulatedClock
+
+	file    *os.File
+	zip     *gzip.Reader
+	decoder *json.Decoder
+	first   time.Time // receive time of the first frame
+	started time.Time // wall time the first frame was returned
+	frames  uint64
+}
+
+// OpenStreamReplay opens the capture in filename for replay at speed.
+func OpenStreamReplay(filename string, speed float64) (*StreamReplay, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream capture: %w", err)
+	}
+	zip, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read stream capture: %w", err)
+	}
+	return &StreamReplay{Speed: speed, file: file, zip: zip, decoder: json.NewDecoder(zip)}, nil
+}
+
+// Read returns the next frame of the capture once it is due, or io.EOF after the last.
+// A capture cut short by a crash ends at its last complete frame.
+func (r *StreamReplay) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	var frame CapturedFrame
+	if err := r.decoder.Decode(&frame); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, fmt.Errorf("failed to decode captured frame: %w", err)
+	}
+
+	if r.frames == 0 {
+		r.first = frame.Time
+		r.started = time.Now()
+	}
+	r.frames++
+	if r.Speed > 0 {
+		due := r.started.Add(time.Duration(float64(frame.Time.Sub(r.first)) / r.Speed))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	if r.Clock != nil {
+		if ahead := frame.Time.Sub(r.Clock.Now()); ahead > 0 {
+			r.Clock.Advance(ahead)
+		}
+	}
+	return frame.Type, frame.Data, nil
+}
+
+// Write discards what the listener sends, the capture already holds the answers.
+func (r *StreamReplay) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	return nil
+}
+
+// Frames returns how many frames have been replayed.
+func (r *StreamReplay) Frames() uint64 {
+	return r.frames
+}
+
+// Close closes the capture file.
+func (r *StreamReplay) Close() error {
+	return errors.Join(r.zip.Close(), r.file.Close())
+}
+
+// FirstFrameTime returns the receive time of the first frame in filename, the time a
+// SimulatedClock replaying the capture starts at.
+func FirstFrameTime(filename string) (time.Time, error) {
+	replay, err := OpenStreamReplay(filename, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer replay.Close()
+	var frame CapturedFrame
+	if err := replay.decoder.Decode(&frame); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode captured frame: %w", err)
+	}
+	return frame.Time, nil
+}
@@ -0,0 +1,187 @@
+package sol
+
+import (
+	"b46/b46/events"
+	"b46/b46/models"
+	"context"
+	"errors"
+	"github.com/coder/websocket"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The capture in testdata was recorded from fakenode: two launches and four trades, with
+// the clock at 2025-03-01T12:00:00Z when the subscription was answered.
+const capture = "testdata/pump-fun.jsonl.gz"
+
+func TestReplayCapture(t *testing.T) {
+	start, err := FirstFrameTime(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Fatalf("FirstFrameTime() = %v, want %v", start, want)
+	}
+	clock := models.NewSimulatedClock(start)
+	models.SetClock(clock)
+	t.Cleanup(func() { models.SetClock(models.SystemClock{}) })
+
+	replay, err := OpenStreamReplay(capture, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	replay.Clock = clock
+
+	bus := events.NewBus()
+	sub := bus.Subscribe("test", events.SubscribeOptions{Buffer: 16, Policy: events.Block, Types: []events.Type{events.TradeObserved}})
+	tokens := make(chan models.MemeToken)
+	go PumpFunListener(replay, tokens, bus)
+
+	type token struct{ name, symbol, mint, bondingCurve, associatedCurve string }
+	var created []token
+	for meme := range tokens {
+		created = append(created, token{meme.Name, meme.Symbol, meme.Mint.String(), meme.BondingCurve.String(), meme.AssociatedCurve.String()})
+	}
+	wantCreated := []token{
+		{"Alpha Dog", "ALPHA", "kufpJyuK6cakrxuxouVXTwYSNW8nFKKxhJmKzvdB62o", "6n5JVXGZHHBowfv93rxvLhfjr6cRspQiqQjyra74wUu", "64RYU4aBao2CU9GYXtxEV3CFRx8NP67Lx9BQXgL778CX"},
+		{"Beta Cat", "BETA", "BkKjMWZ3H1U7KhWayE9msW5f9vyYhB2V8kTdjKh4xuPa", "TS31z3uhk8iJg9hPVsXTTRpibGDpCQq3bRCgq37rHxk", "6gnLWTCXWrzHRpwsrFtbLcKmo3D5kuM1xh1YcNk3Ri5h"},
+	}
+	if !reflect.DeepEqual(created, wantCreated) {
+		t.Errorf("replay created %+v, want %+v", created, wantCreated)
+	}
+	if replay.Frames() != 7 {
+		t.Errorf("replayed %d frames, want 7", replay.Frames())
+	}
+	if end := clock.Now(); !end.Equal(start.Add(14 * time.Second)) {
+		t.Errorf("clock ended at %v, want the last frame at %v", end, start.Add(14*time.Second))
+	}
+
+	type trade struct {
+		seconds     int // after start
+		mint        string
+		isBuy       bool
+		solAmount   uint64
+		tokenAmount uint64
+	}
+	var observed []trade
+	for len(observed) < 4 {
+		select {
+		case event := <-sub.C():
+			e := event.(events.TradeObservedEvent)
+			if e.Trade.Timestamp != e.Time.Unix() {
+				t.Errorf("trade stamped %d on chain was observed at %v", e.Trade.Timestamp, e.Time)
+			}
+			observed = append(observed, trade{int(e.Time.Sub(start).Seconds()), e.Trade.Mint.String(), e.Trade.IsBuy, e.Trade.SolAmount, e.Trade.TokenAmount})
+		case <-time.After(time.Second):
+			t.Fatalf("observed %d trades, want 4", len(observed))
+		}
+	}
+	wantObserved := []trade{
+		{3, "kufpJyuK6cakrxuxouVXTwYSNW8nFKKxhJmKzvdB62o", true, 495049505, 17418831135930},
+		{7, "BkKjMWZ3H1U7KhWayE9msW5f9vyYhB2V8kTdjKh4xuPa", true, 990099010, 34281150129546},
+		{9, "kufpJyuK6cakrxuxouVXTwYSNW8nFKKxhJmKzvdB62o", false, 249550322, 8709415567965},
+		{14, "kufpJyuK6cakrxuxouVXTwYSNW8nFKKxhJmKzvdB62o", true, 1980198020, 65398309110963},
+	}
+	if !reflect.DeepEqual(observed, wantObserved) {
+		t.Errorf("replay observed %+v, want %+v", observed, wantObserved)
+	}
+}
+
+// frames is a StreamConn returning its frames, then io.EOF.
+type frames [][]byte
+
+func (f *frames) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	if len(*f) == 0 {
+		return 0, nil, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return websocket.MessageText, frame, nil
+}
+
+func (f *frames) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	return nil
+}
+
+func TestStreamRecorderRoundTrip(t *testing.T) {
+	clock := models.NewSimulatedClock(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	models.SetClock(clock)
+	t.Cleanup(func() { models.SetClock(models.SystemClock{}) })
+
+	filename := filepath.Join(t.TempDir(), models.StreamCaptureFile)
+	sent := [][]byte{[]byte(`{"id":1}`), []byte(`{"n":2}`), []byte(`{"n":3}`)}
+	conn := frames(append([][]byte(nil), sent...))
+	recorder, err := NewStreamRecorder(&conn, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range sent {
+		if _, _, err := recorder.Read(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+	}
+	if _, _, err := recorder.Read(t.Context()); !errors.Is(err, io.EOF) {
+		t.Fatalf("Read() past the last frame = %v, want io.EOF", err)
+	}
+	if err := errors.Join(recorder.Err(), recorder.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := OpenStreamReplay(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	first, err := FirstFrameTime(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayClock := models.NewSimulatedClock(first)
+	replay.Clock = replayClock
+	for i, want := range sent {
+		_, data, err := replay.Read(t.Context())
+		if err != nil || string(data) != string(want) {
+			t.Fatalf("frame %d = %s, %v, want %s", i, data, err, want)
+		}
+		if at := time.Date(2025, 3, 1, 12, i, 0, 0, time.UTC); !replayClock.Now().Equal(at) {
+			t.Errorf("frame %d replayed at %v, want %v", i, replayClock.Now(), at)
+		}
+	}
+	if _, _, err := replay.Read(t.Context()); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() past the last frame = %v, want io.EOF", err)
+	}
+
+	// A capture cut short ends at its last complete frame.
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.jsonl.gz")
+	if err := os.WriteFile(truncated, data[:len(data)-12], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cut, err := OpenStreamReplay(truncated, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cut.Close()
+	read := 0
+	for {
+		if _, _, err := cut.Read(t.Context()); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Read() of a truncated capture = %v, want io.EOF", err)
+			}
+			break
+		}
+		read++
+	}
+	if read != len(sent) {
+		t.Errorf("read %d frames of the truncated capture, want %d", read, len(sent))
+	}
+}
@@ -0,0 +1,166 @@
+package sol
+
+import (
+	"b46/b46/logging"
+	"b46/b46/models"
+	"context"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"sync"
+	"time"
+)
+
+// BuyCostLamports is the most SOL a buy of amount SOL can take from the wallet: the
+// position with its slippage allowance, the rent of the associated token account and
+// the fees of the account and buy transactions.
+func BuyCostLamports(amount float64) uint64 {
+	position := uint64(amount * models.LamportsPerSOL * (1 + models.Slippage))
+	return position + models.AtaRentLamports + 2*models.EstimatedTxFeeLamports
+}
+
+// BalanceService tracks the wallet's lamports and the funds reserved by in-flight buys.
+// The balance is kept current by an account subscription, with polling as a fallback.
+type BalanceService struct {
+	sync.Mutex
+	rpcClient *rpc.Client
+	wsClient  *ws.Client
+	owner     solana.PublicKey
+	floor     uint64
+
+	lamports  uint64
+	updatedAt time.Time
+	reserved  map[string]uint64
+}
+
+// NewBalanceService creates a balance service for owner that keeps floorSOL untouched.
+func NewBalanceService(rpcClient *rpc.Client, wsClient *ws.Client, owner solana.PublicKey, floorSOL float64) *BalanceService {
+	return &BalanceService{
+		rpcClient: rpcClient,
+		wsClient:  wsClient,
+		owner:     owner,
+		floor:     uint64(floorSOL * models.LamportsPerSOL),
+		reserved:  make(map[string]uint64),
+	}
+}
+
+// Refresh fetches the current balance from the RPC node.
+func (b *BalanceService) Refresh(ctx context.Context) error {
+	out, err := b.rpcClient.GetBalance(ctx, b.owner, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to get wallet balance: %w", err)
+	}
+	b.setLamports(out.Value)
+	return nil
+}
+
+// Watch keeps the balance current until ctx is canceled. It follows the wallet's account
+// subscription and polls the RPC node whenever the subscription is unavailable.
+func (b *BalanceService) Watch(ctx context.Context) {
+	if err := b.Refresh(ctx); err != nil {
+		logging.PrintErrorToLog("Balance refresh error:		", err.Error())
+	}
+	for {
+		if b.wsClient != nil {
+			if err := b.follow(ctx); err != nil {
+				logging.PrintErrorToLog("Balance subscription error:		", err.Error())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(models.BalanceRefreshInterval * time.Second):
+		}
+		if err := b.Refresh(ctx); err != nil {
+			logging.PrintErrorToLog("Balance refresh error:		", err.Error())
+		}
+	}
+}
+
+// follow applies account notifications until the subscription fails or ctx is canceled.
+func (b *BalanceService) follow(ctx context.Context) error {
+	sub, err := b.wsClient.AccountSubscribe(b.owner, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet account: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		result, err := sub.Recv(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if result != nil && result.Value != nil {
+			b.setLamports(result.Value.Lamports)
+		}
+	}
+}
+
+func (b *BalanceService) setLamports(lamports uint64) {
+	b.Lock()
+	defer b.Unlock()
+	b.lamports = lamports
+	b.updatedAt = models.Now()
+}
+
+// Reserve sets aside lamports for the in-flight order identified by key. The reservation
+// is refused when it would leave the wallet below the configured floor.
+func (b *BalanceService) Reserve(key string, lamports uint64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.updatedAt.IsZero() {
+		return &PipelineError{Class: ErrorClassInsufficientFunds, Attempts: 1, Err: fmt.Errorf("wallet balance unknown")}
+	}
+	available := b.available()
+	if available < lamports || available-lamports < b.floor {
+		return &PipelineError{
+			Class:    ErrorClassInsufficientFunds,
+			Attempts: 1,
+			Err: fmt.Errorf("buy needs %.6f SOL, %.6f SOL available above the %.6f SOL floor",
+				lamportsToSOL(lamports), lamportsToSOL(available)-lamportsToSOL(b.floor), lamportsToSOL(b.floor)),
+		}
+	}
+	b.reserved[key] += lamports
+	return nil
+}
+
+// Release frees the reservation of key, once its order has finished either way.
+func (b *BalanceService) Release(key string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.reserved, key)
+}
+
+// Available returns the lamports not reserved by in-flight orders.
+func (b *BalanceService) Available() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.available()
+}
+
+func (b *BalanceService) available() uint64 {
+	var reserved uint64
+	for _, lamports := range b.reserved {
+		reserved += lamports
+	}
+	if reserved > b.lamports {
+		return 0
+	}
+	return b.lamports - reserved
+}
+
+func (b *BalanceService) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return fmt.Sprintf("Balance{Wallet: %.6f SOL, Available: %.6f SOL, Reserved: %d order(s), Floor: %.6f SOL, Updated: %s}",
+		lamportsToSOL(b.lamports), lamportsToSOL(b.available()), len(b.reserved), lamportsToSOL(b.floor), b.updatedAt.Format(time.TimeOnly))
+}
+
+func lamportsToSOL(lamports uint64) float64 {
+	return float64(lamports) / models.LamportsPerSOL
+}
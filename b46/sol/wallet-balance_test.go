@@ -0,0 +1,66 @@
+package sol
+
+import (
+	"b46/b46/models"
+	"errors"
+	"github.com/gagliardetto/solana-go"
+	"testing"
+)
+
+func TestBalanceServiceReserve(t *testing.T) {
+	const wallet = models.LamportsPerSOL
+	floor := uint64(models.MinWalletBalanceSOL * models.LamportsPerSOL)
+
+	tests := []struct {
+		name     string
+		unknown  bool
+		reserved uint64 // held by another in-flight order
+		lamports uint64
+		rejected bool
+	}{
+		{name: "fits", lamports: BuyCostLamports(0.5)},
+		{name: "down to the floor", lamports: wallet - floor},
+		{name: "below the floor", lamports: wallet - floor + 1, rejected: true},
+		{name: "more than the wallet", lamports: wallet + 1, rejected: true},
+		{name: "below the floor with another order", reserved: BuyCostLamports(0.5), lamports: BuyCostLamports(0.5), rejected: true},
+		{name: "balance unknown", unknown: true, lamports: 1, rejected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			balance := NewBalanceService(nil, nil, solana.PublicKey{}, models.MinWalletBalanceSOL)
+			if !test.unknown {
+				balance.setLamports(wallet)
+			}
+			if test.reserved > 0 {
+				if err := balance.Reserve("other", test.reserved); err != nil {
+					t.Fatal(err)
+				}
+			}
+			available := balance.Available()
+
+			err := balance.Reserve("order", test.lamports)
+			if test.rejected {
+				var pipelineErr *PipelineError
+				if !errors.As(err, &pipelineErr) || pipelineErr.Class != ErrorClassInsufficientFunds {
+					t.Fatalf("Reserve() = %v, want insufficient funds", err)
+				}
+				if got := balance.Available(); got != available {
+					t.Errorf("rejected order reserved %d lamports", available-got)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Reserve() = %v", err)
+				}
+				if got := balance.Available(); got != available-test.lamports {
+					t.Errorf("available %d, want %d", got, available-test.lamports)
+				}
+			}
+
+			// Rolling the order back leaves the other orders' reservations alone.
+			balance.Release("order")
+			if got := balance.Available(); got != available {
+				t.Errorf("available %d after release, want %d", got, available)
+			}
+		})
+	}
+}
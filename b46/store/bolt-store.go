@@ -0,0 +1,111 @@
+package store
+
+import (
+	"b46/b46/models"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// BoltStore is the file backed StateStore. Every call is one transaction, fsynced before
+// it returns. Token updates only reach it when models flushes them, so a crash loses the
+// updates queued since the last flush, but not the order states, which are flushed as
+// they happen, nor the positions, which are written directly.
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+// Open opens or creates the store at path.
+func Open(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Put stores value as JSON under key.
+func (s *BoltStore) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", bucket, key, err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Write applies writes in a single transaction, fsynced once. A nil value deletes its key.
+func (s *BoltStore) Write(writes []models.StoreWrite) error {
+	encoded := make([][]byte, len(writes))
+	for i, write := range writes {
+		if write.Value == nil {
+			continue
+		}
+		data, err := json.Marshal(write.Value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s/%s: %w", write.Bucket, write.Key, err)
+		}
+		encoded[i] = data
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for i, write := range writes {
+			b, err := tx.CreateBucketIfNotExists([]byte(write.Bucket))
+			if err != nil {
+				return err
+			}
+			if encoded[i] == nil {
+				err = b.Delete([]byte(write.Key))
+			} else {
+				err = b.Put([]byte(write.Key), encoded[i])
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes key, a missing key is not an error.
+func (s *BoltStore) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// DeleteAll removes every key of bucket.
+func (s *BoltStore) DeleteAll(bucket string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucket)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(bucket))
+	})
+}
+
+// ForEach calls fn for every key of bucket. The data is only valid during the call.
+func (s *BoltStore) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"b46/b46/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Put("trades", "gone", 1); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Write([]models.StoreWrite{
+		{Bucket: "trades", Key: "a", Value: map[string]int{"n": 1}},
+		{Bucket: "archive", Key: "b", Value: "closed"},
+		{Bucket: "trades", Key: "gone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]string{
+		"trades":  {"a": `{"n":1}`},
+		"archive": {"b": `"closed"`},
+	}
+	for bucket, values := range want {
+		got := make(map[string]string)
+		if err := s.ForEach(bucket, func(key string, data []byte) error {
+			got[key] = string(data)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(values) {
+			t.Errorf("%s holds %v, want %v", bucket, got, values)
+		}
+		for key, value := range values {
+			if got[key] != value {
+				t.Errorf("%s/%s = %q, want %q", bucket, key, got[key], value)
+			}
+		}
+	}
+}
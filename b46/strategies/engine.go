@@ -0,0 +1,692 @@
+package strategies
+
+import (
+	"b46/b46/_sys_init"
+	analysis "b46/b46/chart-analysis"
+	"b46/b46/events"
+	"b46/b46/logging"
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/risk"
+	"b46/b46/sol"
+	"b46/b46/store"
+	"context"
+	"github.com/coder/websocket"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"log"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Engine runs strategies against pump.fun: it listens for new tokens, snapshots them,
+// asks the strategies what to do and carries their decisions out through the Trader.
+// Several strategies share the wallet, each within the budget of its Allocation.
+type Engine struct {
+	Context context.Context
+	sync.Mutex
+	RpcClient *rpc.Client
+	WssClient *ws.Client
+	Websocket *websocket.Conn
+	Wallet    solana.PublicKey
+
+	// Stream is what ListenPumpFun reads instead of Websocket when set before Start, e.g.
+	// a sol.StreamReplay. The live Websocket is recorded by Recorder when RecordStream is on.
+	Stream   sol.StreamConn
+	Recorder *sol.StreamRecorder
+
+	// Strategies are consulted in order, the first one to claim a token owns it.
+	Strategies  []Strategy
+	Allocations []risk.Allocation
+	Allocator   *risk.Allocator
+
+	Store      *store.BoltStore
+	Bus        *events.Bus
+	Executor   *sol.PumpFunExecutor
+	Trader     *Trader
+	KillSwitch *KillSwitch
+
+	// Manifest is the session.json of the running session, see StartSession.
+	Manifest       logging.Manifest
+	tokensSeen     atomic.Uint64
+	tokensPromoted atomic.Uint64
+}
+
+func NewEngine(strategies []Strategy, allocations []risk.Allocation) *Engine {
+	return &Engine{Strategies: strategies, Allocations: allocations}
+}
+
+func (engine *Engine) InitializeEngine() {
+	engine.Lock()
+	engine.Context = context.Background()
+
+	engine.RpcClient = rpc.New(_sys_init.Env.RPC)
+	wssClient, errorWss := ws.Connect(engine.Context, _sys_init.Env.WSS)
+	if errorWss != nil {
+		logging.PrintErrorToLog("Failed to initialize wss client:		", errorWss.Error())
+	}
+	engine.WssClient = wssClient
+
+	conn, _, err := websocket.Dial(engine.Context, _sys_init.Env.WSS, nil)
+	if err != nil {
+		logging.PrintErrorToLog("Failed to initialize websocket:		", err.Error())
+	}
+	engine.Websocket = conn
+
+	// Open the state store before anything reads or writes the token maps.
+	stateStore, errStore := store.Open(filepath.Join(logging.LogDir(), models.StateStoreFile))
+	if errStore != nil {
+		logging.PrintErrorToLog("Failed to open state store, running in memory:		", errStore.Error())
+	} else {
+		engine.Store = stateStore
+		models.Store = stateStore
+	}
+
+	// Every component publishes what it observes, strategies and sinks subscribe here.
+	engine.Bus = events.NewBus()
+
+	// Instantiate the executor that knows how to do the actual sells. Orders are paper
+	// traded unless LIVE is set.
+	engine.Executor = &sol.PumpFunExecutor{Live: _sys_init.Env.LIVE == "TRUE"}
+	if engine.Executor.Live {
+		log.Println("LIVE TRADING: orders are sent on chain")
+	}
+	engine.Trader = NewTradeHandler(engine.Executor, models.OrderQueueSize, models.OrderWorkers)
+	engine.Trader.Risk = risk.NewManager(risk.DefaultLimits())
+	engine.Trader.Bus = engine.Bus
+	engine.Allocator = risk.NewAllocator(engine.Allocations)
+	engine.Trader.Allocator = engine.Allocator
+	if errLoad := engine.Trader.Portfolio.Load(); errLoad != nil {
+		logging.PrintErrorToLog("Failed to reload positions:		", errLoad.Error())
+	}
+	payer := solana.MustPrivateKeyFromBase58(_sys_init.Env.PK)
+	engine.Wallet = payer.PublicKey()
+	engine.Trader.Balance = sol.NewBalanceService(engine.RpcClient, engine.WssClient, engine.Wallet, models.MinWalletBalanceSOL)
+	engine.KillSwitch = NewKillSwitch(engine.Trader, filepath.Join(logging.LogDir(), models.KillSwitchStateFile))
+
+	defer engine.Unlock()
+}
+
+func (engine *Engine) Start() {
+	ctx, _ := context.WithCancel(context.Background())
+	for _, allocation := range engine.Allocations {
+		log.Printf("Running strategy %s: budget %.4f SOL, max %d positions\n", allocation.Strategy, allocation.BudgetSOL, allocation.MaxPositions)
+	}
+
+	// Transitions are written by the monitor, the trade loop and the trader alike.
+	if errInitLogger := logging.InitLogger("lifecycle.log"); errInitLogger != nil {
+		logging.PrintErrorToLog("Error init lifecycle logger:		", errInitLogger.Error())
+	}
+
+	models.InitializePumpMemes()
+	engine.ReconcilePositions(ctx)
+
+	go models.WatchStore(ctx)
+	go engine.DispatchEvents(ctx)
+	go engine.ListenPumpFun()
+	go engine.MonitorMemes()
+
+	go engine.Trader.Balance.Watch(ctx)
+	go engine.Trader.Start(ctx)
+	go engine.KillSwitch.WatchSessionFiles(ctx, logging.SessionDir())
+
+	engine.Trade(engine.Trader)
+}
+
+// ReconcilePositions rebuilds the positions of a restarted bot so it keeps managing their
+// exits. Open positions reloaded from the state store come first, then pump.fun tokens
+// still held by the wallet that the store does not know about. Reconciled tokens are
+// added to TradesMap as held, which hands them to the strategy's exit rules in Trade.
+// When trading live, stored positions the wallet no longer holds are written off.
+func (engine *Engine) ReconcilePositions(ctx context.Context) {
+	owner := engine.Strategies[0].Name()
+
+	// Orders in flight when the previous run stopped are gone, their tokens go back
+	// to the state the order started from. Tokens traded before strategies were
+	// tracked, or by a strategy that is not running anymore, are handed to the first
+	// strategy, whose exit rules then manage their positions.
+	for key, token := range models.TradesMap.GetTokens() {
+		if !engine.running(token.Strategy) {
+			if token.Strategy != "" {
+				log.Println("REASSIGNED			:", key, token.Strategy, "->", owner)
+			}
+			token.Strategy = owner
+			models.TradesMap.SetToken(token)
+		}
+		var restored models.TokenState
+		switch token.State {
+		case models.StateEntering:
+			restored = models.StateCandidate
+		case models.StateExiting:
+			restored = models.StateHeld
+		default:
+			continue
+		}
+		transition := token.ForceState(restored, "order lost on restart")
+		models.TradesMap.SetToken(token)
+		logging.PrintTransitionToLog(token, transition)
+		log.Println("RESTORED STATE		:", key, transition)
+	}
+
+	for _, position := range engine.Trader.Portfolio.Positions() {
+		if !position.Open() {
+			continue
+		}
+		if engine.Trader.Risk != nil {
+			engine.Trader.Risk.RestorePosition(position.Mint, "", position.CostBasis, position.EntryPrice)
+		}
+		strategy := position.Strategy
+		if token, exists := models.TradesMap.Get(position.Mint); exists && !engine.running(strategy) {
+			strategy = token.Strategy
+		}
+		if !engine.running(strategy) {
+			strategy = owner
+		}
+		engine.Allocator.RestorePosition(strategy, position.Mint, position.CostBasis)
+		engine.Executor.RestoreHolding(position.Mint, position.Tokens)
+		log.Println("RESTORED			:", position.Mint, position)
+	}
+
+	payer := solana.MustPrivateKeyFromBase58(_sys_init.Env.PK)
+	holdings, err := sol.FindPumpHoldings(ctx, engine.RpcClient, payer.PublicKey())
+	if err != nil {
+		logging.PrintErrorToLog("Error reconciling positions:		", err.Error())
+		return
+	}
+	if engine.Executor.Live {
+		engine.writeOffUnheld(holdings)
+	}
+
+	for _, holding := range holdings {
+		token := holding.Token
+		mint := token.Mint.String()
+		if token.Migrated {
+			log.Println("RECONCILE SKIP MIGRATED	:", mint)
+			continue
+		}
+		if position, exists := engine.Trader.Portfolio.Position(mint); exists && position.Open() {
+			engine.Executor.RestoreHolding(mint, holding.Amount)
+			continue
+		}
+		transition := token.ForceState(models.StateHeld, "reconciled from wallet")
+		token.Strategy = owner
+		models.TradesMap.SetToken(token)
+		logging.PrintTransitionToLog(token, transition)
+
+		fill := sol.ReconciledFill(holding)
+		fill.Strategy = owner
+		position := engine.Trader.Portfolio.ApplyFill(token, fill)
+		if engine.Trader.Risk != nil {
+			engine.Trader.Risk.RestorePosition(mint, token.User, position.CostBasis, fill.Price)
+		}
+		engine.Allocator.RestorePosition(owner, mint, position.CostBasis)
+		engine.Executor.RestoreHolding(mint, holding.Amount)
+
+		log.Println("RECONCILED			:", mint, position)
+	}
+	log.Printf("Reconciled %d position(s) from the wallet\n", len(holdings))
+}
+
+// running reports whether strategy is one of the engine's strategies.
+func (engine *Engine) running(strategy string) bool {
+	for _, running := range engine.Strategies {
+		if running.Name() == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOffUnheld closes the stored live positions the wallet no longer holds, e.g. sold
+// by hand while the bot was down. Their exits cannot be managed, so the positions are
+// written off and their tokens closed.
+func (engine *Engine) writeOffUnheld(holdings []sol.Holding) {
+	held := make(map[string]bool)
+	for _, holding := range holdings {
+		held[holding.Token.Mint.String()] = true
+	}
+	for _, position := range engine.Trader.Portfolio.Positions() {
+		if !position.Open() || held[position.Mint] {
+			continue
+		}
+		token, exists := models.TradesMap.Get(position.Mint)
+		if exists {
+			transition := token.ForceState(models.StateClosed, "not held by the wallet")
+			models.TradesMap.SetToken(token)
+			logging.PrintTransitionToLog(token, transition)
+		} else {
+			token.Mint = solana.MustPublicKeyFromBase58(position.Mint)
+		}
+		engine.Trader.WriteOff(token, "not held by the wallet")
+		log.Println("RECONCILE NOT HELD	:", position.Mint)
+	}
+}
+
+// DispatchEvents hands the bus events strategies react to over to them and carries out
+// their decisions, until ctx is canceled.
+func (engine *Engine) DispatchEvents(ctx context.Context) {
+	sub := engine.Bus.Subscribe("strategies", events.SubscribeOptions{
+		Buffer: models.StrategyEventBuffer,
+		Policy: events.DropNewest,
+		Types:  []events.Type{events.TokenCreated, events.TradeObserved, events.OrderFilled},
+	})
+	defer engine.Bus.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-sub.C():
+			token, exists := engine.lookup(event.Mint())
+			if !exists {
+				continue
+			}
+			switch e := event.(type) {
+			case events.TokenCreatedEvent:
+				engine.decide(token, func(strategy Strategy) Decision { return strategy.OnTokenCreated(token) })
+			case events.TradeObservedEvent:
+				engine.decide(token, func(strategy Strategy) Decision { return strategy.OnTrade(token, e.Trade) })
+			case events.OrderFilledEvent:
+				engine.decide(token, func(strategy Strategy) Decision { return strategy.OnFill(token, e.Fill) })
+			}
+		}
+	}
+}
+
+func (engine *Engine) ListenPumpFun() {
+	memeData := make(chan models.MemeToken)
+	stream := engine.Stream
+	if stream == nil {
+		stream = engine.Websocket
+		if models.RecordStream {
+			recorder, err := sol.NewStreamRecorder(engine.Websocket, filepath.Join(logging.SessionDir(), models.StreamCaptureFile))
+			if err != nil {
+				logging.PrintErrorToLog("Failed to record stream:		", err.Error())
+			} else {
+				engine.Recorder = recorder
+				stream = recorder
+			}
+		}
+	}
+	go sol.PumpFunListener(stream, memeData, engine.Bus)
+
+	go func(ch <-chan models.MemeToken) {
+		for data := range ch { // Continuously receive from the channel
+			//fmt.Printf("📥 Consumer: Received data %v\n", data)
+			//log.Println(models.PumpMemes)
+			finalMemeToken := engine.UpdateMemeToken(data, 0)
+			sol.PrintTokenMeme(finalMemeToken)
+			models.PumpMemes.SetToken(finalMemeToken)
+			engine.tokensSeen.Add(1)
+			engine.Bus.Publish(events.TokenCreatedEvent{Token: finalMemeToken, Time: models.Now()})
+		}
+	}(memeData)
+}
+
+func (engine *Engine) MonitorMemes() {
+	// Poll the tokens every 20 seconds
+	ticker := models.NewTicker(models.MONITOR_DURATION * time.Second)
+	defer ticker.Stop()
+
+	errInitLogger := logging.InitLogger("monitor.log")
+	if errInitLogger != nil {
+		logging.PrintErrorToLog("Error init logger:		", errInitLogger.Error())
+	}
+	defer func() {
+		// Ensure we close the logger before exiting
+		if cerr := logging.CloseLoggerFile("monitor.log"); cerr != nil {
+			logging.PrintErrorToLog("Error close logger:		", cerr.Error())
+		}
+	}()
+	for range ticker.C() {
+		tokens := models.PumpMemes.GetTokens()
+		log.Println("###################################MONITOR##########################################")
+
+		if err := logging.LogEvent("monitor.log", "", logging.TickPayload{Loop: "monitor"}); err != nil {
+			// Optional local error handling
+			logging.PrintErrorToLog("logger write error:			", err.Error())
+		}
+
+		// The map you get here is a copy (if you coded GetTokens that way),
+		// so it’s safe to range over
+		for key, token := range tokens {
+			index := len(token.Info)
+			updatedMemeToken := engine.UpdateMemeToken(token, index)
+
+			// The token may have been promoted or rejected by an event since this tick
+			// started, only the snapshot is added to the token in the map.
+			updatedMemeToken, watching, err := models.PumpMemes.AddSnapshot(key, updatedMemeToken.Info[index])
+			if err != nil {
+				continue
+			}
+			if watching != nil {
+				logging.PrintTransitionToLog(updatedMemeToken, *watching)
+			}
+
+			//log.Println(key, updatedMemeToken)
+			if err := logging.LogEvent("monitor.log", key, logging.NewSnapshotPayload(logging.EventMonitor, updatedMemeToken)); err != nil {
+				// Optional local error handling
+				logging.PrintErrorToLog("logger write error:			", err.Error())
+			}
+
+			if engine.curveComplete(updatedMemeToken) && updatedMemeToken.State == models.StateWatching {
+				if migratedToken, transition, err := models.PumpMemes.Take(key, models.StateMigrated, "bonding curve complete"); err == nil {
+					engine.migrated(migratedToken, transition)
+				}
+				continue
+			}
+
+			engine.decide(updatedMemeToken, func(strategy Strategy) Decision { return strategy.OnSnapshot(updatedMemeToken) })
+		}
+		// Optionally flush:
+		if err := logging.FlushLog("monitor.log"); err != nil {
+			logging.PrintErrorToLog("logger flush error:			", err.Error())
+		}
+	}
+}
+
+func (engine *Engine) UpdateMemeToken(data models.MemeToken, index int) models.MemeToken {
+
+	curveState, err := sol.GetPumpCurveState(engine.RpcClient, data.BondingCurve)
+	if err != nil {
+		logging.PrintErrorToLog("failed to fetch bonding curve state:		", err.Error())
+	}
+	t := models.Now()
+	memeInfo := models.MemeInfo{curveState, 0, 0, t}
+	data.Info = append(data.Info, memeInfo)
+	if data.Info[index].BondingState != nil {
+		// (2) Calculate token price and amount.
+		tokenPrice, err := sol.CalculatePumpCurvePrice(curveState)
+		if err != nil {
+			logging.PrintErrorToLog("failed to calculate pump curve price:		", err.Error())
+		}
+		marketCap := sol.GetTokenMarketCap(data.Info[index].BondingState, tokenPrice)
+		data.Info[index].TokenPrice = tokenPrice
+		data.Info[index].MarketCap = marketCap
+	}
+
+	engine.Bus.Publish(events.SnapshotUpdatedEvent{Token: data, Snapshot: data.Info[index]})
+	return data
+
+}
+
+func (engine *Engine) Trade(trader *Trader) {
+
+	//Poll the tokens every 20 seconds
+	ticker := models.NewTicker(models.MONITOR_DURATION_TRADES * time.Second)
+	defer ticker.Stop()
+
+	errInitLogger := logging.InitLogger("trade.log")
+	if errInitLogger != nil {
+		logging.PrintErrorToLog("Error init logger:		", errInitLogger.Error())
+	}
+	defer func() {
+		// Ensure we close the logger before exiting
+		if cerr := logging.CloseLoggerFile("trade.log"); cerr != nil {
+			logging.PrintErrorToLog("Error close logger:		", cerr.Error())
+		}
+	}()
+
+	for range ticker.C() {
+		//if err := logging.ClearFileLog("trade.log"); err != nil {
+		//	logging.PrintErrorToLog("Error clearing file:		", err.Error())
+		//}
+		tokens := models.TradesMap.GetTokens()
+		log.Println("###################################TRADING##########################################")
+		log.Println(trader.Metrics(), "Mode:", trader.Mode())
+		log.Println(trader.Risk)
+		log.Println(trader.Balance)
+		log.Println(engine.Bus)
+
+		if err := logging.LogEvent("trade.log", "", logging.TickPayload{Loop: "trading"}); err != nil {
+			// Optional local error handling
+			logging.PrintErrorToLog("logger write error:			", err.Error())
+		}
+
+		// The map you get here is a copy (if you coded GetTokens that way),
+		// so it’s safe to range over
+		for key, token := range tokens {
+			// Closed and migrated tokens are done with, they are not polled anymore.
+			if token.State.Terminal() {
+				if models.TradesMap.Archive(key) {
+					log.Println("ARCHIVED			:", key, token.State)
+				}
+				continue
+			}
+			index := len(token.Info)
+			updatedMemeToken := engine.UpdateMemeToken(token, index)
+
+			tokenAnalysis := analysis.AnalyzeTokenData(updatedMemeToken)
+			updatedMemeToken.Analysis = append(updatedMemeToken.Analysis, tokenAnalysis)
+			engine.Bus.Publish(events.AnalysisComputedEvent{Token: updatedMemeToken, Analysis: tokenAnalysis})
+
+			// Only the snapshot is added, the state stays the one set by the trader since
+			// this tick started.
+			updatedMemeToken, migrated, err := models.TradesMap.AddSnapshot(key, updatedMemeToken.Info[index], tokenAnalysis)
+			if err != nil {
+				logging.PrintErrorToLog("Trades map error:		", err.Error())
+				continue
+			}
+			if migrated != nil {
+				engine.migrated(updatedMemeToken, *migrated)
+				if migrated.From == models.StateHeld {
+					log.Println("MIGRATED WHILE HELD		:", key)
+					trader.WriteOff(updatedMemeToken, migrated.Reason)
+				}
+			}
+			trader.Portfolio.Mark(updatedMemeToken)
+
+			//log.Println(key, updatedMemeToken)
+			if err := logging.LogEvent("trade.log", key, logging.NewSnapshotPayload(logging.EventTrading, updatedMemeToken)); err != nil {
+				// Optional local error handling
+				logging.PrintErrorToLog("logger write error:			", err.Error())
+			}
+
+			engine.decide(updatedMemeToken, func(strategy Strategy) Decision { return strategy.OnSnapshot(updatedMemeToken) })
+		}
+		engine.LogPortfolio(trader)
+		// Optionally flush:
+		if err := logging.FlushLog("trade.log"); err != nil {
+			logging.PrintErrorToLog("logger flush error:			", err.Error())
+		}
+	}
+}
+
+// decide asks the strategies about token and applies their decision. A token owned by a
+// strategy is only handed to its owner. Any other token is offered to every strategy in
+// order: the first one with capacity left that promotes or buys it becomes its owner,
+// and it is only rejected once every strategy has rejected it.
+func (engine *Engine) decide(token models.MemeToken, ask func(strategy Strategy) Decision) {
+	if token.Strategy != "" {
+		for _, strategy := range engine.Strategies {
+			if strategy.Name() == token.Strategy {
+				engine.apply(token, strategy.Name(), ask(strategy))
+				return
+			}
+		}
+		return
+	}
+
+	var rejection Decision
+	rejections := 0
+	for _, strategy := range engine.Strategies {
+		decision := ask(strategy)
+		switch decision.Action {
+		case ActionReject:
+			rejection = decision
+			rejections++
+		case ActionPromote, ActionBuy:
+			if !engine.Allocator.HasCapacity(strategy.Name()) {
+				continue
+			}
+			engine.apply(token, strategy.Name(), decision)
+			return
+		}
+	}
+	if rejections > 0 && rejections == len(engine.Strategies) {
+		engine.apply(token, "", rejection)
+	}
+}
+
+// apply carries out a decision of strategy on token with ApplyDecision.
+func (engine *Engine) apply(token models.MemeToken, strategy string, decision Decision) {
+	ApplyDecision(engineActions{engine}, token, strategy, decision)
+}
+
+// engineActions carries out decisions on the token maps, and places orders with the trader.
+type engineActions struct {
+	engine *Engine
+}
+
+func (actions engineActions) Reject(token models.MemeToken, reason string) {
+	rejected, transition, err := models.PumpMemes.Take(token.Mint.String(), models.StateRejected, reason)
+	if err != nil {
+		return
+	}
+	logging.PrintTransitionToLog(rejected, transition)
+	log.Println("REMOVE				:", rejected.Mint.String())
+	actions.engine.logMonitor(logging.EventRemove, rejected)
+}
+
+func (actions engineActions) Promote(token models.MemeToken, strategy string, reason string) models.MemeToken {
+	return actions.engine.promote(token, strategy, reason)
+}
+
+func (actions engineActions) Buy(token models.MemeToken, strategy string, amount float64, reason string) {
+	finalPrice := token.Info[len(token.Info)-1].TokenPrice
+	actions.engine.Trader.SubmitOrder(OrderRequest{
+		Token:      token,
+		OrderType:  OrderTypeBuy,
+		Reason:     reason,
+		Amount:     amount,
+		PriceLimit: finalPrice * (1 + models.MaxPriceDrift),
+		Strategy:   strategy,
+	})
+}
+
+func (actions engineActions) Sell(token models.MemeToken, strategy string, reason string) {
+	log.Println("REMOVE FROM TRADING		:", token.Mint.String())
+	finalPrice := token.Info[len(token.Info)-1].TokenPrice
+	actions.engine.Trader.SubmitOrder(OrderRequest{
+		Token:      token,
+		OrderType:  OrderTypeSell,
+		Reason:     reason,
+		PriceLimit: finalPrice * (1 - models.MaxPriceDrift),
+		Strategy:   strategy,
+	})
+}
+
+// promote moves a watched token to TradesMap, which owns it from now on, on behalf of
+// strategy. The token is taken out of PumpMemes as it is there, so it is promoted once
+// even when the monitor and an event decide about it at the same time.
+func (engine *Engine) promote(token models.MemeToken, strategy string, reason string) models.MemeToken {
+	if token.State != models.StateWatching {
+		return token
+	}
+	promoted, transition, err := models.PumpMemes.Take(token.Mint.String(), models.StateCandidate, reason)
+	if err != nil {
+		return token
+	}
+	log.Println("ADD TO TRADES		:", promoted.Mint.String(), strategy)
+	logging.PrintTransitionToLog(promoted, transition)
+	promoted.Strategy = strategy
+	engine.tokensPromoted.Add(1)
+
+	//ADD TO TRADES MAP
+	models.TradesMap.SetToken(promoted)
+	engine.logMonitor(logging.EventAdd, promoted)
+	return promoted
+}
+
+// lookup returns the current copy of a token, whichever map owns it.
+func (engine *Engine) lookup(mint string) (models.MemeToken, bool) {
+	if token, exists := models.TradesMap.Get(mint); exists {
+		return token, true
+	}
+	return models.PumpMemes.Get(mint)
+}
+
+func (engine *Engine) logMonitor(kind logging.EventType, token models.MemeToken) {
+	if err := logging.LogEvent("monitor.log", token.Mint.String(), logging.NewSnapshotPayload(kind, token)); err != nil {
+		// Optional local error handling
+		logging.PrintErrorToLog("logger write error:			", err.Error())
+	}
+}
+
+// LogPortfolio writes every open position, the totals of every strategy and the session
+// totals to trade.log.
+func (engine *Engine) LogPortfolio(trader *Trader) {
+	for _, position := range trader.Portfolio.Positions() {
+		if !position.Open() {
+			continue
+		}
+		if err := logging.LogEvent("trade.log", position.Mint, positionPayload(position)); err != nil {
+			logging.PrintErrorToLog("logger write error:			", err.Error())
+		}
+	}
+
+	byStrategy := trader.Portfolio.TotalsByStrategy()
+	for _, allocation := range engine.Allocations {
+		totals := byStrategy[allocation.Strategy]
+		log.Println(allocation.Strategy, totals)
+		if err := logging.LogEvent("trade.log", "", totalsPayload(allocation.Strategy, totals)); err != nil {
+			logging.PrintErrorToLog("logger write error:			", err.Error())
+		}
+	}
+	log.Println(engine.Allocator)
+
+	totals := trader.Portfolio.Totals()
+	log.Println(totals)
+	if err := logging.LogEvent("trade.log", "", totalsPayload("", totals)); err != nil {
+		logging.PrintErrorToLog("logger write error:			", err.Error())
+	}
+}
+
+// positionPayload captures an open position for the event log.
+func positionPayload(position portfolio.Position) logging.PositionPayload {
+	return logging.PositionPayload{
+		Name:          position.Name,
+		Symbol:        position.Symbol,
+		Strategy:      position.Strategy,
+		Tokens:        position.Tokens,
+		EntryPrice:    position.EntryPrice,
+		LastPrice:     position.LastPrice,
+		CostBasis:     position.CostBasis,
+		RealizedPnL:   position.RealizedPnL,
+		UnrealizedPnL: position.UnrealizedPnL(),
+	}
+}
+
+// totalsPayload captures the totals of strategy, or of the portfolio for "", for the event log.
+func totalsPayload(strategy string, totals portfolio.Totals) logging.TotalsPayload {
+	return logging.TotalsPayload{
+		Strategy:        strategy,
+		OpenPositions:   totals.OpenPositions,
+		ClosedPositions: totals.ClosedPositions,
+		Invested:        totals.Invested,
+		Proceeds:        totals.Proceeds,
+		Fees:            totals.Fees,
+		Rent:            totals.Rent,
+		Exposure:        totals.Exposure,
+		RealizedPnL:     totals.RealizedPnL,
+		UnrealizedPnL:   totals.UnrealizedPnL,
+		PnL:             totals.PnL(),
+	}
+}
+
+// migrated logs and publishes a token's move to Migrated.
+func (engine *Engine) migrated(token models.MemeToken, transition models.Transition) {
+	logging.PrintTransitionToLog(token, transition)
+	engine.Bus.Publish(events.TokenMigratedEvent{Token: token, Transition: transition})
+}
+
+// curveComplete reports whether the token's latest snapshot shows a completed bonding curve.
+func (engine *Engine) curveComplete(token models.MemeToken) bool {
+	if len(token.Info) == 0 || token.Info[len(token.Info)-1].BondingState == nil {
+		return false
+	}
+	return token.Info[len(token.Info)-1].BondingState.Complete
+}
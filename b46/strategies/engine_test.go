@@ -0,0 +1,371 @@
+package strategies
+
+import (
+	"b46/b46/_sys_init"
+	"b46/b46/logging"
+	"b46/b46/models"
+	"b46/b46/risk"
+	"b46/b46/sol"
+	"b46/b46/sol/fakenode"
+	"context"
+	"github.com/gagliardetto/solana-go"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startEngine initializes an engine against a fake node, with LIVE set to live. The
+// wallet is credited with lamports and the engine's state store lives in a temporary
+// directory.
+func startEngine(t *testing.T, live string, lamports uint64) (*Engine, *fakenode.Node) {
+	t.Helper()
+	return startEngineWith(t, live, lamports, "kamikaze:1:1")
+}
+
+// startEngineWith is startEngine running the strategies allocated by spec.
+func startEngineWith(t *testing.T, live string, lamports uint64, spec string) (*Engine, *fakenode.Node) {
+	t.Helper()
+	allocations, err := risk.ParseAllocations(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategies, err := NewStrategies(allocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(logging.LogDir(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	node, err := fakenode.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+
+	payer := solana.NewWallet().PrivateKey
+	node.Fund(payer.PublicKey(), lamports)
+	env := _sys_init.Env
+	_sys_init.Env = &_sys_init.Enviro{RPC: node.URL(), WSS: node.WebsocketURL(), PK: payer.String(), LIVE: live}
+	t.Cleanup(func() { _sys_init.Env = env })
+
+	engine := NewEngine(strategies, allocations)
+	engine.InitializeEngine()
+	t.Cleanup(func() {
+		models.Store = nil
+		if engine.Store != nil {
+			engine.Store.Close()
+		}
+		if engine.WssClient != nil {
+			engine.WssClient.Close()
+		}
+	})
+	return engine, node
+}
+
+func TestLiveFlag(t *testing.T) {
+	tests := []struct {
+		live string
+		want bool
+	}{
+		{live: "", want: false},
+		{live: "FALSE", want: false},
+		{live: "true", want: false},
+		{live: "TRUE", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.live, func(t *testing.T) {
+			engine, _ := startEngine(t, test.live, models.LamportsPerSOL)
+			if engine.Executor.Live != test.want {
+				t.Errorf("executor live = %v, want %v", engine.Executor.Live, test.want)
+			}
+			if got := engine.Config().Settings.Live; got != test.want {
+				t.Errorf("manifest live = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDefaultEngineNeverSendsTransactions(t *testing.T) {
+	engine, node := startEngine(t, "", 2*models.LamportsPerSOL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Trader.Balance.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go engine.Trader.Start(ctx)
+
+	token := node.Launch("Test", "TEST", "https://example.com/test.json", solana.NewWallet().PublicKey())
+	curve, _ := node.Curve(token.Mint)
+	price, err := sol.QuotePumpCurve(engine.RpcClient, token.BondingCurve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Info = []models.MemeInfo{{BondingState: &curve, TokenPrice: price}}
+	token.State = models.StateCandidate
+	token.Strategy = "kamikaze"
+	models.InitializePumpMemes()
+	models.TradesMap.SetToken(token)
+
+	for _, side := range []OrderType{OrderTypeBuy, OrderTypeSell} {
+		results := make(chan OrderResponse, 1)
+		latest, _ := models.TradesMap.Get(token.Mint.String())
+		if err := engine.Trader.SubmitOrder(OrderRequest{Token: latest, OrderType: side, Amount: 0.1, Reason: "test", ResultChan: results}); err != nil {
+			t.Fatalf("%s: %v", side, err)
+		}
+		select {
+		case response := <-results:
+			if !response.Success {
+				t.Fatalf("%s failed: %s", side, response.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not handled", side)
+		}
+	}
+
+	if sent := node.Sent(); sent != 0 {
+		t.Errorf("paper trading sent %d transaction(s)", sent)
+	}
+	if balance := node.Balance(engine.Wallet); balance != 2*models.LamportsPerSOL {
+		t.Errorf("wallet moved to %d lamports", balance)
+	}
+	position, _ := engine.Trader.Portfolio.Position(token.Mint.String())
+	if position.Open() || position.Proceeds == 0 {
+		t.Errorf("position %s, want it bought and sold on paper", position)
+	}
+}
+
+func TestReconcilePositions(t *testing.T) {
+	type want struct {
+		state  models.TokenState
+		open   bool
+		tokens string // "wallet" for the amount held on chain, "stored" for the stored one
+	}
+	tests := []struct {
+		live                                    string
+		walletOnly, both, storedOnly, orderGone want
+	}{
+		{
+			live:       "",
+			walletOnly: want{state: models.StateHeld, open: true, tokens: "wallet"},
+			both:       want{state: models.StateHeld, open: true, tokens: "stored"},
+			// Paper positions are never held on chain.
+			storedOnly: want{state: models.StateHeld, open: true, tokens: "stored"},
+			orderGone:  want{state: models.StateCandidate},
+		},
+		{
+			live:       "TRUE",
+			walletOnly: want{state: models.StateHeld, open: true, tokens: "wallet"},
+			both:       want{state: models.StateHeld, open: true, tokens: "stored"},
+			storedOnly: want{state: models.StateClosed},
+			orderGone:  want{state: models.StateCandidate},
+		},
+	}
+	for _, test := range tests {
+		t.Run("live="+test.live, func(t *testing.T) {
+			engine, node := startEngine(t, test.live, models.LamportsPerSOL)
+			models.InitializePumpMemes()
+			const stored = 1_000_000
+
+			launch := func(bought bool, state models.TokenState, storedTokens uint64) models.MemeToken {
+				token := node.Launch("Test", "TEST", "https://example.com/test.json", solana.NewWallet().PublicKey())
+				if bought {
+					if _, err := node.Trade(engine.Wallet, token.Mint, true, models.LamportsPerSOL/10); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if state != models.StateWatching {
+					token.ForceState(state, "test")
+					token.Strategy = "kamikaze"
+					models.TradesMap.SetToken(token)
+				}
+				if storedTokens > 0 {
+					engine.Trader.Portfolio.ApplyFill(token, models.Fill{
+						Mint: token.Mint, Side: models.FillSideBuy, TokenAmount: storedTokens, SolLamports: models.LamportsPerSOL / 10, Strategy: "kamikaze",
+					})
+				}
+				return token
+			}
+			tokens := map[string]models.MemeToken{
+				"wallet only": launch(true, models.StateWatching, 0),
+				"both":        launch(true, models.StateHeld, stored),
+				"stored only": launch(false, models.StateHeld, stored),
+				"order gone":  launch(false, models.StateEntering, 0),
+			}
+			wants := map[string]want{"wallet only": test.walletOnly, "both": test.both, "stored only": test.storedOnly, "order gone": test.orderGone}
+
+			engine.ReconcilePositions(context.Background())
+
+			for name, token := range tokens {
+				mint := token.Mint.String()
+				want := wants[name]
+				if reconciled, _ := models.TradesMap.Get(mint); reconciled.State != want.state {
+					t.Errorf("%s: state %s, want %s", name, reconciled.State, want.state)
+				}
+				position, _ := engine.Trader.Portfolio.Position(mint)
+				if position.Open() != want.open {
+					t.Errorf("%s: position %s, want open %v", name, position, want.open)
+				}
+				if _, allocated := engine.Allocator.Strategy(mint); allocated != want.open {
+					t.Errorf("%s: allocated %v, want %v", name, allocated, want.open)
+				}
+				var tokensWanted uint64
+				switch want.tokens {
+				case "wallet":
+					tokensWanted = node.TokenBalance(engine.Wallet, token.Mint)
+				case "stored":
+					tokensWanted = stored
+				}
+				if position.Tokens != tokensWanted {
+					t.Errorf("%s: %d tokens, want %d", name, position.Tokens, tokensWanted)
+				}
+			}
+		})
+	}
+}
+
+func TestPromoteOnce(t *testing.T) {
+	t.Chdir(t.TempDir())
+	models.InitializePumpMemes()
+	engine := NewEngine([]Strategy{NewKamikaze(DefaultKamikazeParams())}, nil)
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateWatching}
+	models.PumpMemes.SetToken(token)
+
+	// The monitor and the event dispatcher may decide about the same token at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine.promote(token, "kamikaze", "test")
+			models.PumpMemes.AddSnapshot(token.Mint.String(), models.MemeInfo{})
+		}()
+	}
+	wg.Wait()
+
+	if promoted := engine.tokensPromoted.Load(); promoted != 1 {
+		t.Errorf("promoted %d times, want once", promoted)
+	}
+	if _, exists := models.PumpMemes.Get(token.Mint.String()); exists {
+		t.Error("promoted token still watched")
+	}
+	if traded, _ := models.TradesMap.Get(token.Mint.String()); traded.State != models.StateCandidate || len(traded.Transitions) != 1 {
+		t.Errorf("traded token is %s after %d transitions, want a single promotion", traded.State, len(traded.Transitions))
+	}
+}
+
+func TestReconcileHandsOrphansToFirstStrategy(t *testing.T) {
+	engine, _ := startEngine(t, "", models.LamportsPerSOL)
+	models.InitializePumpMemes()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The token was bought by a strategy that is not configured anymore.
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateHeld, Strategy: "removed"}
+	token.Info = []models.MemeInfo{{TokenPrice: 1e-6, MarketCap: 2 * models.ExitMarketCap}}
+	models.TradesMap.SetToken(token)
+	engine.Trader.Portfolio.ApplyFill(token, models.Fill{
+		Mint: token.Mint, Side: models.FillSideBuy, TokenAmount: 1_000_000, SolLamports: models.LamportsPerSOL / 10, Strategy: "removed",
+	})
+
+	engine.ReconcilePositions(ctx)
+
+	mint := token.Mint.String()
+	reconciled, _ := models.TradesMap.Get(mint)
+	if reconciled.Strategy != "kamikaze" {
+		t.Fatalf("owned by %q, want the first strategy", reconciled.Strategy)
+	}
+	if strategy, _ := engine.Allocator.Strategy(mint); strategy != "kamikaze" {
+		t.Errorf("charged to %q, want the first strategy", strategy)
+	}
+	engine.decide(reconciled, func(strategy Strategy) Decision { return strategy.OnSnapshot(reconciled) })
+	if exiting, _ := models.TradesMap.Get(mint); exiting.State != models.StateExiting {
+		t.Errorf("state %s, want the position exiting", exiting.State)
+	}
+}
+
+func TestStrategyInstances(t *testing.T) {
+	engine, node := startEngineWith(t, "", 2*models.LamportsPerSOL,
+		"fast=kamikaze:0.01:1:EntryMarketCap=5000;MinEntryHistory=0;PositionAmount=0.006,"+
+			"slow=kamikaze:0.01:2:EntryMarketCap=20000;MinEntryHistory=0;PositionAmount=0.004")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Trader.Balance.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go engine.Trader.Start(ctx)
+	models.InitializePumpMemes()
+
+	watch := func(marketCap float64) models.MemeToken {
+		token := node.Launch("Test", "TEST", "https://example.com/test.json", solana.NewWallet().PublicKey())
+		curve, _ := node.Curve(token.Mint)
+		price, err := sol.QuotePumpCurve(engine.RpcClient, token.BondingCurve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token.Info = []models.MemeInfo{{BondingState: &curve, TokenPrice: price, MarketCap: marketCap}}
+		token.State = models.StateWatching
+		models.PumpMemes.SetToken(token)
+		// Promote, then buy the candidate.
+		for range 2 {
+			latest, _ := engine.lookup(token.Mint.String())
+			engine.decide(latest, func(strategy Strategy) Decision { return strategy.OnSnapshot(latest) })
+		}
+		return token
+	}
+	// Only fast enters at 10000, and it has no position left for the next tokens.
+	tokens := []struct {
+		token  models.MemeToken
+		owner  string
+		amount float64
+	}{
+		{token: watch(10_000), owner: "fast", amount: 0.006},
+		{token: watch(30_000), owner: "slow", amount: 0.004},
+		{token: watch(30_000), owner: "slow", amount: 0.004},
+		{token: watch(30_000)},
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, test := range tokens {
+		mint := test.token.Mint.String()
+		if test.owner == "" {
+			if watched, _ := models.PumpMemes.Get(mint); watched.State != models.StateWatching {
+				t.Errorf("%s is %s, want it still watched with every instance full", mint, watched.State)
+			}
+			continue
+		}
+		traded, _ := models.TradesMap.Get(mint)
+		position, _ := engine.Trader.Portfolio.Position(mint)
+		for (traded.State != models.StateHeld || !position.Open()) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			traded, _ = models.TradesMap.Get(mint)
+			position, _ = engine.Trader.Portfolio.Position(mint)
+		}
+		if traded.State != models.StateHeld || traded.Strategy != test.owner {
+			t.Errorf("%s is %s by %q, want held by %s", mint, traded.State, traded.Strategy, test.owner)
+		}
+		if strategy, _ := engine.Allocator.Strategy(mint); strategy != test.owner {
+			t.Errorf("%s charged to %q, want %s", mint, strategy, test.owner)
+		}
+		if position.Strategy != test.owner || math.Abs(position.Invested-position.Fees-position.Rent-test.amount) > 1e-9 {
+			t.Errorf("%s: position %s, want %.3f SOL bought by %s", mint, position, test.amount, test.owner)
+		}
+	}
+
+	totals := engine.Trader.Portfolio.TotalsByStrategy()
+	if totals["fast"].OpenPositions != 1 || totals["slow"].OpenPositions != 2 || len(totals) != 2 {
+		t.Errorf("totals by strategy %v, want 1 fast and 2 slow positions", totals)
+	}
+	config := engine.Config()
+	if len(config.Strategies) != 2 || config.Strategies[0].Name != "fast" || config.Strategies[1].Name != "slow" {
+		t.Fatalf("manifest strategies %+v", config.Strategies)
+	}
+	if params := config.Strategies[0].Parameters.(KamikazeParams); params.EntryMarketCap != 5000 || params.PositionAmount != 0.006 {
+		t.Errorf("fast runs with %+v", params)
+	}
+	if params := config.Strategies[1].Parameters.(KamikazeParams); params.EntryMarketCap != 20000 || params.ExitMarketCap != models.ExitMarketCap {
+		t.Errorf("slow runs with %+v", params)
+	}
+}
@@ -0,0 +1,52 @@
+package strategies
+
+import (
+	"b46/b46/models"
+	"testing"
+)
+
+// watched returns a watched token whose snapshots have the given market caps, priced at a
+// millionth of the market cap.
+func watched(marketCaps ...float64) models.MemeToken {
+	token := models.MemeToken{State: models.StateWatching}
+	for _, marketCap := range marketCaps {
+		token.Info = append(token.Info, models.MemeInfo{MarketCap: marketCap, TokenPrice: marketCap / 1e6})
+	}
+	return token
+}
+
+func TestKamikazeOnSnapshot(t *testing.T) {
+	stable := DefaultKamikazeParams()
+	stable.TokenStability = 0.000005
+
+	tests := []struct {
+		name   string
+		params KamikazeParams
+		token  models.MemeToken
+		want   Action
+	}{
+		{"too young", DefaultKamikazeParams(), watched(30, 40), ActionNone},
+		{"promoted", DefaultKamikazeParams(), watched(30, 31, 40), ActionPromote},
+		{"volatile promoted by default", DefaultKamikazeParams(), watched(1, 10, 40), ActionPromote},
+		{"volatile held back when swept", stable, watched(1, 10, 40), ActionNone},
+		{"steady promoted when swept", stable, watched(36, 36, 36), ActionPromote},
+		{"below entry", DefaultKamikazeParams(), watched(make([]float64, models.MaxEntryHistory+1)...), ActionReject},
+		{"candidate buys", DefaultKamikazeParams(), models.MemeToken{State: models.StateCandidate, Info: watched(40).Info}, ActionBuy},
+		{"held below exit", DefaultKamikazeParams(), models.MemeToken{State: models.StateHeld, Info: watched(40).Info}, ActionNone},
+		{"held above exit", DefaultKamikazeParams(), models.MemeToken{State: models.StateHeld, Info: watched(50).Info}, ActionSell},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := NewKamikaze(test.params).OnSnapshot(test.token)
+			if decision.Action != test.want {
+				t.Fatalf("OnSnapshot() = %v, want %v", decision.Action, test.want)
+			}
+		})
+	}
+}
+
+func TestDefaultKamikazeParamsSkipStability(t *testing.T) {
+	if stability := DefaultKamikazeParams().TokenStability; stability != 0 {
+		t.Fatalf("TokenStability = %g, want 0 outside of sweeps", stability)
+	}
+}
@@ -0,0 +1,196 @@
+package strategies
+
+import (
+	"b46/b46/logging"
+	"b46/b46/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TradingMode controls which orders the Trader still accepts.
+type TradingMode int32
+
+const (
+	ModeNormal    TradingMode = iota // buys and sells
+	ModeExitsOnly                    // sells only, new buys are rejected
+	ModeHalted                       // no new orders at all
+)
+
+func (m TradingMode) String() string {
+	switch m {
+	case ModeNormal:
+		return "NORMAL"
+	case ModeExitsOnly:
+		return "EXITS_ONLY"
+	case ModeHalted:
+		return "HALTED"
+	default:
+		return fmt.Sprintf("TradingMode(%d)", int32(m))
+	}
+}
+
+func (m TradingMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *TradingMode) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "NORMAL":
+		*m = ModeNormal
+	case "EXITS_ONLY":
+		*m = ModeExitsOnly
+	case "HALTED":
+		*m = ModeHalted
+	default:
+		return fmt.Errorf("unknown trading mode %q", text)
+	}
+	return nil
+}
+
+// Trigger files dropped into the session directory.
+const (
+	HaltFile      = "HALT"
+	ExitsOnlyFile = "EXITS_ONLY"
+	FlattenFile   = "FLATTEN"
+	ResumeFile    = "RESUME"
+)
+
+// KillSwitchState is persisted next to the sessions so a halt survives restarts.
+type KillSwitchState struct {
+	Mode   TradingMode `json:"mode"`
+	Reason string      `json:"reason"`
+	Since  time.Time   `json:"since"`
+}
+
+// KillSwitch moves the Trader into exits-only or halted mode. It can be engaged from a
+// signal, a trigger file in the session directory or directly through Engage, and stays
+// engaged across restarts until Clear is called.
+type KillSwitch struct {
+	sync.Mutex
+	trader    *Trader
+	statePath string
+	State     KillSwitchState
+}
+
+// NewKillSwitch loads the persisted state from statePath and applies it to the trader.
+func NewKillSwitch(trader *Trader, statePath string) *KillSwitch {
+	k := &KillSwitch{
+		trader:    trader,
+		statePath: statePath,
+		State:     KillSwitchState{Mode: ModeNormal},
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.PrintErrorToLog("Error reading kill switch state:		", err.Error())
+	}
+	if err == nil {
+		if errDecode := json.Unmarshal(data, &k.State); errDecode != nil {
+			// An unreadable state file must not silently re-enable buying.
+			logging.PrintErrorToLog("Error decoding kill switch state, halting:		", errDecode.Error())
+			k.State = KillSwitchState{Mode: ModeHalted, Reason: "unreadable kill switch state", Since: models.Now()}
+		}
+	}
+
+	if k.State.Mode != ModeNormal {
+		log.Printf("Kill switch still engaged from a previous run: mode=%s reason=%s since=%s", k.State.Mode, k.State.Reason, k.State.Since)
+	}
+	trader.SetMode(k.State.Mode)
+	return k
+}
+
+// Engage switches the trader into mode and persists it. With flatten every open position is sold.
+func (k *KillSwitch) Engage(mode TradingMode, flatten bool, reason string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.State = KillSwitchState{Mode: mode, Reason: reason, Since: models.Now()}
+	k.trader.SetMode(mode)
+	log.Printf("Kill switch engaged: mode=%s flatten=%t reason=%s", mode, flatten, reason)
+
+	if flatten {
+		k.trader.FlattenAll(reason)
+	}
+	return k.persist()
+}
+
+// Clear returns the trader to normal mode and removes the persisted state.
+func (k *KillSwitch) Clear(reason string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.State = KillSwitchState{Mode: ModeNormal, Reason: reason, Since: models.Now()}
+	k.trader.SetMode(ModeNormal)
+	log.Printf("Kill switch cleared: reason=%s", reason)
+
+	if err := os.Remove(k.statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove kill switch state: %w", err)
+	}
+	return nil
+}
+
+// Mode returns the currently engaged mode.
+func (k *KillSwitch) Mode() TradingMode {
+	k.Lock()
+	defer k.Unlock()
+	return k.State.Mode
+}
+
+func (k *KillSwitch) persist() error {
+	data, err := json.MarshalIndent(k.State, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode kill switch state: %w", err)
+	}
+	if err := os.WriteFile(k.statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write kill switch state: %w", err)
+	}
+	return nil
+}
+
+// WatchSessionFiles polls dir for trigger files until ctx is canceled. A trigger file is
+// removed once it has been acted on.
+func (k *KillSwitch) WatchSessionFiles(ctx context.Context, dir string) {
+	ticker := models.NewTicker(models.KillSwitchPollInterval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			k.checkTriggerFiles(dir)
+		}
+	}
+}
+
+func (k *KillSwitch) checkTriggerFiles(dir string) {
+	triggers := []struct {
+		file   string
+		action func() error
+	}{
+		{ResumeFile, func() error { return k.Clear("resume file") }},
+		{HaltFile, func() error { return k.Engage(ModeHalted, false, "halt file") }},
+		{ExitsOnlyFile, func() error { return k.Engage(ModeExitsOnly, false, "exits only file") }},
+		{FlattenFile, func() error { return k.Engage(ModeExitsOnly, true, "flatten file") }},
+	}
+
+	for _, trigger := range triggers {
+		path := filepath.Join(dir, trigger.file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := trigger.action(); err != nil {
+			logging.PrintErrorToLog("Kill switch error:		", err.Error())
+		}
+		if err := os.Remove(path); err != nil {
+			logging.PrintErrorToLog("Error removing kill switch trigger:		", err.Error())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package strategies
+
+import (
+	"b46/b46/models"
+	"context"
+	"github.com/gagliardetto/solana-go"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// heldToken adds a held token to TradesMap.
+func heldToken() models.MemeToken {
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateHeld}
+	models.TradesMap.SetToken(token)
+	return token
+}
+
+func TestKillSwitchTriggerFiles(t *testing.T) {
+	tests := []struct {
+		file      string
+		engaged   TradingMode
+		want      TradingMode
+		flattened int
+	}{
+		{file: HaltFile, want: ModeHalted},
+		{file: ExitsOnlyFile, want: ModeExitsOnly},
+		{file: FlattenFile, want: ModeExitsOnly, flattened: 1},
+		{file: ResumeFile, engaged: ModeHalted, want: ModeNormal},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			trader := newTestTrader(t, context.Background(), 1)
+			dir := t.TempDir()
+			killSwitch := NewKillSwitch(trader, filepath.Join(dir, models.KillSwitchStateFile))
+			if test.engaged != ModeNormal {
+				if err := killSwitch.Engage(test.engaged, false, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			heldToken()
+
+			trigger := filepath.Join(dir, test.file)
+			if err := os.WriteFile(trigger, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			killSwitch.checkTriggerFiles(dir)
+
+			if killSwitch.Mode() != test.want || trader.Mode() != test.want {
+				t.Errorf("kill switch %s, trader %s, want %s", killSwitch.Mode(), trader.Mode(), test.want)
+			}
+			if got := len(trader.sellChannel); got != test.flattened {
+				t.Errorf("%d sells queued, want %d", got, test.flattened)
+			}
+			if _, err := os.Stat(trigger); !os.IsNotExist(err) {
+				t.Errorf("trigger file left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestKillSwitchSurvivesRestart(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), models.KillSwitchStateFile)
+	killSwitch := NewKillSwitch(newTestTrader(t, context.Background(), 1), statePath)
+	if err := killSwitch.Engage(ModeExitsOnly, false, "drawdown"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestTrader(t, context.Background(), 1)
+	killSwitch = NewKillSwitch(restarted, statePath)
+	if killSwitch.Mode() != ModeExitsOnly || restarted.Mode() != ModeExitsOnly || killSwitch.State.Reason != "drawdown" {
+		t.Errorf("restarted with %+v, trader %s, want exits only", killSwitch.State, restarted.Mode())
+	}
+
+	if err := killSwitch.Clear("resumed"); err != nil {
+		t.Fatal(err)
+	}
+	restarted = newTestTrader(t, context.Background(), 1)
+	NewKillSwitch(restarted, statePath)
+	if restarted.Mode() != ModeNormal {
+		t.Errorf("restarted in %s after clear, want %s", restarted.Mode(), ModeNormal)
+	}
+
+	// An unreadable state must not resume trading.
+	if err := os.WriteFile(statePath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restarted = newTestTrader(t, context.Background(), 1)
+	NewKillSwitch(restarted, statePath)
+	if restarted.Mode() != ModeHalted {
+		t.Errorf("restarted in %s from a corrupt state, want %s", restarted.Mode(), ModeHalted)
+	}
+}
+
+func TestKillSwitchBlocksBuys(t *testing.T) {
+	tests := []struct {
+		mode TradingMode
+		buy  bool
+		sell bool
+	}{
+		{mode: ModeNormal, buy: true, sell: true},
+		{mode: ModeExitsOnly, sell: true},
+		{mode: ModeHalted},
+	}
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			trader := newTestTrader(t, context.Background(), 1)
+			killSwitch := NewKillSwitch(trader, filepath.Join(t.TempDir(), models.KillSwitchStateFile))
+			if err := killSwitch.Engage(test.mode, false, "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			candidate := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate}
+			models.TradesMap.SetToken(candidate)
+			err := trader.SubmitOrder(OrderRequest{Token: candidate, OrderType: OrderTypeBuy, Amount: 0.1})
+			if accepted := err == nil; accepted != test.buy {
+				t.Errorf("buy: %v, want accepted %v", err, test.buy)
+			}
+			if err != nil && !strings.Contains(err.Error(), "trading mode") {
+				t.Errorf("buy rejected for %v, want the trading mode", err)
+			}
+			err = trader.SubmitOrder(OrderRequest{Token: heldToken(), OrderType: OrderTypeSell})
+			if accepted := err == nil; accepted != test.sell {
+				t.Errorf("sell: %v, want accepted %v", err, test.sell)
+			}
+			if candidate, _ = models.TradesMap.Get(candidate.Mint.String()); test.buy != (candidate.State == models.StateEntering) {
+				t.Errorf("candidate is %s", candidate.State)
+			}
+		})
+	}
+
+	// A halted trader still flattens when told to.
+	trader := newTestTrader(t, context.Background(), 1)
+	trader.SetMode(ModeHalted)
+	heldToken()
+	trader.FlattenAll("test")
+	if got := len(trader.sellChannel); got != 1 {
+		t.Errorf("%d sells queued by a halted flatten, want 1", got)
+	}
+}
@@ -0,0 +1,124 @@
+package strategies
+
+import (
+	"b46/b46/_sys_init"
+	"b46/b46/logging"
+	"b46/b46/models"
+	"b46/b46/risk"
+	"log"
+)
+
+// SessionConfig is what a session runs with. It is written to the session manifest so
+// that sessions run under different rules or constants can be compared.
+type SessionConfig struct {
+	Strategies []StrategyConfig
+	Limits     risk.Limits
+	Settings   Settings
+}
+
+// StrategyConfig is one running strategy with its allocation and, when it has any, its
+// tunable parameters.
+type StrategyConfig struct {
+	Name       string
+	Allocation risk.Allocation
+	Parameters any `json:",omitempty"`
+}
+
+// Settings are the models constants shared by every strategy, and whether the orders
+// were sent on chain or paper traded.
+type Settings struct {
+	Live                bool
+	MonitorInterval     int // seconds
+	TradingInterval     int // seconds
+	Slippage            float64
+	PriorityFeeLamports int
+	MaxPriceDrift       float64
+	MaxOrderRetries     int
+	OrderTimeout        int // seconds
+	MinWalletBalanceSOL float64
+	MinReserveRatio     float64
+	TokenStability      float64
+}
+
+// Config returns the configuration the engine runs with.
+func (engine *Engine) Config() SessionConfig {
+	config := SessionConfig{
+		Limits: risk.DefaultLimits(),
+		Settings: Settings{
+			Live:                engine.Executor != nil && engine.Executor.Live,
+			MonitorInterval:     models.MONITOR_DURATION,
+			TradingInterval:     models.MONITOR_DURATION_TRADES,
+			Slippage:            models.Slippage,
+			PriorityFeeLamports: models.PriorityFeeLamport,
+			MaxPriceDrift:       models.MaxPriceDrift,
+			MaxOrderRetries:     models.MaxOrderRetries,
+			OrderTimeout:        models.OrderTimeout,
+			MinWalletBalanceSOL: models.MinWalletBalanceSOL,
+			MinReserveRatio:     models.MinReserveRatio,
+			TokenStability:      models.TokenStability,
+		},
+	}
+	for i, strategy := range engine.Strategies {
+		strategyConfig := StrategyConfig{Name: strategy.Name()}
+		if i < len(engine.Allocations) {
+			strategyConfig.Allocation = engine.Allocations[i]
+		}
+		if parameterized, ok := strategy.(Parameterized); ok {
+			strategyConfig.Parameters = parameterized.Parameters()
+		}
+		config.Strategies = append(config.Strategies, strategyConfig)
+	}
+	return config
+}
+
+// StartSession writes the manifest of the logging session: the configuration, the
+// revision and the wallet the session runs with.
+func (engine *Engine) StartSession() {
+	profile := "production"
+	if _sys_init.Env.DEVELOPMENT == "TRUE" {
+		profile = "development"
+	}
+	engine.Manifest = logging.NewManifest(profile, engine.Wallet.String(), engine.Config())
+	if err := logging.WriteManifest(engine.Manifest); err != nil {
+		logging.PrintErrorToLog("Error writing session manifest:		", err.Error())
+	}
+}
+
+// CloseSession completes the session manifest with the outcome of the session and
+// finishes the stream capture.
+func (engine *Engine) CloseSession() {
+	metrics := engine.Trader.Metrics()
+	totals := engine.Trader.Portfolio.Totals()
+	end := models.Now()
+
+	engine.Manifest.EndTime = &end
+	engine.Manifest.Summary = &logging.Summary{
+		TokensSeen:     engine.tokensSeen.Load(),
+		TokensPromoted: engine.tokensPromoted.Load(),
+		Orders:         metrics.ProcessedOrders,
+		Fills:          metrics.FilledOrders,
+		FailedOrders:   metrics.FailedOrders,
+		RejectedOrders: metrics.RejectedOrders,
+		OpenPositions:  totals.OpenPositions,
+		Invested:       totals.Invested,
+		Proceeds:       totals.Proceeds,
+		Fees:           totals.Fees,
+		RealizedPnL:    totals.RealizedPnL,
+		UnrealizedPnL:  totals.UnrealizedPnL,
+		PnL:            totals.PnL(),
+		Errors:         logging.ErrorCount(),
+	}
+	if err := logging.WriteManifest(engine.Manifest); err != nil {
+		logging.PrintErrorToLog("Error writing session manifest:		", err.Error())
+	}
+
+	if engine.Recorder != nil {
+		if err := engine.Recorder.Err(); err != nil {
+			logging.PrintErrorToLog("Stream capture stopped early:		", err.Error())
+		}
+		if err := engine.Recorder.Close(); err != nil {
+			logging.PrintErrorToLog("Error closing stream capture:		", err.Error())
+		}
+		log.Printf("Captured %d stream frame(s)\n", engine.Recorder.Frames())
+	}
+}
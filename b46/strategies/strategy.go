@@ -0,0 +1,208 @@
+package strategies
+
+import (
+	"b46/b46/models"
+	"b46/b46/risk"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Action is what a strategy wants done with a token.
+type Action int
+
+const (
+	ActionNone    Action = iota
+	ActionReject         // stop watching a token that will not be traded
+	ActionPromote        // move a watched token to the trades, it becomes a Candidate
+	ActionBuy            // open a position, a watched token is promoted first
+	ActionSell           // close a held position
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionNone:
+		return "NONE"
+	case ActionReject:
+		return "REJECT"
+	case ActionPromote:
+		return "PROMOTE"
+	case ActionBuy:
+		return "BUY"
+	case ActionSell:
+		return "SELL"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// Decision is returned by every Strategy callback. The zero Decision does nothing.
+type Decision struct {
+	Action Action
+	Reason string
+	Amount float64 // SOL to spend on a buy, the engine's default position when 0
+}
+
+// Actions carry out decisions: the engine on the live token maps and through the trader,
+// the backtester on a replayed session. ApplyDecision only calls them for decisions that
+// fit the token's state.
+type Actions interface {
+	// Reject stops watching a watched token.
+	Reject(token models.MemeToken, reason string)
+	// Promote makes strategy the owner of a watched token, which becomes a Candidate, and
+	// returns the promoted token. A token that could not be promoted is returned as is.
+	Promote(token models.MemeToken, strategy string, reason string) models.MemeToken
+	// Buy opens a position of amount SOL in a candidate.
+	Buy(token models.MemeToken, strategy string, amount float64, reason string)
+	// Sell closes the position held in token.
+	Sell(token models.MemeToken, strategy string, reason string)
+}
+
+// ApplyDecision carries out a decision of strategy on token. Decisions that do not fit the
+// token's current state, e.g. selling a token that is not held, are ignored. A buy of a
+// watched token promotes it first, and a buy without an amount spends models.PositionAmount.
+func ApplyDecision(actions Actions, token models.MemeToken, strategy string, decision Decision) {
+	switch decision.Action {
+	case ActionReject:
+		if token.State == models.StateWatching {
+			actions.Reject(token, decision.Reason)
+		}
+
+	case ActionPromote:
+		if token.State == models.StateWatching {
+			actions.Promote(token, strategy, decision.Reason)
+		}
+
+	case ActionBuy:
+		if token.State == models.StateWatching {
+			token = actions.Promote(token, strategy, decision.Reason)
+		}
+		if token.State != models.StateCandidate || len(token.Info) == 0 {
+			return
+		}
+		amount := decision.Amount
+		if amount <= 0 {
+			amount = models.PositionAmount
+		}
+		actions.Buy(token, strategy, amount, decision.Reason)
+
+	case ActionSell:
+		if token.State != models.StateHeld || len(token.Info) == 0 {
+			return
+		}
+		actions.Sell(token, strategy, decision.Reason)
+	}
+}
+
+// Strategy holds entry and exit rules. The engine calls it with what it observes and
+// carries out the returned decisions, so a strategy never talks to the chain itself.
+// Callbacks may be called from several goroutines.
+type Strategy interface {
+	Name() string
+	// OnTokenCreated is called once for every token announced by the listener.
+	OnTokenCreated(token models.MemeToken) Decision
+	// OnSnapshot is called whenever a new snapshot was appended to a watched or traded token.
+	OnSnapshot(token models.MemeToken) Decision
+	// OnTrade is called for every pump.fun buy or sell observed on a known token.
+	OnTrade(token models.MemeToken, trade models.PumpTrade) Decision
+	// OnFill is called once one of the strategy's orders has been filled.
+	OnFill(token models.MemeToken, fill models.Fill) Decision
+}
+
+// Parameterized is implemented by strategies with tunable rules. Parameters are written
+// to the session manifest, so sessions run with different rules can be told apart.
+type Parameterized interface {
+	Parameters() any
+}
+
+// Tunable is implemented by strategies whose parameters can be set by name, e.g. from
+// the STRATEGY setting or by a sweep.
+type Tunable interface {
+	Set(name string, value float64) error
+}
+
+// Instance is implemented by strategies that can run several times in one session. Each
+// instance is named after its allocation, which keys its budget, positions and PnL.
+type Instance interface {
+	SetName(name string)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]func() Strategy)
+)
+
+// RegisterStrategy makes a strategy available by name. It is meant to be called from init.
+func RegisterStrategy(name string, factory func() Strategy) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("strategy registered twice: " + name)
+	}
+	registry[name] = factory
+}
+
+// NewStrategy creates a new instance of the strategy registered under name.
+func NewStrategy(name string) (Strategy, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	factory, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown strategy %q, registered: %v", name, strategyNames())
+	}
+	return factory(), nil
+}
+
+// NewStrategies creates the strategy instance of every allocation, in order, e.g. of the
+// allocations parsed from the STRATEGY setting, and sets the allocation's parameters on it.
+func NewStrategies(allocations []risk.Allocation) ([]Strategy, error) {
+	strategies := make([]Strategy, 0, len(allocations))
+	for _, allocation := range allocations {
+		kind := allocation.StrategyKind()
+		strategy, err := NewStrategy(kind)
+		if err != nil {
+			return nil, err
+		}
+		if len(allocation.Parameters) > 0 {
+			tunable, ok := strategy.(Tunable)
+			if !ok {
+				return nil, fmt.Errorf("strategy %s has no parameters", kind)
+			}
+			names := make([]string, 0, len(allocation.Parameters))
+			for name := range allocation.Parameters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if err := tunable.Set(name, allocation.Parameters[name]); err != nil {
+					return nil, fmt.Errorf("strategy %s: %w", allocation.Strategy, err)
+				}
+			}
+		}
+		if allocation.Strategy != kind {
+			instance, ok := strategy.(Instance)
+			if !ok {
+				return nil, fmt.Errorf("strategy %s cannot run as %s", kind, allocation.Strategy)
+			}
+			instance.SetName(allocation.Strategy)
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+// StrategyNames lists the registered strategies.
+func StrategyNames() []string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	return strategyNames()
+}
+
+func strategyNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,153 @@
+package strategies
+
+import (
+	"b46/b46/models"
+	"b46/b46/risk"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// idle is a strategy that never acts.
+type idle struct{}
+
+func (idle) Name() string                                        { return "idle" }
+func (idle) OnTokenCreated(models.MemeToken) Decision            { return Decision{} }
+func (idle) OnSnapshot(models.MemeToken) Decision                { return Decision{} }
+func (idle) OnTrade(models.MemeToken, models.PumpTrade) Decision { return Decision{} }
+func (idle) OnFill(models.MemeToken, models.Fill) Decision       { return Decision{} }
+
+// registerIdle registers idle for the duration of the test.
+func registerIdle(t *testing.T) {
+	t.Helper()
+	RegisterStrategy("idle", func() Strategy { return idle{} })
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		defer registryMutex.Unlock()
+		delete(registry, "idle")
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	registerIdle(t)
+
+	if names := StrategyNames(); strings.Join(names, ",") != "idle,kamikaze" {
+		t.Errorf("registered %v, want [idle kamikaze]", names)
+	}
+	strategy, err := NewStrategy("idle")
+	if err != nil || strategy.Name() != "idle" {
+		t.Errorf("NewStrategy(idle) = %v, %v", strategy, err)
+	}
+
+	_, err = NewStrategy("unknown")
+	if err == nil || !strings.Contains(err.Error(), `"unknown"`) || !strings.Contains(err.Error(), "[idle kamikaze]") {
+		t.Errorf("NewStrategy(unknown) = %v, want the registered strategies listed", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering idle twice did not panic")
+		}
+	}()
+	RegisterStrategy("idle", func() Strategy { return idle{} })
+}
+
+func TestNewStrategies(t *testing.T) {
+	registerIdle(t)
+
+	tests := []struct {
+		spec  string
+		names []string
+		error string
+	}{
+		{spec: "kamikaze", names: []string{"kamikaze"}},
+		{spec: "idle:0.01:1,kamikaze:0.02:3", names: []string{"idle", "kamikaze"}},
+		{spec: "fast=kamikaze:0.01:1:EntryMarketCap=6000,slow=kamikaze", names: []string{"fast", "slow"}},
+		{spec: "kamikaze,unknown:0.01", error: `unknown strategy "unknown"`},
+		{spec: "fast=kamikaze:::Unknown=1", error: `unknown kamikaze parameter "Unknown"`},
+		{spec: "idle:::EntryMarketCap=6000", error: "strategy idle has no parameters"},
+		{spec: "other=idle", error: "strategy idle cannot run as other"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			allocations, err := risk.ParseAllocations(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			strategies, err := NewStrategies(allocations)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Errorf("NewStrategies() = %v, want %q", err, test.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, strategy := range strategies {
+				names = append(names, strategy.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(test.names, ",") {
+				t.Errorf("built %v, want %v", names, test.names)
+			}
+		})
+	}
+}
+
+// recordingActions records the actions it is asked for. Promote promotes unless refuse is set.
+type recordingActions struct {
+	calls  []string
+	refuse bool
+}
+
+func (a *recordingActions) Reject(token models.MemeToken, reason string) {
+	a.calls = append(a.calls, "reject")
+}
+
+func (a *recordingActions) Promote(token models.MemeToken, strategy string, reason string) models.MemeToken {
+	a.calls = append(a.calls, "promote "+strategy)
+	if !a.refuse {
+		token.State = models.StateCandidate
+	}
+	return token
+}
+
+func (a *recordingActions) Buy(token models.MemeToken, strategy string, amount float64, reason string) {
+	a.calls = append(a.calls, fmt.Sprintf("buy %s %g", strategy, amount))
+}
+
+func (a *recordingActions) Sell(token models.MemeToken, strategy string, reason string) {
+	a.calls = append(a.calls, "sell "+strategy)
+}
+
+func TestApplyDecision(t *testing.T) {
+	tests := []struct {
+		state    models.TokenState
+		decision Decision
+		refuse   bool
+		want     string
+	}{
+		{state: models.StateWatching, decision: Decision{Action: ActionReject}, want: "reject"},
+		{state: models.StateCandidate, decision: Decision{Action: ActionReject}},
+		{state: models.StateWatching, decision: Decision{Action: ActionPromote}, want: "promote fast"},
+		{state: models.StateHeld, decision: Decision{Action: ActionPromote}},
+		{state: models.StateWatching, decision: Decision{Action: ActionBuy, Amount: 0.01}, want: "promote fast,buy fast 0.01"},
+		{state: models.StateWatching, decision: Decision{Action: ActionBuy}, refuse: true, want: "promote fast"},
+		{state: models.StateCandidate, decision: Decision{Action: ActionBuy}, want: fmt.Sprintf("buy fast %g", models.PositionAmount)},
+		{state: models.StateEntering, decision: Decision{Action: ActionBuy}},
+		{state: models.StateHeld, decision: Decision{Action: ActionSell}, want: "sell fast"},
+		{state: models.StateCandidate, decision: Decision{Action: ActionSell}},
+		{state: models.StateHeld, decision: Decision{}},
+	}
+	for _, test := range tests {
+		t.Run(test.state.String()+" "+test.decision.Action.String(), func(t *testing.T) {
+			actions := &recordingActions{refuse: test.refuse}
+			token := models.MemeToken{State: test.state, Info: []models.MemeInfo{{TokenPrice: 1e-6}}}
+			ApplyDecision(actions, token, "fast", test.decision)
+			if got := strings.Join(actions.calls, ","); got != test.want {
+				t.Errorf("actions %q, want %q", got, test.want)
+			}
+		})
+	}
+}
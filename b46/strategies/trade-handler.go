@@ -2,13 +2,21 @@ package strategies
 
 import (
 	"b46/b46/_sys_init"
-	"b46/b46/helpers"
+	"b46/b46/events"
 	"b46/b46/logging"
 	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/risk"
+	"b46/b46/sol"
 	"context"
+	"fmt"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
 	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // OrderType enumerates the possible order actions.
@@ -19,6 +27,17 @@ const (
 	OrderTypeBuy  OrderType = iota
 )
 
+func (o OrderType) String() string {
+	switch o {
+	case OrderTypeSell:
+		return "SELL"
+	case OrderTypeBuy:
+		return "BUY"
+	default:
+		return fmt.Sprintf("OrderType(%d)", int(o))
+	}
+}
+
 type OrderResponse struct {
 	Success bool
 	Error   string
@@ -30,36 +49,118 @@ type OrderRequest struct {
 	OrderType  OrderType
 	Reason     string
 	ResultChan chan OrderResponse
+
+	// Amount is the SOL spent by a buy, it may be downsized by the risk manager.
+	Amount float64
+
+	// PriceLimit is the worst token price the order accepts when it has to be requoted:
+	// the maximum for buys, the minimum for sells. 0 disables the check.
+	PriceLimit float64
+
+	// Attempt counts how many times this order has already failed and been retried.
+	Attempt int
+
+	// Strategy is the strategy that placed the order, the token's owner when empty.
+	Strategy string
 }
 
 // Executor is an interface that the order handler can call to execute a particular order.
 // This decouples the handler's concurrency logic from the actual trading implementation.
+// The context carries the per-order timeout and priceLimit the order's PriceLimit.
+// Both calls return the fill measured from the confirmed transaction.
 type Executor interface {
-	ExecuteSellOrder(rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken) error
-	ExecuteBuyOrder(rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken) error
+	ExecuteSellOrder(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken, priceLimit float64) (models.Fill, error)
+	ExecuteBuyOrder(ctx context.Context, rpcClient *rpc.Client, wsClient *ws.Client, token models.MemeToken, amount float64, priceLimit float64) (models.Fill, error)
 	// Add more methods if you have other order types.
 }
 
 // Handler is responsible for concurrently processing all incoming orders.
 type Trader struct {
 
-	// Buffered channel for inbound orders.
-	orderChannel chan OrderRequest
-	executor     Executor
-	RpcClient    *rpc.Client
-	WssClient    *ws.Client
+	// Buffered lanes for inbound orders, sells are always drained first.
+	sellChannel chan OrderRequest
+	buyChannel  chan OrderRequest
+	workers     int
+	executor    Executor
+	RpcClient   *rpc.Client
+	WssClient   *ws.Client
+
+	// Risk gates every buy before it is queued, nil disables the checks.
+	Risk *risk.Manager
+
+	// Allocator charges every buy to its strategy's budget, nil disables the allocation.
+	Allocator *risk.Allocator
+
+	// Balance reserves the wallet funds of every queued buy, nil disables the preflight.
+	Balance *sol.BalanceService
+
+	// Portfolio books every fill into positions and PnL.
+	Portfolio *portfolio.Portfolio
+
+	// Bus receives an OrderFilled event for every confirmed order, nil disables it.
+	Bus *events.Bus
+
+	// mode is the TradingMode set by the kill switch.
+	mode atomic.Int32
+
+	// ctx is the context Start runs under, retries scheduled after it is done are dropped.
+	ctx context.Context
+
+	// orderTimeout bounds the execution of a single order.
+	orderTimeout time.Duration
+
+	activeWorkers   atomic.Int64
+	processedOrders atomic.Uint64
+	filledOrders    atomic.Uint64
+	failedOrders    atomic.Uint64
+	rejectedOrders  atomic.Uint64
+
+	// In-flight guard: at most one order per mint and side is accepted
+	// until the previous one has been handled.
+	inFlightMutex   sync.Mutex
+	inFlight        map[string]OrderRequest
+	duplicateOrders atomic.Uint64
+}
+
+// TraderMetrics is a point in time view of the order pipeline.
+type TraderMetrics struct {
+	SellQueueDepth  int
+	BuyQueueDepth   int
+	ActiveWorkers   int64
+	ProcessedOrders uint64
+	FilledOrders    uint64
+	FailedOrders    uint64
+	RejectedOrders  uint64
+	DuplicateOrders uint64
+}
+
+func (m TraderMetrics) String() string {
+	return fmt.Sprintf(
+		"TraderMetrics{SellQueue: %d, BuyQueue: %d, ActiveWorkers: %d, Processed: %d, Filled: %d, Failed: %d, Rejected: %d, Duplicates: %d}",
+		m.SellQueueDepth, m.BuyQueueDepth, m.ActiveWorkers, m.ProcessedOrders, m.FilledOrders, m.FailedOrders, m.RejectedOrders, m.DuplicateOrders,
+	)
 }
 
 // NewHandler instantiates a new order handler with a given executor.
-// bufferSize is the size of the channel buffer for incoming orders.
-func NewTradeHandler(executor Executor, bufferSize int) *Trader {
+// bufferSize is the size of each lane's channel buffer and workers the number
+// of orders that may be executed at the same time.
+func NewTradeHandler(executor Executor, bufferSize int, workers int) *Trader {
+	if workers < 1 {
+		workers = 1
+	}
 	wssClient, errorWss := ws.Connect(context.Background(), _sys_init.Env.WSS)
 	if errorWss != nil {
 		logging.PrintErrorToLog("Failed to initialize wss client:		", errorWss.Error())
 	}
 	return &Trader{
-		orderChannel: make(chan OrderRequest, bufferSize),
+		sellChannel:  make(chan OrderRequest, bufferSize),
+		buyChannel:   make(chan OrderRequest, bufferSize),
+		workers:      workers,
 		executor:     executor,
+		orderTimeout: models.OrderTimeout * time.Second,
+		ctx:          context.Background(),
+		inFlight:     make(map[string]OrderRequest),
+		Portfolio:    portfolio.New(),
 		RpcClient:    rpc.New(_sys_init.Env.RPC),
 		WssClient:    wssClient,
 	}
@@ -76,62 +177,454 @@ func (t *Trader) Start(ctx context.Context) {
 		}
 	}()
 
+	t.ctx = ctx
+	var wg sync.WaitGroup
+	for i := 0; i < t.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.worker(ctx)
+		}()
+	}
+	wg.Wait()
+	log.Println("OrderHandler: context canceled, shutting down.")
+}
+
+// worker executes orders one at a time, always taking pending sells before buys.
+func (t *Trader) worker(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("OrderHandler: context canceled, shutting down.")
 			return
-		case orderReq := <-t.orderChannel:
-			// Process each order concurrently.
-			go t.handleOrder(orderReq)
+		case orderReq := <-t.sellChannel:
+			t.runOrder(ctx, orderReq)
+			continue
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case orderReq := <-t.sellChannel:
+			t.runOrder(ctx, orderReq)
+		case orderReq := <-t.buyChannel:
+			t.runOrder(ctx, orderReq)
 		}
 	}
 }
 
-func (t *Trader) handleOrder(orderReq OrderRequest) {
-	//account := sol.GetAccountInfo(t.RpcClient)
-	tokenHistoryLength := len(orderReq.Token.Info)
-	finalMarketCap := orderReq.Token.Info[tokenHistoryLength-1].MarketCap
-	finalPrice := orderReq.Token.Info[tokenHistoryLength-1].TokenPrice
+func (t *Trader) runOrder(ctx context.Context, orderReq OrderRequest) {
+	t.activeWorkers.Add(1)
+	defer t.activeWorkers.Add(-1)
+
+	orderCtx, cancel := context.WithTimeout(ctx, t.orderTimeout)
+	defer cancel()
+	t.handleOrder(orderCtx, orderReq)
+	t.processedOrders.Add(1)
+}
+
+func (t *Trader) handleOrder(ctx context.Context, orderReq OrderRequest) {
+	var fill models.Fill
+	var err error
 	switch orderReq.OrderType {
 	case OrderTypeSell:
+		fill, err = t.executor.ExecuteSellOrder(ctx, t.RpcClient, t.WssClient, orderReq.Token, orderReq.PriceLimit)
+	case OrderTypeBuy:
+		fill, err = t.executor.ExecuteBuyOrder(ctx, t.RpcClient, t.WssClient, orderReq.Token, orderReq.Amount, orderReq.PriceLimit)
+	default:
+		log.Printf("Unknown OrderType=%d\n", orderReq.OrderType)
+		t.finishOrder(orderReq, OrderResponse{Success: false, Error: "unknown order type"})
+		return
+	}
+
+	if err != nil {
+		t.rollbackOrder(orderReq, err)
+		return
+	}
+	t.confirmOrder(orderReq, fill)
+}
 
-		//models.TradesMap.DeleteToken(orderReq.Token.Mint.String())
+// confirmOrder moves the token to Held or Closed only once the executor has reported
+// the transaction as confirmed on chain, and books the fill into the portfolio.
+func (t *Trader) confirmOrder(orderReq OrderRequest, fill models.Fill) {
+	mint := orderReq.Token.Mint.String()
+	tokenHistoryLength := len(orderReq.Token.Info)
+	var finalMarketCap, finalPrice float64
+	if tokenHistoryLength > 0 {
+		finalMarketCap = orderReq.Token.Info[tokenHistoryLength-1].MarketCap
+		finalPrice = orderReq.Token.Info[tokenHistoryLength-1].TokenPrice
+	}
+
+	t.transition(orderReq.Token, orderDoneState(orderReq.OrderType), orderReq.OrderType.String()+" confirmed")
+
+	if fill.Price > 0 {
+		finalPrice = fill.Price
+	}
+	fill.Strategy = orderReq.Strategy
+	position := t.Portfolio.ApplyFill(orderReq.Token, fill)
+	t.filledOrders.Add(1)
+	log.Printf("%s filled: %s %s\n", orderReq.OrderType, fill, position)
+	t.Bus.Publish(events.OrderFilledEvent{Token: orderReq.Token, Fill: fill, Reason: orderReq.Reason})
 
-		orderReq.Token.Sold = true
-		models.TradesMap.SetToken(orderReq.Token)
-		if err := logging.PrintToLog("trades.log", []string{
-			"SELL", orderReq.Token.Mint.String(), orderReq.Token.Name, orderReq.Token.Symbol, helpers.ConvertFloatToString(finalMarketCap), helpers.ConvertFloatToString(finalPrice), orderReq.Reason,
-		}); err != nil {
-			logging.PrintErrorToLog("logger write error:", err.Error())
+	if t.Risk != nil {
+		switch orderReq.OrderType {
+		case OrderTypeBuy:
+			t.Risk.ConfirmBuy(mint, finalPrice)
+		case OrderTypeSell:
+			t.Risk.ConfirmSell(mint, position.RealizedPnL)
+			log.Printf("Position closed: token=%s pnl=%.6f SOL %s\n", mint, position.RealizedPnL, t.Risk)
 		}
-		err := t.executor.ExecuteSellOrder(t.RpcClient, t.WssClient, orderReq.Token)
-		if err != nil {
-			log.Printf("Sell order failed: token=%s err=%v\n", orderReq.Token.Mint.String(), err)
-		} else {
-			log.Printf("Sell order executed for token=%s reason=%s\n", orderReq.Token.Mint.String(), orderReq.Reason)
+	}
+	if t.Allocator != nil {
+		switch orderReq.OrderType {
+		case OrderTypeBuy:
+			t.Allocator.ConfirmBuy(mint)
+		case OrderTypeSell:
+			t.Allocator.ConfirmSell(mint, position.RealizedPnL)
 		}
-	case OrderTypeBuy:
+	}
+
+	if err := logging.LogEvent("trades.log", mint, logging.FillPayload{
+		Side: orderReq.OrderType.String(), Name: orderReq.Token.Name, Symbol: orderReq.Token.Symbol, MarketCap: finalMarketCap, Price: finalPrice, Reason: orderReq.Reason, Strategy: orderReq.Strategy,
+	}); err != nil {
+		logging.PrintErrorToLog("logger write error:", err.Error())
+	}
+	log.Printf("%s order confirmed for token=%s reason=%s\n", orderReq.OrderType, mint, orderReq.Reason)
+
+	t.finishOrder(orderReq, OrderResponse{Success: true})
+}
 
-		orderReq.Token.Trading = true
-		models.TradesMap.SetToken(orderReq.Token)
-		if err := logging.PrintToLog("trades.log", []string{
-			"BUY", orderReq.Token.Mint.String(), orderReq.Token.Name, orderReq.Token.Symbol, helpers.ConvertFloatToString(finalMarketCap), helpers.ConvertFloatToString(finalPrice), orderReq.Reason,
-		}); err != nil {
-			logging.PrintErrorToLog("logger write error:", err.Error())
+// WriteOff closes the position of a token that migrated while held: the portfolio books
+// its cost basis as a realized loss and the risk and allocation slots are released.
+func (t *Trader) WriteOff(token models.MemeToken, reason string) {
+	mint := token.Mint.String()
+	position, exists := t.Portfolio.WriteOff(mint, models.Now())
+	if !exists {
+		return
+	}
+	if t.Risk != nil {
+		t.Risk.ConfirmSell(mint, position.RealizedPnL)
+	}
+	if t.Allocator != nil {
+		t.Allocator.ConfirmSell(mint, position.RealizedPnL)
+	}
+	log.Printf("Position written off: token=%s reason=%s pnl=%.6f SOL %s\n", mint, reason, position.RealizedPnL, position)
+}
+
+// rollbackOrder moves the token back to the state it had before the order and
+// schedules a retry while the order still has attempts left.
+func (t *Trader) rollbackOrder(orderReq OrderRequest, orderErr error) {
+	mint := orderReq.Token.Mint.String()
+	t.transition(orderReq.Token, orderStartState(orderReq.OrderType), orderReq.OrderType.String()+" failed")
+	t.failedOrders.Add(1)
+
+	outcome := "FAILED"
+	if sol.ClassifyError(orderErr) == sol.ErrorClassPriceRanAway {
+		outcome = "PRICE RAN AWAY"
+	}
+	log.Printf("%s order failed: token=%s attempt=%d err=%v\n", orderReq.OrderType, mint, orderReq.Attempt+1, orderErr)
+	if err := logging.LogEvent("trades.log", mint, logging.OrderFailedPayload{
+		Outcome: outcome, Side: orderReq.OrderType.String(), Name: orderReq.Token.Name, Symbol: orderReq.Token.Symbol, Attempt: orderReq.Attempt + 1, Error: orderErr.Error(),
+	}); err != nil {
+		logging.PrintErrorToLog("logger write error:", err.Error())
+	}
+
+	if orderReq.Attempt+1 >= models.MaxOrderRetries || sol.IsFatalError(orderErr) {
+		t.finishOrder(orderReq, OrderResponse{Success: false, Error: orderErr.Error()})
+		return
+	}
+
+	retry := orderReq
+	retry.Attempt++
+	backoff := time.Duration(models.OrderRetryBackoff<<orderReq.Attempt) * time.Second
+	models.AfterFunc(backoff, func() {
+		t.retryOrder(retry)
+	})
+}
+
+// retryOrder re-queues a failed order with fresh token data. The in-flight slot
+// is still held by the original order, so it is pushed straight to the channel. The
+// order fails when the lane is full or the workers have stopped.
+func (t *Trader) retryOrder(orderReq OrderRequest) {
+	if latest, exists := models.TradesMap.Get(orderReq.Token.Mint.String()); exists {
+		orderReq.Token = latest
+	}
+	if orderReq.Token.State != orderStartState(orderReq.OrderType) {
+		log.Printf("Dropping %s retry: token=%s is %s\n", orderReq.OrderType, orderReq.Token.Mint.String(), orderReq.Token.State)
+		t.finishOrder(orderReq, OrderResponse{Success: orderReq.Token.State == orderDoneState(orderReq.OrderType), Error: "token is " + orderReq.Token.State.String()})
+		return
+	}
+	if !t.transition(orderReq.Token, orderPendingState(orderReq.OrderType), "retry "+strconv.Itoa(orderReq.Attempt+1)) {
+		t.finishOrder(orderReq, OrderResponse{Success: false, Error: "retry transition rejected"})
+		return
+	}
+	log.Printf("Retrying %s order: token=%s attempt=%d\n", orderReq.OrderType, orderReq.Token.Mint.String(), orderReq.Attempt+1)
+
+	reason := "trader stopped"
+	if t.ctx.Err() == nil {
+		select {
+		case t.lane(orderReq.OrderType) <- orderReq:
+			return
+		default:
+			reason = "queue full"
 		}
-		err := t.executor.ExecuteBuyOrder(t.RpcClient, t.WssClient, orderReq.Token)
+	}
+	t.transition(orderReq.Token, orderStartState(orderReq.OrderType), reason)
+	t.failedOrders.Add(1)
+	log.Printf("Dropping %s retry: token=%s %s\n", orderReq.OrderType, orderReq.Token.Mint.String(), reason)
+	t.finishOrder(orderReq, OrderResponse{Success: false, Error: reason})
+}
+
+// finishOrder releases the in-flight slot and reports the final outcome.
+func (t *Trader) finishOrder(orderReq OrderRequest, response OrderResponse) {
+	t.releaseInFlight(orderReq)
+	if !response.Success && orderReq.OrderType == OrderTypeBuy && t.Risk != nil {
+		t.Risk.CancelBuy(orderReq.Token.Mint.String())
+	}
+	if !response.Success && orderReq.OrderType == OrderTypeBuy && t.Allocator != nil {
+		t.Allocator.CancelBuy(orderReq.Token.Mint.String())
+	}
+	// Once the buy has settled the spent lamports show up in the wallet balance itself.
+	if orderReq.OrderType == OrderTypeBuy && t.Balance != nil {
+		t.Balance.Release(orderReq.Token.Mint.String())
+	}
+	if orderReq.ResultChan != nil {
+		select {
+		case orderReq.ResultChan <- response:
+		default:
+		}
+	}
+}
+
+// SubmitOrder is used by external code to send new orders into the handler.
+// Orders for a mint that already has an in-flight order on the same side are
+// rejected and counted as duplicates. Buys must then fit their strategy's allocation
+// and pass the risk manager, both of which may reject them or reduce their amount,
+// and the wallet balance preflight.
+func (t *Trader) SubmitOrder(req OrderRequest) error {
+	return t.submit(req, false)
+}
+
+// submit queues an order. Forced orders bypass the trading mode, they are used to
+// flatten positions while the kill switch is engaged.
+func (t *Trader) submit(req OrderRequest, force bool) error {
+	if !force {
+		if mode := t.Mode(); mode == ModeHalted || (mode == ModeExitsOnly && req.OrderType == OrderTypeBuy) {
+			t.rejectedOrders.Add(1)
+			err := fmt.Errorf("trading mode is %s", mode)
+			t.logRejection("MODE REJECT", req, err)
+			return err
+		}
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = req.Token.Strategy
+	}
+
+	if err := t.acquireInFlight(req); err != nil {
+		t.duplicateOrders.Add(1)
+		t.logRejection("REJECT", req, err)
+		return err
+	}
+
+	if req.OrderType == OrderTypeBuy && t.Allocator != nil {
+		approved, err := t.Allocator.ApproveBuy(req.Strategy, req.Token.Mint.String(), req.Amount)
 		if err != nil {
-			log.Printf("Buy order failed: token=%s err=%v\n", orderReq.Token.Mint.String(), err)
-		} else {
-			log.Printf("Buy order executed for token=%s reason=%s\n", orderReq.Token.Mint.String(), orderReq.Reason)
+			t.releaseInFlight(req)
+			t.rejectedOrders.Add(1)
+			t.logRejection("ALLOCATION REJECT", req, err)
+			return err
+		}
+		if approved < req.Amount {
+			t.logRejection("ALLOCATION DOWNSIZE", req, fmt.Errorf("amount reduced from %.4f to %.4f SOL", req.Amount, approved))
+			req.Amount = approved
 		}
+	}
+
+	if req.OrderType == OrderTypeBuy && t.Risk != nil {
+		approved, err := t.Risk.ApproveBuy(req.Token.Mint.String(), req.Token.User, req.Amount)
+		if err != nil {
+			t.releaseInFlight(req)
+			t.cancelBuy(req)
+			t.rejectedOrders.Add(1)
+			t.logRejection("RISK REJECT", req, err)
+			return err
+		}
+		if approved < req.Amount {
+			t.logRejection("RISK DOWNSIZE", req, fmt.Errorf("amount reduced from %.4f to %.4f SOL", req.Amount, approved))
+			req.Amount = approved
+		}
+	}
+
+	if req.OrderType == OrderTypeBuy && t.Balance != nil {
+		if err := t.Balance.Reserve(req.Token.Mint.String(), sol.BuyCostLamports(req.Amount)); err != nil {
+			t.releaseInFlight(req)
+			t.cancelBuy(req)
+			t.rejectedOrders.Add(1)
+			t.logRejection("BALANCE REJECT", req, err)
+			return err
+		}
+	}
+
+	// The token must be in the state the order starts from, e.g. a buy needs a Candidate.
+	transition, err := models.TradesMap.Transition(req.Token.Mint.String(), orderPendingState(req.OrderType), req.Reason)
+	if err != nil {
+		t.releaseInFlight(req)
+		if req.OrderType == OrderTypeBuy {
+			t.cancelBuy(req)
+		}
+		t.rejectedOrders.Add(1)
+		t.logRejection("STATE REJECT", req, err)
+		return err
+	}
+	logging.PrintTransitionToLog(req.Token, transition)
+
+	select {
+	case t.lane(req.OrderType) <- req:
+		return nil
 	default:
-		log.Printf("Unknown OrderType=%d\n", orderReq.OrderType)
+		t.transition(req.Token, orderStartState(req.OrderType), "queue full")
+		t.releaseInFlight(req)
+		if req.OrderType == OrderTypeBuy {
+			t.cancelBuy(req)
+		}
+		t.rejectedOrders.Add(1)
+		err := fmt.Errorf("%s queue full, order for %s dropped", req.OrderType, req.Token.Mint.String())
+		log.Println(err)
+		return err
 	}
 }
 
-// SubmitOrder is used by external code to send new orders into the handler.
-func (t *Trader) SubmitOrder(req OrderRequest) {
-	t.orderChannel <- req
+// SetMode changes which orders the trader accepts, see KillSwitch.
+func (t *Trader) SetMode(mode TradingMode) {
+	t.mode.Store(int32(mode))
+}
+
+// Mode returns the current trading mode.
+func (t *Trader) Mode() TradingMode {
+	return TradingMode(t.mode.Load())
+}
+
+// FlattenAll submits a sell for every held position, regardless of the trading mode.
+func (t *Trader) FlattenAll(reason string) {
+	for _, token := range models.TradesMap.GetTokens() {
+		if token.State != models.StateHeld {
+			continue
+		}
+		log.Println("FLATTEN			:", token.Mint.String())
+		_ = t.submit(OrderRequest{
+			Token:     token,
+			OrderType: OrderTypeSell,
+			Reason:    "Flatten all: " + reason,
+		}, true)
+	}
+}
+
+func (t *Trader) logRejection(outcome string, req OrderRequest, reason error) {
+	log.Printf("Order %s: token=%s side=%s strategy=%s reason=%v\n", outcome, req.Token.Mint.String(), req.OrderType, req.Strategy, reason)
+	if err := logging.LogEvent("trades.log", req.Token.Mint.String(), logging.RejectionPayload{
+		Outcome: outcome, Side: req.OrderType.String(), Name: req.Token.Name, Symbol: req.Token.Symbol, Reason: reason.Error(), Strategy: req.Strategy,
+	}); err != nil {
+		logging.PrintErrorToLog("logger write error:", err.Error())
+	}
+}
+
+// cancelBuy releases what the allocator, the risk manager and the balance preflight
+// reserved for a buy that will not be queued.
+func (t *Trader) cancelBuy(req OrderRequest) {
+	mint := req.Token.Mint.String()
+	if t.Allocator != nil {
+		t.Allocator.CancelBuy(mint)
+	}
+	if t.Risk != nil {
+		t.Risk.CancelBuy(mint)
+	}
+	if t.Balance != nil {
+		t.Balance.Release(mint)
+	}
+}
+
+// transition moves a traded token to next and writes the change to lifecycle.log.
+// It reports false when the transition is not allowed.
+func (t *Trader) transition(token models.MemeToken, next models.TokenState, reason string) bool {
+	transition, err := models.TradesMap.Transition(token.Mint.String(), next, reason)
+	if err != nil {
+		logging.PrintErrorToLog("Lifecycle error:		", err.Error())
+		return false
+	}
+	logging.PrintTransitionToLog(token, transition)
+	return true
+}
+
+// orderStartState is the state a token must be in for an order of the given side.
+func orderStartState(orderType OrderType) models.TokenState {
+	if orderType == OrderTypeSell {
+		return models.StateHeld
+	}
+	return models.StateCandidate
+}
+
+// orderPendingState is the state of a token while its order is in flight.
+func orderPendingState(orderType OrderType) models.TokenState {
+	if orderType == OrderTypeSell {
+		return models.StateExiting
+	}
+	return models.StateEntering
+}
+
+// orderDoneState is the state of a token once its order is confirmed.
+func orderDoneState(orderType OrderType) models.TokenState {
+	if orderType == OrderTypeSell {
+		return models.StateClosed
+	}
+	return models.StateHeld
+}
+
+// lane returns the queue an order of the given side is placed on.
+func (t *Trader) lane(orderType OrderType) chan OrderRequest {
+	if orderType == OrderTypeSell {
+		return t.sellChannel
+	}
+	return t.buyChannel
+}
+
+// Metrics reports queue depths and order counters.
+func (t *Trader) Metrics() TraderMetrics {
+	return TraderMetrics{
+		SellQueueDepth:  len(t.sellChannel),
+		BuyQueueDepth:   len(t.buyChannel),
+		ActiveWorkers:   t.activeWorkers.Load(),
+		ProcessedOrders: t.processedOrders.Load(),
+		FilledOrders:    t.filledOrders.Load(),
+		FailedOrders:    t.failedOrders.Load(),
+		RejectedOrders:  t.rejectedOrders.Load(),
+		DuplicateOrders: t.duplicateOrders.Load(),
+	}
+}
+
+// DuplicateOrders returns how many orders have been rejected by the in-flight guard.
+func (t *Trader) DuplicateOrders() uint64 {
+	return t.duplicateOrders.Load()
+}
+
+// orderKey identifies an order by mint and side.
+func orderKey(req OrderRequest) string {
+	return req.Token.Mint.String() + ":" + req.OrderType.String()
+}
+
+func (t *Trader) acquireInFlight(req OrderRequest) error {
+	key := orderKey(req)
+	t.inFlightMutex.Lock()
+	defer t.inFlightMutex.Unlock()
+	if pending, exists := t.inFlight[key]; exists {
+		return fmt.Errorf("duplicate %s order for %s: already in flight (%s)", req.OrderType, req.Token.Mint.String(), pending.Reason)
+	}
+	t.inFlight[key] = req
+	return nil
+}
+
+func (t *Trader) releaseInFlight(req OrderRequest) {
+	t.inFlightMutex.Lock()
+	defer t.inFlightMutex.Unlock()
+	delete(t.inFlight, orderKey(req))
 }
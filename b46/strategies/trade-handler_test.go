@@ -0,0 +1,358 @@
+package strategies
+
+import (
+	"b46/b46/models"
+	"b46/b46/portfolio"
+	"b46/b46/risk"
+	"b46/b46/sol"
+	"b46/b46/sol/fakenode"
+	"context"
+	"errors"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTrader returns a trader without executor, risk manager or allocator whose
+// lanes hold buffer orders each. Logs are written to a temporary session.
+func newTestTrader(t *testing.T, ctx context.Context, buffer int) *Trader {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	models.InitializePumpMemes()
+	return &Trader{
+		sellChannel:  make(chan OrderRequest, buffer),
+		buyChannel:   make(chan OrderRequest, buffer),
+		workers:      1,
+		orderTimeout: models.OrderTimeout * time.Second,
+		ctx:          ctx,
+		inFlight:     make(map[string]OrderRequest),
+	}
+}
+
+// recordingExecutor reports every order it is given on executed and fails it once
+// release is closed or the order's context is done.
+type recordingExecutor struct {
+	executed chan OrderRequest
+	release  chan struct{}
+}
+
+func newRecordingExecutor(buffer int) *recordingExecutor {
+	return &recordingExecutor{executed: make(chan OrderRequest, buffer), release: make(chan struct{})}
+}
+
+func (e *recordingExecutor) execute(ctx context.Context, req OrderRequest) (models.Fill, error) {
+	e.executed <- req
+	select {
+	case <-e.release:
+		return models.Fill{}, &sol.PipelineError{Class: sol.ErrorClassInsufficientFunds, Attempts: 1, Err: errors.New("released")}
+	case <-ctx.Done():
+		return models.Fill{}, ctx.Err()
+	}
+}
+
+func (e *recordingExecutor) ExecuteSellOrder(ctx context.Context, _ *rpc.Client, _ *ws.Client, token models.MemeToken, _ float64) (models.Fill, error) {
+	return e.execute(ctx, OrderRequest{Token: token, OrderType: OrderTypeSell})
+}
+
+func (e *recordingExecutor) ExecuteBuyOrder(ctx context.Context, _ *rpc.Client, _ *ws.Client, token models.MemeToken, amount float64, _ float64) (models.Fill, error) {
+	return e.execute(ctx, OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: amount})
+}
+
+func TestRetryOrderFailsInsteadOfBlocking(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		buffer int
+		queued int
+		error  string
+	}{
+		{name: "queued", ctx: context.Background(), buffer: 1, queued: 1},
+		{name: "lane full", ctx: context.Background(), buffer: 0, error: "queue full"},
+		{name: "trader stopped", ctx: canceled, buffer: 1, error: "trader stopped"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trader := newTestTrader(t, test.ctx, test.buffer)
+			token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate}
+			models.TradesMap.SetToken(token)
+
+			results := make(chan OrderResponse, 1)
+			req := OrderRequest{Token: token, OrderType: OrderTypeBuy, Attempt: 1, ResultChan: results}
+			if err := trader.acquireInFlight(req); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				trader.retryOrder(req)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("retryOrder blocked")
+			}
+
+			if got := len(trader.buyChannel); got != test.queued {
+				t.Errorf("queued %d orders, want %d", got, test.queued)
+			}
+			stored, _ := models.TradesMap.Get(token.Mint.String())
+			if test.error == "" {
+				if stored.State != models.StateEntering {
+					t.Errorf("state %s, want %s", stored.State, models.StateEntering)
+				}
+				return
+			}
+			if stored.State != models.StateCandidate {
+				t.Errorf("state %s, want %s", stored.State, models.StateCandidate)
+			}
+			if err := trader.acquireInFlight(req); err != nil {
+				t.Errorf("in-flight slot still held: %v", err)
+			}
+			select {
+			case response := <-results:
+				if response.Success || response.Error != test.error {
+					t.Errorf("response %+v, want error %q", response, test.error)
+				}
+			default:
+				t.Error("no response")
+			}
+		})
+	}
+}
+
+func TestWriteOffReleasesPosition(t *testing.T) {
+	trader := newTestTrader(t, context.Background(), 1)
+	trader.Portfolio = portfolio.New()
+	trader.Risk = risk.NewManager(risk.Limits{MaxPositions: 1, MaxExposureSOL: 1, MaxCreatorExposureSOL: 1, DailyLossLimitSOL: 1, SessionBudgetSOL: 1})
+	trader.Allocator = risk.NewAllocator([]risk.Allocation{{Strategy: "test", BudgetSOL: 1, MaxPositions: 1}})
+
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateHeld}
+	mint := token.Mint.String()
+	if _, err := trader.Risk.ApproveBuy(mint, "", 0.1); err != nil {
+		t.Fatal(err)
+	}
+	trader.Risk.ConfirmBuy(mint, 1)
+	if _, err := trader.Allocator.ApproveBuy("test", mint, 0.1); err != nil {
+		t.Fatal(err)
+	}
+	trader.Allocator.ConfirmBuy(mint)
+	trader.Portfolio.ApplyFill(token, models.Fill{
+		Mint: token.Mint, Side: models.FillSideBuy, TokenAmount: 1_000_000, SolLamports: models.LamportsPerSOL / 10, Strategy: "test",
+	})
+
+	trader.WriteOff(token, "bonding curve complete")
+
+	position, _ := trader.Portfolio.Position(mint)
+	if position.Open() || position.CostBasis != 0 {
+		t.Errorf("position still open: %s", position)
+	}
+	if position.RealizedPnL > -0.099 || position.RealizedPnL < -0.101 {
+		t.Errorf("realized %.6f SOL, want the 0.1 SOL cost basis lost", position.RealizedPnL)
+	}
+	if totals := trader.Portfolio.Totals(); totals.OpenPositions != 0 || totals.Exposure != 0 {
+		t.Errorf("totals %s, want no open position", totals)
+	}
+	other := solana.NewWallet().PublicKey().String()
+	if _, err := trader.Risk.ApproveBuy(other, "", 0.1); err != nil {
+		t.Errorf("risk slot not released: %v", err)
+	}
+	if _, err := trader.Allocator.ApproveBuy("test", other, 0.1); err != nil {
+		t.Errorf("allocator slot not released: %v", err)
+	}
+
+	// A second write-off, e.g. for a token that was never bought, changes nothing.
+	trader.WriteOff(token, "bonding curve complete")
+	if again, _ := trader.Portfolio.Position(mint); again.RealizedPnL != position.RealizedPnL {
+		t.Errorf("written off twice: %.6f SOL", again.RealizedPnL)
+	}
+}
+
+func TestInFlightGuard(t *testing.T) {
+	tests := []struct {
+		name  string
+		done  func(trader *Trader, req OrderRequest)
+		state models.TokenState
+	}{
+		{
+			name: "rolled back",
+			done: func(trader *Trader, req OrderRequest) {
+				req.Attempt = models.MaxOrderRetries - 1
+				trader.rollbackOrder(req, errors.New("blockhash not found"))
+			},
+			state: models.StateCandidate,
+		},
+		{
+			name: "finished",
+			done: func(trader *Trader, req OrderRequest) {
+				trader.confirmOrder(req, models.Fill{Mint: req.Token.Mint, Side: models.FillSideBuy, TokenAmount: 1_000_000, SolLamports: models.LamportsPerSOL / 10})
+			},
+			state: models.StateHeld,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trader := newTestTrader(t, context.Background(), 2)
+			trader.Portfolio = portfolio.New()
+			token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate}
+			models.TradesMap.SetToken(token)
+
+			results := make(chan OrderResponse, 1)
+			if err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1, ResultChan: results}); err != nil {
+				t.Fatal(err)
+			}
+			if err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1}); err == nil || !strings.Contains(err.Error(), "already in flight") {
+				t.Fatalf("second order: %v, want it rejected as in flight", err)
+			}
+			if got := trader.DuplicateOrders(); got != 1 {
+				t.Errorf("%d duplicates, want 1", got)
+			}
+			if got := len(trader.buyChannel); got != 1 {
+				t.Fatalf("queued %d orders, want 1", got)
+			}
+
+			test.done(trader, <-trader.buyChannel)
+
+			if response := <-results; response.Success != (test.state == models.StateHeld) {
+				t.Errorf("response %+v", response)
+			}
+			if stored, _ := models.TradesMap.Get(token.Mint.String()); stored.State != test.state {
+				t.Errorf("state %s, want %s", stored.State, test.state)
+			}
+			if len(trader.inFlight) != 0 {
+				t.Errorf("in-flight slot still held: %v", trader.inFlight)
+			}
+			// The next order is judged on the token's state, no longer on the guard.
+			err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1})
+			if test.state == models.StateCandidate && err != nil {
+				t.Errorf("new order after rollback: %v", err)
+			}
+			if test.state == models.StateHeld && (err == nil || strings.Contains(err.Error(), "already in flight")) {
+				t.Errorf("new order after fill: %v, want a state rejection", err)
+			}
+			if got := trader.DuplicateOrders(); got != 1 {
+				t.Errorf("%d duplicates, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSellsJumpQueuedBuys(t *testing.T) {
+	const buffer = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trader := newTestTrader(t, ctx, buffer)
+	executor := newRecordingExecutor(buffer + 1)
+	trader.executor = executor
+
+	// Fill the buy lane before any worker runs, the next buy is turned away.
+	for i := 0; i <= buffer; i++ {
+		token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate}
+		models.TradesMap.SetToken(token)
+		err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1, Attempt: models.MaxOrderRetries - 1})
+		if i < buffer && err != nil {
+			t.Fatalf("buy %d: %v", i, err)
+		}
+		if i == buffer && (err == nil || !strings.Contains(err.Error(), "queue full")) {
+			t.Fatalf("buy into a full lane: %v, want queue full", err)
+		}
+	}
+	held := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateHeld}
+	models.TradesMap.SetToken(held)
+	if err := trader.SubmitOrder(OrderRequest{Token: held, OrderType: OrderTypeSell, Attempt: models.MaxOrderRetries - 1}); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := trader.Metrics(); metrics.BuyQueueDepth != buffer || metrics.SellQueueDepth != 1 {
+		t.Fatalf("metrics %s, want %d buys and a sell queued", metrics, buffer)
+	}
+
+	go trader.Start(ctx)
+	close(executor.release)
+	for i := 0; i <= buffer; i++ {
+		select {
+		case req := <-executor.executed:
+			want := OrderTypeBuy
+			if i == 0 {
+				want = OrderTypeSell
+			}
+			if req.OrderType != want {
+				t.Errorf("order %d is a %s, want a %s", i, req.OrderType, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("order %d not executed", i)
+		}
+	}
+}
+
+func TestOrderTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trader := newTestTrader(t, ctx, 1)
+	trader.orderTimeout = 50 * time.Millisecond
+	trader.executor = newRecordingExecutor(1)
+
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate}
+	models.TradesMap.SetToken(token)
+	results := make(chan OrderResponse, 1)
+	if err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1, Attempt: models.MaxOrderRetries - 1, ResultChan: results}); err != nil {
+		t.Fatal(err)
+	}
+	go trader.Start(ctx)
+
+	select {
+	case response := <-results:
+		if response.Success || response.Error != context.DeadlineExceeded.Error() {
+			t.Errorf("response %+v, want the order timed out", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("order never timed out")
+	}
+	if stored, _ := models.TradesMap.Get(token.Mint.String()); stored.State != models.StateCandidate {
+		t.Errorf("state %s, want %s", stored.State, models.StateCandidate)
+	}
+}
+
+func TestBalanceRejectRollsBack(t *testing.T) {
+	node, err := fakenode.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	wallet := solana.NewWallet().PublicKey()
+	node.Fund(wallet, models.LamportsPerSOL/20)
+
+	trader := newTestTrader(t, context.Background(), 1)
+	trader.Risk = risk.NewManager(risk.Limits{MaxPositions: 1, MaxExposureSOL: 1, MaxCreatorExposureSOL: 1, DailyLossLimitSOL: 1, SessionBudgetSOL: 1})
+	trader.Allocator = risk.NewAllocator([]risk.Allocation{{Strategy: "test", BudgetSOL: 1, MaxPositions: 1}})
+	trader.Balance = sol.NewBalanceService(rpc.New(node.URL()), nil, wallet, models.MinWalletBalanceSOL)
+	if err := trader.Balance.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	token := models.MemeToken{Mint: solana.NewWallet().PublicKey(), State: models.StateCandidate, Strategy: "test"}
+	models.TradesMap.SetToken(token)
+	err = trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.1})
+	if sol.ClassifyError(err) != sol.ErrorClassInsufficientFunds {
+		t.Fatalf("buy past the reserve: %v, want insufficient funds", err)
+	}
+
+	if stored, _ := models.TradesMap.Get(token.Mint.String()); stored.State != models.StateCandidate {
+		t.Errorf("state %s, want %s", stored.State, models.StateCandidate)
+	}
+	if len(trader.inFlight) != 0 || len(trader.buyChannel) != 0 {
+		t.Errorf("in flight %v, %d queued, want the order gone", trader.inFlight, len(trader.buyChannel))
+	}
+	if available := trader.Balance.Available(); available != models.LamportsPerSOL/20 {
+		t.Errorf("%d lamports available, want the whole wallet", available)
+	}
+	// The risk and allocation slots are free again, an affordable buy goes through.
+	if err := trader.SubmitOrder(OrderRequest{Token: token, OrderType: OrderTypeBuy, Amount: 0.01}); err != nil {
+		t.Errorf("affordable buy: %v", err)
+	}
+}
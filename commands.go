@@ -0,0 +1,339 @@
+package main
+
+import (
+	"b46/b46/backtest"
+	"b46/b46/events"
+	"b46/b46/models"
+	"b46/b46/sessions"
+	"b46/b46/sol"
+	"b46/b46/sol/fakenode"
+	"b46/b46/strategies"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gagliardetto/solana-go"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runCommand runs one of the offline subcommands and returns the process exit code.
+func runCommand(name string, args []string) int {
+	var err error
+	switch name {
+	case "backtest":
+		err = runBacktest(args)
+	case "sessions":
+		err = runSessions(args)
+	case "sweep":
+		err = runSweep(args)
+	case "replay":
+		err = runReplay(args)
+	case "fakenode":
+		err = runFakeNode(args)
+	default:
+		err = fmt.Errorf("unknown command %q, available: backtest, fakenode, replay, sessions, sweep", name)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runBacktest replays recorded sessions against a strategy:
+//
+//	b46 backtest [-strategy kamikaze] [-sessions examples/trade-sessions] [-trades] [session-dir ...]
+func runBacktest(args []string) error {
+	flags := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	strategyName := flags.String("strategy", models.DefaultStrategy, "strategy to backtest")
+	root := flags.String("sessions", filepath.Join("examples", "trade-sessions"), "directory holding the session-N directories")
+	showTrades := flags.Bool("trades", false, "print every trade")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	sessions, err := loadBacktestSessions(*root, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var trades, wins int
+	var pnl float64
+	for _, session := range sessions {
+		strategy, err := strategies.NewStrategy(*strategyName)
+		if err != nil {
+			return err
+		}
+		report := backtest.Run(session, strategy, backtest.DefaultOptions())
+		fmt.Println(report)
+		if *showTrades {
+			for _, trade := range report.Trades {
+				fmt.Println("  ", trade)
+			}
+		}
+		trades += len(report.Trades)
+		wins += report.Wins
+		pnl += report.Totals.PnL()
+	}
+
+	winRate := 0.0
+	if trades > 0 {
+		winRate = float64(wins) / float64(trades) * 100
+	}
+	fmt.Printf("Total{Sessions: %d, Trades: %d, Wins: %d, WinRate: %.1f%%, PnL: %.6f}\n", len(sessions), trades, wins, winRate, pnl)
+	return nil
+}
+
+// runSessions inspects recorded sessions:
+//
+//	b46 sessions compare [-sessions examples/trade-sessions] session ...
+//
+// Sessions are given as directories or as names under -sessions, the first one is the
+// baseline the others are compared against.
+func runSessions(args []string) error {
+	if len(args) == 0 || args[0] != "compare" {
+		return errors.New("usage: b46 sessions compare [-sessions dir] session session [session ...]")
+	}
+	flags := flag.NewFlagSet("sessions compare", flag.ContinueOnError)
+	root := flags.String("sessions", filepath.Join("examples", "trade-sessions"), "directory holding the session-N directories")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return errors.New("sessions compare needs at least two sessions")
+	}
+
+	var recorded []sessions.Recorded
+	for _, name := range flags.Args() {
+		dir := name
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			dir = filepath.Join(*root, name)
+		}
+		session, err := sessions.Load(dir)
+		if err != nil {
+			return err
+		}
+		recorded = append(recorded, session)
+	}
+	return sessions.Compare(recorded).Write(os.Stdout)
+}
+
+// defaultSweep is the grid swept when -params is not given.
+const defaultSweep = "EntryMarketCap=30:50:5,MinEntryHistory=1:4:1,MaxEntryHistory=10:30:10,ExitMarketCap=40:80:10,TokenStability=0.000005"
+
+// runSweep searches Kamikaze parameters over recorded sessions:
+//
+//	b46 sweep [-params name=min:max:step,...] [-random n] [-seed s] [-objective pnl] [-folds 3] [-workers n] [-top 10] [-sessions examples/trade-sessions] [session-dir ...]
+//
+// Without -random every combination of the parameter values is run.
+func runSweep(args []string) error {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	spec := flags.String("params", defaultSweep, "parameters to sweep, name=min:max:step separated by commas")
+	random := flags.Int("random", 0, "run this many random configurations instead of the whole grid")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed of the random search")
+	objective := flags.String("objective", "pnl", "objective to rank by: "+strings.Join(backtest.ObjectiveNames(), ", "))
+	folds := flags.Int("folds", 3, "walk-forward folds, 0 to only rank over every session")
+	workers := flags.Int("workers", 0, "backtests run at once, one per CPU when 0")
+	top := flags.Int("top", 10, "configurations to print")
+	root := flags.String("sessions", filepath.Join("examples", "trade-sessions"), "directory holding the session-N directories")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	parameters, err := backtest.ParseParameters(*spec)
+	if err != nil {
+		return err
+	}
+	sessions, err := loadBacktestSessions(*root, flags.Args())
+	if err != nil {
+		return err
+	}
+	base := strategies.DefaultKamikazeParams()
+	configs := backtest.Grid(base, parameters)
+	if *random > 0 {
+		configs = backtest.Random(base, parameters, *random, rand.New(rand.NewSource(*seed)))
+	}
+	fmt.Printf("Sweeping %d configurations over %d sessions, objective %s\n", len(configs), len(sessions), *objective)
+
+	options := backtest.SweepOptions{Options: backtest.DefaultOptions(), Objective: *objective, Folds: *folds, Workers: *workers}
+	result, err := backtest.Sweep(sessions, configs, options)
+	if err != nil {
+		return err
+	}
+	for i, candidate := range result.Ranking {
+		if i >= *top {
+			break
+		}
+		fmt.Printf("%3d. %s\n", i+1, candidate)
+	}
+	for i, fold := range result.Folds {
+		fmt.Printf("Fold %d: train %s, test %s\n", i+1, strings.Join(fold.Train, " "), strings.Join(fold.Test, " "))
+		fmt.Println("  best: ", fold.Best)
+		fmt.Printf("  test:  Score: %.6f, Trades: %d, Wins: %d, PnL: %.6f\n", fold.TestResult.Score, fold.TestResult.Trades, fold.TestResult.Wins, fold.TestResult.PnL)
+	}
+	if len(result.Folds) > 0 {
+		fmt.Printf("Out of sample{Score: %.6f, Trades: %d, Wins: %d, PnL: %.6f}\n", result.OutOfSample.Score, result.OutOfSample.Trades, result.OutOfSample.Wins, result.OutOfSample.PnL)
+	}
+	return nil
+}
+
+// runReplay feeds a stream capture back into the pump.fun listener and lists the tokens
+// it creates, on a simulated clock that follows the capture:
+//
+//	b46 replay [-speed 1] capture-file|session-dir
+//
+// A -speed of 10 replays ten times faster than recorded, 0 as fast as possible.
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 1, "replay speed relative to the recording, 0 for as fast as possible")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: b46 replay [-speed 1] capture-file|session-dir")
+	}
+	filename := flags.Arg(0)
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		filename = filepath.Join(filename, models.StreamCaptureFile)
+	}
+
+	start, err := sol.FirstFrameTime(filename)
+	if err != nil {
+		return err
+	}
+	clock := models.NewSimulatedClock(start)
+	models.SetClock(clock)
+	replay, err := sol.OpenStreamReplay(filename, *speed)
+	if err != nil {
+		return err
+	}
+	defer replay.Close()
+	replay.Clock = clock
+
+	bus := events.NewBus()
+	sub := bus.Subscribe("replay", events.SubscribeOptions{Buffer: 1024, Policy: events.Block, Types: []events.Type{events.TradeObserved}})
+	var buys, sells int
+	counted := make(chan struct{})
+	go func() {
+		for event := range sub.C() {
+			if event.(events.TradeObservedEvent).Trade.IsBuy {
+				buys++
+			} else {
+				sells++
+			}
+		}
+		close(counted)
+	}()
+
+	tokens := make(chan models.MemeToken)
+	go sol.PumpFunListener(replay, tokens, bus)
+	created := 0
+	for token := range tokens {
+		created++
+		fmt.Printf("%s  %s (%s)  %s\n", models.Now().Format(time.RFC3339), token.Name, token.Symbol, token.Mint)
+	}
+	bus.Unsubscribe(sub)
+	<-counted
+
+	fmt.Printf("Replay{Frames: %d, Duration: %s, Tokens: %d, Buys: %d, Sells: %d}\n", replay.Frames(), models.Now().Sub(start).Round(time.Second), created, buys, sells)
+	return nil
+}
+
+// runFakeNode serves a local fake Solana node the bot can be pointed at with RPC and WSS,
+// launching tokens and trading them with a few simulated traders:
+//
+//	b46 fakenode [-addr 127.0.0.1:8899] [-fund pubkey=sol,...] [-launch 30s] [-trades 2s] [-seed s]
+func runFakeNode(args []string) error {
+	flags := flag.NewFlagSet("fakenode", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:8899", "address to serve JSON-RPC and websocket subscriptions on")
+	fund := flags.String("fund", "", "accounts to fund, pubkey=sol separated by commas")
+	launchEvery := flags.Duration("launch", 30*time.Second, "launch a token this often, 0 to never")
+	tradeEvery := flags.Duration("trades", 2*time.Second, "trade a launched token this often, 0 to never")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed of the simulated traders")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	node, err := fakenode.Start(*addr)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+	for _, entry := range strings.Split(*fund, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, amount, found := strings.Cut(entry, "=")
+		account, errKey := solana.PublicKeyFromBase58(strings.TrimSpace(key))
+		amountSOL, errAmount := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if !found || errKey != nil || errAmount != nil {
+			return fmt.Errorf("invalid account to fund %q, expected pubkey=sol", entry)
+		}
+		node.Fund(account, uint64(amountSOL*models.LamportsPerSOL))
+	}
+	fmt.Printf("Fake node serving RPC=%s WSS=%s\n", node.URL(), node.WebsocketURL())
+
+	rng := rand.New(rand.NewSource(*seed))
+	traders := make([]solana.PublicKey, 5)
+	for i := range traders {
+		traders[i] = solana.NewWallet().PublicKey()
+		node.Fund(traders[i], 100*models.LamportsPerSOL)
+	}
+	tick := func(every time.Duration) <-chan time.Time {
+		if every <= 0 {
+			return nil
+		}
+		return time.Tick(every)
+	}
+	launches, trades := tick(*launchEvery), tick(*tradeEvery)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	for count := 1; ; {
+		select {
+		case <-quit:
+			return nil
+		case <-launches:
+			token := node.Launch(fmt.Sprintf("Fake %d", count), fmt.Sprintf("FAKE%d", count), "", traders[rng.Intn(len(traders))])
+			fmt.Println("Launched", token.Name, token.Mint)
+			count++
+		case <-trades:
+			mints := node.Mints()
+			if len(mints) == 0 {
+				continue
+			}
+			mint := mints[rng.Intn(len(mints))]
+			trader := traders[rng.Intn(len(traders))]
+			isBuy, amount := true, uint64((0.05+rng.Float64())*models.LamportsPerSOL)
+			if held := node.TokenBalance(trader, mint); held > 0 && rng.Intn(2) == 0 {
+				isBuy, amount = false, held/uint64(1+rng.Intn(3))
+			}
+			if trade, err := node.Trade(trader, mint, isBuy, amount); err == nil {
+				fmt.Printf("Traded %s buy=%t sol=%d tokens=%d\n", mint, trade.IsBuy, trade.SolAmount, trade.TokenAmount)
+			}
+		}
+	}
+}
+
+// loadBacktestSessions loads the given session directories, or every session under root
+// when none is given.
+func loadBacktestSessions(root string, dirs []string) ([]backtest.Session, error) {
+	if len(dirs) == 0 {
+		return backtest.LoadSessions(root)
+	}
+	var sessions []backtest.Session
+	for _, dir := range dirs {
+		session, err := backtest.LoadSession(dir)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}